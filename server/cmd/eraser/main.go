@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/service"
+	"github.com/fernandobarroso/profile-service/internal/blobstore/filesystem"
+	"github.com/fernandobarroso/profile-service/internal/cache"
+	"github.com/fernandobarroso/profile-service/internal/cache/redis"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/queue/rabbitmq"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/backends"
+	"go.uber.org/zap"
+)
+
+// The eraser carries out the data-subject erasures requested through
+// POST /api/v1/profiles/:id/erase. It consumes the erasures queue, resumes
+// erasures left pending every PURGE_INTERVAL, and runs in the worker pod with
+// the server's configuration: it needs the same database, blob store, Redis and
+// RabbitMQ.
+func main() {
+	if err := logger.InitLogger(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Log.Sync()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Log.Fatal("Failed to load configuration", zap.Error(err))
+	}
+
+	profileRepo, err := backends.Open(cfg)
+	if err != nil {
+		logger.Log.Fatal("Failed to create repository", zap.Error(err))
+	}
+	defer profileRepo.Close(context.Background())
+
+	blobs, err := filesystem.NewStore(cfg.Blobstore.Path)
+	if err != nil {
+		logger.Log.Fatal("Failed to create blob store", zap.Error(err))
+	}
+
+	// Erased profiles are deleted from Redis, which tells every server pod to
+	// drop its copy, and redacted from the responses recorded there
+	var cacheImpl cache.Cache = cache.NewNoopCache()
+	var countsImpl cache.FollowCountCache = cache.NewNoopCache()
+	idempotencyStores := []repository.IdempotencyStore{profileRepo}
+	redisClient, err := redis.NewClient(cfg)
+	if err != nil {
+		logger.Log.Warn("Failed to initialize Redis client, cached profiles will expire on their own", zap.Error(err))
+	} else {
+		defer redisClient.Close()
+		cacheImpl = redisClient
+		countsImpl = redisClient
+		idempotencyStores = append([]repository.IdempotencyStore{redisClient}, idempotencyStores...)
+	}
+
+	q, err := rabbitmq.NewQueue(cfg)
+	if err != nil {
+		logger.Log.Fatal("Failed to connect to RabbitMQ", zap.Error(err))
+	}
+	defer q.Close()
+
+	profileService := service.NewProfileService(profileRepo, profileRepo, profileRepo, profileRepo, profileRepo, profileRepo, blobs, cacheImpl, countsImpl, q)
+	profileService.SetIdempotency(service.NewIdempotencyService(cfg.Idempotency.TTL, idempotencyStores...))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.Log.Info("Eraser started")
+	profileService.RunEraser(ctx, q, cfg.Purge.Interval)
+	if ctx.Err() == nil {
+		// The subscription failed; exit so that the eraser is restarted
+		logger.Log.Error("Eraser exiting")
+		os.Exit(1)
+	}
+	logger.Log.Info("Eraser exiting")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/repository/postgresql"
+	"github.com/fernandobarroso/profile-service/internal/repository/postgresql/migrations"
+	"go.uber.org/zap"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up          Apply all pending migrations
+  down [n]    Roll back the last n applied migrations (default 1)
+  status      Show which migrations have been applied`
+
+func main() {
+	if err := logger.InitLogger(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Log.Sync()
+
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Log.Fatal("Failed to load configuration", zap.Error(err))
+	}
+
+	command, steps := os.Args[1], 1
+	switch command {
+	case "up", "status":
+	case "down":
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, usage)
+				os.Exit(2)
+			}
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// A sharded deployment keeps the same schema on every shard
+	uris := []string{cfg.Database.URI}
+	if cfg.Database.Driver == "sharded" {
+		uris = cfg.Database.ShardURIs
+	}
+	for i, uri := range uris {
+		if len(uris) > 1 {
+			logger.Log.Info("Migrating shard", zap.Int("shard", i))
+		}
+		migrate(uri, command, steps)
+	}
+}
+
+// migrate runs a command against the database at uri
+func migrate(uri, command string, steps int) {
+	db, err := postgresql.OpenDB(uri)
+	if err != nil {
+		logger.Log.Fatal("Failed to connect to PostgreSQL", zap.Error(err))
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		logger.Log.Fatal("Failed to load migrations", zap.Error(err))
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		if err := migrator.Up(ctx); err != nil {
+			logger.Log.Fatal("Migration failed", zap.Error(err))
+		}
+		logger.Log.Info("Database is up to date")
+
+	case "down":
+		if err := migrator.Down(ctx, steps); err != nil {
+			logger.Log.Fatal("Rollback failed", zap.Error(err))
+		}
+		logger.Log.Info("Rollback completed", zap.Int("steps", steps))
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Log.Fatal("Failed to read migration status", zap.Error(err))
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, state)
+		}
+	}
+}
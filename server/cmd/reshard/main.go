@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/repository/sharded"
+	"go.uber.org/zap"
+)
+
+const usage = `Usage: reshard
+
+Moves every profile to the shard that owns it under the shards listed in
+DB_SHARD_URIS, then rebuilds the email directory. Run it with writes paused
+after appending shards, or after first sharding an existing database. It can
+be repeated safely if interrupted.`
+
+func main() {
+	if err := logger.InitLogger(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Log.Sync()
+
+	if len(os.Args) > 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Log.Fatal("Failed to load configuration", zap.Error(err))
+	}
+	if cfg.Database.Driver != "sharded" {
+		logger.Log.Fatal("Resharding requires DB_DRIVER=sharded", zap.String("driver", cfg.Database.Driver))
+	}
+
+	repo, err := sharded.NewRepository(cfg)
+	if err != nil {
+		logger.Log.Fatal("Failed to connect to shards", zap.Error(err))
+	}
+	defer repo.Close(context.Background())
+
+	stats, err := repo.Reshard(context.Background())
+	if err != nil {
+		logger.Log.Fatal("Resharding failed", zap.Error(err))
+	}
+	logger.Log.Info("Resharding completed",
+		zap.Int("shards", len(cfg.Database.ShardURIs)),
+		zap.Int("moved", stats.Moved),
+		zap.Int("conflicts", stats.Conflicts),
+	)
+	if stats.Conflicts > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/repository/postgresql"
+	"go.uber.org/zap"
+)
+
+const usage = `Usage: rotate-keys [batch-size]
+
+Reseals the PII of every profile not yet sealed with the primary key of the
+keyring at PII_KEYRING_PATH, batch-size profiles per transaction (default 500),
+and moves email claims to blind indexes, until none is left. Run it after
+making a new key primary, alongside the service; retired keys can be removed
+from the keyring once it completes and cached profiles have expired. To enable
+encryption, stop the service and run it before restarting the service with the
+keyring, which refuses to start while plaintext profiles remain. It can be
+repeated safely if interrupted.`
+
+// defaultBatchSize is the number of profiles resealed per transaction
+const defaultBatchSize = 500
+
+func main() {
+	if err := logger.InitLogger(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Log.Sync()
+
+	batchSize := defaultBatchSize
+	switch len(os.Args) {
+	case 1:
+	case 2:
+		size, err := strconv.Atoi(os.Args[1])
+		if err != nil || size < 1 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		batchSize = size
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Log.Fatal("Failed to load configuration", zap.Error(err))
+	}
+	if cfg.PII.KeyringPath == "" {
+		logger.Log.Fatal("Rotating keys requires PII_KEYRING_PATH")
+	}
+
+	// Every shard seals its own profiles
+	uris := []string{cfg.Database.URI}
+	switch cfg.Database.Driver {
+	case "postgres":
+	case "sharded":
+		uris = cfg.Database.ShardURIs
+	default:
+		logger.Log.Fatal("Rotating keys requires DB_DRIVER=postgres or sharded", zap.String("driver", cfg.Database.Driver))
+	}
+
+	total := 0
+	for i, uri := range uris {
+		total += rotate(cfg, i, uri, batchSize)
+	}
+	logger.Log.Info("Key rotation completed", zap.Int("rotated", total))
+}
+
+// rotate reseals the profiles of the database at uri, the shard-th of the
+// deployment, and returns how many it resealed
+func rotate(cfg *config.Config, shard int, uri string, batchSize int) int {
+	shardCfg := *cfg
+	shardCfg.Database.URI = uri
+	shardCfg.Database.ReplicaURIs = nil
+
+	repo, err := postgresql.NewRepository(&shardCfg)
+	if err != nil {
+		logger.Log.Fatal("Failed to connect to PostgreSQL", zap.Int("shard", shard), zap.Error(err))
+	}
+	defer repo.Close(context.Background())
+
+	rotated, err := repo.RotateKeys(context.Background(), batchSize)
+	if err != nil {
+		logger.Log.Fatal("Key rotation failed", zap.Int("shard", shard), zap.Int("rotated", rotated), zap.Error(err))
+	}
+	logger.Log.Info("Rotated shard keys", zap.Int("shard", shard), zap.Int("rotated", rotated))
+	return rotated
+}
@@ -15,11 +15,17 @@ import (
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
 	"github.com/fernandobarroso/profile-service/internal/api/router"
 	"github.com/fernandobarroso/profile-service/internal/api/service"
+	"github.com/fernandobarroso/profile-service/internal/blobstore/filesystem"
 	"github.com/fernandobarroso/profile-service/internal/cache"
 	"github.com/fernandobarroso/profile-service/internal/cache/redis"
 	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/outbox"
+	"github.com/fernandobarroso/profile-service/internal/queue"
 	"github.com/fernandobarroso/profile-service/internal/queue/rabbitmq"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/backends"
 	"github.com/fernandobarroso/profile-service/internal/repository/postgresql"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -43,38 +49,99 @@ func main() {
 	logger.Log.Info("Configuration loaded", zap.Any("config", cfg))
 
 	// Initialize repository
-	profileRepo, err := postgresql.NewRepository(cfg)
+	profileRepo, err := backends.Open(cfg)
 	if err != nil {
-		logger.Log.Fatal("Failed to create PostgreSQL repository", zap.Error(err))
+		logger.Log.Fatal("Failed to create repository", zap.Error(err))
 	}
-	logger.Log.Info("PostgreSQL repository created")
+	logger.Log.Info("Repository created", zap.String("driver", cfg.Database.Driver))
 	defer profileRepo.Close(context.Background())
 
 	// Initialize Redis client
 	var cacheImpl cache.Cache
+	var countsImpl cache.FollowCountCache
+	memoryCache, err := cache.NewMemoryCache(cache.MemoryCacheOptions{
+		Capacity: cfg.Cache.Memory.Capacity,
+		Policy:   cache.EvictionPolicy(cfg.Cache.Memory.Policy),
+	})
+	if err != nil {
+		logger.Log.Fatal("Failed to create memory cache", zap.Error(err))
+	}
+	// Idempotency keys are kept in Redis when it is reachable, and in the
+	// database otherwise
+	idempotencyStores := []repository.IdempotencyStore{profileRepo}
 	redisClient, err := redis.NewClient(cfg)
 	if err != nil {
 		logger.Log.Warn("Failed to initialize Redis client, continuing without cache", zap.Error(err))
-		cacheImpl = cache.NewMemoryCache()
+		cacheImpl = memoryCache
+		countsImpl = cache.NewNoopCache()
 	} else {
 		logger.Log.Info("Redis client initialized")
 		cacheImpl = redisClient
+		if cfg.Cache.L1.Enabled {
+			layered := cache.NewLayeredCache(memoryCache, redisClient, cfg.Cache.L1.TTL)
+			redisClient.OnInvalidation(layered.Invalidate)
+			cacheImpl = layered
+		}
+		countsImpl = redisClient
+		idempotencyStores = append([]repository.IdempotencyStore{redisClient}, idempotencyStores...)
 	}
 
-	// Initialize RabbitMQ connection
-	rabbitConn, err := rabbitmq.NewQueue(cfg)
+	// Start background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Initialize RabbitMQ connection. Profile events wait in the outbox until the
+	// relay has a queue to publish them to.
+	var queueImpl queue.Queue
+	relay := outbox.NewRelay(profileRepo, nil, cfg.Outbox.PollInterval, cfg.Outbox.BatchSize, cfg.Outbox.Retention)
+	rabbitConn, err := newQueue(cfg)
 	if err != nil {
 		logger.Log.Warn("Failed to connect to RabbitMQ, continuing without queue", zap.Error(err))
 	} else {
 		logger.Log.Info("RabbitMQ connection initialized")
+		queueImpl = rabbitConn
+	}
+
+	// Initialize the blob store holding uploaded images
+	blobs, err := filesystem.NewStore(cfg.Blobstore.Path)
+	if err != nil {
+		logger.Log.Fatal("Failed to create blob store", zap.Error(err))
 	}
 
 	// Initialize components
-	profileService := service.NewProfileService(profileRepo, cacheImpl, rabbitConn)
+	profileService := service.NewProfileService(profileRepo, profileRepo, profileRepo, profileRepo, profileRepo, profileRepo, blobs, cacheImpl, countsImpl, queueImpl)
+	if redisClient != nil && cfg.Cache.FillLock.Enabled {
+		profileService.SetFillLocker(redisClient, cfg.Cache.FillLock.Lease)
+	}
 	profileHandler := handler.NewProfileHandler(profileService)
+	idempotencyService := service.NewIdempotencyService(cfg.Idempotency.TTL, idempotencyStores...)
+
+	// Once there is a queue, the relay publishes to it and the follow counter
+	// consumes from it. Erasures are carried out by cmd/eraser.
+	onQueue := func(q queue.Queue) {
+		relay.SetQueue(q)
+		go profileService.RunFollowCounter(jobsCtx, q)
+	}
+	if queueImpl != nil {
+		onQueue(queueImpl)
+	} else {
+		go connectQueue(jobsCtx, cfg, onQueue)
+	}
+	go relay.Run(jobsCtx)
+	if pg, ok := profileRepo.(*postgresql.Repository); ok {
+		go pg.MonitorReplicas(jobsCtx, cfg.Database.ReplicaCheckInterval)
+	}
+
+	go profileService.RunPurger(jobsCtx, cfg.Purge.Interval, cfg.Purge.Retention)
+	go idempotencyService.RunExpiry(jobsCtx, cfg.Purge.Interval)
+	go memoryCache.RunExpiry(jobsCtx, cfg.Cache.Memory.ExpiryInterval)
 
 	// Initialize Gin router
-	router := router.SetupRouter(profileHandler)
+	resolver, err := tenant.NewResolver(cfg.Tenancy.APIKeys, cfg.Tenancy.TrustHeader)
+	if err != nil {
+		logger.Log.Fatal("Invalid tenant API keys", zap.Error(err))
+	}
+	router := router.SetupRouter(profileHandler, resolver, idempotencyService)
 
 	// Get pod name from environment
 	podName := os.Getenv("POD_NAME")
@@ -133,6 +200,9 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 
+	// Stop background jobs
+	stopJobs()
+
 	// Close connections
 	if redisClient != nil {
 		if err := redisClient.Close(); err != nil {
@@ -153,3 +223,37 @@ func main() {
 
 	logger.Log.Info("Server exiting")
 }
+
+// newQueue connects to RabbitMQ. Profile events are only read through copies,
+// by the follow counter, so the events channel gets no queue of its own.
+func newQueue(cfg *config.Config) (*rabbitmq.Queue, error) {
+	q, err := rabbitmq.NewQueue(cfg)
+	if err != nil {
+		return nil, err
+	}
+	q.SetCopiesOnly(service.EventsChannel)
+	return q, nil
+}
+
+// connectQueue keeps trying to connect to RabbitMQ and hands the connection to
+// onConnect once it succeeds
+func connectQueue(ctx context.Context, cfg *config.Config, onConnect func(queue.Queue)) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rabbitConn, err := newQueue(cfg)
+			if err != nil {
+				logger.Log.Warn("Still unable to connect to RabbitMQ", zap.Error(err))
+				continue
+			}
+			logger.Log.Info("RabbitMQ connection established, relaying outbox")
+			onConnect(rabbitConn)
+			return
+		}
+	}
+}
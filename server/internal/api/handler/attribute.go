@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ListAttributes handles listing the tenant's custom attribute definitions
+func (h *ProfileHandler) ListAttributes(c *gin.Context) {
+	defs, err := h.service.ListAttributes(c.Request.Context())
+	if err != nil {
+		h.handleError(c, "Failed to list attributes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attributes": defs})
+}
+
+// PutAttribute handles defining or redefining a custom attribute. Profiles
+// are checked against the definition whenever they are next written.
+func (h *ProfileHandler) PutAttribute(c *gin.Context) {
+	var req models.PutAttributeDefinitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleError(c, "Invalid request", bindError(err))
+		return
+	}
+
+	def := &models.AttributeDefinition{
+		Name:      c.Param("name"),
+		Type:      req.Type,
+		Required:  req.Required,
+		Enum:      req.Enum,
+		MaxLength: req.MaxLength,
+	}
+	if err := h.service.PutAttribute(c.Request.Context(), def); err != nil {
+		h.handleError(c, "Failed to define attribute", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, def)
+}
+
+// DeleteAttribute handles removing a custom attribute definition. Stored
+// values are kept, but profiles carrying them cannot be written until the
+// attribute is removed from them or defined again.
+func (h *ProfileHandler) DeleteAttribute(c *gin.Context) {
+	if err := h.service.DeleteAttribute(c.Request.Context(), c.Param("name")); err != nil {
+		h.handleError(c, "Failed to delete attribute", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// ndjsonContentType is the media type of newline-delimited JSON request bodies
+const ndjsonContentType = "application/x-ndjson"
+
+// maxBatchRequestSize caps the size of a batch request body, leaving room for
+// repository.MaxBatchSize profiles of a generous size
+const maxBatchRequestSize = 16 << 20
+
+// BatchItemResult is the outcome of a single profile in a batch request
+type BatchItemResult struct {
+	// Index is the position of the profile in the request
+	Index   int             `json:"index"`
+	Status  string          `json:"status"`
+	Profile *models.Profile `json:"profile,omitempty"`
+	// Error explains why an invalid profile was rejected
+	Error         string         `json:"error,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// BatchResponse reports the outcome of every profile in a batch request
+type BatchResponse struct {
+	Results   []*BatchItemResult `json:"results"`
+	Created   int                `json:"created"`
+	Updated   int                `json:"updated"`
+	Duplicate int                `json:"duplicate"`
+	Invalid   int                `json:"invalid"`
+}
+
+// CreateBatch handles creating many profiles in one request. The body is either
+// a JSON array of profiles or, with Content-Type application/x-ndjson, one
+// profile per line. With ?upsert=true, profiles whose email is in use update the
+// existing profile.
+func (h *ProfileHandler) CreateBatch(c *gin.Context) {
+	upsert := false
+	if value := c.Query("upsert"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			h.handleError(c, "Invalid batch options", repository.NewValidationError("upsert", "must be true or false"))
+			return
+		}
+		upsert = parsed
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchRequestSize)
+	items, err := readBatch(c.Request)
+	if err != nil {
+		h.handleError(c, "Invalid batch request", err)
+		return
+	}
+
+	response := &BatchResponse{Results: make([]*BatchItemResult, len(items))}
+	var profiles []*models.Profile
+	var indexes []int
+	for i, item := range items {
+		req, err := decodeBatchItem(item)
+		if err != nil {
+			response.Results[i] = invalidBatchItem(i, err)
+			continue
+		}
+		profiles = append(profiles, &models.Profile{
+			Name:       req.Name,
+			Email:      req.Email,
+			Bio:        req.Bio,
+			ImageURLs:  []string{},
+			Attributes: req.Attributes,
+			Tags:       req.Tags,
+		})
+		indexes = append(indexes, i)
+	}
+
+	if len(profiles) > 0 {
+		outcomes, err := h.service.CreateBatch(writeContext(c), profiles, upsert)
+		if err != nil {
+			h.handleError(c, "Failed to create profile batch", err)
+			return
+		}
+		h.setConsistencyToken(c)
+		for j, outcome := range outcomes {
+			i := indexes[j]
+			if outcome.Status == repository.BatchInvalid {
+				response.Results[i] = invalidBatchItem(i, outcome.Err)
+				continue
+			}
+			response.Results[i] = &BatchItemResult{Index: i, Status: outcome.Status, Profile: outcome.Profile}
+		}
+	}
+
+	for _, result := range response.Results {
+		switch result.Status {
+		case repository.BatchCreated:
+			response.Created++
+		case repository.BatchUpdated:
+			response.Updated++
+		case repository.BatchDuplicate:
+			response.Duplicate++
+		case repository.BatchInvalid:
+			response.Invalid++
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// readBatch splits a batch request body into its raw profiles
+func readBatch(r *http.Request) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(r.Body)
+	var items []json.RawMessage
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == ndjsonContentType {
+		for {
+			var item json.RawMessage
+			err := decoder.Decode(&item)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, badRequest("Request body is not valid NDJSON", err)
+			}
+			items = append(items, item)
+			if len(items) > repository.MaxBatchSize {
+				break
+			}
+		}
+	} else if err := decoder.Decode(&items); err != nil {
+		return nil, badRequest("Request body must be a JSON array of profiles", err)
+	}
+
+	if len(items) == 0 {
+		return nil, repository.NewValidationError("profiles", "at least one profile is required")
+	}
+	if len(items) > repository.MaxBatchSize {
+		return nil, repository.NewValidationError("profiles", fmt.Sprintf("at most %d profiles are allowed per batch", repository.MaxBatchSize))
+	}
+	return items, nil
+}
+
+// decodeBatchItem decodes and validates a single profile of a batch
+func decodeBatchItem(item json.RawMessage) (*models.CreateProfileRequest, error) {
+	var req models.CreateProfileRequest
+	if err := json.Unmarshal(item, &req); err != nil {
+		return nil, badRequest("Item is not a valid profile", err)
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// invalidBatchItem builds the result for a profile rejected before it was written
+func invalidBatchItem(index int, err error) *BatchItemResult {
+	detail, params := describe(err)
+	return &BatchItemResult{
+		Index:         index,
+		Status:        repository.BatchInvalid,
+		Error:         detail,
+		InvalidParams: params,
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInvalidIfMatch is returned for an If-Match header that is not a profile ETag
+var errInvalidIfMatch = errors.New("invalid If-Match header")
+
+// formatETag renders a profile version as a strong entity tag
+func formatETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag sets the ETag response header for a profile version
+func setETag(c *gin.Context, version int) {
+	if version > 0 {
+		c.Header("ETag", formatETag(version))
+	}
+}
+
+// parseIfMatch returns the profile version required by the If-Match header.
+// It returns 0 when the header is absent or "*", meaning any version matches.
+func parseIfMatch(c *gin.Context) (int, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	// Profile versions are exact, so weak tags compare the same as strong ones
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, errInvalidIfMatch
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version < 1 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// csvContentType is the media type of CSV exports and imports
+	csvContentType = "text/csv"
+	// exportFlushInterval is how many profiles are written between flushes of
+	// an export to the client
+	exportFlushInterval = 100
+)
+
+// csvColumns are the columns of a CSV export, in order. Imports read the
+// editable columns by name and ignore the others.
+var csvColumns = []string{"id", "name", "email", "bio", "image_urls", "attributes", "tags", "version", "created_at", "updated_at"}
+
+// profileEncoder writes profiles to an export stream
+type profileEncoder interface {
+	encode(profile *models.Profile) error
+	// flush writes any buffered profiles to the client
+	flush() error
+}
+
+// ndjsonEncoder writes one JSON profile per line
+type ndjsonEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w http.ResponseWriter) *ndjsonEncoder {
+	buffered := bufio.NewWriter(w)
+	return &ndjsonEncoder{w: buffered, enc: json.NewEncoder(buffered)}
+}
+
+func (e *ndjsonEncoder) encode(profile *models.Profile) error { return e.enc.Encode(profile) }
+
+func (e *ndjsonEncoder) flush() error { return e.w.Flush() }
+
+// csvEncoder writes a header row followed by one row per profile. Image URLs
+// and tags cannot contain spaces, so each share a cell separated by spaces;
+// attributes are written as a JSON object.
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w http.ResponseWriter) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+// writeHeader writes the header row, unless it has been written already
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvEncoder) encode(profile *models.Profile) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	attributes := []byte("{}")
+	if len(profile.Attributes) > 0 {
+		var err error
+		if attributes, err = json.Marshal(profile.Attributes); err != nil {
+			return err
+		}
+	}
+	return e.w.Write([]string{
+		profile.ID,
+		profile.Name,
+		profile.Email,
+		profile.Bio,
+		strings.Join(profile.ImageURLs, " "),
+		string(attributes),
+		strings.Join(profile.Tags, " "),
+		strconv.Itoa(profile.Version),
+		profile.CreatedAt.UTC().Format(time.RFC3339Nano),
+		profile.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvEncoder) flush() error {
+	// An empty export still has its header
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Export handles streaming every profile matching the list filters, as NDJSON
+// (the default) or, with ?format=csv, as CSV. Profiles are read from the store
+// as they are written, so exports of any size use constant memory.
+func (h *ProfileHandler) Export(c *gin.Context) {
+	opts, err := parseListOptions(c)
+	if err != nil {
+		h.handleError(c, "Invalid export options", err)
+		return
+	}
+
+	var encoder profileEncoder
+	contentType, extension := ndjsonContentType, "ndjson"
+	switch format := c.DefaultQuery("format", "ndjson"); format {
+	case "ndjson":
+		encoder = newNDJSONEncoder(c.Writer)
+	case "csv":
+		encoder = newCSVEncoder(c.Writer)
+		contentType, extension = csvContentType, "csv"
+	default:
+		h.handleError(c, "Invalid export options", repository.NewValidationError("format", "must be ndjson or csv"))
+		return
+	}
+
+	it, err := h.service.Export(readContext(c), opts)
+	if err != nil {
+		h.handleError(c, "Failed to export profiles", err)
+		return
+	}
+	defer it.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="profiles.`+extension+`"`)
+	c.Status(http.StatusOK)
+
+	count := 0
+	for it.Next() {
+		if err := encoder.encode(it.Profile()); err != nil {
+			h.abortExport(c, count, err)
+			return
+		}
+		count++
+		if count%exportFlushInterval == 0 {
+			if err := encoder.flush(); err != nil {
+				h.abortExport(c, count, err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+	if err := it.Err(); err != nil {
+		if !c.Writer.Written() {
+			// Nothing has reached the client yet, so the failure can still be reported
+			c.Writer.Header().Del("Content-Disposition")
+			h.handleError(c, "Failed to export profiles", err)
+			return
+		}
+		h.abortExport(c, count, err)
+		return
+	}
+	if err := encoder.flush(); err != nil {
+		h.abortExport(c, count, err)
+	}
+}
+
+// abortExport ends an export that failed after its response started. The
+// status has already been sent, so the connection is closed without ending the
+// response, which clients see as a truncated body rather than a complete one.
+func (h *ProfileHandler) abortExport(c *gin.Context, count int, err error) {
+	logger.Log.Error("Export failed part way",
+		zap.Int("profiles_written", count),
+		zap.Error(err),
+	)
+	abortResponse(c)
+}
+
+// abortResponse closes the connection of a response that has already started
+func abortResponse(c *gin.Context) {
+	c.Abort()
+
+	conn, _, hijackErr := c.Writer.Hijack()
+	if hijackErr != nil {
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// Follow handles making a profile follow another. It responds 201 with the new
+// follow, or 200 with the existing one if the profile already followed the target.
+func (h *ProfileHandler) Follow(c *gin.Context) {
+	id, target := c.Param("id"), c.Param("target")
+	if id == "" || target == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID and target are required", nil))
+		return
+	}
+
+	follow, created, err := h.service.Follow(writeContext(c), id, target)
+	if err != nil {
+		h.handleError(c, "Failed to follow profile", err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, follow)
+}
+
+// Unfollow handles removing a profile's follow on another. Removing a follow
+// that does not exist succeeds, so retries are safe.
+func (h *ProfileHandler) Unfollow(c *gin.Context) {
+	id, target := c.Param("id"), c.Param("target")
+	if id == "" || target == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID and target are required", nil))
+		return
+	}
+
+	if err := h.service.Unfollow(writeContext(c), id, target); err != nil {
+		h.handleError(c, "Failed to unfollow profile", err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	c.Status(http.StatusNoContent)
+}
+
+// Relationship handles describing how a profile and a target follow each other
+func (h *ProfileHandler) Relationship(c *gin.Context) {
+	id, target := c.Param("id"), c.Param("target")
+	if id == "" || target == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID and target are required", nil))
+		return
+	}
+
+	relationship, err := h.service.Relationship(readContext(c), id, target)
+	if err != nil {
+		h.handleError(c, "Failed to get follow relationship", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, relationship)
+}
+
+// Followers handles listing the profiles following a profile, most recent first
+func (h *ProfileHandler) Followers(c *gin.Context) {
+	h.listFollows(c, "Failed to list followers", h.service.Followers)
+}
+
+// Following handles listing the profiles a profile follows, most recent first
+func (h *ProfileHandler) Following(c *gin.Context) {
+	h.listFollows(c, "Failed to list followed profiles", h.service.Following)
+}
+
+// Mutuals handles listing the profiles a profile follows that follow it back,
+// most recent first
+func (h *ProfileHandler) Mutuals(c *gin.Context) {
+	h.listFollows(c, "Failed to list mutual follows", h.service.MutualFollows)
+}
+
+// FollowCounts handles counting a profile's followers and followed profiles
+func (h *ProfileHandler) FollowCounts(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	counts, err := h.service.FollowCounts(readContext(c), id)
+	if err != nil {
+		h.handleError(c, "Failed to count follows", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, counts)
+}
+
+// followLister lists a page of a profile's follows
+type followLister func(ctx context.Context, id string, opts repository.FollowListOptions) (*repository.FollowListResult, error)
+
+// listFollows handles listing a page of a profile's follows with list
+func (h *ProfileHandler) listFollows(c *gin.Context, message string, list followLister) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	opts, err := parseFollowListOptions(c)
+	if err != nil {
+		h.handleError(c, "Invalid follow list options", err)
+		return
+	}
+
+	result, err := list(readContext(c), id, opts)
+	if err != nil {
+		h.handleError(c, message, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// parseFollowListOptions reads follow list pagination from the query string
+func parseFollowListOptions(c *gin.Context) (repository.FollowListOptions, error) {
+	opts := repository.FollowListOptions{Cursor: c.Query("cursor")}
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 {
+			return opts, fmt.Errorf("%w: limit must be a positive integer", repository.ErrInvalidListOptions)
+		}
+		opts.Limit = value
+	}
+	return opts, nil
+}
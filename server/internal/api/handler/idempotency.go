@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// idempotencyKeyHeader carries a client-chosen key that makes a POST safe to retry
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayHeader marks a response replayed from an earlier request
+	idempotentReplayHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength caps the length of idempotency keys
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentRequestSize caps the size of the bodies kept to fingerprint
+	// requests carrying an Idempotency-Key
+	maxIdempotentRequestSize = 1 << 20
+)
+
+// IdempotencyMiddleware makes requests carrying an Idempotency-Key header safe
+// to retry. The first request with a key is performed and its response
+// recorded; a retry with the same key and payload gets the recorded status and
+// body back. A retry while the first request is in flight gets 409, and reusing
+// a key for a different payload gets 422. Server errors are not recorded, so a
+// request that failed with one is performed again when retried.
+func (h *ProfileHandler) IdempotencyMiddleware(idempotency *service.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			h.handleError(c, "Invalid Idempotency-Key header", badRequest("Idempotency-Key must be at most 255 characters", nil))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentRequestSize))
+		if err != nil {
+			h.handleError(c, "Failed to read request body", badRequest("Request body could not be read", err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The key must be completed or released even if the client goes away
+		ctx := context.WithoutCancel(c.Request.Context())
+		request, recorded, err := idempotency.Begin(ctx, key, requestFingerprint(c, body))
+		if err != nil {
+			h.handleError(c, "Failed to check idempotency key", err)
+			return
+		}
+		if recorded != nil {
+			c.Header(idempotentReplayHeader, "true")
+			c.Data(recorded.StatusCode, recorded.ContentType, recorded.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// Also reached when the handler panics
+			if !completed {
+				if err := request.Release(ctx); err != nil {
+					logger.Log.Error("Failed to release idempotency key", zap.String("key", key), zap.Error(err))
+				}
+			}
+		}()
+
+		c.Next()
+
+		if status := recorder.Status(); status < http.StatusInternalServerError {
+			if err := request.Complete(ctx, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+				logger.Log.Error("Failed to record idempotent response", zap.String("key", key), zap.Error(err))
+				return
+			}
+			completed = true
+		}
+	}
+}
+
+// requestFingerprint identifies a request by its method, URL and body, so that
+// a key reused for a different request can be told apart from a retry
+func requestFingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of its body
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/service"
+	"github.com/fernandobarroso/profile-service/internal/repository/sqlite"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	os.Exit(m.Run())
+}
+
+// idempotentRouter serves POST /profiles behind the idempotency middleware,
+// counting the requests that reach the handler. Requests wait for release, if
+// set, before they are answered.
+type idempotentRouter struct {
+	*gin.Engine
+	calls   int32
+	release chan struct{}
+}
+
+func newIdempotentRouter(t *testing.T, release chan struct{}) *idempotentRouter {
+	t.Helper()
+	store, err := sqlite.Open(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close(context.Background()) })
+
+	gin.SetMode(gin.TestMode)
+	r := &idempotentRouter{Engine: gin.New(), release: release}
+	h := &ProfileHandler{}
+	r.POST("/profiles", h.IdempotencyMiddleware(service.NewIdempotencyService(time.Hour, store)), func(c *gin.Context) {
+		n := atomic.AddInt32(&r.calls, 1)
+		if r.release != nil {
+			<-r.release
+		}
+		c.JSON(http.StatusCreated, gin.H{"call": n})
+	})
+	return r
+}
+
+func (r *idempotentRouter) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/profiles", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	r := newIdempotentRouter(t, nil)
+
+	first := r.post("key-1", `{"name":"Ada"}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(idempotentReplayHeader))
+
+	retry := r.post("key-1", `{"name":"Ada"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(idempotentReplayHeader))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.EqualValues(t, 1, r.calls)
+
+	// Requests without a key, or with another, are performed
+	assert.Equal(t, http.StatusCreated, r.post("", `{"name":"Ada"}`).Code)
+	assert.Equal(t, http.StatusCreated, r.post("key-2", `{"name":"Ada"}`).Code)
+	assert.EqualValues(t, 3, r.calls)
+}
+
+func TestIdempotencyRejectsReusedKey(t *testing.T) {
+	r := newIdempotentRouter(t, nil)
+
+	require.Equal(t, http.StatusCreated, r.post("key-1", `{"name":"Ada"}`).Code)
+
+	w := r.post("key-1", `{"name":"Grace"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"idempotency_key_reused"`)
+	assert.EqualValues(t, 1, r.calls)
+}
+
+func TestIdempotencyRejectsRequestInFlight(t *testing.T) {
+	release := make(chan struct{})
+	r := newIdempotentRouter(t, release)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- r.post("key-1", `{"name":"Ada"}`) }()
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&r.calls) == 1
+	}, time.Second, time.Millisecond)
+
+	w := r.post("key-1", `{"name":"Ada"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"idempotency_key_in_use"`)
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+	assert.Equal(t, "true", r.post("key-1", `{"name":"Ada"}`).Header().Get(idempotentReplayHeader))
+	assert.EqualValues(t, 1, r.calls)
+}
+
+func TestIdempotencyRejectsLongKey(t *testing.T) {
+	r := newIdempotentRouter(t, nil)
+
+	w := r.post(strings.Repeat("k", maxIdempotencyKeyLength+1), `{"name":"Ada"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Zero(t, r.calls)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/fernandobarroso/profile-service/internal/api/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxImageSize caps the size of an uploaded image
+	maxImageSize = 5 << 20
+	// maxImageRequestSize caps the size of an image upload request, leaving
+	// room for the multipart framing around the image
+	maxImageRequestSize = maxImageSize + 64<<10
+	// imageFormField names the multipart form field carrying an uploaded image
+	imageFormField = "image"
+	// sniffLength is how many bytes content type detection looks at
+	sniffLength = 512
+)
+
+// UploadImage handles uploading an image to a profile as the "image" field of
+// a multipart form. The image type is detected from its content, whatever the
+// client declared, and must be JPEG, PNG, GIF or WebP. It responds 201 with the
+// updated profile and the image URL in the Location header.
+func (h *ProfileHandler) UploadImage(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageRequestSize)
+	file, header, err := c.Request.FormFile(imageFormField)
+	if err != nil {
+		var sizeErr *http.MaxBytesError
+		if errors.As(err, &sizeErr) {
+			h.handleError(c, "Image too large", err)
+			return
+		}
+		h.handleError(c, "Invalid image upload", badRequest("Request must be a multipart form with an image field", err))
+		return
+	}
+	defer file.Close()
+	if header.Size > maxImageSize {
+		h.handleError(c, "Image too large", &http.MaxBytesError{Limit: maxImageSize})
+		return
+	}
+
+	content := bufio.NewReaderSize(file, sniffLength)
+	head, err := content.Peek(sniffLength)
+	if err != nil && len(head) == 0 {
+		h.handleError(c, "Invalid image upload", badRequest("Image is empty", err))
+		return
+	}
+	contentType := http.DetectContentType(head)
+	if _, ok := service.ImageExtensions[contentType]; !ok {
+		h.handleError(c, "Invalid image upload", &mediaTypeError{accepted: imageContentTypes()})
+		return
+	}
+
+	profile, url, err := h.service.AddImage(writeContext(c), id, content, contentType, expectedVersion)
+	if err != nil {
+		h.handleWriteError(c, "Failed to upload image", expectedVersion, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
+	c.Header("Location", url)
+	c.JSON(http.StatusCreated, profile)
+}
+
+// DeleteImage handles deleting an image uploaded to a profile
+func (h *ProfileHandler) DeleteImage(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
+		return
+	}
+
+	profile, err := h.service.RemoveImage(writeContext(c), id, c.Param("imageID"), expectedVersion)
+	if err != nil {
+		h.handleWriteError(c, "Failed to delete image", expectedVersion, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetImage handles serving an image uploaded to a profile. Image IDs are never
+// reused, so clients may cache images for as long as they like.
+func (h *ProfileHandler) GetImage(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	blob, contentType, err := h.service.OpenImage(readContext(c), id, c.Param("imageID"))
+	if err != nil {
+		h.handleError(c, "Failed to get image", err)
+		return
+	}
+	defer blob.Close()
+
+	c.DataFromReader(http.StatusOK, blob.Size, contentType, blob, map[string]string{
+		"Cache-Control":          "private, max-age=31536000, immutable",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// imageContentTypes lists the content types accepted for uploaded images
+func imageContentTypes() []string {
+	types := make([]string, 0, len(service.ImageExtensions))
+	for contentType := range service.ImageExtensions {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// importChunkSize is how many valid rows of an import are written together
+	importChunkSize = 500
+	// maxImportLineSize bounds a single line of an NDJSON import
+	maxImportLineSize = 1 << 20
+	// maxReportedRows caps how many rejected rows an import report lists
+	maxReportedRows = 1000
+)
+
+// ImportRowError describes a row of an import that was not written
+type ImportRowError struct {
+	// Line is the row's line number in the request body, counting from 1
+	Line          int            `json:"line"`
+	Status        string         `json:"status"`
+	Error         string         `json:"error"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// ImportReport summarizes an import
+type ImportReport struct {
+	Rows      int `json:"rows"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Duplicate int `json:"duplicate"`
+	Invalid   int `json:"invalid"`
+	// Errors lists the rejected rows, in order, up to a limit
+	Errors []*ImportRowError `json:"errors"`
+	// ErrorsTruncated is set when more rows were rejected than Errors lists
+	ErrorsTruncated bool `json:"errors_truncated,omitempty"`
+}
+
+// reject records a row that was not written
+func (r *ImportReport) reject(rowErr *ImportRowError) {
+	if len(r.Errors) < maxReportedRows {
+		r.Errors = append(r.Errors, rowErr)
+	} else {
+		r.ErrorsTruncated = true
+	}
+}
+
+// importRow is a single row read from an import
+type importRow struct {
+	line int
+	req  *models.ReplaceProfileRequest
+	// err is set instead of req for a row that is not a valid profile
+	err error
+}
+
+// importReader reads the rows of an import. next returns io.EOF after the last
+// row; any other error means the rest of the body cannot be read.
+type importReader interface {
+	next() (*importRow, error)
+}
+
+// Import handles creating profiles from a stream of NDJSON (application/x-ndjson)
+// or CSV (text/csv) rows, such as an export from another environment. Each row
+// is validated on its own and the valid ones are written in chunks, so a
+// failure part way leaves the earlier chunks imported. With ?upsert=true, rows
+// whose email is in use update the existing profile, which makes re-running an
+// import safe.
+func (h *ProfileHandler) Import(c *gin.Context) {
+	upsert := false
+	if value := c.Query("upsert"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			h.handleError(c, "Invalid import options", repository.NewValidationError("upsert", "must be true or false"))
+			return
+		}
+		upsert = parsed
+	}
+
+	var reader importReader
+	switch c.ContentType() {
+	case ndjsonContentType:
+		reader = newNDJSONImportReader(c.Request.Body)
+	case csvContentType:
+		csvReader, err := newCSVImportReader(c.Request.Body)
+		if err != nil {
+			h.handleError(c, "Invalid import", err)
+			return
+		}
+		reader = csvReader
+	default:
+		h.handleError(c, "Invalid import", &mediaTypeError{accepted: []string{ndjsonContentType, csvContentType}})
+		return
+	}
+
+	ctx := writeContext(c)
+	report := &ImportReport{Errors: []*ImportRowError{}}
+	var pending []*importRow
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := h.importChunk(ctx, pending, upsert, report)
+		pending = pending[:0]
+		return err
+	}
+
+	for {
+		row, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// What was read before the failure is still imported
+			if flushErr := flush(); flushErr != nil {
+				h.handleError(c, "Failed to import profiles", flushErr)
+				return
+			}
+			h.handleError(c, "Invalid import", badRequest(fmt.Sprintf("Import stopped after %d rows, which were processed: %v", report.Rows, err), err))
+			return
+		}
+
+		report.Rows++
+		if row.err != nil {
+			detail, params := describe(row.err)
+			report.Invalid++
+			report.reject(&ImportRowError{Line: row.line, Status: repository.BatchInvalid, Error: detail, InvalidParams: params})
+			continue
+		}
+
+		pending = append(pending, row)
+		if len(pending) == importChunkSize {
+			if err := flush(); err != nil {
+				h.handleError(c, "Failed to import profiles", err)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		h.handleError(c, "Failed to import profiles", err)
+		return
+	}
+
+	if report.Created+report.Updated > 0 {
+		h.setConsistencyToken(c)
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// importChunk writes the valid rows of an import as one batch and adds their
+// outcomes to the report
+func (h *ProfileHandler) importChunk(ctx context.Context, rows []*importRow, upsert bool, report *ImportReport) error {
+	profiles := make([]*models.Profile, len(rows))
+	for i, row := range rows {
+		profiles[i] = replacementProfile(row.req)
+	}
+
+	outcomes, err := h.service.CreateBatch(ctx, profiles, upsert)
+	if err != nil {
+		return err
+	}
+
+	for i, outcome := range outcomes {
+		switch outcome.Status {
+		case repository.BatchCreated:
+			report.Created++
+		case repository.BatchUpdated:
+			report.Updated++
+		case repository.BatchDuplicate:
+			report.Duplicate++
+			report.reject(&ImportRowError{Line: rows[i].line, Status: repository.BatchDuplicate, Error: repository.ErrDuplicateEmail.Error()})
+		case repository.BatchInvalid:
+			detail, params := describe(outcome.Err)
+			report.Invalid++
+			report.reject(&ImportRowError{Line: rows[i].line, Status: repository.BatchInvalid, Error: detail, InvalidParams: params})
+		}
+	}
+	return nil
+}
+
+// decodeImportRow decodes and validates an NDJSON row. Members other than the
+// editable fields, such as the id and timestamps of an export, are ignored.
+func decodeImportRow(data []byte) (*models.ReplaceProfileRequest, error) {
+	var req models.ReplaceProfileRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, badRequest("Row is not a valid profile", err)
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ndjsonImportReader reads one profile per line, skipping blank lines
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+	return &ndjsonImportReader{scanner: scanner}
+}
+
+func (r *ndjsonImportReader) next() (*importRow, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		req, err := decodeImportRow(data)
+		return &importRow{line: r.line, req: req, err: err}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d is longer than %d bytes", r.line+1, maxImportLineSize)
+		}
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// csvImportReader reads profiles from CSV rows. The header row names the
+// columns; name and email are required, bio, image_urls, attributes (a JSON
+// object) and tags optional, and any other columns, such as those of an
+// export, are ignored.
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, repository.NewValidationError("", "CSV import must start with a header row")
+	}
+	if err != nil {
+		return nil, badRequest("CSV header row could not be read", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, seen := columns[name]; !seen {
+			columns[name] = i
+		}
+	}
+	for _, required := range []string{"name", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, repository.NewValidationError(required, "column is missing from the CSV header")
+		}
+	}
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvImportReader) next() (*importRow, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &importRow{line: parseErr.StartLine, err: badRequest("Row is not valid CSV", err)}, nil
+		}
+		return nil, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	req := &models.ReplaceProfileRequest{
+		Name:      r.field(record, "name"),
+		Email:     r.field(record, "email"),
+		Bio:       r.field(record, "bio"),
+		ImageURLs: strings.Fields(r.field(record, "image_urls")),
+		Tags:      strings.Fields(r.field(record, "tags")),
+	}
+	if attributes := strings.TrimSpace(r.field(record, "attributes")); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &req.Attributes); err != nil {
+			return &importRow{line: line, err: repository.NewValidationError("attributes", "must be a JSON object")}, nil
+		}
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return &importRow{line: line, err: err}, nil
+	}
+	return &importRow{line: line, req: req}, nil
+}
+
+// field returns the value of a named column, or "" if the row has no such column
+func (r *csvImportReader) field(record []string, column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
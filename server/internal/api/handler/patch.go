@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// mergePatchContentType is the media type of RFC 7396 JSON Merge Patch bodies
+	mergePatchContentType = "application/merge-patch+json"
+	// jsonPatchContentType is the media type of RFC 6902 JSON Patch bodies
+	jsonPatchContentType = "application/json-patch+json"
+	// maxPatchRequestSize caps the size of a PATCH body
+	maxPatchRequestSize = 1 << 20
+)
+
+// patchError is a well-formed patch that cannot be applied to the profile, such
+// as a JSON Patch whose test operation fails or whose path does not exist
+type patchError struct {
+	cause error
+}
+
+func (e *patchError) Error() string { return "patch cannot be applied: " + e.cause.Error() }
+
+func (e *patchError) Unwrap() error { return e.cause }
+
+// Patch handles partial profile updates. The body is either a JSON Merge Patch
+// or a JSON Patch, applied to the profile's editable document; the result must
+// be a valid document, as for Replace. In a merge patch, null removes a field,
+// which clears bio, image_urls, attributes and tags and fails validation for
+// name and email; null within attributes removes a single attribute.
+func (h *ProfileHandler) Patch(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
+		return
+	}
+
+	patch, err := readPatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid patch", err)
+		return
+	}
+
+	profile, err := h.service.Patch(writeContext(c), id, expectedVersion, func(current *models.Profile) (*models.Profile, error) {
+		req, err := applyPatch(current, patch)
+		if err != nil {
+			return nil, err
+		}
+		return replacementProfile(req), nil
+	})
+	if err != nil {
+		h.handleWriteError(c, "Failed to patch profile", expectedVersion, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
+	c.JSON(http.StatusOK, profile)
+}
+
+// documentPatch applies a patch to a JSON document
+type documentPatch func(doc []byte) ([]byte, error)
+
+// readPatch reads a PATCH body in the format named by its Content-Type
+func readPatch(c *gin.Context) (documentPatch, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPatchRequestSize))
+	if err != nil {
+		return nil, badRequest("Request body could not be read", err)
+	}
+
+	switch c.ContentType() {
+	case mergePatchContentType:
+		if !json.Valid(body) || !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+			return nil, badRequest("Merge patch must be a JSON object", nil)
+		}
+		return func(doc []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(doc, body)
+		}, nil
+	case jsonPatchContentType:
+		operations, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, badRequest("JSON Patch must be an array of operations", err)
+		}
+		return operations.Apply, nil
+	default:
+		return nil, &mediaTypeError{accepted: []string{mergePatchContentType, jsonPatchContentType}}
+	}
+}
+
+// editableFields are the members of a profile's editable document
+var editableFields = map[string]bool{"name": true, "email": true, "bio": true, "image_urls": true, "attributes": true, "tags": true}
+
+// applyPatch applies a patch to the editable document of a profile and returns
+// the validated result
+func applyPatch(current *models.Profile, patch documentPatch) (*models.ReplaceProfileRequest, error) {
+	imageURLs := current.ImageURLs
+	if imageURLs == nil {
+		imageURLs = []string{}
+	}
+	attributes := current.Attributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	tags := current.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	doc, err := json.Marshal(&models.ReplaceProfileRequest{
+		Name:       current.Name,
+		Email:      current.Email,
+		Bio:        current.Bio,
+		ImageURLs:  imageURLs,
+		Attributes: attributes,
+		Tags:       tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := patch(doc)
+	if err != nil {
+		return nil, &patchError{cause: err}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patched, &fields); err != nil {
+		return nil, repository.NewValidationError("", "patched profile must be a JSON object")
+	}
+	for field := range fields {
+		if !editableFields[field] {
+			return nil, repository.NewValidationError(field, "is not an editable field")
+		}
+	}
+
+	var req models.ReplaceProfileRequest
+	if err := json.Unmarshal(patched, &req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, repository.NewValidationError(typeErr.Field, "has the wrong JSON type")
+		}
+		return nil, err
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
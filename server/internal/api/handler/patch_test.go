@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// patchContext returns a context for a PATCH request with the given body
+func patchContext(contentType, body string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPatch, "/api/v1/profiles/1", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestReadPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"merge patch", mergePatchContentType, `{"bio": null}`, 0},
+		{"JSON patch", jsonPatchContentType, `[{"op": "remove", "path": "/bio"}]`, 0},
+		{"merge patch array", mergePatchContentType, `[{"op": "remove", "path": "/bio"}]`, http.StatusBadRequest},
+		{"merge patch not JSON", mergePatchContentType, `{"bio":`, http.StatusBadRequest},
+		{"JSON patch object", jsonPatchContentType, `{"bio": null}`, http.StatusBadRequest},
+		{"plain JSON", "application/json", `{"bio": null}`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := readPatch(patchContext(tt.contentType, tt.body))
+			if tt.want == 0 {
+				require.NoError(t, err)
+				assert.NotNil(t, patch)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.want, problemFor(err).status)
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	current := &models.Profile{
+		ID:         "1",
+		Name:       "Ada",
+		Email:      "ada@example.com",
+		Bio:        "Mathematician",
+		ImageURLs:  []string{"https://example.com/ada.png"},
+		Attributes: map[string]interface{}{"city": "London", "team": "engines"},
+		Tags:       []string{"math"},
+		Version:    3,
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        *models.ReplaceProfileRequest
+		wantStatus  int
+		wantCode    string
+	}{
+		{
+			name:        "merge patch changes a field",
+			contentType: mergePatchContentType,
+			body:        `{"name": "Ada Lovelace"}`,
+			want: &models.ReplaceProfileRequest{
+				Name: "Ada Lovelace", Email: "ada@example.com", Bio: "Mathematician",
+				ImageURLs:  []string{"https://example.com/ada.png"},
+				Attributes: map[string]interface{}{"city": "London", "team": "engines"},
+				Tags:       []string{"math"},
+			},
+		},
+		{
+			name:        "merge patch null clears fields",
+			contentType: mergePatchContentType,
+			body:        `{"bio": null, "tags": null, "attributes": {"team": null}}`,
+			want: &models.ReplaceProfileRequest{
+				Name: "Ada", Email: "ada@example.com",
+				ImageURLs:  []string{"https://example.com/ada.png"},
+				Attributes: map[string]interface{}{"city": "London"},
+			},
+		},
+		{
+			name:        "merge patch null on a required field",
+			contentType: mergePatchContentType,
+			body:        `{"email": null}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "validation_failed",
+		},
+		{
+			name:        "JSON patch",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "test", "path": "/name", "value": "Ada"}, {"op": "add", "path": "/tags/-", "value": "engines"}]`,
+			want: &models.ReplaceProfileRequest{
+				Name: "Ada", Email: "ada@example.com", Bio: "Mathematician",
+				ImageURLs:  []string{"https://example.com/ada.png"},
+				Attributes: map[string]interface{}{"city": "London", "team": "engines"},
+				Tags:       []string{"math", "engines"},
+			},
+		},
+		{
+			name:        "JSON patch failed test",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "test", "path": "/name", "value": "Grace"}, {"op": "replace", "path": "/name", "value": "Grace"}]`,
+			wantStatus:  http.StatusConflict,
+			wantCode:    "patch_conflict",
+		},
+		{
+			name:        "JSON patch missing path",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "remove", "path": "/nickname"}]`,
+			wantStatus:  http.StatusConflict,
+			wantCode:    "patch_conflict",
+		},
+		{
+			name:        "non-editable field",
+			contentType: mergePatchContentType,
+			body:        `{"version": 7}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "validation_failed",
+		},
+		{
+			name:        "wrong type",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "replace", "path": "/tags", "value": "math"}]`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "validation_failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := readPatch(patchContext(tt.contentType, tt.body))
+			require.NoError(t, err)
+
+			req, err := applyPatch(current, patch)
+			if tt.want != nil {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, req)
+				return
+			}
+			require.Error(t, err)
+			kind := problemFor(err)
+			assert.Equal(t, tt.wantStatus, kind.status)
+			assert.Equal(t, tt.wantCode, kind.code)
+		})
+	}
+
+	// The current profile is left unchanged
+	assert.Equal(t, []string{"math"}, current.Tags)
+	assert.Len(t, current.Attributes, 2)
+}
+
+func TestPatchBodyTooLarge(t *testing.T) {
+	body := bytes.Repeat([]byte(" "), maxPatchRequestSize+1)
+	_, err := readPatch(patchContext(mergePatchContentType, string(body)))
+	require.Error(t, err)
+	kind := problemFor(err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, kind.status)
+	detail, _ := describe(err)
+	assert.Equal(t, "Request body must not exceed 1048576 bytes", detail)
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// zipContentType is the media type of data export bundles
+const zipContentType = "application/zip"
+
+// DataExport handles exporting everything held about a profile, whether or not
+// it is soft-deleted, as a zip bundle. The bundle holds data.json, describing
+// the profile, its cached copy, its revision history and its stored events,
+// and the content of every uploaded image still stored under images/.
+func (h *ProfileHandler) DataExport(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	ctx := c.Request.Context()
+	export, err := h.service.ExportData(ctx, id)
+	if err != nil {
+		h.handleError(c, "Failed to export profile data", err)
+		return
+	}
+
+	c.Header("Content-Type", zipContentType)
+	c.Header("Content-Disposition", `attachment; filename="profile-`+id+`.zip"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	bundle := zip.NewWriter(c.Writer)
+	data, err := bundle.Create("data.json")
+	if err == nil {
+		encoder := json.NewEncoder(data)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(export)
+	}
+	if err != nil {
+		abortDataExport(c, id, 0, err)
+		return
+	}
+
+	for i, image := range export.Images {
+		if err := h.writeExportedImage(c, bundle, id, image.ID); err != nil {
+			abortDataExport(c, id, i, err)
+			return
+		}
+	}
+	if err := bundle.Close(); err != nil {
+		abortDataExport(c, id, len(export.Images), err)
+	}
+}
+
+// abortDataExport ends a data export that failed after its response started,
+// leaving the client with a truncated bundle
+func abortDataExport(c *gin.Context, id string, images int, err error) {
+	logger.Log.Error("Data export failed part way",
+		zap.String("id", id),
+		zap.Int("images_written", images),
+		zap.Error(err),
+	)
+	abortResponse(c)
+}
+
+// writeExportedImage copies an uploaded image into a data export bundle
+func (h *ProfileHandler) writeExportedImage(c *gin.Context, bundle *zip.Writer, id, imageID string) error {
+	blob, err := h.service.OpenExportedImage(c.Request.Context(), id, imageID)
+	if errors.Is(err, repository.ErrImageNotFound) {
+		// Deleted since the export was gathered
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	// Images are already compressed
+	w, err := bundle.CreateHeader(&zip.FileHeader{Name: path.Join("images", imageID), Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, blob)
+	return err
+}
+
+// Erase handles requesting the erasure of everything held about a profile,
+// whether or not it is soft-deleted. The erasure runs in the background; it
+// responds 202 with the pending receipt, which can be polled at the Location
+// header, or 200 with the receipt of an erasure that already completed.
+func (h *ProfileHandler) Erase(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	receipt, err := h.service.RequestErasure(writeContext(c), id)
+	if err != nil {
+		h.handleError(c, "Failed to request erasure", err)
+		return
+	}
+
+	if receipt.Completed() {
+		c.JSON(http.StatusOK, receipt)
+		return
+	}
+	c.Header("Location", "/api/v1/profiles/"+id+"/erasure")
+	c.JSON(http.StatusAccepted, receipt)
+}
+
+// Erasure handles retrieving the receipt of a profile's erasure
+func (h *ProfileHandler) Erasure(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	receipt, err := h.service.GetErasure(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, "Failed to get erasure", err)
+		return
+	}
+	c.JSON(http.StatusOK, receipt)
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// problemContentType is the media type of RFC 7807 error responses
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response body
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is a stable, machine-readable error code
+	Code string `json:"code"`
+	// InvalidParams lists the fields that failed validation
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam describes a single field that failed validation
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// problemKind is a category of error with a fixed status, code and title
+type problemKind struct {
+	status int
+	code   string
+	title  string
+}
+
+// Error codes returned in problem responses. Clients may rely on these staying stable.
+var (
+	problemBadRequest         = problemKind{http.StatusBadRequest, "bad_request", "Bad request"}
+	problemValidation         = problemKind{http.StatusUnprocessableEntity, "validation_failed", "Validation failed"}
+	problemUnauthenticated    = problemKind{http.StatusUnauthorized, "unauthenticated", "Authentication required"}
+	problemTenantForbidden    = problemKind{http.StatusForbidden, "tenant_forbidden", "Access to the tenant is not allowed"}
+	problemNotFound           = problemKind{http.StatusNotFound, "profile_not_found", "Profile not found"}
+	problemRevisionNotFound   = problemKind{http.StatusNotFound, "revision_not_found", "Revision not found"}
+	problemAttributeNotFound  = problemKind{http.StatusNotFound, "attribute_not_found", "Attribute not defined"}
+	problemImageNotFound      = problemKind{http.StatusNotFound, "image_not_found", "Image not found"}
+	problemErasureNotFound    = problemKind{http.StatusNotFound, "erasure_not_found", "Erasure not found"}
+	problemDuplicateEmail     = problemKind{http.StatusConflict, "duplicate_email", "Email address is already in use"}
+	problemConflict           = problemKind{http.StatusConflict, "version_conflict", "Profile was modified concurrently"}
+	problemPatchConflict      = problemKind{http.StatusConflict, "patch_conflict", "Patch cannot be applied to the profile"}
+	problemPreconditionFailed = problemKind{http.StatusPreconditionFailed, "precondition_failed", "Profile version does not match If-Match"}
+	problemIdempotencyInUse   = problemKind{http.StatusConflict, "idempotency_key_in_use", "A request with this idempotency key is in progress"}
+	problemIdempotencyReused  = problemKind{http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency key was used for a different request"}
+	problemUnsupportedMedia   = problemKind{http.StatusUnsupportedMediaType, "unsupported_media_type", "Unsupported media type"}
+	problemTooLarge           = problemKind{http.StatusRequestEntityTooLarge, "payload_too_large", "Request body is too large"}
+	problemUnavailable        = problemKind{http.StatusServiceUnavailable, "dependency_unavailable", "A required service is unavailable"}
+	problemInternal           = problemKind{http.StatusInternalServerError, "internal_error", "Internal server error"}
+)
+
+// requestError is a malformed request, such as an unparseable body or header
+type requestError struct {
+	detail string
+	cause  error
+}
+
+// badRequest creates a requestError with a client-safe detail message
+func badRequest(detail string, cause error) error {
+	return &requestError{detail: detail, cause: cause}
+}
+
+func (e *requestError) Error() string { return e.detail }
+
+func (e *requestError) Unwrap() error { return e.cause }
+
+// mediaTypeError is a request body whose Content-Type the endpoint does not accept
+type mediaTypeError struct {
+	accepted []string
+}
+
+func (e *mediaTypeError) Error() string {
+	return "Content-Type must be one of " + strings.Join(e.accepted, ", ")
+}
+
+// bindError classifies an error from binding a request body: field validation
+// failures are validation errors, anything else is a malformed body
+func bindError(err error) error {
+	var fieldErrs validator.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		return err
+	}
+	return badRequest("Request body is not valid JSON for this resource", err)
+}
+
+// problemFor classifies an error
+func problemFor(err error) problemKind {
+	var fieldErrs validator.ValidationErrors
+	var reqErr *requestError
+	var mediaErr *mediaTypeError
+	var patchErr *patchError
+	var sizeErr *http.MaxBytesError
+	switch {
+	// Size limits surface as read errors, which may be wrapped as bad requests
+	case errors.As(err, &sizeErr):
+		return problemTooLarge
+	case errors.As(err, &reqErr), errors.Is(err, tenant.ErrInvalidID):
+		return problemBadRequest
+	case errors.Is(err, tenant.ErrUnauthenticated):
+		return problemUnauthenticated
+	case errors.Is(err, tenant.ErrForbidden):
+		return problemTenantForbidden
+	case errors.As(err, &mediaErr):
+		return problemUnsupportedMedia
+	case errors.As(err, &patchErr):
+		return problemPatchConflict
+	case errors.As(err, &fieldErrs), errors.Is(err, repository.ErrValidation):
+		return problemValidation
+	case errors.Is(err, repository.ErrNotFound):
+		return problemNotFound
+	case errors.Is(err, repository.ErrRevisionNotFound):
+		return problemRevisionNotFound
+	case errors.Is(err, repository.ErrAttributeNotFound):
+		return problemAttributeNotFound
+	case errors.Is(err, repository.ErrImageNotFound):
+		return problemImageNotFound
+	case errors.Is(err, repository.ErrErasureNotFound):
+		return problemErasureNotFound
+	case errors.Is(err, repository.ErrDuplicateEmail):
+		return problemDuplicateEmail
+	case errors.Is(err, repository.ErrConflict):
+		return problemConflict
+	case errors.Is(err, repository.ErrIdempotencyKeyInUse):
+		return problemIdempotencyInUse
+	case errors.Is(err, repository.ErrIdempotencyKeyReused):
+		return problemIdempotencyReused
+	case errors.Is(err, repository.ErrUnavailable):
+		return problemUnavailable
+	default:
+		return problemInternal
+	}
+}
+
+// handleError writes a problem response for err. The message describes the
+// failed operation; it is logged, and used as the detail of server errors so
+// that internal causes are not exposed to clients.
+func (h *ProfileHandler) handleError(c *gin.Context, message string, err error) {
+	h.writeProblem(c, problemFor(err), message, err)
+}
+
+// writeProblem logs err and writes a problem response of the given kind
+func (h *ProfileHandler) writeProblem(c *gin.Context, kind problemKind, message string, err error) {
+	problem := &Problem{
+		Type:     "/problems/" + kind.code,
+		Title:    kind.title,
+		Status:   kind.status,
+		Instance: c.Request.URL.Path,
+		Code:     kind.code,
+	}
+
+	if kind.status >= http.StatusInternalServerError {
+		problem.Detail = message
+		logger.Log.Error(message, zap.Error(err))
+	} else {
+		problem.Detail, problem.InvalidParams = describe(err)
+		logger.Log.Warn(message, zap.Int("status", kind.status), zap.Error(err))
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(kind.status, problem)
+}
+
+// describe returns a client-safe detail message and any invalid fields for a client error
+func describe(err error) (string, []InvalidParam) {
+	var fieldErrs validator.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		params := make([]InvalidParam, 0, len(fieldErrs))
+		for _, fieldErr := range fieldErrs {
+			params = append(params, InvalidParam{
+				Name:   fieldErr.Field(),
+				Reason: "failed the '" + fieldErr.Tag() + "' rule",
+			})
+		}
+		return "The request body has invalid fields", params
+	}
+
+	// Checked first, as size limits surface wrapped in bad requests
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		return "Request body must not exceed " + strconv.FormatInt(sizeErr.Limit, 10) + " bytes", nil
+	}
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.detail, nil
+	}
+
+	var validationErr *repository.ValidationError
+	if errors.As(err, &validationErr) {
+		if validationErr.Field != "" {
+			return validationErr.Error(), []InvalidParam{{Name: validationErr.Field, Reason: validationErr.Message}}
+		}
+		// Validation errors may be wrapped with further detail
+		return err.Error(), nil
+	}
+
+	// Domain errors wrap internal causes, so only the domain error's own text is shown
+	for _, domainErr := range []error{
+		repository.ErrNotFound,
+		repository.ErrRevisionNotFound,
+		repository.ErrAttributeNotFound,
+		repository.ErrImageNotFound,
+		repository.ErrErasureNotFound,
+		repository.ErrDuplicateEmail,
+		repository.ErrConflict,
+		repository.ErrIdempotencyKeyInUse,
+		repository.ErrIdempotencyKeyReused,
+		tenant.ErrInvalidID,
+		tenant.ErrUnauthenticated,
+		tenant.ErrForbidden,
+	} {
+		if errors.Is(err, domainErr) {
+			return domainErr.Error(), nil
+		}
+	}
+
+	if err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
@@ -1,18 +1,34 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
 	"github.com/fernandobarroso/profile-service/internal/api/service"
 	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
 	"github.com/fernandobarroso/profile-service/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+const (
+	// actorHeader identifies who is making a change, for the revision history
+	actorHeader = "X-Actor"
+	// consistencyHeader carries the token that lets a client read its own writes
+	// from replicas. Writes return it; reads that send it back observe those writes.
+	consistencyHeader = "X-Consistency-Token"
+	// attributeParamPrefix marks the query parameters filtering on custom attributes
+	attributeParamPrefix = "attr."
+)
+
 // ProfileHandler handles HTTP requests for profile operations
 type ProfileHandler struct {
 	service *service.ProfileService
@@ -29,22 +45,25 @@ func NewProfileHandler(service *service.ProfileService) *ProfileHandler {
 func (h *ProfileHandler) Create(c *gin.Context) {
 	var req models.CreateProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.handleError(c, http.StatusBadRequest, "Invalid request", err)
+		h.handleError(c, "Invalid request", bindError(err))
 		return
 	}
 
 	profile := &models.Profile{
-		Name:      req.Name,
-		Email:     req.Email,
-		Bio:       req.Bio,
-		ImageURLs: []string{},
+		Name:       req.Name,
+		Email:      req.Email,
+		Bio:        req.Bio,
+		ImageURLs:  []string{},
+		Attributes: req.Attributes,
+		Tags:       req.Tags,
 	}
 
-	if err := h.service.Create(c.Request.Context(), profile); err != nil {
-		h.handleError(c, http.StatusInternalServerError, "Failed to create profile", err)
+	if err := h.service.Create(writeContext(c), profile); err != nil {
+		h.handleError(c, "Failed to create profile", err)
 		return
 	}
 
+	h.setConsistencyToken(c)
 	c.JSON(http.StatusCreated, profile)
 }
 
@@ -52,82 +71,331 @@ func (h *ProfileHandler) Create(c *gin.Context) {
 func (h *ProfileHandler) GetProfile(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
 		return
 	}
 
-	profile, err := h.service.Get(c.Request.Context(), id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get profile"})
+	if asOf := c.Query("as_of"); asOf != "" {
+		at, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			h.handleError(c, "Invalid as_of", repository.NewValidationError("as_of", "must be an RFC 3339 timestamp"))
+			return
+		}
+
+		profile, err := h.service.GetAsOf(readContext(c), id, at)
+		if err != nil {
+			h.handleError(c, "Failed to get profile history", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, profile)
 		return
 	}
 
-	if profile == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+	profile, err := h.service.Get(readContext(c), id)
+	if err != nil {
+		h.handleError(c, "Failed to get profile", err)
 		return
 	}
 
+	setETag(c, profile.Profile.Version)
 	c.JSON(http.StatusOK, profile)
 }
 
-// Update handles profile updates
-func (h *ProfileHandler) Update(c *gin.Context) {
+// Replace handles replacing a profile. The body is the complete editable
+// document: optional fields it omits are cleared.
+func (h *ProfileHandler) Replace(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		h.handleError(c, http.StatusBadRequest, "Missing profile ID", nil)
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
 		return
 	}
 
-	var profile models.Profile
-	if err := c.ShouldBindJSON(&profile); err != nil {
-		h.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	var req models.ReplaceProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleError(c, "Invalid request", bindError(err))
 		return
 	}
 
-	profile.ID = id
-	if err := h.service.Update(c.Request.Context(), id, &profile); err != nil {
-		h.handleError(c, http.StatusInternalServerError, "Failed to update profile", err)
+	profile := replacementProfile(&req)
+	if err := h.service.Replace(writeContext(c), id, profile, expectedVersion); err != nil {
+		h.handleWriteError(c, "Failed to replace profile", expectedVersion, err)
 		return
 	}
 
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
 	c.JSON(http.StatusOK, profile)
 }
 
+// replacementProfile builds the profile written by a replace request
+func replacementProfile(req *models.ReplaceProfileRequest) *models.Profile {
+	imageURLs := req.ImageURLs
+	if imageURLs == nil {
+		imageURLs = []string{}
+	}
+	attributes := req.Attributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	return &models.Profile{
+		Name:       req.Name,
+		Email:      req.Email,
+		Bio:        req.Bio,
+		ImageURLs:  imageURLs,
+		Attributes: attributes,
+		Tags:       req.Tags,
+	}
+}
+
 // Delete handles profile deletion
 func (h *ProfileHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		h.handleError(c, http.StatusBadRequest, "Missing profile ID", nil)
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
 		return
 	}
 
-	if err := h.service.Delete(c.Request.Context(), id); err != nil {
-		h.handleError(c, http.StatusInternalServerError, "Failed to delete profile", err)
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
 		return
 	}
 
+	if err := h.service.Delete(writeContext(c), id, expectedVersion); err != nil {
+		h.handleWriteError(c, "Failed to delete profile", expectedVersion, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
 	c.Status(http.StatusNoContent)
 }
 
-// List handles retrieving all profiles
+// List handles retrieving a page of profiles
 func (h *ProfileHandler) List(c *gin.Context) {
-	profiles, err := h.service.List(c.Request.Context())
+	opts, err := parseListOptions(c)
+	if err != nil {
+		h.handleError(c, "Invalid list options", err)
+		return
+	}
+
+	result, err := h.service.List(readContext(c), opts)
+	if err != nil {
+		h.handleError(c, "Failed to list profiles", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Search handles full-text search over profile names and bios
+func (h *ProfileHandler) Search(c *gin.Context) {
+	opts := repository.SearchOptions{
+		Query:  c.Query("q"),
+		Cursor: c.Query("cursor"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 {
+			h.handleError(c, "Invalid search options", repository.NewValidationError("limit", "must be a positive integer"))
+			return
+		}
+		opts.Limit = value
+	}
+
+	result, err := h.service.Search(readContext(c), opts)
+	if err != nil {
+		h.handleError(c, "Failed to search profiles", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// parseListOptions reads listing filters, sorting and pagination from the query string
+func parseListOptions(c *gin.Context) (repository.ListOptions, error) {
+	opts := repository.ListOptions{
+		Cursor:      c.Query("cursor"),
+		EmailDomain: c.Query("email_domain"),
+		NamePrefix:  c.Query("name_prefix"),
+		SortBy:      c.Query("sort"),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 {
+			return opts, fmt.Errorf("%w: limit must be a positive integer", repository.ErrInvalidListOptions)
+		}
+		opts.Limit = value
+	}
+
+	switch order := c.Query("order"); order {
+	case "", "desc":
+	case "asc":
+		opts.Ascending = true
+	default:
+		return opts, fmt.Errorf("%w: order must be asc or desc", repository.ErrInvalidListOptions)
+	}
+
+	for param, dest := range map[string]*time.Time{
+		"created_after":  &opts.CreatedAfter,
+		"created_before": &opts.CreatedBefore,
+	} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return opts, fmt.Errorf("%w: %s must be an RFC 3339 timestamp", repository.ErrInvalidListOptions, param)
+			}
+			*dest = t
+		}
+	}
+
+	// tags=a,b filters on tags: profiles must carry all of them, or with
+	// tag_mode=or any of them
+	if tags := c.Query("tags"); tags != "" {
+		opts.Tags = strings.Split(tags, ",")
+	}
+	switch mode := c.Query("tag_mode"); mode {
+	case "", "and":
+	case "or":
+		opts.AnyTag = true
+	default:
+		return opts, fmt.Errorf("%w: tag_mode must be and or or", repository.ErrInvalidListOptions)
+	}
+
+	// attr.<name>=<value> filters on a custom attribute; the service types the
+	// value according to the attribute's definition
+	for param, values := range c.Request.URL.Query() {
+		name, ok := strings.CutPrefix(param, attributeParamPrefix)
+		if !ok {
+			continue
+		}
+		if len(values) > 1 {
+			return opts, fmt.Errorf("%w: %s may only be given once", repository.ErrInvalidListOptions, param)
+		}
+		if opts.Attributes == nil {
+			opts.Attributes = make(map[string]interface{})
+		}
+		opts.Attributes[name] = values[0]
+	}
+
+	return opts, nil
+}
+
+// Restore handles restoring a soft-deleted profile
+func (h *ProfileHandler) Restore(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	profile, err := h.service.Restore(writeContext(c), id)
+	if err != nil {
+		h.handleError(c, "Failed to restore profile", err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
+	c.JSON(http.StatusOK, profile)
+}
+
+// History handles retrieving a page of a profile's revisions
+func (h *ProfileHandler) History(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	var opts repository.HistoryOptions
+	for param, dest := range map[string]*int{
+		"limit":  &opts.Limit,
+		"before": &opts.Before,
+	} {
+		if value := c.Query(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				h.handleError(c, "Invalid history options", repository.NewValidationError(param, "must be a positive integer"))
+				return
+			}
+			*dest = n
+		}
+	}
+
+	result, err := h.service.History(readContext(c), id, opts)
+	if err != nil {
+		h.handleError(c, "Failed to get profile history", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Revert handles restoring a profile to the state recorded in one of its revisions
+func (h *ProfileHandler) Revert(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		h.handleError(c, "Invalid revision", badRequest("Revision must be a positive integer", err))
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
+		return
+	}
+
+	profile, err := h.service.Revert(writeContext(c), id, revision, expectedVersion)
+	if err != nil {
+		h.handleWriteError(c, "Failed to revert profile", expectedVersion, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
+	c.JSON(http.StatusOK, profile)
+}
+
+// ListDeleted handles retrieving a page of soft-deleted profiles
+func (h *ProfileHandler) ListDeleted(c *gin.Context) {
+	opts, err := parseListOptions(c)
 	if err != nil {
-		h.handleError(c, http.StatusInternalServerError, "Failed to list profiles", err)
+		h.handleError(c, "Invalid list options", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, profiles)
+	result, err := h.service.ListDeleted(readContext(c), opts)
+	if err != nil {
+		h.handleError(c, "Failed to list deleted profiles", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
 }
 
 // GenerateRandom handles generating random profiles
 func (h *ProfileHandler) GenerateRandom(c *gin.Context) {
 	profile := utils.GenerateRandomProfile()
-	if err := h.service.Create(c.Request.Context(), profile); err != nil {
-		h.handleError(c, http.StatusInternalServerError, "Failed to create random profile", err)
+	if err := h.service.Create(writeContext(c), profile); err != nil {
+		h.handleError(c, "Failed to create random profile", err)
 		return
 	}
 
+	h.setConsistencyToken(c)
 	c.JSON(http.StatusCreated, profile)
 }
 
@@ -140,19 +408,43 @@ func (h *ProfileHandler) ProcessDelayedTask(c *gin.Context) {
 	}
 
 	if err := h.service.ProcessDelayedTask(c.Request.Context(), task); err != nil {
-		h.handleError(c, http.StatusInternalServerError, "Failed to process delayed task", err)
+		h.handleError(c, "Failed to process delayed task", err)
 		return
 	}
 
 	c.JSON(http.StatusAccepted, gin.H{"taskID": taskID})
 }
 
-// handleError handles error responses
-func (h *ProfileHandler) handleError(c *gin.Context, status int, message string, err error) {
+// writeContext returns the request context, identifying the actor making the change
+func writeContext(c *gin.Context) context.Context {
+	return service.WithActor(c.Request.Context(), c.GetHeader(actorHeader))
+}
+
+// readContext returns the request context, carrying the client's consistency token
+func readContext(c *gin.Context) context.Context {
+	return repository.WithConsistencyToken(c.Request.Context(), c.GetHeader(consistencyHeader))
+}
+
+// setConsistencyToken sets the consistency token response header after a write.
+// Failing to get one only costs the client read-your-writes, so it is not an error.
+func (h *ProfileHandler) setConsistencyToken(c *gin.Context) {
+	token, err := h.service.ConsistencyToken(c.Request.Context())
 	if err != nil {
-		logger.Log.Error(message,
-			zap.Error(err),
-		)
+		logger.Log.Warn("Failed to get consistency token", zap.Error(err))
+		return
+	}
+	if token != "" {
+		c.Header(consistencyHeader, token)
+	}
+}
+
+// handleWriteError writes the response for a failed conditional write. A version
+// conflict is a failed precondition when the client sent If-Match, and a
+// concurrent modification otherwise.
+func (h *ProfileHandler) handleWriteError(c *gin.Context, message string, expectedVersion int, err error) {
+	if expectedVersion != 0 && errors.Is(err, repository.ErrConflict) {
+		h.writeProblem(c, problemPreconditionFailed, message, err)
+		return
 	}
-	c.JSON(status, gin.H{"error": message})
+	h.handleError(c, message, err)
 }
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultFacetLimit is how many tags a facet count returns by default
+	defaultFacetLimit = 20
+	// maxFacetLimit caps how many tags a facet count may return
+	maxFacetLimit = 100
+)
+
+// AddTags handles adding tags to a profile. Tags are normalized, and tags the
+// profile already carries are ignored.
+func (h *ProfileHandler) AddTags(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
+		return
+	}
+
+	var req models.TagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleError(c, "Invalid request", bindError(err))
+		return
+	}
+
+	profile, err := h.service.AddTags(writeContext(c), id, req.Tags, expectedVersion)
+	if err != nil {
+		h.handleWriteError(c, "Failed to tag profile", expectedVersion, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
+	c.JSON(http.StatusOK, profile)
+}
+
+// RemoveTag handles removing a tag from a profile. Removing a tag the profile
+// does not carry leaves it unchanged.
+func (h *ProfileHandler) RemoveTag(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.handleError(c, "Missing profile ID", badRequest("ID is required", nil))
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		h.handleError(c, "Invalid If-Match header", badRequest("If-Match must be a profile ETag or *", err))
+		return
+	}
+
+	profile, err := h.service.RemoveTag(writeContext(c), id, c.Param("tag"), expectedVersion)
+	if err != nil {
+		h.handleWriteError(c, "Failed to untag profile", expectedVersion, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+	setETag(c, profile.Version)
+	c.JSON(http.StatusOK, profile)
+}
+
+// Facets handles counting the tags of the profiles matching the listing
+// filters. limit caps the number of tags returned, most common first.
+func (h *ProfileHandler) Facets(c *gin.Context) {
+	opts, err := parseListOptions(c)
+	if err != nil {
+		h.handleError(c, "Invalid facet options", err)
+		return
+	}
+
+	limit := defaultFacetLimit
+	if opts.Limit != 0 {
+		if opts.Limit > maxFacetLimit {
+			h.handleError(c, "Invalid facet options", repository.NewValidationError("limit", "must be at most 100"))
+			return
+		}
+		limit = opts.Limit
+	}
+
+	counts, err := h.service.TagFacets(readContext(c), opts, limit)
+	if err != nil {
+		h.handleError(c, "Failed to count profile tags", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": counts})
+}
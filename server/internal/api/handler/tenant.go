@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// tenantHeader names the tenant a request is made for
+	tenantHeader = "X-Tenant-ID"
+	// apiKeyHeader carries an API key. A bearer token in Authorization is
+	// accepted as well.
+	apiKeyHeader = "X-API-Key"
+)
+
+// TenantMiddleware resolves the tenant of each request from its API key and
+// X-Tenant-ID header, and makes the request context carry it. Requests whose
+// tenant cannot be resolved are rejected before reaching a handler.
+func (h *ProfileHandler) TenantMiddleware(resolver *tenant.Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := resolver.Resolve(apiKey(c), c.GetHeader(tenantHeader))
+		if err != nil {
+			h.handleError(c, "Failed to resolve tenant", err)
+			return
+		}
+		c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// apiKey returns the API key a request presented, if any
+func apiKey(c *gin.Context) string {
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
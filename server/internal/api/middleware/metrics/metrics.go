@@ -39,6 +39,30 @@ var (
 		},
 	)
 
+	CacheTierHits = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_tier_hits_total",
+			Help: "Total number of cache hits by the tier that served them",
+		},
+		[]string{"tier"},
+	)
+
+	CacheMissesCoalesced = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_misses_coalesced_total",
+			Help: "Total number of cache misses served by a load of the same profile by this pod (local) or another (remote)",
+		},
+		[]string{"scope"},
+	)
+
+	CacheMissLoadWaiters = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "cache_miss_load_waiters",
+			Help:    "Number of cache misses waiting on each profile load by this pod",
+			Buckets: []float64{0, 1, 2, 5, 10, 25, 50, 100},
+		},
+	)
+
 	// Database metrics
 	DbOperationsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -57,6 +81,30 @@ var (
 		[]string{"operation"},
 	)
 
+	DbReadsRoutedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_reads_routed_total",
+			Help: "Total number of reads routed to the primary or a replica",
+		},
+		[]string{"target"},
+	)
+
+	DbReplicaHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_replica_healthy",
+			Help: "Whether a read replica is serving reads (1) or not (0)",
+		},
+		[]string{"replica"},
+	)
+
+	DbReplicaLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_replica_lag_seconds",
+			Help: "Replication lag of a read replica in seconds",
+		},
+		[]string{"replica"},
+	)
+
 	// Queue metrics (for future use)
 	QueueOperationsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -74,4 +122,27 @@ var (
 		},
 		[]string{"operation"},
 	)
+
+	// Outbox metrics
+	OutboxPendingMessages = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_pending_messages",
+			Help: "Number of outbox messages waiting to be relayed",
+		},
+	)
+
+	OutboxOldestPendingAge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_oldest_pending_age_seconds",
+			Help: "Age in seconds of the oldest outbox message waiting to be relayed",
+		},
+	)
+
+	OutboxRelayedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "outbox_relayed_total",
+			Help: "Total number of outbox message relay attempts",
+		},
+		[]string{"status"},
+	)
 )
@@ -2,11 +2,15 @@ package router
 
 import (
 	"github.com/fernandobarroso/profile-service/internal/api/handler"
+	"github.com/fernandobarroso/profile-service/internal/api/service"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRouter configures and returns a new Gin router
-func SetupRouter(profileHandler *handler.ProfileHandler) *gin.Engine {
+// SetupRouter configures and returns a new Gin router. Every API route runs for
+// the tenant the resolver finds for the request, and the creating POST routes
+// honour Idempotency-Key headers.
+func SetupRouter(profileHandler *handler.ProfileHandler, resolver *tenant.Resolver, idempotency *service.IdempotencyService) *gin.Engine {
 	router := gin.Default()
 
 	// Health check endpoint
@@ -16,20 +20,54 @@ func SetupRouter(profileHandler *handler.ProfileHandler) *gin.Engine {
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
+	v1.Use(profileHandler.TenantMiddleware(resolver))
+	idempotent := profileHandler.IdempotencyMiddleware(idempotency)
 	{
 		profiles := v1.Group("/profiles")
 		{
-			profiles.POST("", profileHandler.Create)
+			profiles.POST("", idempotent, profileHandler.Create)
 			profiles.GET("", profileHandler.List)
+			profiles.POST("/batch", profileHandler.CreateBatch)
+			profiles.GET("/search", profileHandler.Search)
+			profiles.GET("/export", profileHandler.Export)
+			profiles.POST("/import", profileHandler.Import)
+			profiles.GET("/facets", profileHandler.Facets)
 			profiles.GET("/:id", profileHandler.GetProfile)
-			profiles.PUT("/:id", profileHandler.Update)
+			profiles.PUT("/:id", profileHandler.Replace)
+			profiles.PATCH("/:id", profileHandler.Patch)
 			profiles.DELETE("/:id", profileHandler.Delete)
-			profiles.POST("/random", profileHandler.GenerateRandom)
+			profiles.POST("/:id/restore", profileHandler.Restore)
+			profiles.GET("/:id/history", profileHandler.History)
+			profiles.GET("/:id/data-export", profileHandler.DataExport)
+			profiles.POST("/:id/erase", profileHandler.Erase)
+			profiles.GET("/:id/erasure", profileHandler.Erasure)
+			profiles.POST("/:id/revert/:revision", profileHandler.Revert)
+			profiles.POST("/:id/tags", profileHandler.AddTags)
+			profiles.DELETE("/:id/tags/:tag", profileHandler.RemoveTag)
+			profiles.POST("/:id/images", profileHandler.UploadImage)
+			profiles.GET("/:id/images/:imageID", profileHandler.GetImage)
+			profiles.DELETE("/:id/images/:imageID", profileHandler.DeleteImage)
+			profiles.POST("/:id/follow/:target", profileHandler.Follow)
+			profiles.DELETE("/:id/follow/:target", profileHandler.Unfollow)
+			profiles.GET("/:id/follow/:target", profileHandler.Relationship)
+			profiles.GET("/:id/followers", profileHandler.Followers)
+			profiles.GET("/:id/following", profileHandler.Following)
+			profiles.GET("/:id/mutuals", profileHandler.Mutuals)
+			profiles.GET("/:id/follow-counts", profileHandler.FollowCounts)
+			profiles.POST("/random", idempotent, profileHandler.GenerateRandom)
+		}
+
+		admin := v1.Group("/admin")
+		{
+			admin.GET("/profiles/deleted", profileHandler.ListDeleted)
+			admin.GET("/attributes", profileHandler.ListAttributes)
+			admin.PUT("/attributes/:name", profileHandler.PutAttribute)
+			admin.DELETE("/attributes/:name", profileHandler.DeleteAttribute)
 		}
 
 		tasks := v1.Group("/tasks")
 		{
-			tasks.POST("/delayed", profileHandler.ProcessDelayedTask)
+			tasks.POST("/delayed", idempotent, profileHandler.ProcessDelayedTask)
 		}
 	}
 
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// ListAttributes returns the definitions of the tenant's custom attributes
+func (s *ProfileService) ListAttributes(ctx context.Context) ([]*models.AttributeDefinition, error) {
+	defs, err := s.schemas.ListAttributeDefinitions(ctx)
+	if err != nil {
+		logger.Log.Error("Failed to list attribute definitions",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	return defs, nil
+}
+
+// PutAttribute defines or redefines a custom attribute. Profiles already
+// stored are not checked against the new definition; they must satisfy it the
+// next time they are written.
+func (s *ProfileService) PutAttribute(ctx context.Context, def *models.AttributeDefinition) error {
+	start := time.Now()
+
+	if !models.ValidAttributeName(def.Name) {
+		return repository.NewValidationError("name", "must be lowercase letters, digits and underscores, starting with a letter")
+	}
+	if def.Type != models.AttributeString {
+		if len(def.Enum) > 0 {
+			return repository.NewValidationError("enum", "applies to string attributes only")
+		}
+		if def.MaxLength > 0 {
+			return repository.NewValidationError("max_length", "applies to string attributes only")
+		}
+	}
+	for _, value := range def.Enum {
+		if def.MaxLength > 0 && utf8.RuneCountInString(value) > def.MaxLength {
+			return repository.NewValidationError("enum", fmt.Sprintf("value %q is longer than max_length", value))
+		}
+	}
+
+	if err := s.schemas.PutAttributeDefinition(ctx, def); err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("put_attribute", "error").Inc()
+		logger.Log.Error("Failed to store attribute definition",
+			zap.String("name", def.Name),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("put_attribute", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("put_attribute").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// DeleteAttribute removes the definition of a custom attribute. Profiles keep
+// their stored values, but may not be written again while they carry it.
+func (s *ProfileService) DeleteAttribute(ctx context.Context, name string) error {
+	if err := s.schemas.DeleteAttributeDefinition(ctx, name); err != nil {
+		if !errors.Is(err, repository.ErrAttributeNotFound) {
+			logger.Log.Error("Failed to delete attribute definition",
+				zap.String("name", name),
+				zap.Error(err),
+			)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkAttributes validates the custom attributes of a profile about to be
+// written against the tenant's schema
+func (s *ProfileService) checkAttributes(ctx context.Context, profile *models.Profile) error {
+	defs, err := s.schemas.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+	return validateAttributes(defs, profile.Attributes)
+}
+
+// validateAttributes checks attributes against a schema: every attribute must
+// be defined, every required one present, and each value of its attribute's
+// type and within its constraints
+func validateAttributes(defs []*models.AttributeDefinition, attributes map[string]interface{}) error {
+	byName := make(map[string]*models.AttributeDefinition, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+		if _, ok := attributes[def.Name]; def.Required && !ok {
+			return repository.NewValidationError("attributes."+def.Name, "is required")
+		}
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def, ok := byName[name]
+		if !ok {
+			return repository.NewValidationError("attributes."+name, "is not a defined attribute")
+		}
+		if msg := checkAttributeValue(def, attributes[name]); msg != "" {
+			return repository.NewValidationError("attributes."+name, msg)
+		}
+	}
+	return nil
+}
+
+// checkAttributeValue returns why a value does not satisfy its attribute's
+// definition, or "" if it does
+func checkAttributeValue(def *models.AttributeDefinition, value interface{}) string {
+	switch def.Type {
+	case models.AttributeString:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if def.MaxLength > 0 && utf8.RuneCountInString(s) > def.MaxLength {
+			return fmt.Sprintf("must be at most %d characters", def.MaxLength)
+		}
+		if len(def.Enum) > 0 && !containsString(def.Enum, s) {
+			return fmt.Sprintf("must be one of %v", def.Enum)
+		}
+	case models.AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return "must be a number"
+		}
+	case models.AttributeInteger:
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			return "must be an integer"
+		}
+	case models.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+	}
+	return ""
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// typeAttributeFilters converts attribute filter values, which arrive as query
+// strings, to the types of their attributes, so that they compare equal to the
+// stored values
+func (s *ProfileService) typeAttributeFilters(ctx context.Context, opts *repository.ListOptions) error {
+	if len(opts.Attributes) == 0 {
+		return nil
+	}
+
+	defs, err := s.schemas.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+	types := make(map[string]string, len(defs))
+	for _, def := range defs {
+		types[def.Name] = def.Type
+	}
+
+	typed := make(map[string]interface{}, len(opts.Attributes))
+	for name, value := range opts.Attributes {
+		raw, ok := value.(string)
+		if !ok {
+			typed[name] = value
+			continue
+		}
+
+		field := "attr." + name
+		switch types[name] {
+		case "":
+			return repository.NewValidationError(field, "is not a defined attribute")
+		case models.AttributeString:
+			typed[name] = raw
+		case models.AttributeNumber, models.AttributeInteger:
+			n, err := strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return repository.NewValidationError(field, "must be a number")
+			}
+			typed[name] = n
+		case models.AttributeBoolean:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return repository.NewValidationError(field, "must be true or false")
+			}
+			typed[name] = b
+		}
+	}
+	opts.Attributes = typed
+	return nil
+}
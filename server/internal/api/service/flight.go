@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// errLoadAborted is what calls waiting on a load get if it panicked
+var errLoadAborted = errors.New("profile load aborted")
+
+// flightGroup coalesces concurrent profile loads sharing a key into one
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a load in progress. Its result is set before done is closed.
+type flight struct {
+	done     chan struct{}
+	response *models.ProfileResponse
+	err      error
+	// waiters counts the calls waiting on the load
+	waiters int
+}
+
+// do calls load, unless a call with the same key is already loading, in which
+// case it waits for that call's result; shared reports whether it did. load
+// is not canceled with ctx, since other calls may be waiting on it, but
+// waiting calls give up when their own ctx is done.
+func (g *flightGroup) do(ctx context.Context, key string, load func(context.Context) (*models.ProfileResponse, error)) (response *models.ProfileResponse, shared bool, err error) {
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		f.waiters++
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+			if f.response == nil {
+				return nil, true, f.err
+			}
+			// Each caller gets its own copy of the profile to change
+			copied := *f.response
+			if copied.Profile != nil {
+				copied.Profile = copied.Profile.Copy()
+			}
+			return &copied, true, f.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{}), err: errLoadAborted}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.flights, key)
+		waiters := f.waiters
+		g.mu.Unlock()
+		close(f.done)
+		metrics.CacheMissLoadWaiters.Observe(float64(waiters))
+	}()
+	f.response, f.err = load(context.WithoutCancel(ctx))
+	return f.response, false, f.err
+}
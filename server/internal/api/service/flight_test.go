@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waiters returns how many calls wait on the load of key
+func waiters(group *flightGroup, key string) int {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	if f, ok := group.flights[key]; ok {
+		return f.waiters
+	}
+	return 0
+}
+
+func TestFlightGroupCoalescesLoads(t *testing.T) {
+	var group flightGroup
+	var loads int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*models.ProfileResponse, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return &models.ProfileResponse{Profile: &models.Profile{ID: "1"}, Source: "database"}, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	var sharedCount int32
+	responses := make([]*models.ProfileResponse, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, shared, err := group.do(context.Background(), "acme:1", load)
+			assert.NoError(t, err)
+			responses[i] = response
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}(i)
+	}
+
+	// Let every caller join the load before it completes
+	require.Eventually(t, func() bool {
+		return waiters(&group, "acme:1") == callers-1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, loads)
+	assert.EqualValues(t, callers-1, sharedCount)
+	for _, response := range responses {
+		require.NotNil(t, response)
+		assert.Equal(t, "1", response.Profile.ID)
+	}
+	assert.Empty(t, group.flights)
+
+	// Each caller can change its profile without the others seeing it
+	for i, response := range responses {
+		response.Profile.Tags = append(response.Profile.Tags, "changed")
+		response.Profile.Name = fmt.Sprint(i)
+	}
+	for i, response := range responses {
+		assert.Equal(t, fmt.Sprint(i), response.Profile.Name)
+		assert.Equal(t, []string{"changed"}, response.Profile.Tags)
+	}
+
+	// Loads that finished are not reused
+	_, shared, err := group.do(context.Background(), "acme:1", load)
+	require.NoError(t, err)
+	assert.False(t, shared)
+	assert.EqualValues(t, 2, loads)
+}
+
+func TestFlightGroupWaitersGiveUp(t *testing.T) {
+	var group flightGroup
+	release := make(chan struct{})
+	started := make(chan struct{})
+	errLoad := errors.New("load failed")
+
+	done := make(chan error)
+	go func() {
+		_, _, err := group.do(context.Background(), "acme:1", func(ctx context.Context) (*models.ProfileResponse, error) {
+			close(started)
+			<-release
+			return nil, errLoad
+		})
+		done <- err
+	}()
+	<-started
+
+	// A waiter whose context ends stops waiting; the load goes on
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := group.do(ctx, "acme:1", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	assert.ErrorIs(t, <-done, errLoad)
+}
+
+func TestFlightGroupSurvivesPanics(t *testing.T) {
+	var group flightGroup
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _, _ = group.do(context.Background(), "acme:1", func(ctx context.Context) (*models.ProfileResponse, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waited := make(chan error)
+	go func() {
+		_, _, err := group.do(context.Background(), "acme:1", nil)
+		waited <- err
+	}()
+	require.Eventually(t, func() bool {
+		return waiters(&group, "acme:1") == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+	assert.ErrorIs(t, <-waited, errLoadAborted)
+}
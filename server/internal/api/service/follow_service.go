@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/queue"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+const (
+	// followEvent is the type of the event published when a profile follows another
+	followEvent = "follow"
+	// unfollowEvent is the type of the event published when a follow is removed
+	unfollowEvent = "unfollow"
+	// followCountsTTL bounds how long cached follow counts are served. Counts
+	// loaded while an event is still in flight are off by its delta until then.
+	followCountsTTL = 10 * time.Minute
+	// followCounterGroup names the consumers of the copies of profile events
+	// that keep follow counts current
+	followCounterGroup = "follow-counter"
+)
+
+// Follow makes a profile follow another and returns the follow. It reports
+// false if the profile already followed the target, in which case the follow
+// is returned unchanged.
+func (s *ProfileService) Follow(ctx context.Context, followerID, targetID string) (*models.Follow, bool, error) {
+	start := time.Now()
+	if followerID == targetID {
+		return nil, false, repository.NewValidationError("target", "a profile cannot follow itself")
+	}
+
+	follow := &models.Follow{FollowerID: followerID, TargetID: targetID, CreatedAt: time.Now()}
+	var created bool
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		for _, id := range []string{followerID, targetID} {
+			if _, err := s.repository.Get(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if created, err = s.follows.Follow(ctx, follow); err != nil || !created {
+			return err
+		}
+		return s.publishEvent(ctx, followEvent, targetID, follow)
+	})
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("follow", "error").Inc()
+		logger.Log.Error("Failed to follow profile",
+			zap.String("follower_id", followerID),
+			zap.String("target_id", targetID),
+			zap.Error(err),
+		)
+		return nil, false, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("follow", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("follow").Observe(time.Since(start).Seconds())
+	return follow, created, nil
+}
+
+// Unfollow removes the follow of a profile on another. Removing a follow that
+// does not exist is not an error.
+func (s *ProfileService) Unfollow(ctx context.Context, followerID, targetID string) error {
+	start := time.Now()
+
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		removed, err := s.follows.Unfollow(ctx, followerID, targetID)
+		if err != nil || !removed {
+			return err
+		}
+		follow := &models.Follow{FollowerID: followerID, TargetID: targetID, CreatedAt: time.Now()}
+		return s.publishEvent(ctx, unfollowEvent, targetID, follow)
+	})
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("unfollow", "error").Inc()
+		logger.Log.Error("Failed to unfollow profile",
+			zap.String("follower_id", followerID),
+			zap.String("target_id", targetID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("unfollow", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("unfollow").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// Followers returns a page of the follows on a profile, most recent first
+func (s *ProfileService) Followers(ctx context.Context, id string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return s.listFollows(ctx, id, opts, s.follows.ListFollowers)
+}
+
+// Following returns a page of the follows a profile made, most recent first
+func (s *ProfileService) Following(ctx context.Context, id string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return s.listFollows(ctx, id, opts, s.follows.ListFollowing)
+}
+
+// MutualFollows returns a page of the follows a profile made on profiles that
+// follow it back, most recent first
+func (s *ProfileService) MutualFollows(ctx context.Context, id string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return s.listFollows(ctx, id, opts, s.follows.ListMutualFollows)
+}
+
+// listFollows lists the follows of an existing profile with list
+func (s *ProfileService) listFollows(ctx context.Context, id string, opts repository.FollowListOptions, list func(ctx context.Context, id string, opts repository.FollowListOptions) (*repository.FollowListResult, error)) (*repository.FollowListResult, error) {
+	start := time.Now()
+
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	result, err := list(ctx, id, opts)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("list_follows", "error").Inc()
+		logger.Log.Error("Failed to list follows",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("list_follows", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("list_follows").Observe(time.Since(start).Seconds())
+	return result, nil
+}
+
+// Relationship describes how two profiles follow each other
+func (s *ProfileService) Relationship(ctx context.Context, id, otherID string) (*models.FollowRelationship, error) {
+	for _, profileID := range []string{id, otherID} {
+		if _, err := s.Get(ctx, profileID); err != nil {
+			return nil, err
+		}
+	}
+
+	following, err := s.follows.IsFollowing(ctx, id, otherID)
+	if err != nil {
+		return nil, err
+	}
+	followedBy, err := s.follows.IsFollowing(ctx, otherID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.FollowRelationship{
+		Following:  following,
+		FollowedBy: followedBy,
+		Mutual:     following && followedBy,
+	}, nil
+}
+
+// FollowCounts returns how many profiles follow a profile and how many it
+// follows. Counts are served from the cache, which follow events keep current.
+func (s *ProfileService) FollowCounts(ctx context.Context, id string) (*models.FollowCounts, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	counts, err := s.counts.GetFollowCounts(ctx, id)
+	if err == nil && counts != nil {
+		return counts, nil
+	}
+	if err != nil {
+		logger.Log.Warn("Failed to read cached follow counts",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+
+	if counts, err = s.follows.CountFollows(ctx, id); err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("count_follows", "error").Inc()
+		return nil, err
+	}
+	metrics.DbOperationsTotal.WithLabelValues("count_follows", "success").Inc()
+
+	if err := s.counts.SetFollowCounts(ctx, id, counts, followCountsTTL); err != nil {
+		logger.Log.Error("Failed to cache follow counts",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+	return counts, nil
+}
+
+// RunFollowCounter keeps cached follow counts current by consuming follow and
+// unfollow events from its own copy of the events channel, leaving the events
+// queue to its consumers. It blocks until ctx is cancelled or the subscription
+// fails.
+func (s *ProfileService) RunFollowCounter(ctx context.Context, q queue.Queue) {
+	err := q.SubscribeCopies(ctx, EventsChannel, followCounterGroup, s.applyFollowEvent)
+	if err != nil && ctx.Err() == nil {
+		logger.Log.Error("Follow counter stopped", zap.Error(err))
+	}
+}
+
+// applyFollowEvent adjusts the cached counts of the profiles of a follow or
+// unfollow event. Other events are ignored.
+func (s *ProfileService) applyFollowEvent(message *queue.Message) error {
+	var delta int
+	switch message.Type {
+	case followEvent:
+		delta = 1
+	case unfollowEvent:
+		delta = -1
+	default:
+		return nil
+	}
+
+	var event struct {
+		ID       string        `json:"id"`
+		TenantID string        `json:"tenant_id"`
+		Data     models.Follow `json:"data"`
+	}
+	if err := json.Unmarshal(message.Data, &event); err != nil {
+		return err
+	}
+
+	ctx := tenant.WithID(context.Background(), event.TenantID)
+	return s.counts.AdjustFollowCounts(ctx, event.ID, &event.Data, delta)
+}
+
+// removeFollows removes every follow made by or on a purged or erased profile,
+// publishing an unfollow event for each, and returns how many it removed. It
+// must be called in a transaction.
+func (s *ProfileService) removeFollows(ctx context.Context, id string) (int, error) {
+	removed, err := s.follows.RemoveFollows(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	for _, follow := range removed {
+		if err := s.publishEvent(ctx, unfollowEvent, follow.TargetID, follow); err != nil {
+			return 0, err
+		}
+	}
+	return len(removed), nil
+}
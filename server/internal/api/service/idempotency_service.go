@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// idempotencyLeaseTTL is how long an idempotency key stays reserved for a
+// request in flight. It outlasts any request, and frees the key for a retry if
+// the server dies before the response is recorded.
+const idempotencyLeaseTTL = time.Minute
+
+// IdempotencyService makes retried requests safe: a request sent again with the
+// same idempotency key is answered with the response to the first one instead
+// of being performed twice. Keys are reserved in every store that can be
+// reached, so a primary store such as Redis can fall back to the database, and
+// a key recorded in either while the other was down is still honoured.
+type IdempotencyService struct {
+	stores []repository.IdempotencyStore
+	ttl    time.Duration
+}
+
+// NewIdempotencyService creates an idempotency service keeping responses for
+// ttl in the reachable stores
+func NewIdempotencyService(ttl time.Duration, stores ...repository.IdempotencyStore) *IdempotencyService {
+	return &IdempotencyService{stores: stores, ttl: ttl}
+}
+
+// IdempotentRequest is a request holding an idempotency key. It must be
+// completed with its response, or released if it has none worth replaying.
+type IdempotentRequest struct {
+	// stores are the stores that reserved the key
+	stores []repository.IdempotencyStore
+	record *models.IdempotencyRecord
+	ttl    time.Duration
+}
+
+// Begin reserves an idempotency key for the request identified by fingerprint.
+// When the key has a recorded response to the same request, Begin returns that
+// instead. It fails with ErrIdempotencyKeyInUse while another request holds
+// the key, and with ErrIdempotencyKeyReused if the key was used for a different
+// request.
+func (s *IdempotencyService) Begin(ctx context.Context, key, fingerprint string) (*IdempotentRequest, *models.IdempotencyRecord, error) {
+	now := time.Now()
+	request := &IdempotentRequest{
+		record: &models.IdempotencyRecord{
+			Key:         key,
+			Fingerprint: fingerprint,
+			Token:       uuid.New().String(),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyLeaseTTL),
+		},
+		ttl: s.ttl,
+	}
+
+	var err error
+	for _, store := range s.stores {
+		var existing *models.IdempotencyRecord
+		if existing, err = store.ReserveIdempotencyKey(ctx, request.record); err != nil {
+			logger.Log.Warn("Failed to reserve idempotency key in a store",
+				zap.String("key", key),
+				zap.Error(err),
+			)
+			continue
+		}
+		if existing == nil {
+			request.stores = append(request.stores, store)
+			continue
+		}
+
+		// The key is held in this store, so the reservations made in the
+		// others are given up
+		if err := request.Release(ctx); err != nil {
+			logger.Log.Warn("Failed to release idempotency key", zap.String("key", key), zap.Error(err))
+		}
+		switch {
+		case existing.Fingerprint != fingerprint:
+			return nil, nil, repository.ErrIdempotencyKeyReused
+		case !existing.Completed():
+			return nil, nil, repository.ErrIdempotencyKeyInUse
+		default:
+			return nil, existing, nil
+		}
+	}
+	if len(request.stores) == 0 {
+		return nil, nil, fmt.Errorf("%w: no idempotency store is reachable: %v", repository.ErrUnavailable, err)
+	}
+	return request, nil, nil
+}
+
+// Complete records the response to the request, to be replayed to retries
+// until the key expires. Stores where the lease ran out and another request
+// took over the key are left alone.
+func (r *IdempotentRequest) Complete(ctx context.Context, statusCode int, contentType string, body []byte) error {
+	r.record.StatusCode = statusCode
+	r.record.ContentType = contentType
+	r.record.Body = body
+	r.record.ExpiresAt = time.Now().Add(r.ttl)
+
+	var errs []error
+	for _, store := range r.stores {
+		errs = append(errs, store.CompleteIdempotencyKey(ctx, r.record))
+	}
+	return errors.Join(errs...)
+}
+
+// Release frees the key without recording a response, so that a retry is
+// performed again
+func (r *IdempotentRequest) Release(ctx context.Context) error {
+	var errs []error
+	for _, store := range r.stores {
+		errs = append(errs, store.ReleaseIdempotencyKey(ctx, r.record))
+	}
+	return errors.Join(errs...)
+}
+
+// Redact empties the recorded responses of the context tenant that contain
+// text in every store, and returns how many it emptied
+func (s *IdempotencyService) Redact(ctx context.Context, text string) (int64, error) {
+	var redacted int64
+	var errs []error
+	for _, store := range s.stores {
+		n, err := store.RedactIdempotencyResponses(ctx, text)
+		redacted += n
+		errs = append(errs, err)
+	}
+	return redacted, errors.Join(errs...)
+}
+
+// RunExpiry periodically removes expired idempotency keys from stores that do
+// not expire them on their own. It blocks until ctx is cancelled.
+func (s *IdempotencyService) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, store := range s.stores {
+				deleted, err := store.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+				if err != nil {
+					logger.Log.Error("Failed to delete expired idempotency keys", zap.Error(err))
+					continue
+				}
+				if deleted > 0 {
+					logger.Log.Info("Deleted expired idempotency keys", zap.Int64("count", deleted))
+				}
+			}
+		}
+	}
+}
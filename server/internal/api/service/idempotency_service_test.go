@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyIdempotencyStore fails every call while down is set
+type flakyIdempotencyStore struct {
+	repository.IdempotencyStore
+	down bool
+}
+
+var errStoreDown = errors.New("store is down")
+
+func (s *flakyIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	if s.down {
+		return nil, errStoreDown
+	}
+	return s.IdempotencyStore.ReserveIdempotencyKey(ctx, record)
+}
+
+func (s *flakyIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	if s.down {
+		return errStoreDown
+	}
+	return s.IdempotencyStore.CompleteIdempotencyKey(ctx, record)
+}
+
+func newIdempotencyStore(t *testing.T) *flakyIdempotencyStore {
+	t.Helper()
+	store, err := sqlite.Open(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close(context.Background()) })
+	return &flakyIdempotencyStore{IdempotencyStore: store}
+}
+
+func TestIdempotencyServiceHonoursKeysOfEveryStore(t *testing.T) {
+	logger.InitLogger()
+	ctx := context.Background()
+	primary, fallback := newIdempotencyStore(t), newIdempotencyStore(t)
+	s := NewIdempotencyService(time.Hour, primary, fallback)
+
+	// Recorded in the fallback while the primary is down...
+	primary.down = true
+	request, recorded, err := s.Begin(ctx, "key-1", "abc")
+	require.NoError(t, err)
+	require.Nil(t, recorded)
+	require.NoError(t, request.Complete(ctx, 201, "application/json", []byte(`{"id":"1"}`)))
+
+	// ...and replayed once it is back
+	primary.down = false
+	request, recorded, err = s.Begin(ctx, "key-1", "abc")
+	require.NoError(t, err)
+	assert.Nil(t, request)
+	require.NotNil(t, recorded)
+	assert.Equal(t, 201, recorded.StatusCode)
+
+	// The reservation taken in the primary meanwhile was given up
+	existing, err := primary.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{Key: "key-1", Fingerprint: "def", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// A request in flight holds the key in every store
+	request, _, err = s.Begin(ctx, "key-2", "abc")
+	require.NoError(t, err)
+	primary.down = true
+	_, _, err = s.Begin(ctx, "key-2", "abc")
+	assert.ErrorIs(t, err, repository.ErrIdempotencyKeyInUse)
+	primary.down = false
+	require.NoError(t, request.Release(ctx))
+	request, _, err = s.Begin(ctx, "key-2", "abc")
+	require.NoError(t, err)
+	assert.NotNil(t, request)
+
+	primary.down, fallback.down = true, true
+	_, _, err = s.Begin(ctx, "key-3", "abc")
+	assert.ErrorIs(t, err, repository.ErrUnavailable)
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/blobstore"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxProfileImages caps how many images can be uploaded to a profile
+const maxProfileImages = 10
+
+// ImageExtensions maps the content types accepted for uploaded images to the
+// extension their image IDs end with
+var ImageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// AddImage stores an uploaded image of the given content type and appends its
+// URL to the profile's image URLs. It returns the updated profile and the URL.
+// A non-zero expectedVersion makes the change conditional on the profile being
+// at that version.
+func (s *ProfileService) AddImage(ctx context.Context, id string, content io.Reader, contentType string, expectedVersion int) (*models.Profile, string, error) {
+	extension, ok := ImageExtensions[contentType]
+	if !ok {
+		return nil, "", repository.NewValidationError("image", "must be a JPEG, PNG, GIF or WebP image")
+	}
+	// Fail before storing anything if the profile does not exist
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, "", err
+	}
+
+	imageID := uuid.New().String() + extension
+	key := imageKey(ctx, id, imageID)
+	if err := s.blobs.Put(ctx, key, content); err != nil {
+		logger.Log.Error("Failed to store image",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, "", err
+	}
+
+	url := imageURL(id, imageID)
+	profile, err := s.modify(ctx, "add_image", id, expectedVersion, func(current *models.Profile) (*models.Profile, error) {
+		if countUploadedImages(current) >= maxProfileImages {
+			return nil, repository.NewValidationError("image", "a profile has at most 10 uploaded images")
+		}
+		updated := *current
+		updated.ImageURLs = append(append([]string{}, current.ImageURLs...), url)
+		return &updated, nil
+	})
+	if err != nil {
+		s.deleteBlob(ctx, key)
+		return nil, "", err
+	}
+
+	s.invalidateImages(ctx, id)
+	return profile, url, nil
+}
+
+// RemoveImage deletes an uploaded image and removes its URL from the profile's
+// image URLs. A non-zero expectedVersion makes the change conditional on the
+// profile being at that version.
+func (s *ProfileService) RemoveImage(ctx context.Context, id, imageID string, expectedVersion int) (*models.Profile, error) {
+	if _, ok := imageContentType(imageID); !ok {
+		return nil, repository.ErrImageNotFound
+	}
+
+	url := imageURL(id, imageID)
+	profile, err := s.modify(ctx, "remove_image", id, expectedVersion, func(current *models.Profile) (*models.Profile, error) {
+		kept := make([]string, 0, len(current.ImageURLs))
+		for _, imageURL := range current.ImageURLs {
+			if imageURL != url {
+				kept = append(kept, imageURL)
+			}
+		}
+		if len(kept) == len(current.ImageURLs) {
+			return nil, repository.ErrImageNotFound
+		}
+		updated := *current
+		updated.ImageURLs = kept
+		return &updated, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteBlob(ctx, imageKey(ctx, id, imageID))
+	s.invalidateImages(ctx, id)
+	return profile, nil
+}
+
+// OpenImage opens an image uploaded to a profile and returns it with its
+// content type. Only images the profile still lists are served.
+func (s *ProfileService) OpenImage(ctx context.Context, id, imageID string) (*blobstore.Blob, string, error) {
+	response, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType, ok := imageContentType(imageID)
+	if !ok || !hasImageURL(response.Profile, imageURL(id, imageID)) {
+		return nil, "", repository.ErrImageNotFound
+	}
+
+	blob, err := s.blobs.Get(ctx, imageKey(ctx, id, imageID))
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, "", repository.ErrImageNotFound
+	}
+	if err != nil {
+		logger.Log.Error("Failed to open image",
+			zap.String("id", id),
+			zap.String("image_id", imageID),
+			zap.Error(err),
+		)
+		return nil, "", err
+	}
+	return blob, contentType, nil
+}
+
+// deleteImages deletes every image uploaded to a profile. Failing to delete
+// one leaves an orphaned blob, which is logged rather than returned.
+func (s *ProfileService) deleteImages(ctx context.Context, profile *models.Profile) {
+	for _, url := range profile.ImageURLs {
+		if imageID, ok := uploadedImageID(profile.ID, url); ok {
+			s.deleteBlob(ctx, imageKey(ctx, profile.ID, imageID))
+		}
+	}
+}
+
+// checkImageEdit checks the image URLs a client edit sets on a profile.
+// Uploaded images are only added through AddImage, so the edit may keep or
+// drop the profile's uploaded images but not list others, of this profile or
+// any other.
+func checkImageEdit(id string, current, updated *models.Profile) error {
+	listed := uploadedImageIDs(id, current)
+	for _, url := range updated.ImageURLs {
+		imageID, uploaded := uploadedImageID(id, url)
+		if uploaded && !listed[imageID] || !uploaded && strings.HasPrefix(url, "/") {
+			return repository.NewValidationError("image_urls", "images are added by uploading them")
+		}
+	}
+	return nil
+}
+
+// droppedImages returns the IDs of the images uploaded to a profile that a
+// write took out of its image URLs
+func droppedImages(id string, before, after *models.Profile) []string {
+	kept := uploadedImageIDs(id, after)
+	var dropped []string
+	for imageID := range uploadedImageIDs(id, before) {
+		if !kept[imageID] {
+			dropped = append(dropped, imageID)
+		}
+	}
+	return dropped
+}
+
+// deleteDroppedImages deletes the blobs of images a stored write dropped from
+// a profile, as RemoveImage does
+func (s *ProfileService) deleteDroppedImages(ctx context.Context, id string, imageIDs []string) {
+	for _, imageID := range imageIDs {
+		s.deleteBlob(ctx, imageKey(ctx, id, imageID))
+	}
+}
+
+// existingImageURLs returns the image URLs of a profile without the uploaded
+// images whose blobs were deleted since they were listed
+func (s *ProfileService) existingImageURLs(ctx context.Context, id string, urls []string) ([]string, error) {
+	existing := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if imageID, ok := uploadedImageID(id, url); ok {
+			blob, err := s.blobs.Get(ctx, imageKey(ctx, id, imageID))
+			if errors.Is(err, blobstore.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			blob.Close()
+		}
+		existing = append(existing, url)
+	}
+	return existing, nil
+}
+
+// deleteBlob deletes a blob, logging failures
+func (s *ProfileService) deleteBlob(ctx context.Context, key string) {
+	if err := s.blobs.Delete(ctx, key); err != nil {
+		logger.Log.Error("Failed to delete image",
+			zap.String("key", key),
+			zap.Error(err),
+		)
+	}
+}
+
+// invalidateImages drops a profile from the cache after its images changed,
+// rather than refreshing it, so that every pod reloads the new image URLs
+func (s *ProfileService) invalidateImages(ctx context.Context, id string) {
+	if err := s.cache.Delete(ctx, id); err != nil {
+		logger.Log.Error("Failed to invalidate cached profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+}
+
+// imageKey returns the blob key of an image uploaded to a tenant's profile
+func imageKey(ctx context.Context, id, imageID string) string {
+	return path.Join("images", tenant.FromContext(ctx), id, imageID)
+}
+
+// imageURL returns the URL an image uploaded to a profile is served from
+func imageURL(id, imageID string) string {
+	return "/api/v1/profiles/" + id + "/images/" + imageID
+}
+
+// uploadedImageID returns the image ID of a URL served for an image uploaded
+// to a profile. Image URLs set by clients are not uploaded images.
+func uploadedImageID(id, url string) (string, bool) {
+	imageID, ok := strings.CutPrefix(url, imageURL(id, ""))
+	if !ok {
+		return "", false
+	}
+	_, ok = imageContentType(imageID)
+	return imageID, ok
+}
+
+// imageContentType returns the content type of an uploaded image from its ID,
+// which is a UUID followed by the extension of its type
+func imageContentType(imageID string) (string, bool) {
+	name := path.Ext(imageID)
+	if _, err := uuid.Parse(strings.TrimSuffix(imageID, name)); err != nil {
+		return "", false
+	}
+	for contentType, extension := range ImageExtensions {
+		if extension == name {
+			return contentType, true
+		}
+	}
+	return "", false
+}
+
+// uploadedImageIDs returns the IDs of the uploaded images a profile lists
+func uploadedImageIDs(id string, profile *models.Profile) map[string]bool {
+	imageIDs := make(map[string]bool)
+	for _, url := range profile.ImageURLs {
+		if imageID, ok := uploadedImageID(id, url); ok {
+			imageIDs[imageID] = true
+		}
+	}
+	return imageIDs
+}
+
+// countUploadedImages counts the images uploaded to a profile
+func countUploadedImages(profile *models.Profile) int {
+	count := 0
+	for _, url := range profile.ImageURLs {
+		if _, ok := uploadedImageID(profile.ID, url); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// hasImageURL reports whether a profile lists an image URL
+func hasImageURL(profile *models.Profile, url string) bool {
+	for _, imageURL := range profile.ImageURLs {
+		if imageURL == url {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/blobstore"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/queue"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// erasuresChannel is the queue erasure requests are published to
+	erasuresChannel = "erasures"
+	// erasureRequestedEvent is the type of the message asking for an erasure
+	erasureRequestedEvent = "profile_erasure_requested"
+	// erasedEvent is the type of the tombstone event published once a profile
+	// has been erased. It carries nothing but the profile ID.
+	erasedEvent = "profile_erased"
+	// erasureResumeDelay is how long an erasure stays pending before the eraser
+	// resumes it, in case its request was lost on the way through the queue
+	erasureResumeDelay = 15 * time.Minute
+	// erasureBatchSize caps the pending erasures resumed per run
+	erasureBatchSize = 100
+)
+
+// ExportData gathers everything held about a profile, whether or not it is
+// soft-deleted: the stored profile, its cached copy, its revision history, the
+// events stored about it and its uploaded images still in the blob store
+func (s *ProfileService) ExportData(ctx context.Context, id string) (*models.DataExport, error) {
+	start := time.Now()
+
+	export, err := s.exportData(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("data_export", "error").Inc()
+		logger.Log.Error("Failed to export profile data",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("data_export", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("data_export").Observe(time.Since(start).Seconds())
+	return export, nil
+}
+
+func (s *ProfileService) exportData(ctx context.Context, id string) (*models.DataExport, error) {
+	profile, err := s.repository.GetIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	export := &models.DataExport{
+		ProfileID:  id,
+		ExportedAt: time.Now(),
+		Profile:    profile,
+		Revisions:  []*models.Revision{},
+		Events:     []*models.ExportedEvent{},
+		Images:     []*models.ExportedImage{},
+	}
+
+	// A cache failure only means there is no cached copy to report
+	if cached, err := s.cache.Get(ctx, id); err == nil && cached != nil {
+		export.Cached = cached
+	}
+
+	revisions, err := s.allRevisions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) > 0 {
+		export.Revisions = revisions
+	}
+
+	if export.Events, err = s.storedEvents(ctx, id); err != nil {
+		return nil, err
+	}
+
+	for _, imageID := range storedImageIDs(profile, revisions) {
+		blob, err := s.blobs.Get(ctx, imageKey(ctx, id, imageID))
+		if errors.Is(err, blobstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		blob.Close()
+		contentType, _ := imageContentType(imageID)
+		export.Images = append(export.Images, &models.ExportedImage{
+			ID:          imageID,
+			URL:         imageURL(id, imageID),
+			ContentType: contentType,
+			Size:        blob.Size,
+		})
+	}
+
+	receipt, err := s.erasures.GetErasure(ctx, id)
+	if err != nil && !errors.Is(err, repository.ErrErasureNotFound) {
+		return nil, err
+	}
+	export.Erasure = receipt
+	return export, nil
+}
+
+// OpenExportedImage opens an uploaded image listed by a data export. Unlike
+// OpenImage, it serves images of soft-deleted profiles and images the profile
+// no longer lists.
+func (s *ProfileService) OpenExportedImage(ctx context.Context, id, imageID string) (*blobstore.Blob, error) {
+	if _, ok := imageContentType(imageID); !ok {
+		return nil, repository.ErrImageNotFound
+	}
+	blob, err := s.blobs.Get(ctx, imageKey(ctx, id, imageID))
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, repository.ErrImageNotFound
+	}
+	return blob, err
+}
+
+// RequestErasure records a request to erase everything held about a profile,
+// whether or not it is soft-deleted, and queues the erasure, which RunEraser
+// carries out. A profile is erased at most once: repeated requests return the
+// receipt of the first one, even after the profile is gone.
+func (s *ProfileService) RequestErasure(ctx context.Context, id string) (*models.ErasureReceipt, error) {
+	var receipt *models.ErasureReceipt
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := s.erasures.GetErasure(ctx, id)
+		if err == nil {
+			receipt = existing
+			return nil
+		}
+		if !errors.Is(err, repository.ErrErasureNotFound) {
+			return err
+		}
+		if _, err := s.repository.GetIncludingDeleted(ctx, id); err != nil {
+			return err
+		}
+
+		receipt = &models.ErasureReceipt{
+			ID:          uuid.New().String(),
+			ProfileID:   id,
+			Status:      models.ErasurePending,
+			RequestedAt: time.Now(),
+		}
+		if existing, err = s.erasures.RecordErasure(ctx, receipt); err != nil {
+			return err
+		}
+		if existing != nil {
+			// A concurrent request recorded its receipt first
+			receipt = existing
+			return nil
+		}
+		return s.enqueueEvent(ctx, erasuresChannel, erasureRequestedEvent, id, id)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		logger.Log.Error("Failed to request erasure",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// GetErasure retrieves the receipt of a profile's erasure
+func (s *ProfileService) GetErasure(ctx context.Context, id string) (*models.ErasureReceipt, error) {
+	return s.erasures.GetErasure(ctx, id)
+}
+
+// RunEraser carries out the erasures requested through RequestErasure as their
+// requests arrive from the queue, and every interval resumes those left
+// pending. It blocks until ctx is cancelled or the subscription fails.
+func (s *ProfileService) RunEraser(ctx context.Context, q queue.Queue, interval time.Duration) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.runErasureResumer(ctx, interval)
+
+	err := q.Subscribe(ctx, erasuresChannel, s.applyErasureRequest)
+	if err != nil && ctx.Err() == nil {
+		logger.Log.Error("Eraser stopped", zap.Error(err))
+	}
+}
+
+// runErasureResumer runs ResumeErasures every interval until ctx is cancelled
+func (s *ProfileService) runErasureResumer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resumed, err := s.ResumeErasures(ctx)
+			if err != nil {
+				logger.Log.Error("Failed to resume pending erasures", zap.Error(err))
+			} else if resumed > 0 {
+				logger.Log.Info("Resumed pending erasures", zap.Int("count", resumed))
+			}
+		}
+	}
+}
+
+// applyErasureRequest erases the profile named by an erasure request. A failed
+// erasure stays pending, and is retried by ResumeErasures.
+func (s *ProfileService) applyErasureRequest(message *queue.Message) error {
+	if message.Type != erasureRequestedEvent {
+		return nil
+	}
+
+	var event struct {
+		TenantID string `json:"tenant_id"`
+		Data     string `json:"data"`
+	}
+	if err := json.Unmarshal(message.Data, &event); err != nil {
+		return err
+	}
+
+	ctx := tenant.WithID(context.Background(), event.TenantID)
+	_, err := s.Erase(ctx, event.Data)
+	return err
+}
+
+// ResumeErasures carries out the erasures of every tenant that have been
+// pending for longer than they should, in case their requests were lost on the
+// way through the queue. It returns how many it completed.
+func (s *ProfileService) ResumeErasures(ctx context.Context) (int, error) {
+	pending, err := s.erasures.ListPendingErasures(ctx, time.Now().Add(-erasureResumeDelay), erasureBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	completed := 0
+	for _, receipt := range pending {
+		if _, err := s.Erase(tenant.WithID(ctx, receipt.TenantID), receipt.ProfileID); err != nil {
+			continue
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// Erase carries out the pending erasure of a profile. It deletes every image
+// ever uploaded to the profile and redacts the recorded idempotent responses
+// holding it, then in one transaction the profile with its
+// revision history, its follows and the events stored about it, publishing a
+// profile_erased tombstone and completing the receipt. Cached copies are purged
+// on every pod once it commits.
+//
+// Erasing a profile whose erasure completed returns its receipt unchanged; an
+// erasure that failed part way is finished by running it again.
+func (s *ProfileService) Erase(ctx context.Context, id string) (*models.ErasureReceipt, error) {
+	start := time.Now()
+
+	receipt, err := s.erase(ctx, id)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("erase", "error").Inc()
+		logger.Log.Error("Failed to erase profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("erase", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("erase").Observe(time.Since(start).Seconds())
+	return receipt, nil
+}
+
+func (s *ProfileService) erase(ctx context.Context, id string) (*models.ErasureReceipt, error) {
+	receipt, err := s.erasures.GetErasure(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Completed() {
+		return receipt, nil
+	}
+
+	// Images go first, while the profile and its history still say which
+	// images it had. A profile already gone was purged along with its images.
+	var imageIDs []string
+	profile, err := s.repository.GetIncludingDeleted(ctx, id)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if profile != nil {
+		revisions, err := s.allRevisions(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		imageIDs = storedImageIDs(profile, revisions)
+	}
+	for _, imageID := range imageIDs {
+		if err := s.blobs.Delete(ctx, imageKey(ctx, id, imageID)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Responses recorded for idempotent retries, such as that of the request
+	// that created the profile, hold it too
+	if s.idempotency != nil {
+		if _, err := s.idempotency.Redact(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	completed := *receipt
+	err = s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.repository.Erase(ctx, id); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		// Events go before the follows, whose unfollow events must still be relayed
+		events, err := s.outbox.DeleteForAggregate(ctx, id)
+		if err != nil {
+			return err
+		}
+		follows, err := s.removeFollows(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.publishEvent(ctx, erasedEvent, id, id); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		completed.Status = models.ErasureCompleted
+		completed.CompletedAt = &now
+		completed.ImagesDeleted = len(imageIDs)
+		completed.FollowsDeleted = follows
+		completed.EventsDeleted = int(events)
+		return s.erasures.CompleteErasure(ctx, &completed)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleting publishes the invalidation that drops every pod's copy
+	if err := s.cache.Delete(ctx, id); err != nil {
+		logger.Log.Error("Failed to delete cache",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+	logger.Log.Info("Erased profile",
+		zap.String("id", id),
+		zap.String("tenant_id", tenant.FromContext(ctx)),
+	)
+	return &completed, nil
+}
+
+// allRevisions returns every revision of a profile, newest first
+func (s *ProfileService) allRevisions(ctx context.Context, id string) ([]*models.Revision, error) {
+	var revisions []*models.Revision
+	opts := repository.HistoryOptions{Limit: repository.MaxListLimit}
+	for {
+		page, err := s.revisions.ListRevisions(ctx, id, opts)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, page.Revisions...)
+		if page.NextBefore == 0 {
+			return revisions, nil
+		}
+		opts.Before = page.NextBefore
+	}
+}
+
+// storedEvents returns the context tenant's events stored in the outbox about
+// a profile, oldest first
+func (s *ProfileService) storedEvents(ctx context.Context, id string) ([]*models.ExportedEvent, error) {
+	messages, err := s.outbox.ListForAggregate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*models.ExportedEvent{}
+	for _, message := range messages {
+		var payload queue.Message
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return nil, err
+		}
+		var event struct {
+			ID        string          `json:"id"`
+			TenantID  string          `json:"tenant_id"`
+			Data      json.RawMessage `json:"data"`
+			Timestamp time.Time       `json:"timestamp"`
+		}
+		if err := json.Unmarshal(payload.Data, &event); err != nil {
+			return nil, err
+		}
+		// Profile IDs are unique across tenants, but the outbox is not scoped
+		if event.TenantID != tenant.FromContext(ctx) {
+			continue
+		}
+		events = append(events, &models.ExportedEvent{
+			ID:        event.ID,
+			Type:      payload.Type,
+			Channel:   message.Channel,
+			Data:      event.Data,
+			Timestamp: event.Timestamp,
+		})
+	}
+	return events, nil
+}
+
+// storedImageIDs returns the IDs of every image uploaded to a profile, as
+// listed by the profile or any of its revisions
+func storedImageIDs(profile *models.Profile, revisions []*models.Revision) []string {
+	var imageIDs []string
+	seen := make(map[string]bool)
+	collect := func(urls []string) {
+		for _, url := range urls {
+			imageID, ok := uploadedImageID(profile.ID, url)
+			if ok && !seen[imageID] {
+				seen[imageID] = true
+				imageIDs = append(imageIDs, imageID)
+			}
+		}
+	}
+
+	collect(profile.ImageURLs)
+	for _, revision := range revisions {
+		if revision.Snapshot != nil {
+			collect(revision.Snapshot.ImageURLs)
+		}
+	}
+	return imageIDs
+}
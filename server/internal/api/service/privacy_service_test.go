@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/blobstore/filesystem"
+	"github.com/fernandobarroso/profile-service/internal/cache"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEraseBatchProfile(t *testing.T) {
+	logger.InitLogger()
+	ctx := context.Background()
+	store, err := sqlite.Open(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close(context.Background()) })
+	blobs, err := filesystem.NewStore(t.TempDir())
+	require.NoError(t, err)
+	memory, err := cache.NewMemoryCache(cache.MemoryCacheOptions{Capacity: 10, Policy: cache.EvictLRU})
+	require.NoError(t, err)
+	s := NewProfileService(store, store, store, store, store, store, blobs, memory, cache.NewNoopCache(), nil)
+	idempotency := NewIdempotencyService(time.Hour, store)
+	s.SetIdempotency(idempotency)
+
+	outcomes, err := s.CreateBatch(ctx, []*models.Profile{
+		{Name: "Ada", Email: "ada@example.com"},
+		{Name: "Grace", Email: "grace@example.com"},
+	}, false)
+	require.NoError(t, err)
+	erased, kept := outcomes[0].Profile, outcomes[1].Profile
+
+	// The response to the batch was recorded for retries
+	request, _, err := idempotency.Begin(ctx, "batch-1", "abc")
+	require.NoError(t, err)
+	require.NoError(t, request.Complete(ctx, 207, "application/json", []byte(`{"id":"`+erased.ID+`"}`)))
+
+	// Every profile of the batch has an event of its own
+	export, err := s.ExportData(ctx, erased.ID)
+	require.NoError(t, err)
+	require.Len(t, export.Events, 1)
+	assert.Equal(t, "profile_batch_created", export.Events[0].Type)
+	assert.Contains(t, string(export.Events[0].Data), erased.Email)
+
+	_, err = s.RequestErasure(ctx, erased.ID)
+	require.NoError(t, err)
+	receipt, err := s.Erase(ctx, erased.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ErasureCompleted, receipt.Status)
+	assert.Equal(t, 2, receipt.EventsDeleted) // the batch event and the erasure request
+
+	events, err := store.ListForAggregate(ctx, erased.ID)
+	require.NoError(t, err)
+	for _, event := range events {
+		assert.NotContains(t, string(event.Payload), erased.Email)
+	}
+	events, err = store.ListForAggregate(ctx, kept.ID)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	// The recorded response is still replayed, without the profile
+	_, recorded, err := idempotency.Begin(ctx, "batch-1", "abc")
+	require.NoError(t, err)
+	require.NotNil(t, recorded)
+	assert.Equal(t, 207, recorded.StatusCode)
+	assert.Empty(t, recorded.Body)
+
+	_, err = s.ExportData(ctx, erased.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
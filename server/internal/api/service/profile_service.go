@@ -3,42 +3,107 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/blobstore"
 	"github.com/fernandobarroso/profile-service/internal/cache"
 	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/outbox"
 	"github.com/fernandobarroso/profile-service/internal/queue"
 	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// EventsChannel is the queue profile events are published to
+const EventsChannel = "events"
+
+// fillPollInterval is how often a Get waiting for another instance to cache a
+// profile checks the cache
+const fillPollInterval = 20 * time.Millisecond
+
 // ProfileService handles business logic for profile operations
 type ProfileService struct {
 	repository repository.Store
+	outbox     repository.Outbox
+	revisions  repository.RevisionStore
+	schemas    repository.AttributeSchemaStore
+	follows    repository.FollowStore
+	erasures   repository.ErasureStore
+	blobs      blobstore.Store
 	cache      cache.Cache
+	counts     cache.FollowCountCache
 	queue      queue.Queue
+
+	// loads coalesces concurrent cache misses of a profile
+	loads flightGroup
+	// fillLocker, if set, coalesces cache misses across instances, which wait
+	// up to fillLease for the instance holding the lease to cache the profile
+	fillLocker cache.FillLocker
+	fillLease  time.Duration
+	// idempotency, if set, holds recorded responses that erasures redact
+	idempotency *IdempotencyService
 }
 
 // NewProfileService creates a new profile service
-func NewProfileService(repository repository.Store, cache cache.Cache, queue queue.Queue) *ProfileService {
+func NewProfileService(repository repository.Store, outbox repository.Outbox, revisions repository.RevisionStore, schemas repository.AttributeSchemaStore, follows repository.FollowStore, erasures repository.ErasureStore, blobs blobstore.Store, cache cache.Cache, counts cache.FollowCountCache, queue queue.Queue) *ProfileService {
 	return &ProfileService{
 		repository: repository,
+		outbox:     outbox,
+		revisions:  revisions,
+		schemas:    schemas,
+		follows:    follows,
+		erasures:   erasures,
+		blobs:      blobs,
 		cache:      cache,
+		counts:     counts,
 		queue:      queue,
 	}
 }
 
+// SetFillLocker makes cache misses wait for another instance already loading
+// the profile, for at most lease
+func (s *ProfileService) SetFillLocker(locker cache.FillLocker, lease time.Duration) {
+	s.fillLocker = locker
+	s.fillLease = lease
+}
+
+// SetIdempotency makes erasures redact the recorded idempotent responses
+// holding the erased profile
+func (s *ProfileService) SetIdempotency(idempotency *IdempotencyService) {
+	s.idempotency = idempotency
+}
+
 // Create creates a new profile
 func (s *ProfileService) Create(ctx context.Context, profile *models.Profile) error {
 	start := time.Now()
 	profile.ID = uuid.New().String()
 	profile.CreatedAt = time.Now()
 	profile.UpdatedAt = time.Now()
+	if profile.Attributes == nil {
+		profile.Attributes = map[string]interface{}{}
+	}
+	if err := normalizeProfileTags(profile); err != nil {
+		return err
+	}
 
-	if err := s.repository.Create(ctx, profile); err != nil {
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.checkAttributes(ctx, profile); err != nil {
+			return err
+		}
+		if err := s.repository.Create(ctx, profile); err != nil {
+			return err
+		}
+		if err := s.recordRevision(ctx, models.RevisionCreate, profile); err != nil {
+			return err
+		}
+		return s.publishEvent(ctx, "profile_created", profile.ID, profile)
+	})
+	if err != nil {
 		metrics.DbOperationsTotal.WithLabelValues("create", "error").Inc()
 		logger.Log.Error("Failed to create profile",
 			zap.Error(err),
@@ -54,35 +119,197 @@ func (s *ProfileService) Create(ctx context.Context, profile *models.Profile) er
 		)
 	}
 
-	// Publish event
-	if err := s.publishEvent(ctx, "profile_created", profile); err != nil {
-		logger.Log.Error("Failed to publish event",
-			zap.Error(err),
-		)
-	}
-
 	metrics.DbOperationsTotal.WithLabelValues("create", "success").Inc()
 	metrics.DbOperationDuration.WithLabelValues("create").Observe(time.Since(start).Seconds())
 	return nil
 }
 
-// Get retrieves a profile by ID
-func (s *ProfileService) Get(ctx context.Context, id string) (*models.ProfileResponse, error) {
+// CreateBatch creates several profiles in one transaction and returns one
+// outcome per profile. With upsert, a profile whose email is in use updates the
+// existing profile instead of being reported as a duplicate. Profiles with
+// invalid tags or attributes that do not fit the schema are left out and
+// reported as invalid.
+func (s *ProfileService) CreateBatch(ctx context.Context, profiles []*models.Profile, upsert bool) ([]*repository.BatchOutcome, error) {
 	start := time.Now()
+	now := time.Now()
+	for _, profile := range profiles {
+		profile.ID = uuid.New().String()
+		profile.CreatedAt = now
+		profile.UpdatedAt = now
+	}
 
+	outcomes := make([]*repository.BatchOutcome, len(profiles))
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		defs, err := s.schemas.ListAttributeDefinitions(ctx)
+		if err != nil {
+			return err
+		}
+		var valid []*models.Profile
+		var indexes []int
+		for i, profile := range profiles {
+			err := normalizeProfileTags(profile)
+			if err == nil {
+				err = validateAttributes(defs, profile.Attributes)
+			}
+			if err != nil {
+				outcomes[i] = &repository.BatchOutcome{Status: repository.BatchInvalid, Err: err}
+				continue
+			}
+			valid = append(valid, profile)
+			indexes = append(indexes, i)
+		}
+		if len(valid) == 0 {
+			return nil
+		}
+
+		written, err := s.repository.CreateBatch(ctx, valid, upsert)
+		if err != nil {
+			return err
+		}
+		for j, outcome := range written {
+			outcomes[indexes[j]] = outcome
+		}
+
+		// Every profile written gets an event of its own, so that exports and
+		// erasures find it, tagged with the batch it came from
+		batchID := uuid.New().String()
+		var revisions []*models.Revision
+		var events []*models.BatchEvent
+		for _, outcome := range outcomes {
+			switch outcome.Status {
+			case repository.BatchCreated:
+				revisions = append(revisions, newRevision(ctx, models.RevisionCreate, nil, outcome.Profile))
+			case repository.BatchUpdated:
+				revisions = append(revisions, newRevision(ctx, models.RevisionUpdate, outcome.Previous, outcome.Profile))
+			default:
+				continue
+			}
+			events = append(events, &models.BatchEvent{BatchID: batchID, Status: outcome.Status, Profile: outcome.Profile})
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+
+		if err := s.revisions.AddRevisions(ctx, revisions); err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := s.publishEvent(ctx, "profile_batch_created", event.Profile.ID, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("create_batch", "error").Inc()
+		logger.Log.Error("Failed to create profile batch",
+			zap.Int("size", len(profiles)),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	// Warm the cache with the written profiles
+	for _, outcome := range outcomes {
+		if outcome.Profile == nil {
+			continue
+		}
+		if outcome.Previous != nil {
+			s.deleteDroppedImages(ctx, outcome.Profile.ID, droppedImages(outcome.Profile.ID, outcome.Previous, outcome.Profile))
+		}
+		if err := s.cache.Set(ctx, outcome.Profile.ID, outcome.Profile, 24*time.Hour); err != nil {
+			logger.Log.Error("Failed to cache profile",
+				zap.String("id", outcome.Profile.ID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("create_batch", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("create_batch").Observe(time.Since(start).Seconds())
+	return outcomes, nil
+}
+
+// Get retrieves a profile by ID. Concurrent cache misses of a profile are
+// coalesced, so only one of them reads it from the repository.
+func (s *ProfileService) Get(ctx context.Context, id string) (*models.ProfileResponse, error) {
 	// Try to get from cache first
-	profile, err := s.cache.Get(ctx, id)
-	if err == nil && profile != nil {
+	if response := s.cached(ctx, id); response != nil {
 		metrics.CacheHits.Inc()
-		return &models.ProfileResponse{
-			Profile: profile,
-			Source:  "cache",
-		}, nil
+		return response, nil
 	}
 
 	// If not in cache, get from repository
 	metrics.CacheMisses.Inc()
-	profile, err = s.repository.Get(ctx, id)
+	key := tenant.FromContext(ctx) + ":" + id
+	if token := repository.ConsistencyTokenFrom(ctx); token != "" {
+		// A read that must observe a write only shares loads started after it,
+		// which carry the same token
+		key += "@" + token
+	}
+	response, shared, err := s.loads.do(ctx, key, func(ctx context.Context) (*models.ProfileResponse, error) {
+		return s.load(ctx, id)
+	})
+	if shared {
+		metrics.CacheMissesCoalesced.WithLabelValues("local").Inc()
+	}
+	return response, err
+}
+
+// cached returns a profile from the cache, or nil if it is not cached
+func (s *ProfileService) cached(ctx context.Context, id string) *models.ProfileResponse {
+	profile, err := s.cache.Get(ctx, id)
+	if err != nil || profile == nil {
+		return nil
+	}
+
+	// Layered caches report the tier that served the profile
+	source := profile.GetFrom
+	if source == "" {
+		source = "cache"
+	}
+	metrics.CacheTierHits.WithLabelValues(source).Inc()
+	return &models.ProfileResponse{
+		Profile: profile,
+		Source:  source,
+	}
+}
+
+// load reads a profile missing from the cache from the repository and caches
+// it, unless another instance is doing so
+func (s *ProfileService) load(ctx context.Context, id string) (*models.ProfileResponse, error) {
+	// Another instance's fill may have read the profile before the write a
+	// consistency token covers, so reads carrying one load it themselves
+	if s.fillLocker != nil && repository.ConsistencyTokenFrom(ctx) == "" {
+		unlock, response := s.lockFill(ctx, id)
+		if response != nil {
+			return response, nil
+		}
+		if unlock != nil {
+			defer unlock()
+		}
+	}
+
+	// The profile is cached for every reader, so it is read as of the latest
+	// write: from a replica that has replayed it, or else the primary. If the
+	// latest write is unknown, the profile is read as the request asks and not
+	// cached.
+	start := time.Now()
+	readCtx, cacheable := ctx, true
+	if token, err := s.repository.ConsistencyToken(ctx); err != nil {
+		logger.Log.Warn("Failed to get consistency token, not caching profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		cacheable = false
+	} else {
+		readCtx = repository.WithConsistencyToken(ctx, token)
+	}
+	profile, err := s.repository.Get(readCtx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		metrics.DbOperationsTotal.WithLabelValues("get", "not_found").Inc()
+		return nil, err
+	}
 	if err != nil {
 		metrics.DbOperationsTotal.WithLabelValues("get", "error").Inc()
 		logger.Log.Error("Failed to get profile",
@@ -92,17 +319,14 @@ func (s *ProfileService) Get(ctx context.Context, id string) (*models.ProfileRes
 		return nil, err
 	}
 
-	if profile == nil {
-		metrics.DbOperationsTotal.WithLabelValues("get", "not_found").Inc()
-		return nil, nil
-	}
-
 	// Cache the profile
-	if err := s.cache.Set(ctx, id, profile, 24*time.Hour); err != nil {
-		logger.Log.Error("Failed to cache profile",
-			zap.String("id", id),
-			zap.Error(err),
-		)
+	if cacheable {
+		if err := s.cache.Set(ctx, id, profile, 24*time.Hour); err != nil {
+			logger.Log.Error("Failed to cache profile",
+				zap.String("id", id),
+				zap.Error(err),
+			)
+		}
 	}
 
 	metrics.DbOperationsTotal.WithLabelValues("get", "success").Inc()
@@ -113,57 +337,188 @@ func (s *ProfileService) Get(ctx context.Context, id string) (*models.ProfileRes
 	}, nil
 }
 
-// Update updates an existing profile
-func (s *ProfileService) Update(ctx context.Context, id string, profile *models.Profile) error {
+// lockFill takes the lease on filling a profile into the cache. While another
+// instance holds it, lockFill waits for that instance to cache the profile and
+// returns it. Without the lease, unlock is nil: the profile is loaded anyway
+// if the lock cannot be reached or the holder takes longer than a lease.
+func (s *ProfileService) lockFill(ctx context.Context, id string) (unlock func(), response *models.ProfileResponse) {
+	deadline := time.Now().Add(s.fillLease)
+	for {
+		unlock, locked, err := s.fillLocker.LockFill(ctx, id, s.fillLease)
+		if err != nil {
+			logger.Log.Error("Failed to lock cache fill",
+				zap.String("id", id),
+				zap.Error(err),
+			)
+			return nil, nil
+		}
+		if locked {
+			// Another instance may have cached it since the miss
+			if response := s.cached(ctx, id); response != nil {
+				unlock()
+				return nil, response
+			}
+			return unlock, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil
+		}
+		time.Sleep(fillPollInterval)
+		if response := s.cached(ctx, id); response != nil {
+			metrics.CacheMissesCoalesced.WithLabelValues("remote").Inc()
+			return nil, response
+		}
+	}
+}
+
+// Replace overwrites all editable fields of a profile. A non-zero
+// expectedVersion makes the write conditional on the profile still being at
+// that version. Uploaded images left out of its image URLs are deleted.
+func (s *ProfileService) Replace(ctx context.Context, id string, profile *models.Profile, expectedVersion int) error {
 	start := time.Now()
 
-	if err := s.repository.Update(ctx, id, profile); err != nil {
-		logger.Log.Error("Failed to update profile",
+	var dropped []string
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.repository.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkImageEdit(id, current, profile); err != nil {
+			return err
+		}
+		if err := s.replace(ctx, id, profile, expectedVersion); err != nil {
+			return err
+		}
+		dropped = droppedImages(id, current, profile)
+		return nil
+	})
+	if err != nil {
+		logger.Log.Error("Failed to replace profile",
 			zap.String("id", id),
 			zap.Error(err),
 		)
-		metrics.DbOperationsTotal.WithLabelValues("update", "error").Inc()
+		metrics.DbOperationsTotal.WithLabelValues("replace", "error").Inc()
 		return err
 	}
 
-	// Get the complete updated profile
-	updatedProfile, err := s.repository.Get(ctx, id)
+	s.deleteDroppedImages(ctx, id, dropped)
+	s.cacheProfile(ctx, profile)
+	metrics.DbOperationsTotal.WithLabelValues("replace", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("replace").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// Patch applies a change to the current state of a profile and stores the
+// result. apply receives the stored profile and returns its replacement; it
+// runs in the write's transaction, so the profile cannot change in between. A
+// non-zero expectedVersion makes the patch conditional on the profile being at
+// that version. As for Replace, uploaded images left out are deleted.
+func (s *ProfileService) Patch(ctx context.Context, id string, expectedVersion int, apply func(current *models.Profile) (*models.Profile, error)) (*models.Profile, error) {
+	var dropped []string
+	profile, err := s.modify(ctx, "patch", id, expectedVersion, func(current *models.Profile) (*models.Profile, error) {
+		updated, err := apply(current)
+		if err != nil || updated == nil {
+			return updated, err
+		}
+		if err := checkImageEdit(id, current, updated); err != nil {
+			return nil, err
+		}
+		dropped = droppedImages(id, current, updated)
+		return updated, nil
+	})
 	if err != nil {
-		logger.Log.Error("Failed to get updated profile",
-			zap.String("id", id),
-			zap.Error(err),
-		)
-		return err
+		return nil, err
 	}
 
-	// Update cache with complete profile (use same TTL as new profiles)
-	if err := s.cache.Set(ctx, id, updatedProfile, 24*time.Hour); err != nil {
-		logger.Log.Error("Failed to cache profile",
+	s.deleteDroppedImages(ctx, id, dropped)
+	return profile, nil
+}
+
+// modify runs a read-modify-write of a profile for Patch and the operations
+// built like it. If apply returns no profile, nothing is written and the
+// current profile is returned.
+func (s *ProfileService) modify(ctx context.Context, operation, id string, expectedVersion int, apply func(current *models.Profile) (*models.Profile, error)) (*models.Profile, error) {
+	start := time.Now()
+
+	var profile *models.Profile
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.repository.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != 0 && current.Version != expectedVersion {
+			return repository.ErrConflict
+		}
+
+		if profile, err = apply(current); err != nil {
+			return err
+		}
+		if profile == nil {
+			profile = current
+			return nil
+		}
+		return s.replace(ctx, id, profile, current.Version)
+	})
+	if err != nil {
+		logger.Log.Error("Failed to modify profile",
+			zap.String("operation", operation),
 			zap.String("id", id),
 			zap.Error(err),
 		)
+		metrics.DbOperationsTotal.WithLabelValues(operation, "error").Inc()
+		return nil, err
 	}
 
-	// Publish event with complete profile
-	if err := s.publishEvent(ctx, "profile_updated", updatedProfile); err != nil {
-		logger.Log.Error("Failed to publish event",
+	s.cacheProfile(ctx, profile)
+	metrics.DbOperationsTotal.WithLabelValues(operation, "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	return profile, nil
+}
+
+// replace overwrites a profile and records the change. It must be called in a transaction.
+func (s *ProfileService) replace(ctx context.Context, id string, profile *models.Profile, expectedVersion int) error {
+	if err := normalizeProfileTags(profile); err != nil {
+		return err
+	}
+	if err := s.checkAttributes(ctx, profile); err != nil {
+		return err
+	}
+	if err := s.repository.Replace(ctx, id, profile, expectedVersion); err != nil {
+		return err
+	}
+	if err := s.recordRevision(ctx, models.RevisionUpdate, profile); err != nil {
+		return err
+	}
+	return s.publishEvent(ctx, "profile_updated", id, profile)
+}
+
+// cacheProfile caches a profile after a write. Failing to cache is not an error.
+func (s *ProfileService) cacheProfile(ctx context.Context, profile *models.Profile) {
+	if err := s.cache.Set(ctx, profile.ID, profile, 24*time.Hour); err != nil {
+		logger.Log.Error("Failed to cache profile",
+			zap.String("id", profile.ID),
 			zap.Error(err),
 		)
 	}
-
-	// Update the input profile with the complete data
-	*profile = *updatedProfile
-
-	metrics.DbOperationsTotal.WithLabelValues("update", "success").Inc()
-	metrics.DbOperationDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
-	return nil
 }
 
-// Delete removes a profile
-func (s *ProfileService) Delete(ctx context.Context, id string) error {
+// Delete removes a profile. A non-zero expectedVersion makes the delete
+// conditional on the profile still being at that version.
+func (s *ProfileService) Delete(ctx context.Context, id string, expectedVersion int) error {
 	start := time.Now()
 
-	if err := s.repository.Delete(ctx, id); err != nil {
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		profile, err := s.repository.Delete(ctx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if err := s.recordRevision(ctx, models.RevisionDelete, profile); err != nil {
+			return err
+		}
+		return s.publishEvent(ctx, "profile_deleted", id, id)
+	})
+	if err != nil {
 		logger.Log.Error("Failed to delete profile",
 			zap.String("id", id),
 			zap.Error(err),
@@ -180,23 +535,19 @@ func (s *ProfileService) Delete(ctx context.Context, id string) error {
 		)
 	}
 
-	// Publish event
-	if err := s.publishEvent(ctx, "profile_deleted", id); err != nil {
-		logger.Log.Error("Failed to publish event",
-			zap.Error(err),
-		)
-	}
-
 	metrics.DbOperationsTotal.WithLabelValues("delete", "success").Inc()
 	metrics.DbOperationDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
 	return nil
 }
 
-// List retrieves all profiles
-func (s *ProfileService) List(ctx context.Context) ([]*models.Profile, error) {
+// List retrieves a page of profiles
+func (s *ProfileService) List(ctx context.Context, opts repository.ListOptions) (*repository.ListResult, error) {
 	start := time.Now()
 
-	profiles, err := s.repository.List(ctx)
+	if err := s.typeAttributeFilters(ctx, &opts); err != nil {
+		return nil, err
+	}
+	result, err := s.repository.List(ctx, opts)
 	if err != nil {
 		metrics.DbOperationsTotal.WithLabelValues("list", "error").Inc()
 		logger.Log.Error("Failed to list profiles",
@@ -207,7 +558,93 @@ func (s *ProfileService) List(ctx context.Context) ([]*models.Profile, error) {
 
 	metrics.DbOperationsTotal.WithLabelValues("list", "success").Inc()
 	metrics.DbOperationDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
-	return profiles, nil
+	return result, nil
+}
+
+// Export returns an iterator over every profile matching opts, for streaming
+// to a client without loading them all. The caller must close it.
+func (s *ProfileService) Export(ctx context.Context, opts repository.ListOptions) (repository.ProfileIterator, error) {
+	if err := s.typeAttributeFilters(ctx, &opts); err != nil {
+		return nil, err
+	}
+	it, err := s.repository.Iterate(ctx, opts)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("export", "error").Inc()
+		logger.Log.Error("Failed to export profiles",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("export", "success").Inc()
+	return it, nil
+}
+
+// Search runs a ranked full-text search over profiles
+func (s *ProfileService) Search(ctx context.Context, opts repository.SearchOptions) (*repository.SearchResult, error) {
+	start := time.Now()
+
+	result, err := s.repository.Search(ctx, opts)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("search", "error").Inc()
+		logger.Log.Error("Failed to search profiles",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("search", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("search").Observe(time.Since(start).Seconds())
+	return result, nil
+}
+
+// Restore undoes the soft delete of a profile
+func (s *ProfileService) Restore(ctx context.Context, id string) (*models.Profile, error) {
+	start := time.Now()
+
+	var profile *models.Profile
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if profile, err = s.repository.Restore(ctx, id); err != nil {
+			return err
+		}
+		if err := s.recordRevision(ctx, models.RevisionRestore, profile); err != nil {
+			return err
+		}
+		return s.publishEvent(ctx, "profile_restored", id, profile)
+	})
+	if err != nil {
+		logger.Log.Error("Failed to restore profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		metrics.DbOperationsTotal.WithLabelValues("restore", "error").Inc()
+		return nil, err
+	}
+
+	// Cache the restored profile
+	if err := s.cache.Set(ctx, id, profile, 24*time.Hour); err != nil {
+		logger.Log.Error("Failed to cache profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("restore", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("restore").Observe(time.Since(start).Seconds())
+	return profile, nil
+}
+
+// ListDeleted retrieves a page of soft-deleted profiles
+func (s *ProfileService) ListDeleted(ctx context.Context, opts repository.ListOptions) (*repository.ListResult, error) {
+	opts.Deleted = true
+	return s.List(ctx, opts)
+}
+
+// ConsistencyToken returns a token that makes later reads observe every write
+// committed so far. It is empty when reads are always consistent.
+func (s *ProfileService) ConsistencyToken(ctx context.Context) (string, error) {
+	return s.repository.ConsistencyToken(ctx)
 }
 
 // ProcessDelayedTask processes a delayed task
@@ -228,27 +665,26 @@ func (s *ProfileService) ProcessDelayedTask(ctx context.Context, task *models.De
 	})
 }
 
-// publishEvent publishes an event to the queue
-func (s *ProfileService) publishEvent(ctx context.Context, eventType string, data interface{}) error {
-	// Skip publishing if queue is not configured
-	if s.queue == nil {
-		return nil
-	}
+// publishEvent records an event for the context's tenant in the outbox, to be
+// relayed to the queue once the surrounding transaction commits
+func (s *ProfileService) publishEvent(ctx context.Context, eventType, aggregateID string, data interface{}) error {
+	return s.enqueueEvent(ctx, EventsChannel, eventType, aggregateID, data)
+}
 
+// enqueueEvent records an event for the context's tenant in the outbox, to be
+// relayed to the given channel once the surrounding transaction commits
+func (s *ProfileService) enqueueEvent(ctx context.Context, channel, eventType, aggregateID string, data interface{}) error {
 	event := &models.Event{
 		ID:        uuid.New().String(),
 		Type:      eventType,
+		TenantID:  tenant.FromContext(ctx),
 		Data:      data,
 		Timestamp: time.Now(),
 	}
 
-	eventData, err := json.Marshal(event)
+	message, err := outbox.NewMessage(channel, aggregateID, event)
 	if err != nil {
 		return err
 	}
-
-	return s.queue.Publish(ctx, "events", &queue.Message{
-		Data:      eventData,
-		Timestamp: time.Now(),
-	})
+	return s.outbox.Enqueue(ctx, message)
 }
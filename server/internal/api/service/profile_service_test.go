@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/cache"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// latestToken is the consistency token blockingStore reports for its latest write
+const latestToken = "0/16B3748"
+
+// blockingStore serves profile reads once release is closed
+type blockingStore struct {
+	repository.Store
+	release chan struct{}
+	gets    int32
+	// stale counts reads that need not observe the latest write
+	stale int32
+	// tokenErr fails ConsistencyToken
+	tokenErr error
+}
+
+func (s *blockingStore) Get(ctx context.Context, id string) (*models.Profile, error) {
+	atomic.AddInt32(&s.gets, 1)
+	if repository.ConsistencyTokenFrom(ctx) != latestToken {
+		atomic.AddInt32(&s.stale, 1)
+	}
+	<-s.release
+	return &models.Profile{ID: id, TenantID: tenant.FromContext(ctx), Name: "Jane"}, nil
+}
+
+func (s *blockingStore) ConsistencyToken(ctx context.Context) (string, error) {
+	return latestToken, s.tokenErr
+}
+
+// heldFillLocker reports every fill lease as held by another instance
+type heldFillLocker struct {
+	calls int32
+}
+
+func (l *heldFillLocker) LockFill(ctx context.Context, id string, lease time.Duration) (func(), bool, error) {
+	atomic.AddInt32(&l.calls, 1)
+	return nil, false, nil
+}
+
+func newTestProfileService(t *testing.T, store repository.Store) *ProfileService {
+	t.Helper()
+	memory, err := cache.NewMemoryCache(cache.MemoryCacheOptions{Capacity: 10, Policy: cache.EvictLRU})
+	require.NoError(t, err)
+	return NewProfileService(store, nil, nil, nil, nil, nil, nil, memory, nil, nil)
+}
+
+func TestProfileServiceGetCoalescesMisses(t *testing.T) {
+	store := &blockingStore{release: make(chan struct{})}
+	s := newTestProfileService(t, store)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	const callers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := s.Get(ctx, "1")
+			assert.NoError(t, err)
+			if assert.NotNil(t, response) {
+				assert.Equal(t, "Jane", response.Profile.Name)
+			}
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return waiters(&s.loads, "acme:1") == callers-1
+	}, time.Second, time.Millisecond)
+	close(store.release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, store.gets)
+	// Cached profiles are read as of the latest write
+	assert.Zero(t, store.stale)
+
+	response, err := s.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "cache", response.Source)
+	assert.EqualValues(t, 1, store.gets)
+}
+
+func TestProfileServiceGetWithConsistencyToken(t *testing.T) {
+	store := &blockingStore{release: make(chan struct{})}
+	s := newTestProfileService(t, store)
+	ctx := tenant.WithID(context.Background(), "acme")
+	tokenCtx := repository.WithConsistencyToken(ctx, "0/1")
+
+	// A load started without the token, as if before the write it covers, is
+	// not shared with a read carrying the token
+	var wg sync.WaitGroup
+	for i, ctx := range []context.Context{ctx, tokenCtx} {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			_, err := s.Get(ctx, "1")
+			assert.NoError(t, err)
+		}(ctx)
+		loads := int32(i + 1)
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt32(&store.gets) == loads
+		}, time.Second, time.Millisecond)
+	}
+	close(store.release)
+	wg.Wait()
+
+	// nor does it wait on the lease of another instance filling the cache
+	require.NoError(t, s.cache.Delete(ctx, "1"))
+	locker := &heldFillLocker{}
+	s.SetFillLocker(locker, time.Hour)
+	response, err := s.Get(tokenCtx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "database", response.Source)
+	assert.Zero(t, locker.calls)
+}
+
+func TestProfileServiceGetSkipsCacheWithoutLatestWrite(t *testing.T) {
+	store := &blockingStore{release: make(chan struct{}), tokenErr: repository.ErrUnavailable}
+	close(store.release)
+	s := newTestProfileService(t, store)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	// Without the position of the latest write, a profile that may come from a
+	// lagging replica is served but not cached
+	for i := 0; i < 2; i++ {
+		response, err := s.Get(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, "database", response.Source)
+	}
+	assert.EqualValues(t, 2, store.gets)
+	assert.EqualValues(t, 2, store.stale)
+}
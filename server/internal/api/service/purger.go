@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// purgeBatchSize is the number of tombstones removed per database round trip
+const purgeBatchSize = 100
+
+// RunPurger periodically purges profiles that have been soft-deleted for longer
+// than the retention period. It blocks until ctx is cancelled.
+func (s *ProfileService) RunPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeDeleted(ctx, retention)
+			if err != nil {
+				logger.Log.Error("Failed to purge deleted profiles", zap.Error(err))
+			} else if purged > 0 {
+				logger.Log.Info("Purged deleted profiles", zap.Int("count", purged))
+			}
+		}
+	}
+}
+
+// PurgeDeleted permanently removes profiles of every tenant soft-deleted longer
+// ago than the retention period, along with their follows and uploaded images,
+// publishing a profile_purged event for each one under its own tenant
+func (s *ProfileService) PurgeDeleted(ctx context.Context, retention time.Duration) (int, error) {
+	start := time.Now()
+	before := start.Add(-retention)
+
+	total := 0
+	for {
+		var purged []*models.Profile
+		err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+			var err error
+			if purged, err = s.repository.PurgeDeleted(ctx, before, purgeBatchSize); err != nil {
+				return err
+			}
+			for _, profile := range purged {
+				tenantCtx := tenant.WithID(ctx, profile.TenantID)
+				if _, err := s.removeFollows(tenantCtx, profile.ID); err != nil {
+					return err
+				}
+				if err := s.publishEvent(tenantCtx, "profile_purged", profile.ID, profile.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			metrics.DbOperationsTotal.WithLabelValues("purge", "error").Inc()
+			return total, err
+		}
+
+		for _, profile := range purged {
+			s.deleteImages(tenant.WithID(ctx, profile.TenantID), profile)
+		}
+		total += len(purged)
+		if len(purged) < purgeBatchSize {
+			break
+		}
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("purge", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("purge").Observe(time.Since(start).Seconds())
+	return total, nil
+}
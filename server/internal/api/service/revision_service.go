@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// anonymousActor is recorded for changes made without an identified actor
+const anonymousActor = "anonymous"
+
+// actorKey is the context key for the actor making a change
+type actorKey struct{}
+
+// WithActor returns a context identifying who is making changes, for the
+// revision history
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the actor carried by ctx
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return anonymousActor
+}
+
+// History retrieves a page of a profile's revisions, newest first
+func (s *ProfileService) History(ctx context.Context, id string, opts repository.HistoryOptions) (*repository.HistoryResult, error) {
+	start := time.Now()
+
+	result, err := s.revisions.ListRevisions(ctx, id, opts)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("history", "error").Inc()
+		logger.Log.Error("Failed to list profile history",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	if len(result.Revisions) == 0 && opts.Before == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("history", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("history").Observe(time.Since(start).Seconds())
+	return result, nil
+}
+
+// GetAsOf retrieves a profile as it was at the given time
+func (s *ProfileService) GetAsOf(ctx context.Context, id string, at time.Time) (*models.ProfileResponse, error) {
+	revision, err := s.revisions.GetRevisionAt(ctx, id, at)
+	if errors.Is(err, repository.ErrRevisionNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		logger.Log.Error("Failed to get profile history",
+			zap.String("id", id),
+			zap.Time("as_of", at),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	// A profile did not exist while it was deleted
+	if revision.Snapshot.DeletedAt != nil {
+		return nil, repository.ErrNotFound
+	}
+
+	return &models.ProfileResponse{
+		Profile: revision.Snapshot,
+		Source:  "history",
+	}, nil
+}
+
+// Revert restores the editable fields of a profile to their values at the given
+// revision, recording the result as a new revision. A non-zero expectedVersion
+// makes the revert conditional on the profile still being at that version.
+// Uploaded images deleted since the revision are left out, and those uploaded
+// after it are deleted.
+func (s *ProfileService) Revert(ctx context.Context, id string, revision int, expectedVersion int) (*models.Profile, error) {
+	start := time.Now()
+
+	var profile *models.Profile
+	var dropped []string
+	err := s.repository.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.repository.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		target, err := s.revisions.GetRevision(ctx, id, revision)
+		if err != nil {
+			return err
+		}
+
+		// Images deleted since the revision are gone for good
+		imageURLs, err := s.existingImageURLs(ctx, id, target.Snapshot.ImageURLs)
+		if err != nil {
+			return err
+		}
+		profile = &models.Profile{
+			Name:       target.Snapshot.Name,
+			Email:      target.Snapshot.Email,
+			Bio:        target.Snapshot.Bio,
+			ImageURLs:  imageURLs,
+			Attributes: target.Snapshot.Attributes,
+			Tags:       target.Snapshot.Tags,
+		}
+		// The schema may have changed since the revision was recorded
+		if err := s.checkAttributes(ctx, profile); err != nil {
+			return err
+		}
+		if err := s.repository.Replace(ctx, id, profile, expectedVersion); err != nil {
+			return err
+		}
+		if err := s.recordRevision(ctx, models.RevisionRevert, profile); err != nil {
+			return err
+		}
+		dropped = droppedImages(id, current, profile)
+		return s.publishEvent(ctx, "profile_updated", id, profile)
+	})
+	if err != nil {
+		logger.Log.Error("Failed to revert profile",
+			zap.String("id", id),
+			zap.Int("revision", revision),
+			zap.Error(err),
+		)
+		metrics.DbOperationsTotal.WithLabelValues("revert", "error").Inc()
+		return nil, err
+	}
+
+	s.deleteDroppedImages(ctx, id, dropped)
+	if err := s.cache.Set(ctx, id, profile, 24*time.Hour); err != nil {
+		logger.Log.Error("Failed to cache profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("revert", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("revert").Observe(time.Since(start).Seconds())
+	return profile, nil
+}
+
+// recordRevision records the change that brought a profile to its current
+// version, diffed against the revision before it. It must be called in the
+// transaction that made the change.
+func (s *ProfileService) recordRevision(ctx context.Context, operation string, profile *models.Profile) error {
+	var previous *models.Profile
+	if profile.Version > 1 {
+		// The previous version's change committed its revision along with it,
+		// so the revision is visible to the transaction that superseded it
+		revision, err := s.revisions.GetRevision(ctx, profile.ID, profile.Version-1)
+		switch {
+		case err == nil:
+			previous = revision.Snapshot
+		case !errors.Is(err, repository.ErrRevisionNotFound):
+			return err
+		}
+	}
+
+	return s.revisions.AddRevision(ctx, newRevision(ctx, operation, previous, profile))
+}
+
+// newRevision builds the revision for a change from previous to profile
+func newRevision(ctx context.Context, operation string, previous, profile *models.Profile) *models.Revision {
+	snapshot := *profile
+	snapshot.GetFrom = ""
+	return &models.Revision{
+		ProfileID: profile.ID,
+		Revision:  profile.Version,
+		Operation: operation,
+		Actor:     actorFrom(ctx),
+		Snapshot:  &snapshot,
+		Changes:   diffProfiles(previous, profile),
+		CreatedAt: profile.UpdatedAt,
+	}
+}
+
+// diffProfiles lists the fields that differ between two versions of a profile.
+// A nil before is treated as a profile with every field unset.
+func diffProfiles(before, after *models.Profile) []models.FieldChange {
+	if before == nil {
+		before = &models.Profile{}
+	}
+
+	changes := []models.FieldChange{}
+	for _, field := range []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"name", before.Name, after.Name},
+		{"email", before.Email, after.Email},
+		{"bio", before.Bio, after.Bio},
+		{"image_urls", before.ImageURLs, after.ImageURLs},
+		{"attributes", before.Attributes, after.Attributes},
+		{"tags", before.Tags, after.Tags},
+		{"deleted_at", before.DeletedAt, after.DeletedAt},
+	} {
+		if !equalFieldValues(field.before, field.after) {
+			changes = append(changes, models.FieldChange{Field: field.name, Old: field.before, New: field.after})
+		}
+	}
+	return changes
+}
+
+// equalFieldValues compares profile field values, treating nil and empty
+// slices and maps as equal and comparing timestamps by instant
+func equalFieldValues(a, b interface{}) bool {
+	switch a := a.(type) {
+	case []string:
+		b := b.([]string)
+		if len(a) == 0 && len(b) == 0 {
+			return true
+		}
+		return reflect.DeepEqual(a, b)
+	case map[string]interface{}:
+		b := b.(map[string]interface{})
+		if len(a) == 0 && len(b) == 0 {
+			return true
+		}
+		return reflect.DeepEqual(a, b)
+	case *time.Time:
+		b := b.(*time.Time)
+		if a == nil || b == nil {
+			return a == b
+		}
+		return a.Equal(*b)
+	default:
+		return a == b
+	}
+}
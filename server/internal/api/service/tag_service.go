@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// AddTags adds tags to a profile. Tags it already carries are ignored, and a
+// profile carrying all of them is returned unchanged. A non-zero
+// expectedVersion makes the change conditional on the profile being at that
+// version.
+func (s *ProfileService) AddTags(ctx context.Context, id string, tags []string, expectedVersion int) (*models.Profile, error) {
+	added, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.modify(ctx, "add_tags", id, expectedVersion, func(current *models.Profile) (*models.Profile, error) {
+		merged, _, _ := models.NormalizeTags(append(append([]string{}, current.Tags...), added...))
+		if len(merged) == len(current.Tags) {
+			return nil, nil
+		}
+		updated := *current
+		updated.Tags = merged
+		return &updated, nil
+	})
+}
+
+// RemoveTag removes a tag from a profile. A profile without the tag is
+// returned unchanged. A non-zero expectedVersion makes the change conditional
+// on the profile being at that version.
+func (s *ProfileService) RemoveTag(ctx context.Context, id string, tag string, expectedVersion int) (*models.Profile, error) {
+	removed, ok := models.NormalizeTag(tag)
+	if !ok {
+		return nil, repository.NewValidationError("tag", "is not a valid tag")
+	}
+
+	return s.modify(ctx, "remove_tag", id, expectedVersion, func(current *models.Profile) (*models.Profile, error) {
+		kept := make([]string, 0, len(current.Tags))
+		for _, tag := range current.Tags {
+			if tag != removed {
+				kept = append(kept, tag)
+			}
+		}
+		if len(kept) == len(current.Tags) {
+			return nil, nil
+		}
+		updated := *current
+		updated.Tags = kept
+		return &updated, nil
+	})
+}
+
+// TagFacets counts the tags of the profiles matching opts, most common first.
+// A positive limit caps the tags returned.
+func (s *ProfileService) TagFacets(ctx context.Context, opts repository.ListOptions, limit int) ([]*models.TagCount, error) {
+	start := time.Now()
+
+	if err := s.typeAttributeFilters(ctx, &opts); err != nil {
+		return nil, err
+	}
+	counts, err := s.repository.TagFacets(ctx, opts, limit)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("tag_facets", "error").Inc()
+		logger.Log.Error("Failed to count profile tags",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("tag_facets", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("tag_facets").Observe(time.Since(start).Seconds())
+	return counts, nil
+}
+
+// normalizeProfileTags puts a profile's tags in their stored form: normalized,
+// sorted and without duplicates
+func normalizeProfileTags(profile *models.Profile) error {
+	tags, err := normalizeTags(profile.Tags)
+	if err != nil {
+		return err
+	}
+	profile.Tags = tags
+	return nil
+}
+
+// normalizeTags normalizes tags, rejecting invalid ones and more than a profile may carry
+func normalizeTags(tags []string) ([]string, error) {
+	normalized, invalid, ok := models.NormalizeTags(tags)
+	if !ok {
+		return nil, repository.NewValidationError("tags", fmt.Sprintf("%q is not a valid tag", invalid))
+	}
+	if len(normalized) > models.MaxTagsPerProfile {
+		return nil, repository.NewValidationError("tags", fmt.Sprintf("a profile may carry at most %d tags", models.MaxTagsPerProfile))
+	}
+	return normalized, nil
+}
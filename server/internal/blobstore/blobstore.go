@@ -0,0 +1,40 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Blob is the content of a stored blob, which the reader must close
+type Blob struct {
+	io.ReadCloser
+	// Size is the length of the content in bytes
+	Size int64
+}
+
+// Store defines the interface for storing binary objects, such as uploaded
+// images, by key. Keys must be valid according to ValidKey.
+type Store interface {
+	// Put stores the content read from r under key, replacing any blob
+	// already stored there. A failed Put leaves no partial blob behind.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the blob stored under key
+	Get(ctx context.Context, key string) (*Blob, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// keyPattern matches blob keys: slash-separated segments of letters, digits
+// and "._-" that do not start with a dot, so keys cannot climb out of a
+// directory or name hidden files
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+// ValidKey reports whether key is a well-formed blob key
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
@@ -0,0 +1,55 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fernandobarroso/profile-service/internal/blobstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewStore(root)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(ctx, "images/default/p1/a.png", strings.NewReader("first")))
+	require.NoError(t, store.Put(ctx, "images/default/p1/a.png", strings.NewReader("second")))
+
+	blob, err := store.Get(ctx, "images/default/p1/a.png")
+	require.NoError(t, err)
+	content, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	require.NoError(t, blob.Close())
+	assert.Equal(t, "second", string(content))
+	assert.Equal(t, int64(len("second")), blob.Size)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Join(root, "images", "default", "p1"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, store.Delete(ctx, "images/default/p1/a.png"))
+	require.NoError(t, store.Delete(ctx, "images/default/p1/a.png"))
+	_, err = store.Get(ctx, "images/default/p1/a.png")
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+}
+
+func TestStoreRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../escape", "a/../../escape", "/absolute", "a//b", ".hidden", "a/b/"} {
+		assert.Error(t, store.Put(ctx, key, strings.NewReader("x")), key)
+		_, err := store.Get(ctx, key)
+		assert.Error(t, err, key)
+		assert.Error(t, store.Delete(ctx, key), key)
+	}
+}
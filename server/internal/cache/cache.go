@@ -7,6 +7,9 @@ import (
 	"github.com/fernandobarroso/profile-service/internal/models"
 )
 
+// DefaultTTL is how long profiles are cached when Set is given no TTL
+const DefaultTTL = 1 * time.Hour
+
 // Cache defines the interface for caching operations
 type Cache interface {
 	// Get retrieves a profile from cache
@@ -19,61 +22,46 @@ type Cache interface {
 	Delete(ctx context.Context, id string) error
 }
 
-// MemoryCache implements the Cache interface using in-memory storage
-type MemoryCache struct {
-	profiles map[string]*models.Profile
-	order    []string // Maintain order for FIFO
-	maxSize  int
-}
+// FollowCountCache caches the follower and following counts of profiles
+type FollowCountCache interface {
+	// GetFollowCounts retrieves the counts of a profile, or nil if they are not cached
+	GetFollowCounts(ctx context.Context, id string) (*models.FollowCounts, error)
 
-// NewMemoryCache creates a new MemoryCache instance
-func NewMemoryCache() *MemoryCache {
-	return &MemoryCache{
-		profiles: make(map[string]*models.Profile),
-		order:    make([]string, 0),
-		maxSize:  10,
-	}
-}
+	// SetFollowCounts stores the counts of a profile with TTL
+	SetFollowCounts(ctx context.Context, id string, counts *models.FollowCounts, ttl time.Duration) error
 
-// Get retrieves a profile from the cache
-func (c *MemoryCache) Get(ctx context.Context, id string) (*models.Profile, error) {
-	profile, exists := c.profiles[id]
-	if !exists {
-		return nil, nil
-	}
-	return profile, nil
+	// AdjustFollowCounts applies a follow (delta 1) or an unfollow (delta -1) to
+	// the cached counts of both profiles. Each event is applied once, so
+	// redelivered events are harmless; counts that are not cached stay so.
+	AdjustFollowCounts(ctx context.Context, eventID string, follow *models.Follow, delta int) error
 }
 
-// Set stores a profile in the cache
-func (c *MemoryCache) Set(ctx context.Context, id string, profile *models.Profile, ttl time.Duration) error {
-	// If profile already exists, update it
-	if _, exists := c.profiles[id]; exists {
-		c.profiles[id] = profile
-		return nil
-	}
-
-	// If cache is full, remove the oldest entry
-	if len(c.order) >= c.maxSize {
-		oldestID := c.order[0]
-		delete(c.profiles, oldestID)
-		c.order = c.order[1:]
-	}
-
-	// Add new profile
-	c.profiles[id] = profile
-	c.order = append(c.order, id)
-	return nil
+// FillLocker coordinates filling the cache across instances, so a profile
+// missing from the cache is loaded by one of them while the others wait for it
+// to be cached
+type FillLocker interface {
+	// LockFill takes the lease on filling a profile, reporting whether it was
+	// free. The lease expires by itself; unlock releases it early.
+	LockFill(ctx context.Context, id string, lease time.Duration) (unlock func(), locked bool, err error)
 }
 
-// Delete removes a profile from cache
-func (c *MemoryCache) Delete(ctx context.Context, id string) error {
-	delete(c.profiles, id)
-	// Remove from order slice
-	for i, profileID := range c.order {
-		if profileID == id {
-			c.order = append(c.order[:i], c.order[i+1:]...)
-			break
-		}
-	}
-	return nil
+// CacheMetrics tracks cache performance metrics
+type CacheMetrics struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Errors    int64
+	// New detailed metrics
+	GetLatency     int64 // Total latency in nanoseconds for Get operations
+	SetLatency     int64 // Total latency in nanoseconds for Set operations
+	DeleteLatency  int64 // Total latency in nanoseconds for Delete operations
+	OperationCount int64 // Total number of operations
+	CacheSize      int64 // Current size of the cache
+	LastEviction   int64 // Timestamp of last eviction
+	// New detailed metrics
+	TotalRequests     int64 // Total number of requests
+	FailedRequests    int64 // Number of failed requests
+	AverageLatency    int64 // Average latency in nanoseconds
+	LastOperation     int64 // Timestamp of last operation
+	ConsecutiveMisses int64 // Number of consecutive misses
 }
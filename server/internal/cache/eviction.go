@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// EvictionPolicy selects which entries a MemoryCache evicts once it is full
+type EvictionPolicy string
+
+// Eviction policies
+const (
+	// EvictLRU evicts the least recently used entry
+	EvictLRU EvictionPolicy = "lru"
+	// EvictLFU evicts the least frequently used entry, breaking ties by
+	// recency
+	EvictLFU EvictionPolicy = "lfu"
+	// EvictTinyLFU admits entries through a small LRU window into a segmented
+	// LRU, evicting whichever of a candidate and its victim was used less
+	// often recently. It resists scans better than LRU and adapts to shifting
+	// popularity better than LFU.
+	EvictTinyLFU EvictionPolicy = "tinylfu"
+)
+
+// evictionPolicy tracks the keys of a cache and picks which to evict. It is not
+// safe for concurrent use; the cache's lock guards it.
+type evictionPolicy interface {
+	// touch records a lookup of key, which is tracked if stored is true
+	touch(key string, stored bool)
+	// add starts tracking key and returns the keys to evict to make room,
+	// which may include key itself
+	add(key string) []string
+	// remove stops tracking key
+	remove(key string)
+}
+
+// newEvictionPolicy returns an eviction policy tracking up to capacity keys
+func newEvictionPolicy(policy EvictionPolicy, capacity int) (evictionPolicy, error) {
+	switch policy {
+	case EvictLRU:
+		return newLRUPolicy(capacity), nil
+	case EvictLFU:
+		return newLFUPolicy(capacity), nil
+	case EvictTinyLFU:
+		return newTinyLFUPolicy(capacity), nil
+	default:
+		return nil, fmt.Errorf("cache: unknown eviction policy %q", policy)
+	}
+}
+
+// lruList is a list of keys in recency order, most recent first
+type lruList struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func newLRUList() *lruList {
+	return &lruList{order: list.New(), elements: make(map[string]*list.Element)}
+}
+
+func (l *lruList) len() int {
+	return l.order.Len()
+}
+
+func (l *lruList) contains(key string) bool {
+	_, ok := l.elements[key]
+	return ok
+}
+
+// pushFront adds key as the most recently used
+func (l *lruList) pushFront(key string) {
+	l.elements[key] = l.order.PushFront(key)
+}
+
+// moveToFront marks key as the most recently used
+func (l *lruList) moveToFront(key string) {
+	if element, ok := l.elements[key]; ok {
+		l.order.MoveToFront(element)
+	}
+}
+
+// back returns the least recently used key
+func (l *lruList) back() (string, bool) {
+	element := l.order.Back()
+	if element == nil {
+		return "", false
+	}
+	return element.Value.(string), true
+}
+
+func (l *lruList) remove(key string) bool {
+	element, ok := l.elements[key]
+	if !ok {
+		return false
+	}
+	l.order.Remove(element)
+	delete(l.elements, key)
+	return true
+}
+
+// lruPolicy evicts the least recently used key
+type lruPolicy struct {
+	capacity int
+	keys     *lruList
+}
+
+func newLRUPolicy(capacity int) *lruPolicy {
+	return &lruPolicy{capacity: capacity, keys: newLRUList()}
+}
+
+func (p *lruPolicy) touch(key string, stored bool) {
+	if stored {
+		p.keys.moveToFront(key)
+	}
+}
+
+func (p *lruPolicy) add(key string) []string {
+	p.keys.pushFront(key)
+	var evicted []string
+	for p.keys.len() > p.capacity {
+		victim, _ := p.keys.back()
+		p.keys.remove(victim)
+		evicted = append(evicted, victim)
+	}
+	return evicted
+}
+
+func (p *lruPolicy) remove(key string) {
+	p.keys.remove(key)
+}
+
+// lfuPolicy evicts the least frequently used key in constant time, keeping
+// keys in one recency-ordered bucket per use count
+type lfuPolicy struct {
+	capacity int
+	counts   map[string]int
+	buckets  map[int]*lruList
+	// minCount is the lowest use count with a bucket, unless the bucket was
+	// emptied by remove
+	minCount int
+}
+
+func newLFUPolicy(capacity int) *lfuPolicy {
+	return &lfuPolicy{capacity: capacity, counts: make(map[string]int), buckets: make(map[int]*lruList)}
+}
+
+func (p *lfuPolicy) touch(key string, stored bool) {
+	if !stored {
+		return
+	}
+	count, ok := p.counts[key]
+	if !ok {
+		return
+	}
+	p.unlink(key, count)
+	if count == p.minCount && p.buckets[count] == nil {
+		p.minCount++
+	}
+	p.link(key, count+1)
+}
+
+func (p *lfuPolicy) add(key string) []string {
+	var evicted []string
+	for len(p.counts) >= p.capacity && len(p.counts) > 0 {
+		victim := p.victim()
+		p.remove(victim)
+		evicted = append(evicted, victim)
+	}
+	p.link(key, 1)
+	p.minCount = 1
+	return evicted
+}
+
+func (p *lfuPolicy) remove(key string) {
+	if count, ok := p.counts[key]; ok {
+		p.unlink(key, count)
+	}
+}
+
+// victim returns the least recently used of the least frequently used keys
+func (p *lfuPolicy) victim() string {
+	if p.buckets[p.minCount] == nil {
+		// The lowest bucket was emptied by remove
+		p.minCount = 0
+		for count := range p.buckets {
+			if p.minCount == 0 || count < p.minCount {
+				p.minCount = count
+			}
+		}
+	}
+	victim, _ := p.buckets[p.minCount].back()
+	return victim
+}
+
+func (p *lfuPolicy) link(key string, count int) {
+	bucket := p.buckets[count]
+	if bucket == nil {
+		bucket = newLRUList()
+		p.buckets[count] = bucket
+	}
+	bucket.pushFront(key)
+	p.counts[key] = count
+}
+
+func (p *lfuPolicy) unlink(key string, count int) {
+	bucket := p.buckets[count]
+	bucket.remove(key)
+	if bucket.len() == 0 {
+		delete(p.buckets, count)
+	}
+	delete(p.counts, key)
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+)
+
+// Tiers a LayeredCache reports as the GetFrom of the profiles it serves
+const (
+	SourceL1 = "cache:l1"
+	SourceL2 = "cache:l2"
+)
+
+// LayeredCache implements the Cache interface with a small in-process L1 in
+// front of a shared L2, such as Redis. Profiles found in L2 are copied into
+// L1, where they are kept for at most the L1 TTL.
+//
+// L1 copies go stale when another instance updates or deletes a profile;
+// Invalidate must be called whenever that happens, typically from L2's
+// invalidation messages. The L1 TTL bounds how long a missed message leaves a
+// stale copy behind.
+type LayeredCache struct {
+	l1    *MemoryCache
+	l2    Cache
+	l1TTL time.Duration
+
+	// invalidations counts changes to cached profiles, so a profile read from
+	// L2 while it was changing is not copied into L1
+	invalidations uint64
+}
+
+// NewLayeredCache creates a new LayeredCache instance
+func NewLayeredCache(l1 *MemoryCache, l2 Cache, l1TTL time.Duration) *LayeredCache {
+	return &LayeredCache{l1: l1, l2: l2, l1TTL: l1TTL}
+}
+
+// Get retrieves a profile from L1, or else from L2
+func (c *LayeredCache) Get(ctx context.Context, id string) (*models.Profile, error) {
+	profile, err := c.l1.Get(ctx, id)
+	if err == nil && profile != nil {
+		profile.GetFrom = SourceL1
+		return profile, nil
+	}
+
+	invalidations := atomic.LoadUint64(&c.invalidations)
+	profile, err = c.l2.Get(ctx, id)
+	if err != nil || profile == nil {
+		return profile, err
+	}
+	if atomic.LoadUint64(&c.invalidations) == invalidations {
+		_ = c.l1.Set(ctx, id, profile, c.l1TTL)
+	}
+	profile.GetFrom = SourceL2
+	return profile, nil
+}
+
+// Set stores a profile in both tiers. L1 keeps it for at most the L1 TTL.
+func (c *LayeredCache) Set(ctx context.Context, id string, profile *models.Profile, ttl time.Duration) error {
+	l1TTL := c.l1TTL
+	if ttl > 0 && ttl < l1TTL {
+		l1TTL = ttl
+	}
+	atomic.AddUint64(&c.invalidations, 1)
+	_ = c.l1.Set(ctx, id, profile, l1TTL)
+	return c.l2.Set(ctx, id, profile, ttl)
+}
+
+// Delete removes a profile from both tiers
+func (c *LayeredCache) Delete(ctx context.Context, id string) error {
+	atomic.AddUint64(&c.invalidations, 1)
+	_ = c.l1.Delete(ctx, id)
+	return c.l2.Delete(ctx, id)
+}
+
+// Invalidate removes a tenant's profile from L1 after it changed elsewhere
+func (c *LayeredCache) Invalidate(tenantID, id string) {
+	atomic.AddUint64(&c.invalidations, 1)
+	_ = c.l1.Delete(tenant.WithID(context.Background(), tenantID), id)
+}
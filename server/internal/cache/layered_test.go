@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// invalidatingCache invalidates a LayeredCache while a profile is read from it,
+// as an invalidation message racing the read would
+type invalidatingCache struct {
+	Cache
+	layered *LayeredCache
+}
+
+func (c *invalidatingCache) Get(ctx context.Context, id string) (*models.Profile, error) {
+	profile, err := c.Cache.Get(ctx, id)
+	c.layered.Invalidate(tenant.FromContext(ctx), id)
+	return profile, err
+}
+
+func TestLayeredCacheTiers(t *testing.T) {
+	ctx := tenant.WithID(context.Background(), "acme")
+	l1 := newTestMemoryCache(t, EvictLRU, 10)
+	l2 := newTestMemoryCache(t, EvictLRU, 10)
+	c := NewLayeredCache(l1, l2, time.Minute)
+
+	missing, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// Profiles found in L2 are copied into L1
+	require.NoError(t, l2.Set(ctx, "1", &models.Profile{ID: "1", Name: "Jane"}, time.Hour))
+	profile, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, SourceL2, profile.GetFrom)
+	assert.Equal(t, "Jane", profile.Name)
+
+	profile, err = c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, SourceL1, profile.GetFrom)
+
+	// Invalidation drops only the L1 copy, and only the tenant's
+	c.Invalidate("globex", "1")
+	assert.True(t, cached(t, l1, ctx, "1"))
+	c.Invalidate("acme", "1")
+	assert.False(t, cached(t, l1, ctx, "1"))
+	assert.True(t, cached(t, l2, ctx, "1"))
+
+	require.NoError(t, c.Set(ctx, "2", &models.Profile{ID: "2"}, time.Hour))
+	assert.True(t, cached(t, l1, ctx, "2"))
+	assert.True(t, cached(t, l2, ctx, "2"))
+	require.NoError(t, c.Delete(ctx, "2"))
+	assert.False(t, cached(t, l1, ctx, "2"))
+	assert.False(t, cached(t, l2, ctx, "2"))
+}
+
+func TestLayeredCacheL1TTL(t *testing.T) {
+	ctx := context.Background()
+	l1 := newTestMemoryCache(t, EvictLRU, 10)
+	l2 := newTestMemoryCache(t, EvictLRU, 10)
+	now := time.Now()
+	l1.now = func() time.Time { return now }
+	l2.now = l1.now
+	c := NewLayeredCache(l1, l2, time.Minute)
+
+	require.NoError(t, c.Set(ctx, "long", &models.Profile{ID: "long"}, time.Hour))
+	require.NoError(t, c.Set(ctx, "short", &models.Profile{ID: "short"}, 10*time.Second))
+
+	now = now.Add(30 * time.Second)
+	assert.False(t, cached(t, l1, ctx, "short"))
+	assert.True(t, cached(t, l1, ctx, "long"))
+
+	// L1 copies outlive neither the L1 TTL nor the profile's own TTL
+	now = now.Add(time.Minute)
+	assert.False(t, cached(t, l1, ctx, "long"))
+	profile, err := c.Get(ctx, "long")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, SourceL2, profile.GetFrom)
+}
+
+func TestLayeredCacheSkipsL1WhenInvalidatedDuringRead(t *testing.T) {
+	ctx := context.Background()
+	l1 := newTestMemoryCache(t, EvictLRU, 10)
+	l2 := newTestMemoryCache(t, EvictLRU, 10)
+	require.NoError(t, l2.Set(ctx, "1", &models.Profile{ID: "1"}, time.Hour))
+
+	c := NewLayeredCache(l1, nil, time.Minute)
+	c.l2 = &invalidatingCache{Cache: l2, layered: c}
+
+	profile, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, SourceL2, profile.GetFrom)
+	// The profile read may be stale, so it is not kept in L1
+	assert.False(t, cached(t, l1, ctx, "1"))
+}
@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// MemoryCacheOptions configures a MemoryCache
+type MemoryCacheOptions struct {
+	// Capacity is how many profiles the cache holds, across all tenants
+	Capacity int
+	// Policy selects which profiles are evicted once the cache is full
+	Policy EvictionPolicy
+}
+
+// MemoryCache implements the Cache interface using in-memory storage. It is
+// safe for concurrent use. Tenants share its capacity and eviction order, which
+// bounds its memory however many tenants there are, but never see each other's
+// profiles.
+//
+// Entries expire after their TTL: expired entries are dropped when looked up,
+// and RunExpiry drops those never looked up again.
+type MemoryCache struct {
+	options MemoryCacheOptions
+
+	mu      sync.Mutex
+	entries map[string]*memoryEntry // by memoryKey
+	policy  evictionPolicy
+
+	metrics CacheMetrics
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// memoryEntry is a cached profile. Entries are replaced, never modified, so
+// they can be read after the cache is unlocked.
+type memoryEntry struct {
+	profile   *models.Profile
+	expiresAt time.Time
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !now.Before(e.expiresAt)
+}
+
+// NewMemoryCache creates a new MemoryCache instance
+func NewMemoryCache(options MemoryCacheOptions) (*MemoryCache, error) {
+	if options.Capacity <= 0 {
+		return nil, errors.New("cache: memory cache capacity must be positive")
+	}
+	policy, err := newEvictionPolicy(options.Policy, options.Capacity)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryCache{
+		options: options,
+		entries: make(map[string]*memoryEntry),
+		policy:  policy,
+		now:     time.Now,
+	}, nil
+}
+
+// Get retrieves a profile from the cache
+func (c *MemoryCache) Get(ctx context.Context, id string) (*models.Profile, error) {
+	start := time.Now()
+	defer c.recordLatency(&c.metrics.GetLatency, start)
+	atomic.AddInt64(&c.metrics.TotalRequests, 1)
+
+	tenantID := tenant.FromContext(ctx)
+	key := memoryKey(tenantID, id)
+	c.mu.Lock()
+	entry := c.entries[key]
+	if entry != nil && entry.expired(c.now()) {
+		c.removeLocked(key)
+		entry = nil
+	}
+	c.policy.touch(key, entry != nil)
+	c.mu.Unlock()
+
+	if entry == nil {
+		atomic.AddInt64(&c.metrics.Misses, 1)
+		atomic.AddInt64(&c.metrics.ConsecutiveMisses, 1)
+		return nil, nil
+	}
+	atomic.AddInt64(&c.metrics.Hits, 1)
+	atomic.StoreInt64(&c.metrics.ConsecutiveMisses, 0)
+
+	profile := entry.profile.Copy()
+	profile.GetFrom = "cache"
+	profile.TenantID = tenantID
+	return profile, nil
+}
+
+// Set stores a profile in the cache. A zero TTL means DefaultTTL.
+func (c *MemoryCache) Set(ctx context.Context, id string, profile *models.Profile, ttl time.Duration) error {
+	start := time.Now()
+	defer c.recordLatency(&c.metrics.SetLatency, start)
+
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	entry := &memoryEntry{profile: profile.Copy(), expiresAt: c.now().Add(ttl)}
+
+	key := memoryKey(tenant.FromContext(ctx), id)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; exists {
+		c.entries[key] = entry
+		c.policy.touch(key, true)
+		return nil
+	}
+
+	c.entries[key] = entry
+	atomic.AddInt64(&c.metrics.CacheSize, 1)
+	for _, evicted := range c.policy.add(key) {
+		delete(c.entries, evicted)
+		atomic.AddInt64(&c.metrics.CacheSize, -1)
+		atomic.AddInt64(&c.metrics.Evictions, 1)
+		atomic.StoreInt64(&c.metrics.LastEviction, time.Now().UnixNano())
+	}
+	return nil
+}
+
+// Delete removes a profile from cache
+func (c *MemoryCache) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	defer c.recordLatency(&c.metrics.DeleteLatency, start)
+
+	c.mu.Lock()
+	c.removeLocked(memoryKey(tenant.FromContext(ctx), id))
+	c.mu.Unlock()
+	return nil
+}
+
+// RunExpiry removes expired entries every interval until the context is
+// canceled. Expired entries are never served, but without it they hold their
+// space until looked up or evicted.
+func (c *MemoryCache) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := c.RemoveExpired(); removed > 0 {
+				logger.Log.Debug("Removed expired cache entries", zap.Int("count", removed))
+			}
+		}
+	}
+}
+
+// RemoveExpired removes every expired entry and returns how many it removed
+func (c *MemoryCache) RemoveExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	now := c.now()
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			c.removeLocked(key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// GetMetrics returns the current cache metrics
+func (c *MemoryCache) GetMetrics() CacheMetrics {
+	return CacheMetrics{
+		Hits:              atomic.LoadInt64(&c.metrics.Hits),
+		Misses:            atomic.LoadInt64(&c.metrics.Misses),
+		Evictions:         atomic.LoadInt64(&c.metrics.Evictions),
+		Errors:            atomic.LoadInt64(&c.metrics.Errors),
+		GetLatency:        atomic.LoadInt64(&c.metrics.GetLatency),
+		SetLatency:        atomic.LoadInt64(&c.metrics.SetLatency),
+		DeleteLatency:     atomic.LoadInt64(&c.metrics.DeleteLatency),
+		OperationCount:    atomic.LoadInt64(&c.metrics.OperationCount),
+		CacheSize:         atomic.LoadInt64(&c.metrics.CacheSize),
+		LastEviction:      atomic.LoadInt64(&c.metrics.LastEviction),
+		TotalRequests:     atomic.LoadInt64(&c.metrics.TotalRequests),
+		FailedRequests:    atomic.LoadInt64(&c.metrics.FailedRequests),
+		AverageLatency:    atomic.LoadInt64(&c.metrics.AverageLatency),
+		LastOperation:     atomic.LoadInt64(&c.metrics.LastOperation),
+		ConsecutiveMisses: atomic.LoadInt64(&c.metrics.ConsecutiveMisses),
+	}
+}
+
+// memoryKey returns the key of a tenant's profile. Tenant IDs contain no ':'.
+func memoryKey(tenantID, id string) string {
+	return tenantID + ":" + id
+}
+
+// removeLocked removes an entry while the cache's lock is held
+func (c *MemoryCache) removeLocked(key string) {
+	if _, ok := c.entries[key]; !ok {
+		return
+	}
+	delete(c.entries, key)
+	c.policy.remove(key)
+	atomic.AddInt64(&c.metrics.CacheSize, -1)
+}
+
+// recordLatency records an operation started at start
+func (c *MemoryCache) recordLatency(total *int64, start time.Time) {
+	latency := time.Since(start).Nanoseconds()
+	atomic.AddInt64(total, latency)
+	atomic.AddInt64(&c.metrics.OperationCount, 1)
+	atomic.StoreInt64(&c.metrics.LastOperation, time.Now().UnixNano())
+
+	// Update average latency
+	currentAvg := atomic.LoadInt64(&c.metrics.AverageLatency)
+	atomic.StoreInt64(&c.metrics.AverageLatency, (currentAvg+latency)/2)
+}
@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMemoryCache(t *testing.T, policy EvictionPolicy, capacity int) *MemoryCache {
+	t.Helper()
+	c, err := NewMemoryCache(MemoryCacheOptions{Capacity: capacity, Policy: policy})
+	require.NoError(t, err)
+	return c
+}
+
+func setProfile(t *testing.T, c *MemoryCache, ctx context.Context, id string) {
+	t.Helper()
+	require.NoError(t, c.Set(ctx, id, &models.Profile{ID: id, Name: "Profile " + id}, time.Hour))
+}
+
+func cached(t *testing.T, c *MemoryCache, ctx context.Context, id string) bool {
+	t.Helper()
+	profile, err := c.Get(ctx, id)
+	require.NoError(t, err)
+	return profile != nil
+}
+
+func TestNewMemoryCacheValidatesOptions(t *testing.T) {
+	_, err := NewMemoryCache(MemoryCacheOptions{Capacity: 0, Policy: EvictLRU})
+	assert.Error(t, err)
+	_, err = NewMemoryCache(MemoryCacheOptions{Capacity: 10, Policy: "fifo"})
+	assert.Error(t, err)
+}
+
+func TestMemoryCacheGetReturnsCopies(t *testing.T) {
+	ctx := tenant.WithID(context.Background(), "acme")
+	c := newTestMemoryCache(t, EvictLRU, 10)
+
+	profile := &models.Profile{ID: "1", Name: "Jane", Tags: []string{"a"}}
+	require.NoError(t, c.Set(ctx, "1", profile, 0))
+	profile.Tags[0] = "changed"
+
+	got, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "Jane", got.Name)
+	assert.Equal(t, []string{"a"}, got.Tags)
+	assert.Equal(t, "cache", got.GetFrom)
+	assert.Equal(t, "acme", got.TenantID)
+
+	got.Name = "changed"
+	again, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Jane", again.Name)
+
+	require.NoError(t, c.Delete(ctx, "1"))
+	assert.False(t, cached(t, c, ctx, "1"))
+}
+
+func TestMemoryCacheLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	c := newTestMemoryCache(t, EvictLRU, 3)
+
+	setProfile(t, c, ctx, "1")
+	setProfile(t, c, ctx, "2")
+	setProfile(t, c, ctx, "3")
+	// Using 1 makes 2 the least recently used
+	assert.True(t, cached(t, c, ctx, "1"))
+	setProfile(t, c, ctx, "4")
+
+	assert.False(t, cached(t, c, ctx, "2"))
+	assert.True(t, cached(t, c, ctx, "1"))
+	assert.True(t, cached(t, c, ctx, "3"))
+	assert.True(t, cached(t, c, ctx, "4"))
+	assert.EqualValues(t, 1, c.GetMetrics().Evictions)
+}
+
+func TestMemoryCacheLFUEviction(t *testing.T) {
+	ctx := context.Background()
+	c := newTestMemoryCache(t, EvictLFU, 3)
+
+	setProfile(t, c, ctx, "1")
+	setProfile(t, c, ctx, "2")
+	setProfile(t, c, ctx, "3")
+	for i := 0; i < 3; i++ {
+		cached(t, c, ctx, "1")
+		cached(t, c, ctx, "3")
+	}
+	cached(t, c, ctx, "2")
+	// 2 was used least often, even though it was used last
+	setProfile(t, c, ctx, "4")
+	assert.False(t, cached(t, c, ctx, "2"))
+
+	// Among equally used entries, the least recently used goes first
+	require.NoError(t, c.Delete(ctx, "1"))
+	setProfile(t, c, ctx, "5")
+	setProfile(t, c, ctx, "6")
+	assert.False(t, cached(t, c, ctx, "4"))
+	assert.True(t, cached(t, c, ctx, "3"))
+	assert.True(t, cached(t, c, ctx, "5"))
+	assert.True(t, cached(t, c, ctx, "6"))
+}
+
+func TestMemoryCacheTinyLFUResistsScans(t *testing.T) {
+	ctx := context.Background()
+	c := newTestMemoryCache(t, EvictTinyLFU, 100)
+
+	hot := make([]string, 50)
+	for i := range hot {
+		hot[i] = fmt.Sprintf("hot-%d", i)
+		setProfile(t, c, ctx, hot[i])
+	}
+	for round := 0; round < 3; round++ {
+		for _, id := range hot {
+			assert.True(t, cached(t, c, ctx, id))
+		}
+	}
+
+	// A scan of entries used once does not flush the frequently used ones,
+	// as it would under LRU. The frequency sketch is approximate, so a few may
+	// lose out to colliding scan entries.
+	for i := 0; i < 1000; i++ {
+		setProfile(t, c, ctx, fmt.Sprintf("scan-%d", i))
+	}
+	survivors := 0
+	for _, id := range hot {
+		if cached(t, c, ctx, id) {
+			survivors++
+		}
+	}
+	assert.GreaterOrEqual(t, survivors, 45)
+	assert.LessOrEqual(t, c.GetMetrics().CacheSize, int64(100))
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	c := newTestMemoryCache(t, EvictLRU, 10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Set(ctx, "short", &models.Profile{ID: "short"}, time.Minute))
+	require.NoError(t, c.Set(ctx, "lazy", &models.Profile{ID: "lazy"}, time.Minute))
+	require.NoError(t, c.Set(ctx, "default", &models.Profile{ID: "default"}, 0))
+	assert.True(t, cached(t, c, ctx, "short"))
+
+	now = now.Add(2 * time.Minute)
+	// Expired entries are dropped when looked up
+	assert.False(t, cached(t, c, ctx, "lazy"))
+	assert.EqualValues(t, 2, c.GetMetrics().CacheSize)
+
+	// and by the background expiry otherwise
+	assert.Equal(t, 1, c.RemoveExpired())
+	assert.EqualValues(t, 1, c.GetMetrics().CacheSize)
+	assert.False(t, cached(t, c, ctx, "short"))
+	assert.True(t, cached(t, c, ctx, "default"))
+
+	now = now.Add(DefaultTTL)
+	assert.False(t, cached(t, c, ctx, "default"))
+}
+
+func TestMemoryCacheIsolatesTenants(t *testing.T) {
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+	c := newTestMemoryCache(t, EvictLRU, 3)
+
+	setProfile(t, c, acme, "1")
+	setProfile(t, c, acme, "2")
+	assert.False(t, cached(t, c, globex, "1"))
+
+	require.NoError(t, c.Set(globex, "1", &models.Profile{ID: "1", Name: "Globex"}, time.Hour))
+	profile, err := c.Get(acme, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Profile 1", profile.Name)
+	require.NoError(t, c.Delete(globex, "1"))
+	assert.True(t, cached(t, c, acme, "1"))
+
+	// Tenants share the capacity, however many there are
+	for _, id := range []string{"initech", "umbrella", "hooli"} {
+		setProfile(t, c, tenant.WithID(context.Background(), id), "1")
+	}
+	assert.False(t, cached(t, c, acme, "1"))
+	assert.False(t, cached(t, c, acme, "2"))
+	assert.EqualValues(t, 3, c.GetMetrics().CacheSize)
+}
+
+func TestMemoryCacheMetrics(t *testing.T) {
+	ctx := context.Background()
+	c := newTestMemoryCache(t, EvictLRU, 1)
+
+	cached(t, c, ctx, "1")
+	cached(t, c, ctx, "1")
+	assert.EqualValues(t, 2, c.GetMetrics().ConsecutiveMisses)
+
+	setProfile(t, c, ctx, "1")
+	cached(t, c, ctx, "1")
+	setProfile(t, c, ctx, "2")
+
+	metrics := c.GetMetrics()
+	assert.EqualValues(t, 1, metrics.Hits)
+	assert.EqualValues(t, 2, metrics.Misses)
+	assert.EqualValues(t, 0, metrics.ConsecutiveMisses)
+	assert.EqualValues(t, 1, metrics.Evictions)
+	assert.EqualValues(t, 1, metrics.CacheSize)
+	assert.EqualValues(t, 3, metrics.TotalRequests)
+	assert.EqualValues(t, 5, metrics.OperationCount)
+	assert.NotZero(t, metrics.LastEviction)
+}
+
+func TestMemoryCacheConcurrentAccess(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictLRU, EvictLFU, EvictTinyLFU} {
+		t.Run(string(policy), func(t *testing.T) {
+			c := newTestMemoryCache(t, policy, 50)
+			var wg sync.WaitGroup
+			for worker := 0; worker < 8; worker++ {
+				wg.Add(1)
+				go func(worker int) {
+					defer wg.Done()
+					ctx := tenant.WithID(context.Background(), fmt.Sprintf("tenant-%d", worker%2))
+					for i := 0; i < 500; i++ {
+						id := fmt.Sprintf("%d", (worker*i)%120)
+						switch i % 4 {
+						case 0:
+							_ = c.Set(ctx, id, &models.Profile{ID: id}, time.Minute)
+						case 3:
+							_ = c.Delete(ctx, id)
+						default:
+							_, _ = c.Get(ctx, id)
+						}
+					}
+					c.RemoveExpired()
+				}(worker)
+			}
+			wg.Wait()
+
+			assert.LessOrEqual(t, len(c.entries), 50)
+			assert.EqualValues(t, len(c.entries), c.GetMetrics().CacheSize)
+		})
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"github.com/fernandobarroso/profile-service/internal/models"
 )
 
-// NoopCache implements the Cache interface with no-op operations
+// NoopCache implements the Cache and FollowCountCache interfaces with no-op
+// operations
 type NoopCache struct{}
 
 // NewNoopCache creates a new NoopCache instance
@@ -29,3 +30,18 @@ func (c *NoopCache) Set(ctx context.Context, id string, profile *models.Profile,
 func (c *NoopCache) Delete(ctx context.Context, id string) error {
 	return nil
 }
+
+// GetFollowCounts always returns nil, nil
+func (c *NoopCache) GetFollowCounts(ctx context.Context, id string) (*models.FollowCounts, error) {
+	return nil, nil
+}
+
+// SetFollowCounts always returns nil
+func (c *NoopCache) SetFollowCounts(ctx context.Context, id string, counts *models.FollowCounts, ttl time.Duration) error {
+	return nil
+}
+
+// AdjustFollowCounts always returns nil
+func (c *NoopCache) AdjustFollowCounts(ctx context.Context, eventID string, follow *models.Follow, delta int) error {
+	return nil
+}
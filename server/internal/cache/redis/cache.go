@@ -5,24 +5,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/cache"
 	"github.com/fernandobarroso/profile-service/internal/config"
 	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/pii"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
 const (
 	// DefaultTTL is the default time-to-live for cached items
-	DefaultTTL = 1 * time.Hour
-	// ProfileKeyPrefix is the prefix for profile keys in Redis
+	DefaultTTL = cache.DefaultTTL
+	// TenantKeyPrefix starts every key and channel, followed by the tenant ID
+	// and a colon, so that tenants never share cache entries
+	TenantKeyPrefix = "tenant:"
+	// ProfileKeyPrefix is the prefix for profile keys in Redis, after the tenant
 	ProfileKeyPrefix = "profile:"
-	// InvalidationChannelPrefix is the prefix for invalidation channels
+	// InvalidationChannelPrefix is the prefix for invalidation channels, after
+	// the tenant
 	InvalidationChannelPrefix = "invalidation:"
-	// OrderKey is the key for the sorted set that tracks cache order
+	// OrderKey is the key, after the tenant, for the sorted set that tracks the
+	// cache order of a tenant's profiles
 	OrderKey = "profile:order"
 	// MaxCacheSize is the maximum number of profiles to cache
 	MaxCacheSize = 10
@@ -30,32 +41,43 @@ const (
 	CleanupInterval = 5 * time.Minute
 )
 
-// CacheMetrics tracks cache performance metrics
-type CacheMetrics struct {
-	Hits      int64
-	Misses    int64
-	Evictions int64
-	Errors    int64
-	// New detailed metrics
-	GetLatency     int64 // Total latency in nanoseconds for Get operations
-	SetLatency     int64 // Total latency in nanoseconds for Set operations
-	DeleteLatency  int64 // Total latency in nanoseconds for Delete operations
-	OperationCount int64 // Total number of operations
-	CacheSize      int64 // Current size of the cache
-	LastEviction   int64 // Timestamp of last eviction
-	// New detailed metrics
-	TotalRequests     int64 // Total number of requests
-	FailedRequests    int64 // Number of failed requests
-	AverageLatency    int64 // Average latency in nanoseconds
-	LastOperation     int64 // Timestamp of last operation
-	ConsecutiveMisses int64 // Number of consecutive misses
-}
+// Invalidation messages. A deleted profile is removed from Redis by every
+// subscriber; an updated one stays, but copies held by the processes of other
+// instances, such as L1 caches, are stale.
+const (
+	invalidateMessage = "invalidate"
+	// updatedMessagePrefix is followed by the ID of the instance that cached
+	// the update
+	updatedMessagePrefix = "updated:"
+)
+
+// CacheMetrics tracks cache performance metrics. The in-memory cache reports
+// the same metrics.
+type CacheMetrics = cache.CacheMetrics
 
 // Cache implements the cache.Cache interface for Redis
 type Cache struct {
 	client  *redis.Client
 	metrics CacheMetrics
 	stop    chan struct{}
+
+	// instanceID tells this instance's invalidation messages apart from those
+	// of other instances
+	instanceID string
+	// listeners are notified of every invalidated profile
+	listenersMu sync.RWMutex
+	listeners   []func(tenantID, id string)
+
+	// pii seals the emails, and bios if encryptBio is set, of cached profiles
+	pii        pii.Codec
+	encryptBio bool
+}
+
+// cachedProfile is the form profiles are cached in, with their PII sealed with
+// the key KeyID
+type cachedProfile struct {
+	models.Profile
+	KeyID string `json:"pii_key_id,omitempty"`
 }
 
 // TODO: Future Performance Improvements
@@ -72,6 +94,12 @@ type Cache struct {
 
 // NewClient creates a new Redis client
 func NewClient(cfg *config.Config) (*Cache, error) {
+	codec, err := pii.NewCodec(cfg.PII.KeyringPath)
+	if err != nil {
+		logger.Log.Error("Failed to load PII keyring", zap.Error(err))
+		return nil, err
+	}
+
 	client := redis.NewClient(&redis.Options{
 		Addr:     cfg.Cache.Address,
 		Password: cfg.Cache.Password,
@@ -85,7 +113,10 @@ func NewClient(cfg *config.Config) (*Cache, error) {
 	}
 
 	cache := &Cache{
-		client: client,
+		client:     client,
+		instanceID: uuid.NewString(),
+		pii:        codec,
+		encryptBio: cfg.PII.EncryptBio,
 	}
 
 	// Start listening for invalidation events
@@ -110,7 +141,8 @@ func (c *Cache) Get(ctx context.Context, id string) (*models.Profile, error) {
 		atomic.StoreInt64(&c.metrics.AverageLatency, newAvg)
 	}()
 
-	key := fmt.Sprintf("%s%s", ProfileKeyPrefix, id)
+	tenantID := tenant.FromContext(ctx)
+	key := profileKey(tenantID, id)
 	data, err := c.client.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
@@ -128,15 +160,16 @@ func (c *Cache) Get(ctx context.Context, id string) (*models.Profile, error) {
 	atomic.StoreInt64(&c.metrics.ConsecutiveMisses, 0)
 	log.Printf("Cache hit for profile %s (latency: %v)", id, time.Since(start))
 	atomic.AddInt64(&c.metrics.Hits, 1)
-	var profile models.Profile
-	if err := json.Unmarshal(data, &profile); err != nil {
-		log.Printf("Error unmarshaling profile %s: %v", id, err)
+	profile, err := c.decodeProfile(data)
+	if err != nil {
+		log.Printf("Error decoding profile %s: %v", id, err)
 		atomic.AddInt64(&c.metrics.Errors, 1)
 		atomic.AddInt64(&c.metrics.FailedRequests, 1)
 		return nil, err
 	}
 	profile.GetFrom = "cache"
-	return &profile, nil
+	profile.TenantID = tenantID
+	return profile, nil
 }
 
 // Set stores a profile in cache with TTL
@@ -160,8 +193,10 @@ func (c *Cache) Set(ctx context.Context, id string, profile *models.Profile, ttl
 	cacheProfile := *profile
 	cacheProfile.GetFrom = "cache"
 
-	key := fmt.Sprintf("%s%s", ProfileKeyPrefix, id)
-	data, err := json.Marshal(cacheProfile)
+	tenantID := tenant.FromContext(ctx)
+	key := profileKey(tenantID, id)
+	order := orderKey(tenantID)
+	data, err := c.encodeProfile(&cacheProfile)
 	if err != nil {
 		return err
 	}
@@ -173,13 +208,13 @@ func (c *Cache) Set(ctx context.Context, id string, profile *models.Profile, ttl
 	tx.Set(ctx, key, data, ttl)
 
 	// Add to order set with current timestamp as score
-	tx.ZAdd(ctx, OrderKey, redis.Z{
+	tx.ZAdd(ctx, order, redis.Z{
 		Score:  float64(time.Now().UnixNano()),
 		Member: id,
 	})
 
 	// Check cache size and evict if needed
-	tx.ZCard(ctx, OrderKey)
+	tx.ZCard(ctx, order)
 	result, err := tx.Exec(ctx)
 	if err != nil {
 		return err
@@ -195,6 +230,14 @@ func (c *Cache) Set(ctx context.Context, id string, profile *models.Profile, ttl
 	// Update cache size metric
 	atomic.StoreInt64(&c.metrics.CacheSize, count)
 
+	// Copies held by other instances are now stale
+	if err := c.publish(ctx, tenantID, id, updatedMessagePrefix+c.instanceID); err != nil {
+		logger.Log.Error("Failed to publish cache invalidation",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+
 	if count > MaxCacheSize {
 		log.Printf("Cache full (%d > %d), evicting oldest entry", count, MaxCacheSize)
 		// Update last eviction timestamp
@@ -203,7 +246,7 @@ func (c *Cache) Set(ctx context.Context, id string, profile *models.Profile, ttl
 		evictTx := c.client.TxPipeline()
 
 		// Get the oldest entry
-		evictTx.ZRange(ctx, OrderKey, 0, 0)
+		evictTx.ZRange(ctx, order, 0, 0)
 		evictResult, err := evictTx.Exec(ctx)
 		if err != nil {
 			return err
@@ -220,9 +263,8 @@ func (c *Cache) Set(ctx context.Context, id string, profile *models.Profile, ttl
 			log.Printf("Evicting profile %s from cache", oldest[0])
 			// Remove the oldest entry in a new transaction
 			removeTx := c.client.TxPipeline()
-			oldestKey := fmt.Sprintf("%s%s", ProfileKeyPrefix, oldest[0])
-			removeTx.Del(ctx, oldestKey)
-			removeTx.ZRem(ctx, OrderKey, oldest[0])
+			removeTx.Del(ctx, profileKey(tenantID, oldest[0]))
+			removeTx.ZRem(ctx, order, oldest[0])
 			_, err = removeTx.Exec(ctx)
 			if err != nil {
 				return err
@@ -246,12 +288,45 @@ func (c *Cache) Delete(ctx context.Context, id string) error {
 	}()
 
 	log.Printf("Deleting profile %s from cache", id)
-	key := fmt.Sprintf("%s%s", ProfileKeyPrefix, id)
+	tenantID := tenant.FromContext(ctx)
 	// Publish invalidation event
-	c.publishInvalidation(ctx, id)
+	c.publishInvalidation(ctx, tenantID, id)
 	// Remove from order set
-	c.client.ZRem(ctx, OrderKey, id)
-	return c.client.Del(ctx, key).Err()
+	c.client.ZRem(ctx, orderKey(tenantID), id)
+	return c.client.Del(ctx, profileKey(tenantID, id)).Err()
+}
+
+// encodeProfile serializes a profile for caching, sealing its PII
+func (c *Cache) encodeProfile(profile *models.Profile) ([]byte, error) {
+	cached := cachedProfile{Profile: *profile, KeyID: c.pii.KeyID()}
+	var err error
+	if cached.Email, err = c.pii.Seal(profile.Email); err != nil {
+		return nil, err
+	}
+	if c.encryptBio && profile.Bio != "" {
+		if cached.Bio, err = c.pii.Seal(profile.Bio); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(cached)
+}
+
+// decodeProfile deserializes a cached profile, opening its PII. Profiles cached
+// before their PII was sealed are read as they are.
+func (c *Cache) decodeProfile(data []byte) (*models.Profile, error) {
+	var cached cachedProfile
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	profile := &cached.Profile
+	var err error
+	if profile.Email, err = c.pii.Open(cached.KeyID, profile.Email); err != nil {
+		return nil, err
+	}
+	if profile.Bio, err = c.pii.Open(cached.KeyID, profile.Bio); err != nil {
+		return nil, err
+	}
+	return profile, nil
 }
 
 // Close closes the Redis connection
@@ -259,26 +334,88 @@ func (c *Cache) Close() error {
 	return c.client.Close()
 }
 
-// subscribeToInvalidation listens for cache invalidation events
+// OnInvalidation registers a function called with every profile deleted from
+// the cache, or updated in it by another instance. It is called from a single
+// goroutine and should return quickly.
+func (c *Cache) OnInvalidation(listener func(tenantID, id string)) {
+	c.listenersMu.Lock()
+	defer c.listenersMu.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// subscribeToInvalidation listens for cache invalidation events of every tenant
 func (c *Cache) subscribeToInvalidation() {
 	ctx := context.Background()
-	pubsub := c.client.Subscribe(ctx, fmt.Sprintf("%s*", InvalidationChannelPrefix))
+	pubsub := c.client.PSubscribe(ctx, fmt.Sprintf("%s*:%s*", TenantKeyPrefix, InvalidationChannelPrefix))
 	defer pubsub.Close()
 
 	ch := pubsub.Channel()
 	for msg := range ch {
-		// Extract profile ID from channel name
-		profileID := msg.Channel[len(InvalidationChannelPrefix):]
-		key := fmt.Sprintf("%s%s", ProfileKeyPrefix, profileID)
-		c.client.Del(ctx, key)
-		c.client.ZRem(ctx, OrderKey, profileID)
+		tenantID, profileID, ok := parseInvalidationChannel(msg.Channel)
+		if !ok {
+			continue
+		}
+		if msg.Payload == updatedMessagePrefix+c.instanceID {
+			// This instance's own update
+			continue
+		}
+		if !strings.HasPrefix(msg.Payload, updatedMessagePrefix) {
+			c.client.Del(ctx, profileKey(tenantID, profileID))
+			c.client.ZRem(ctx, orderKey(tenantID), profileID)
+		}
+		c.notifyInvalidation(tenantID, profileID)
+	}
+}
+
+// notifyInvalidation calls the invalidation listeners
+func (c *Cache) notifyInvalidation(tenantID, id string) {
+	c.listenersMu.RLock()
+	defer c.listenersMu.RUnlock()
+	for _, listener := range c.listeners {
+		listener(tenantID, id)
 	}
 }
 
 // publishInvalidation publishes a cache invalidation event
-func (c *Cache) publishInvalidation(ctx context.Context, id string) error {
-	channel := fmt.Sprintf("%s%s", InvalidationChannelPrefix, id)
-	return c.client.Publish(ctx, channel, "invalidate").Err()
+func (c *Cache) publishInvalidation(ctx context.Context, tenantID, id string) error {
+	return c.publish(ctx, tenantID, id, invalidateMessage)
+}
+
+// publish publishes a message on a profile's invalidation channel
+func (c *Cache) publish(ctx context.Context, tenantID, id, message string) error {
+	return c.client.Publish(ctx, invalidationChannel(tenantID, id), message).Err()
+}
+
+// profileKey returns the key caching a tenant's profile
+func profileKey(tenantID, id string) string {
+	return TenantKeyPrefix + tenantID + ":" + ProfileKeyPrefix + id
+}
+
+// orderKey returns the key of the sorted set ordering a tenant's cached profiles
+func orderKey(tenantID string) string {
+	return TenantKeyPrefix + tenantID + ":" + OrderKey
+}
+
+// invalidationChannel returns the channel announcing that a tenant's profile
+// has left the cache
+func invalidationChannel(tenantID, id string) string {
+	return TenantKeyPrefix + tenantID + ":" + InvalidationChannelPrefix + id
+}
+
+// parseInvalidationChannel extracts the tenant and profile ID from an
+// invalidation channel. Tenant IDs cannot contain a colon, so the first one
+// after the prefix ends the tenant.
+func parseInvalidationChannel(channel string) (tenantID, id string, ok bool) {
+	rest, ok := strings.CutPrefix(channel, TenantKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	tenantID, rest, ok = strings.Cut(rest, ":")
+	if !ok {
+		return "", "", false
+	}
+	id, ok = strings.CutPrefix(rest, InvalidationChannelPrefix)
+	return tenantID, id, ok
 }
 
 // GetMetrics returns the current cache metrics
@@ -305,17 +442,19 @@ func (c *Cache) GetMetrics() CacheMetrics {
 	}
 }
 
-// Warm preloads profiles into the cache
+// Warm preloads profiles of the context's tenant into the cache
 func (c *Cache) Warm(ctx context.Context, profiles []*models.Profile) error {
 	log.Printf("Warming cache with %d profiles", len(profiles))
+	tenantID := tenant.FromContext(ctx)
+	order := orderKey(tenantID)
 
 	// Start a transaction for all operations
 	tx := c.client.TxPipeline()
 
 	// Add all profiles to cache and order set
 	for _, profile := range profiles {
-		key := fmt.Sprintf("%s%s", ProfileKeyPrefix, profile.ID)
-		data, err := json.Marshal(profile)
+		key := profileKey(tenantID, profile.ID)
+		data, err := c.encodeProfile(profile)
 		if err != nil {
 			return err
 		}
@@ -324,7 +463,7 @@ func (c *Cache) Warm(ctx context.Context, profiles []*models.Profile) error {
 		tx.Set(ctx, key, data, DefaultTTL)
 
 		// Add to order set
-		tx.ZAdd(ctx, OrderKey, redis.Z{
+		tx.ZAdd(ctx, order, redis.Z{
 			Score:  float64(time.Now().UnixNano()),
 			Member: profile.ID,
 		})
@@ -338,7 +477,7 @@ func (c *Cache) Warm(ctx context.Context, profiles []*models.Profile) error {
 
 	// Check if we need to evict any entries
 	tx = c.client.TxPipeline()
-	tx.ZCard(ctx, OrderKey)
+	tx.ZCard(ctx, order)
 	result, err := tx.Exec(ctx)
 	if err != nil {
 		return err
@@ -357,7 +496,7 @@ func (c *Cache) Warm(ctx context.Context, profiles []*models.Profile) error {
 		log.Printf("Cache warming: need to evict %d entries", toEvict)
 
 		// Get the oldest entries
-		oldest, err := c.client.ZRange(ctx, OrderKey, 0, toEvict-1).Result()
+		oldest, err := c.client.ZRange(ctx, order, 0, toEvict-1).Result()
 		if err != nil {
 			return err
 		}
@@ -365,9 +504,8 @@ func (c *Cache) Warm(ctx context.Context, profiles []*models.Profile) error {
 		// Remove them in a transaction
 		evictTx := c.client.TxPipeline()
 		for _, id := range oldest {
-			key := fmt.Sprintf("%s%s", ProfileKeyPrefix, id)
-			evictTx.Del(ctx, key)
-			evictTx.ZRem(ctx, OrderKey, id)
+			evictTx.Del(ctx, profileKey(tenantID, id))
+			evictTx.ZRem(ctx, order, id)
 		}
 		_, err = evictTx.Exec(ctx)
 		if err != nil {
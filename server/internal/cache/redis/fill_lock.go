@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// FillLockKeyPrefix is the prefix, after the tenant, of the keys holding the
+// leases on filling profiles into the cache
+const FillLockKeyPrefix = "fill-lock:"
+
+// releaseFillLock deletes a fill lease (KEYS[1]) if it still holds the token
+// ARGV[1], leaving a lease taken by another instance since it expired alone
+var releaseFillLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// LockFill takes the lease on filling a profile of the context's tenant
+func (c *Cache) LockFill(ctx context.Context, id string, lease time.Duration) (func(), bool, error) {
+	key := fillLockKey(tenant.FromContext(ctx), id)
+	token := uuid.NewString()
+	locked, err := c.client.SetNX(ctx, key, token, lease).Result()
+	if err != nil || !locked {
+		return nil, false, err
+	}
+
+	unlock := func() {
+		if err := releaseFillLock.Run(context.WithoutCancel(ctx), c.client, []string{key}, token).Err(); err != nil {
+			logger.Log.Error("Failed to release cache fill lock",
+				zap.String("id", id),
+				zap.Error(err),
+			)
+		}
+	}
+	return unlock, true, nil
+}
+
+// fillLockKey returns the key of the lease on filling a tenant's profile
+func fillLockKey(tenantID, id string) string {
+	return TenantKeyPrefix + tenantID + ":" + FillLockKeyPrefix + id
+}
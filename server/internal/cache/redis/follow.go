@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// FollowCountsKeyPrefix is the prefix, after the tenant, of the hashes
+	// holding the follower and following counts of profiles
+	FollowCountsKeyPrefix = "follow_counts:"
+	// FollowEventKeyPrefix is the prefix, after the tenant, of the keys
+	// recording which follow events have been applied to the counts
+	FollowEventKeyPrefix = "follow_event:"
+	// FollowEventTTL is how long an applied follow event is remembered. The
+	// queue redelivers events well within it.
+	FollowEventTTL = 24 * time.Hour
+)
+
+// adjustFollowCounts applies a follow event to the counts of its target
+// (KEYS[2]) and follower (KEYS[3]), unless its key (KEYS[1]) shows it was
+// applied already. Counts are only adjusted while cached; the next read of
+// uncached counts loads them from the database.
+var adjustFollowCounts = redis.NewScript(`
+if not redis.call('SET', KEYS[1], 1, 'NX', 'EX', ARGV[2]) then
+	return 0
+end
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('HINCRBY', KEYS[2], 'followers', ARGV[1])
+end
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('HINCRBY', KEYS[3], 'following', ARGV[1])
+end
+return 1
+`)
+
+// GetFollowCounts retrieves the cached follow counts of a profile
+func (c *Cache) GetFollowCounts(ctx context.Context, id string) (*models.FollowCounts, error) {
+	values, err := c.client.HMGet(ctx, followCountsKey(tenant.FromContext(ctx), id), "followers", "following").Result()
+	if err != nil {
+		return nil, err
+	}
+	if values[0] == nil || values[1] == nil {
+		return nil, nil
+	}
+
+	followers, err := strconv.Atoi(values[0].(string))
+	if err != nil {
+		return nil, err
+	}
+	following, err := strconv.Atoi(values[1].(string))
+	if err != nil {
+		return nil, err
+	}
+	return &models.FollowCounts{Followers: followers, Following: following}, nil
+}
+
+// SetFollowCounts caches the follow counts of a profile with TTL
+func (c *Cache) SetFollowCounts(ctx context.Context, id string, counts *models.FollowCounts, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	key := followCountsKey(tenant.FromContext(ctx), id)
+	tx := c.client.TxPipeline()
+	tx.HSet(ctx, key, "followers", counts.Followers, "following", counts.Following)
+	tx.Expire(ctx, key, ttl)
+	_, err := tx.Exec(ctx)
+	return err
+}
+
+// AdjustFollowCounts applies a follow or unfollow event to the cached counts of
+// both profiles, once per event
+func (c *Cache) AdjustFollowCounts(ctx context.Context, eventID string, follow *models.Follow, delta int) error {
+	tenantID := tenant.FromContext(ctx)
+	keys := []string{
+		TenantKeyPrefix + tenantID + ":" + FollowEventKeyPrefix + eventID,
+		followCountsKey(tenantID, follow.TargetID),
+		followCountsKey(tenantID, follow.FollowerID),
+	}
+	return adjustFollowCounts.Run(ctx, c.client, keys, delta, int(FollowEventTTL.Seconds())).Err()
+}
+
+// followCountsKey returns the key caching the follow counts of a tenant's profile
+func followCountsKey(tenantID, id string) string {
+	return TenantKeyPrefix + tenantID + ":" + FollowCountsKeyPrefix + id
+}
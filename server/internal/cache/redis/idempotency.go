@@ -0,0 +1,162 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyKeyPrefix is the prefix, after the tenant, of the keys holding
+// idempotency records. Each expires with its record.
+const IdempotencyKeyPrefix = "idempotency:"
+
+// completeIdempotencyKey replaces an idempotency record (KEYS[1]) still in
+// flight under a token (ARGV[1]) with its completed record (ARGV[2]), which
+// expires in ARGV[3] milliseconds
+var completeIdempotencyKey = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value then
+	local record = cjson.decode(value)
+	if record.token == ARGV[1] and record.status_code == 0 then
+		return redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	end
+end
+return 0
+`)
+
+// releaseIdempotencyKey deletes an idempotency record (KEYS[1]) if its request
+// is still in flight under a token (ARGV[1]), leaving recorded responses and
+// reservations taken over since alone
+var releaseIdempotencyKey = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value then
+	local record = cjson.decode(value)
+	if record.token == ARGV[1] and record.status_code == 0 then
+		return redis.call('DEL', KEYS[1])
+	end
+end
+return 0
+`)
+
+// redactIdempotencyKey replaces an idempotency record (KEYS[1]) with its
+// redacted copy (ARGV[2]), keeping its expiry, unless it changed since it was
+// read (ARGV[1])
+var redactIdempotencyKey = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'KEEPTTL')
+	return 1
+end
+return 0
+`)
+
+// ReserveIdempotencyKey stores an in-flight record for a key, unless a record
+// holds it, which is returned instead
+func (c *Cache) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	key := idempotencyKey(tenant.FromContext(ctx), record.Key)
+	for {
+		reserved, err := c.client.SetNX(ctx, key, data, idempotencyTTL(record)).Result()
+		if err != nil || reserved {
+			return nil, err
+		}
+
+		value, err := c.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// The record expired or was released since SETNX; try again
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing := &models.IdempotencyRecord{}
+		if err := json.Unmarshal(value, existing); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+}
+
+// CompleteIdempotencyKey stores the response of a key still reserved with the
+// record's token
+func (c *Cache) CompleteIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	key := idempotencyKey(tenant.FromContext(ctx), record.Key)
+	ttl := idempotencyTTL(record).Milliseconds()
+	return completeIdempotencyKey.Run(ctx, c.client, []string{key}, record.Token, data, ttl).Err()
+}
+
+// ReleaseIdempotencyKey removes a key still in flight under the record's token
+func (c *Cache) ReleaseIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	key := idempotencyKey(tenant.FromContext(ctx), record.Key)
+	return releaseIdempotencyKey.Run(ctx, c.client, []string{key}, record.Token).Err()
+}
+
+// DeleteExpiredIdempotencyKeys does nothing, as Redis expires records itself
+func (c *Cache) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// RedactIdempotencyResponses empties the tenant's recorded response bodies
+// containing text. Bodies are encoded in the records, so every record of the
+// tenant is read.
+func (c *Cache) RedactIdempotencyResponses(ctx context.Context, text string) (int64, error) {
+	var redacted int64
+	iter := c.client.Scan(ctx, 0, idempotencyKey(tenant.FromContext(ctx), "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		value, err := c.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return redacted, err
+		}
+		record := &models.IdempotencyRecord{}
+		if err := json.Unmarshal(value, record); err != nil {
+			return redacted, err
+		}
+		if !record.Completed() || !bytes.Contains(record.Body, []byte(text)) {
+			continue
+		}
+
+		record.ContentType, record.Body = "", nil
+		data, err := json.Marshal(record)
+		if err != nil {
+			return redacted, err
+		}
+		// A record replaced since it was read no longer holds this response
+		n, err := redactIdempotencyKey.Run(ctx, c.client, []string{key}, value, data).Int64()
+		if err != nil {
+			return redacted, err
+		}
+		redacted += n
+	}
+	return redacted, iter.Err()
+}
+
+// idempotencyTTL returns how long a record has left before it expires
+func idempotencyTTL(record *models.IdempotencyRecord) time.Duration {
+	ttl := time.Until(record.ExpiresAt)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return ttl
+}
+
+// idempotencyKey returns the key holding the idempotency record of a tenant's key
+func idempotencyKey(tenantID, key string) string {
+	return TenantKeyPrefix + tenantID + ":" + IdempotencyKeyPrefix + key
+}
@@ -0,0 +1,176 @@
+package cache
+
+import "hash/fnv"
+
+// W-TinyLFU sizing, as a share of the capacity
+const (
+	// tinyLFUWindowShare is the share of the capacity given to the admission
+	// window, where new keys prove themselves before competing for the rest
+	tinyLFUWindowShare = 0.01
+	// tinyLFUProtectedShare is the share of the main space given to keys used
+	// again since admission
+	tinyLFUProtectedShare = 0.8
+)
+
+// tinyLFUPolicy is a W-TinyLFU eviction policy. New keys enter an LRU window;
+// keys falling out of it compete with the main space's next victim, and the
+// one a frequency sketch estimates as used less often recently is evicted.
+// The main space is a segmented LRU, where keys used again after admission
+// are protected from eviction until they go unused long enough.
+type tinyLFUPolicy struct {
+	window    *lruList
+	probation *lruList
+	protected *lruList
+
+	windowCapacity    int
+	mainCapacity      int
+	protectedCapacity int
+
+	sketch *countMinSketch
+}
+
+func newTinyLFUPolicy(capacity int) *tinyLFUPolicy {
+	windowCapacity := int(float64(capacity) * tinyLFUWindowShare)
+	if windowCapacity < 1 {
+		windowCapacity = 1
+	}
+	mainCapacity := capacity - windowCapacity
+	return &tinyLFUPolicy{
+		window:            newLRUList(),
+		probation:         newLRUList(),
+		protected:         newLRUList(),
+		windowCapacity:    windowCapacity,
+		mainCapacity:      mainCapacity,
+		protectedCapacity: int(float64(mainCapacity) * tinyLFUProtectedShare),
+		sketch:            newCountMinSketch(capacity),
+	}
+}
+
+func (p *tinyLFUPolicy) touch(key string, stored bool) {
+	// Misses count too, so keys looked up often are admitted once stored
+	p.sketch.increment(key)
+	if !stored {
+		return
+	}
+
+	switch {
+	case p.window.contains(key):
+		p.window.moveToFront(key)
+	case p.protected.contains(key):
+		p.protected.moveToFront(key)
+	case p.probation.remove(key):
+		p.protected.pushFront(key)
+		if p.protected.len() > p.protectedCapacity {
+			demoted, _ := p.protected.back()
+			p.protected.remove(demoted)
+			p.probation.pushFront(demoted)
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) add(key string) []string {
+	p.sketch.increment(key)
+	p.window.pushFront(key)
+	if p.window.len() <= p.windowCapacity {
+		return nil
+	}
+
+	candidate, _ := p.window.back()
+	p.window.remove(candidate)
+	if p.probation.len()+p.protected.len() < p.mainCapacity {
+		p.probation.pushFront(candidate)
+		return nil
+	}
+
+	victims := p.probation
+	if victims.len() == 0 {
+		victims = p.protected
+	}
+	victim, ok := victims.back()
+	if !ok || p.sketch.estimate(candidate) <= p.sketch.estimate(victim) {
+		return []string{candidate}
+	}
+	victims.remove(victim)
+	p.probation.pushFront(candidate)
+	return []string{victim}
+}
+
+func (p *tinyLFUPolicy) remove(key string) {
+	if !p.window.remove(key) && !p.probation.remove(key) {
+		p.protected.remove(key)
+	}
+}
+
+// countMinSketch estimates how often keys were used recently. Counts saturate
+// at 15 and are halved every sampleSize increments, so old popularity fades.
+type countMinSketch struct {
+	rows       [countMinDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+// countMinDepth is the number of hashed counters per key; the estimate is the
+// smallest of them
+const countMinDepth = 4
+
+// countMinMaxCount is where counters saturate
+const countMinMaxCount = 15
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{mask: uint64(width - 1), sampleSize: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes returns the counter of key in each row, by double hashing
+func (s *countMinSketch) indexes(key string) [countMinDepth]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	lo, hi := sum, sum>>32|1
+
+	var indexes [countMinDepth]uint64
+	for i := range indexes {
+		indexes[i] = (lo + uint64(i)*hi) & s.mask
+	}
+	return indexes
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, index := range s.indexes(key) {
+		if s.rows[i][index] < countMinMaxCount {
+			s.rows[i][index]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.age()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	estimate := uint8(countMinMaxCount)
+	for i, index := range s.indexes(key) {
+		if s.rows[i][index] < estimate {
+			estimate = s.rows[i][index]
+		}
+	}
+	return estimate
+}
+
+// age halves every counter
+func (s *countMinSketch) age() {
+	for _, row := range s.rows {
+		for i := range row {
+			row[i] >>= 1
+		}
+	}
+	s.additions /= 2
+}
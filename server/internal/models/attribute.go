@@ -0,0 +1,47 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// Types of custom profile attributes
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeInteger = "integer"
+	AttributeBoolean = "boolean"
+)
+
+// attributeNamePattern restricts attribute names to identifiers that are safe
+// in JSON paths and query parameters
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// ValidAttributeName reports whether name can name a custom attribute
+func ValidAttributeName(name string) bool {
+	return attributeNamePattern.MatchString(name)
+}
+
+// AttributeDefinition describes a custom attribute that a tenant's profiles may
+// carry in Profile.Attributes
+type AttributeDefinition struct {
+	Name string `json:"name"`
+	// Type is one of the Attribute* types
+	Type string `json:"type"`
+	// Required attributes must be present on every profile written
+	Required bool `json:"required"`
+	// Enum lists the values a string attribute may take; empty allows any
+	Enum []string `json:"enum,omitempty"`
+	// MaxLength caps the length, in characters, of a string attribute; zero is unlimited
+	MaxLength int       `json:"max_length,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PutAttributeDefinitionRequest defines or redefines a custom attribute
+type PutAttributeDefinitionRequest struct {
+	Type      string   `json:"type" binding:"required,oneof=string number integer boolean"`
+	Required  bool     `json:"required"`
+	Enum      []string `json:"enum" binding:"omitempty,dive,required"`
+	MaxLength int      `json:"max_length" binding:"min=0"`
+}
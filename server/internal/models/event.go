@@ -6,6 +6,16 @@ import "time"
 type Event struct {
 	ID        string      `json:"id"`
 	Type      string      `json:"type"`
+	TenantID  string      `json:"tenant_id"`
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
 }
+
+// BatchEvent is the data of the event about a profile written by a batch. The
+// events of a batch share its ID.
+type BatchEvent struct {
+	BatchID string `json:"batch_id"`
+	// Status is "created" or "updated"
+	Status  string   `json:"status"`
+	Profile *Profile `json:"profile"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Follow records that one profile follows another
+type Follow struct {
+	FollowerID string    `json:"follower_id"`
+	TargetID   string    `json:"target_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FollowCounts is how many profiles follow a profile and how many it follows
+type FollowCounts struct {
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+}
+
+// FollowRelationship describes how two profiles follow each other
+type FollowRelationship struct {
+	Following  bool `json:"following"`
+	FollowedBy bool `json:"followed_by"`
+	Mutual     bool `json:"mutual"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers a request made with an idempotency key and, once
+// it completes, the response to replay to retries of it
+type IdempotencyRecord struct {
+	Key string `json:"key"`
+	// Fingerprint identifies the request, so that reusing the key for a
+	// different request can be detected
+	Fingerprint string `json:"fingerprint"`
+	// Token identifies the reservation, so that a request that outlived its
+	// lease cannot complete or release the key for another that took it over
+	Token string `json:"token"`
+	// StatusCode is the response status, or 0 while the request is in flight
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Completed reports whether the request's response has been recorded
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
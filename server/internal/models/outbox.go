@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxMessage is a queue message stored alongside the change that produced
+// it, waiting to be relayed to the queue
+type OutboxMessage struct {
+	ID          string          `json:"id"`
+	AggregateID string          `json:"aggregate_id"`
+	Channel     string          `json:"channel"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Erasure statuses
+const (
+	ErasurePending   = "pending"
+	ErasureCompleted = "completed"
+)
+
+// ErasureReceipt records a request to erase everything held about a profile
+// and, once the erasure has run, what it removed. Receipts outlive the
+// profiles they describe, so they hold no personal data besides the ID.
+type ErasureReceipt struct {
+	ID          string     `json:"id"`
+	ProfileID   string     `json:"profile_id"`
+	TenantID    string     `json:"-"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// The counts of what the erasure removed, set once it completes
+	ImagesDeleted  int `json:"images_deleted"`
+	FollowsDeleted int `json:"follows_deleted"`
+	EventsDeleted  int `json:"events_deleted"`
+}
+
+// Completed reports whether the erasure has run
+func (r *ErasureReceipt) Completed() bool {
+	return r.Status == ErasureCompleted
+}
+
+// DataExport is everything held about a profile, as handed to its data
+// subject. Images lists the uploaded images still stored, whose content is
+// exported alongside.
+type DataExport struct {
+	ProfileID  string    `json:"profile_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Profile is the stored profile, which may be soft-deleted
+	Profile *Profile `json:"profile"`
+	// Cached is the copy of the profile held in the cache, if any
+	Cached    *Profile         `json:"cached"`
+	Revisions []*Revision      `json:"revisions"`
+	Events    []*ExportedEvent `json:"events"`
+	Images    []*ExportedImage `json:"images"`
+	Erasure   *ErasureReceipt  `json:"erasure,omitempty"`
+}
+
+// ExportedEvent is a stored event published about a profile
+type ExportedEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Channel   string          `json:"channel"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// ExportedImage describes an uploaded image of a profile
+type ExportedImage struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
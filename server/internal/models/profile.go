@@ -1,30 +1,59 @@
 package models
 
 import (
+	"maps"
+	"slices"
 	"time"
 )
 
 type Profile struct {
-	ID        string    `json:"id" bson:"_id,omitempty"`
-	Name      string    `json:"name" bson:"name"`
-	Email     string    `json:"email" bson:"email"`
-	Bio       string    `json:"bio" bson:"bio"`
-	ImageURLs []string  `json:"image_urls" bson:"image_urls"`
-	CreatedAt time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
-	GetFrom   string    `json:"get_from" bson:"get_from"`
+	ID         string                 `json:"id" bson:"_id,omitempty"`
+	TenantID   string                 `json:"-" bson:"tenant_id"`
+	Name       string                 `json:"name" bson:"name"`
+	Email      string                 `json:"email" bson:"email"`
+	Bio        string                 `json:"bio" bson:"bio"`
+	ImageURLs  []string               `json:"image_urls" bson:"image_urls"`
+	Attributes map[string]interface{} `json:"attributes" bson:"attributes"`
+	Tags       []string               `json:"tags" bson:"tags"`
+	Version    int                    `json:"version" bson:"version"`
+	CreatedAt  time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at" bson:"updated_at"`
+	DeletedAt  *time.Time             `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	GetFrom    string                 `json:"get_from" bson:"get_from"`
+}
+
+// Copy copies a profile, so neither the copy nor the original sees the other's
+// later changes
+func (p *Profile) Copy() *Profile {
+	copied := *p
+	copied.ImageURLs = slices.Clone(p.ImageURLs)
+	copied.Tags = slices.Clone(p.Tags)
+	copied.Attributes = maps.Clone(p.Attributes)
+	if p.DeletedAt != nil {
+		deletedAt := *p.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+	return &copied
 }
 
 type CreateProfileRequest struct {
-	Name  string `json:"name" binding:"required"`
-	Email string `json:"email" binding:"required,email"`
-	Bio   string `json:"bio"`
+	Name       string                 `json:"name" binding:"required"`
+	Email      string                 `json:"email" binding:"required,email"`
+	Bio        string                 `json:"bio"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Tags       []string               `json:"tags"`
 }
 
-type UpdateProfileRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email" binding:"omitempty,email"`
-	Bio   string `json:"bio"`
+// ReplaceProfileRequest is the complete editable document of a profile, as sent
+// to PUT and as produced by applying a PATCH. Omitted optional fields are cleared.
+// Image URLs are absolute, or the paths of images uploaded to the profile.
+type ReplaceProfileRequest struct {
+	Name       string                 `json:"name" binding:"required"`
+	Email      string                 `json:"email" binding:"required,email"`
+	Bio        string                 `json:"bio"`
+	ImageURLs  []string               `json:"image_urls" binding:"omitempty,dive,url|startswith=/api/v1/profiles/"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Tags       []string               `json:"tags"`
 }
 
 type ProfileResponse struct {
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Revision operations
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionRestore  = "restore"
+	RevisionRevert   = "revert"
+	RevisionBaseline = "baseline"
+)
+
+// Revision is a recorded change to a profile. Its number is the profile
+// version the change produced.
+type Revision struct {
+	ProfileID string `json:"profile_id"`
+	Revision  int    `json:"revision"`
+	Operation string `json:"operation"`
+	Actor     string `json:"actor"`
+	// Snapshot is the full profile as it was after the change
+	Snapshot *Profile `json:"snapshot"`
+	// Changes lists the fields the change modified
+	Changes   []FieldChange `json:"changes"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// FieldChange is the old and new value of a single profile field
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
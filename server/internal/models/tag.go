@@ -0,0 +1,53 @@
+package models
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxTagsPerProfile caps how many tags a profile may carry
+const MaxTagsPerProfile = 50
+
+// tagPattern restricts normalized tags to short slugs, which need no escaping
+// in query strings or CSV cells
+var tagPattern = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}][\p{Ll}\p{Lo}\p{N}_./+#&-]{0,49}$`)
+
+// NormalizeTag returns the canonical form of a tag: lowercased, with runs of
+// whitespace replaced by hyphens, so that "Cloud Computing" and
+// "cloud-computing" are the same tag. It reports false for tags that are empty
+// or not a valid slug once normalized.
+func NormalizeTag(tag string) (string, bool) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+	return normalized, tagPattern.MatchString(normalized)
+}
+
+// NormalizeTags normalizes tags and returns them sorted without duplicates. It
+// returns the first invalid tag, if any.
+func NormalizeTags(tags []string) ([]string, string, bool) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		canonical, ok := NormalizeTag(tag)
+		if !ok {
+			return nil, tag, false
+		}
+		if !seen[canonical] {
+			seen[canonical] = true
+			normalized = append(normalized, canonical)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, "", true
+}
+
+// TagCount is the number of profiles carrying a tag, as a facet of a listing
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagsRequest adds tags to a profile
+type TagsRequest struct {
+	Tags []string `json:"tags" binding:"required,min=1,max=50"`
+}
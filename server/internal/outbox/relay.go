@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/queue"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// claimLease is how long a claimed message is hidden from other relays
+	claimLease = 30 * time.Second
+	// baseBackoff is the delay before retrying a message that failed once
+	baseBackoff = time.Second
+	// maxBackoff caps the delay between retries of a failing message
+	maxBackoff = 5 * time.Minute
+	// cleanupInterval is how often delivered messages past retention are removed
+	cleanupInterval = time.Hour
+)
+
+// Relay publishes pending outbox messages to the queue
+type Relay struct {
+	store        repository.Outbox
+	pollInterval time.Duration
+	batchSize    int
+	retention    time.Duration
+
+	mu    sync.RWMutex
+	queue queue.Queue
+}
+
+// NewRelay creates a new Relay. The queue may be nil, in which case messages
+// accumulate in the outbox until one is provided with SetQueue.
+func NewRelay(store repository.Outbox, q queue.Queue, pollInterval time.Duration, batchSize int, retention time.Duration) *Relay {
+	return &Relay{
+		store:        store,
+		queue:        q,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		retention:    retention,
+	}
+}
+
+// SetQueue sets the queue messages are published to
+func (r *Relay) SetQueue(q queue.Queue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queue = q
+}
+
+// currentQueue returns the queue messages are published to, if any
+func (r *Relay) currentQueue() queue.Queue {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.queue
+}
+
+// Run relays messages until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Drain the backlog batch by batch before waiting for the next tick
+			for {
+				relayed, err := r.RelayBatch(ctx)
+				if err != nil {
+					logger.Log.Error("Failed to relay outbox messages", zap.Error(err))
+					break
+				}
+				if relayed < r.batchSize || ctx.Err() != nil {
+					break
+				}
+			}
+			r.updateLagMetrics(ctx)
+
+			if time.Since(lastCleanup) >= cleanupInterval {
+				r.cleanup(ctx)
+				lastCleanup = time.Now()
+			}
+		}
+	}
+}
+
+// RelayBatch claims and publishes one batch of pending messages, returning how
+// many were claimed
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	q := r.currentQueue()
+	if q == nil {
+		return 0, nil
+	}
+
+	messages, err := r.store.ClaimPending(ctx, r.batchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, message := range messages {
+		if err := q.Publish(ctx, message.Channel, json.RawMessage(message.Payload)); err != nil {
+			metrics.OutboxRelayedTotal.WithLabelValues("error").Inc()
+			retryAt := time.Now().Add(backoff(message.Attempts))
+			logger.Log.Warn("Failed to relay outbox message, will retry",
+				zap.String("id", message.ID),
+				zap.Int("attempts", message.Attempts),
+				zap.Time("retry_at", retryAt),
+				zap.Error(err),
+			)
+			if err := r.store.MarkFailed(ctx, message, err, retryAt); err != nil {
+				logger.Log.Error("Failed to record outbox failure", zap.String("id", message.ID), zap.Error(err))
+			}
+			continue
+		}
+
+		metrics.OutboxRelayedTotal.WithLabelValues("success").Inc()
+		if err := r.store.MarkSent(ctx, message); err != nil {
+			// The lease will expire and the message will be published again;
+			// consumers must tolerate duplicates
+			logger.Log.Error("Failed to mark outbox message sent", zap.String("id", message.ID), zap.Error(err))
+		}
+	}
+
+	return len(messages), nil
+}
+
+// updateLagMetrics exports the size and age of the outbox backlog
+func (r *Relay) updateLagMetrics(ctx context.Context) {
+	stats, err := r.store.Stats(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			logger.Log.Error("Failed to read outbox stats", zap.Error(err))
+		}
+		return
+	}
+	metrics.OutboxPendingMessages.Set(float64(stats.Pending))
+	metrics.OutboxOldestPendingAge.Set(stats.OldestPendingAge.Seconds())
+}
+
+// cleanup removes delivered messages older than the retention period
+func (r *Relay) cleanup(ctx context.Context) {
+	deleted, err := r.store.DeleteSent(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		logger.Log.Error("Failed to clean up outbox", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		logger.Log.Info("Cleaned up delivered outbox messages", zap.Int64("count", deleted))
+	}
+}
+
+// backoff returns the retry delay after the given number of attempts
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// NewMessage builds an outbox message carrying a domain event for the given channel
+func NewMessage(channel, aggregateID string, event *models.Event) (*models.OutboxMessage, error) {
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(&queue.Message{
+		Type:      event.Type,
+		Data:      eventData,
+		Timestamp: event.Timestamp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OutboxMessage{
+		ID:          event.ID,
+		AggregateID: aggregateID,
+		Channel:     channel,
+		Payload:     payload,
+		CreatedAt:   event.Timestamp,
+	}, nil
+}
@@ -0,0 +1,203 @@
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// keySize is the size in bytes of every key: AES-256 and HMAC-SHA256 keys alike
+const keySize = 32
+
+// maxKeyIDLength is the longest key ID the stores have room for
+const maxKeyIDLength = 64
+
+// keyringFile is the JSON layout of a keyring file. Keys are base64 encoded.
+//
+//	{
+//	  "primary": "2024-06",
+//	  "keys": {"2024-06": "...", "2023-11": "..."},
+//	  "index_key": "..."
+//	}
+type keyringFile struct {
+	// Primary is the ID of the key new values are sealed with
+	Primary string `json:"primary"`
+	// Keys maps key IDs to key encryption keys. Retired keys stay listed until
+	// no stored value is sealed with them.
+	Keys map[string]string `json:"keys"`
+	// IndexKey keys the blind index. Changing it invalidates every stored index.
+	IndexKey string `json:"index_key"`
+}
+
+// Keyring is a Codec sealing values with envelope encryption under the key
+// encryption keys it holds
+type Keyring struct {
+	primary  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// LoadKeyring reads a keyring file
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("pii: parse keyring %s: %w", path, err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		if keys[id], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("pii: decode key %q: %w", id, err)
+		}
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(file.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("pii: decode index key: %w", err)
+	}
+	return NewKeyring(file.Primary, keys, indexKey)
+}
+
+// NewKeyring creates a keyring sealing new values with the key primary, which
+// must be one of keys. Every key, including indexKey, must be 32 bytes long.
+func NewKeyring(primary string, keys map[string][]byte, indexKey []byte) (*Keyring, error) {
+	if primary == "" {
+		return nil, errors.New("pii: keyring has no primary key")
+	}
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("pii: primary key %q is not in the keyring", primary)
+	}
+	if len(indexKey) != keySize {
+		return nil, fmt.Errorf("pii: index key must be %d bytes", keySize)
+	}
+
+	ring := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys)), indexKey: indexKey}
+	for id, key := range keys {
+		// Key IDs are stored with every sealed row
+		if id == "" || len(id) > maxKeyIDLength {
+			return nil, fmt.Errorf("pii: invalid key ID %q", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("pii: key %q must be %d bytes", id, keySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys[id] = aead
+	}
+	return ring, nil
+}
+
+// KeyID returns the ID of the primary key
+func (k *Keyring) KeyID() string {
+	return k.primary
+}
+
+// Seal encrypts a value under a fresh data key, which is wrapped with the
+// primary key. The key ID is bound to the wrapped data key, so a value cannot
+// be opened as if it had been sealed with another key.
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Layout: wrap nonce | wrapped data key | value nonce | sealed value
+	sealed, err := seal(k.keys[k.primary], nil, dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+	if sealed, err = seal(data, sealed, []byte(plaintext), nil); err != nil {
+		return "", err
+	}
+	return SealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed with the key keyID
+func (k *Keyring) Open(keyID, value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SealedPrefix))
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	wrappedSize := kek.NonceSize() + keySize + kek.Overhead()
+	if len(sealed) < wrappedSize {
+		return "", ErrMalformed
+	}
+	dataKey, err := open(kek, sealed[:wrappedSize], []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(data, sealed[wrappedSize:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns the hex-encoded HMAC-SHA256 of a value under the index key
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newAEAD returns AES-256-GCM keyed with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext under a random nonce, appending the nonce followed
+// by the ciphertext to dst
+func seal(aead cipher.AEAD, dst, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, additional), nil
+}
+
+// open decrypts a nonce followed by ciphertext, as returned by seal
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,95 @@
+package pii
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func TestKeyringSealsAndOpens(t *testing.T) {
+	old, err := NewKeyring("old", map[string][]byte{"old": testKey(1)}, testKey(9))
+	require.NoError(t, err)
+	ring, err := NewKeyring("new", map[string][]byte{"old": testKey(1), "new": testKey(2)}, testKey(9))
+	require.NoError(t, err)
+
+	sealed, err := ring.Seal("jane@example.com")
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, sealed, "jane")
+
+	// Sealing is randomized, so equal values do not look alike
+	again, err := ring.Seal("jane@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	opened, err := ring.Open("new", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", opened)
+
+	// Values sealed with a retired key stay readable while it is in the ring
+	retired, err := old.Seal("old@example.com")
+	require.NoError(t, err)
+	opened, err = ring.Open("old", retired)
+	require.NoError(t, err)
+	assert.Equal(t, "old@example.com", opened)
+
+	// A value only opens under the key ID it was sealed with
+	_, err = ring.Open("old", sealed)
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = ring.Open("missing", sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = ring.Open("new", SealedPrefix+"AAAA")
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	// Values stored before encryption was enabled are returned as they are
+	opened, err = ring.Open("", "plain@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "plain@example.com", opened)
+
+	// The index key, not the sealing key, determines the blind index
+	assert.Equal(t, old.BlindIndex("jane@example.com"), ring.BlindIndex("jane@example.com"))
+	assert.NotEqual(t, ring.BlindIndex("jane@example.com"), ring.BlindIndex("john@example.com"))
+	assert.NotContains(t, ring.BlindIndex("jane@example.com"), "@")
+}
+
+func TestNewKeyringValidatesKeys(t *testing.T) {
+	_, err := NewKeyring("", map[string][]byte{"a": testKey(1)}, testKey(9))
+	assert.Error(t, err)
+	_, err = NewKeyring("b", map[string][]byte{"a": testKey(1)}, testKey(9))
+	assert.Error(t, err)
+	_, err = NewKeyring("a", map[string][]byte{"a": testKey(1)[:16]}, testKey(9))
+	assert.Error(t, err)
+	_, err = NewKeyring("a", map[string][]byte{"a": testKey(1)}, nil)
+	assert.Error(t, err)
+}
+
+func TestNewCodec(t *testing.T) {
+	codec, err := NewCodec("")
+	require.NoError(t, err)
+	assert.Equal(t, Plaintext, codec)
+	assert.Equal(t, "jane@example.com", codec.BlindIndex("jane@example.com"))
+
+	encode := base64.StdEncoding.EncodeToString
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	contents := `{"primary": "k1", "keys": {"k1": "` + encode(testKey(1)) + `"}, "index_key": "` + encode(testKey(9)) + `"}`
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+	codec, err = NewCodec(path)
+	require.NoError(t, err)
+	assert.Equal(t, "k1", codec.KeyID())
+	sealed, err := codec.Seal("jane@example.com")
+	require.NoError(t, err)
+
+	// Without the keyring, sealed values cannot be read
+	_, err = Plaintext.Open("k1", sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
@@ -0,0 +1,83 @@
+// Package pii protects personally identifiable profile fields, such as email
+// addresses, where they are stored at rest.
+//
+// Values are sealed with envelope encryption: each value is encrypted with its
+// own random data key, which is in turn encrypted with a key encryption key
+// from a Keyring. Stored values carry the ID of the key they were sealed with,
+// so keys can be rotated while older values remain readable. Equality lookups
+// on a sealed value go through its blind index, a keyed hash of the plaintext.
+package pii
+
+import (
+	"errors"
+	"strings"
+)
+
+// SealedPrefix starts every sealed value, telling it apart from a plaintext
+// value stored before encryption was enabled. It contains no LIKE wildcards.
+const SealedPrefix = "enc:v1:"
+
+// Errors returned when sealing or opening values
+var (
+	ErrUnknownKey = errors.New("pii: unknown key ID")
+	ErrMalformed  = errors.New("pii: malformed sealed value")
+)
+
+// Codec seals field values for storage and opens them again
+type Codec interface {
+	// KeyID returns the ID of the key new values are sealed with, which is
+	// empty if values are stored in plaintext
+	KeyID() string
+	// Seal encrypts a value with the key named by KeyID
+	Seal(plaintext string) (string, error)
+	// Open decrypts a value sealed with the key keyID. Values that were never
+	// sealed are returned unchanged, whatever the key ID.
+	Open(keyID, value string) (string, error)
+	// BlindIndex returns a deterministic, non-reversible token of a value, for
+	// unique constraints and equality lookups on sealed values
+	BlindIndex(value string) string
+}
+
+// Plaintext is the Codec used when no keyring is configured. It stores values
+// as they are and indexes them by themselves, which is how they were stored
+// before encryption was introduced.
+var Plaintext Codec = plaintext{}
+
+type plaintext struct{}
+
+func (plaintext) KeyID() string { return "" }
+
+func (plaintext) Seal(value string) (string, error) { return value, nil }
+
+func (plaintext) Open(keyID, value string) (string, error) {
+	if IsSealed(value) {
+		return "", ErrUnknownKey
+	}
+	return value, nil
+}
+
+func (plaintext) BlindIndex(value string) string { return value }
+
+// IsSealed reports whether a stored value was sealed by a Keyring
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, SealedPrefix)
+}
+
+// NewCodec loads the keyring at path, or returns Plaintext if path is empty
+func NewCodec(path string) (Codec, error) {
+	if path == "" {
+		return Plaintext, nil
+	}
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// EmailDomain returns the lowercased domain of an email address, which is how
+// listings filter by domain
+func EmailDomain(email string) string {
+	_, domain, _ := strings.Cut(email, "@")
+	return strings.ToLower(domain)
+}
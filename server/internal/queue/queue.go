@@ -19,6 +19,10 @@ type Queue interface {
 	Publish(ctx context.Context, channel string, message interface{}) error
 	// Subscribe subscribes to messages from a queue
 	Subscribe(ctx context.Context, channel string, handler func(*Message) error) error
+	// SubscribeCopies subscribes to copies of the messages published to a
+	// channel, kept in a queue of their own for the named group of consumers,
+	// so neither takes messages from the other
+	SubscribeCopies(ctx context.Context, channel, group string, handler func(*Message) error) error
 	// Close closes the queue connection
 	Close() error
 }
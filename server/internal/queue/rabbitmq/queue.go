@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
@@ -14,10 +15,17 @@ import (
 	"go.uber.org/zap"
 )
 
-// Queue implements the queue.Queue interface using RabbitMQ
+// Queue implements the queue.Queue interface using RabbitMQ. Messages to a
+// channel are published through a fanout exchange named after it, which feeds
+// the channel's queue and the queues of SubscribeCopies.
 type Queue struct {
 	conn    *amqp091.Connection
 	channel *amqp091.Channel
+
+	mu         sync.Mutex
+	exchanges  map[string]bool // channels whose exchange exists
+	queues     map[string]bool // queues declared and bound to their exchange
+	copiesOnly map[string]bool // channels read only through SubscribeCopies
 }
 
 // NewQueue creates a new RabbitMQ queue
@@ -51,11 +59,25 @@ func NewQueue(cfg *config.Config) (*Queue, error) {
 	}
 
 	return &Queue{
-		conn:    conn,
-		channel: channel,
+		conn:       conn,
+		channel:    channel,
+		exchanges:  make(map[string]bool),
+		queues:     make(map[string]bool),
+		copiesOnly: make(map[string]bool),
 	}, nil
 }
 
+// SetCopiesOnly marks channels that are only read through SubscribeCopies.
+// Publishing to them does not declare the channel's own queue, which would
+// otherwise keep every message with no one to consume it.
+func (q *Queue) SetCopiesOnly(channels ...string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, channel := range channels {
+		q.copiesOnly[channel] = true
+	}
+}
+
 // Publish publishes a message to a RabbitMQ queue
 func (q *Queue) Publish(ctx context.Context, queueName string, message interface{}) error {
 	// Skip publishing if channel is not initialized
@@ -65,6 +87,15 @@ func (q *Queue) Publish(ctx context.Context, queueName string, message interface
 
 	start := time.Now()
 
+	if err := q.declareChannel(queueName, false); err != nil {
+		logger.Log.Error("Failed to declare queue",
+			zap.String("queue", queueName),
+			zap.Error(err),
+		)
+		metrics.QueueOperationsTotal.WithLabelValues("publish", "error").Inc()
+		return err
+	}
+
 	data, err := json.Marshal(message)
 	if err != nil {
 		logger.Log.Error("Failed to marshal message",
@@ -76,8 +107,8 @@ func (q *Queue) Publish(ctx context.Context, queueName string, message interface
 	}
 
 	err = q.channel.PublishWithContext(ctx,
-		"",        // exchange
-		queueName, // routing key
+		queueName, // exchange
+		"",        // routing key
 		false,     // mandatory
 		false,     // immediate
 		amqp091.Publishing{
@@ -103,7 +134,75 @@ func (q *Queue) Publish(ctx context.Context, queueName string, message interface
 
 // Subscribe subscribes to messages from a RabbitMQ queue
 func (q *Queue) Subscribe(ctx context.Context, queueName string, handler func(*queue.Message) error) error {
-	// Declare the queue
+	if err := q.declareChannel(queueName, true); err != nil {
+		return err
+	}
+	return q.consume(ctx, queueName, handler)
+}
+
+// SubscribeCopies subscribes to copies of the messages published to a
+// channel, from the queue <channel>.<group> bound to the channel's exchange.
+// Consumers of the same group share the copies.
+func (q *Queue) SubscribeCopies(ctx context.Context, channel, group string, handler func(*queue.Message) error) error {
+	queueName := channel + "." + group
+	if err := q.declareExchange(channel); err != nil {
+		return err
+	}
+	if err := q.bindQueue(channel, queueName); err != nil {
+		return err
+	}
+	return q.consume(ctx, queueName, handler)
+}
+
+// declareChannel declares the exchange messages to a channel are published
+// through and, unless the channel is read only through copies or subscribe is
+// set, the channel's queue bound to it. Messages published before any queue is
+// bound to the exchange are dropped.
+func (q *Queue) declareChannel(channel string, subscribe bool) error {
+	if err := q.declareExchange(channel); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	copiesOnly := q.copiesOnly[channel]
+	q.mu.Unlock()
+	if copiesOnly && !subscribe {
+		return nil
+	}
+	return q.bindQueue(channel, channel)
+}
+
+// declareExchange declares the fanout exchange of a channel, unless already done
+func (q *Queue) declareExchange(channel string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.exchanges[channel] {
+		return nil
+	}
+
+	err := q.channel.ExchangeDeclare(
+		channel,  // name
+		"fanout", // kind
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		return err
+	}
+	q.exchanges[channel] = true
+	return nil
+}
+
+// bindQueue declares a queue and binds it to an exchange, unless already done
+func (q *Queue) bindQueue(exchange, queueName string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queues[queueName] {
+		return nil
+	}
+
 	_, err := q.channel.QueueDeclare(
 		queueName, // name
 		true,      // durable
@@ -115,7 +214,15 @@ func (q *Queue) Subscribe(ctx context.Context, queueName string, handler func(*q
 	if err != nil {
 		return err
 	}
+	if err := q.channel.QueueBind(queueName, "", exchange, false, nil); err != nil {
+		return err
+	}
+	q.queues[queueName] = true
+	return nil
+}
 
+// consume handles the messages of a queue until ctx is cancelled
+func (q *Queue) consume(ctx context.Context, queueName string, handler func(*queue.Message) error) error {
 	msgs, err := q.channel.Consume(
 		queueName, // queue
 		"",        // consumer
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// AttributeSchemaStore keeps the definitions of the custom attributes the
+// profiles of each tenant may carry. Like profiles, definitions belong to the
+// tenant carried by the context.
+type AttributeSchemaStore interface {
+	// ListAttributeDefinitions returns every attribute definition, by name
+	ListAttributeDefinitions(ctx context.Context) ([]*models.AttributeDefinition, error)
+
+	// PutAttributeDefinition creates or replaces the definition of an
+	// attribute, leaving def holding the stored result
+	PutAttributeDefinition(ctx context.Context, def *models.AttributeDefinition) error
+
+	// DeleteAttributeDefinition removes the definition of an attribute. It
+	// returns ErrAttributeNotFound if there is none. Values already stored on
+	// profiles are kept.
+	DeleteAttributeDefinition(ctx context.Context, name string) error
+}
@@ -0,0 +1,48 @@
+// Package backends opens the storage backend selected by the configuration
+package backends
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/postgresql"
+	"github.com/fernandobarroso/profile-service/internal/repository/sharded"
+	"github.com/fernandobarroso/profile-service/internal/repository/sqlite"
+)
+
+// Open opens the storage backend selected by the configuration.
+// PostgreSQL backends with a keyring must have had their plaintext PII sealed.
+func Open(cfg *config.Config) (repository.Backend, error) {
+	switch cfg.Database.Driver {
+	case "postgres":
+		repo, err := postgresql.NewRepository(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.CheckSealed(context.Background()); err != nil {
+			repo.Close(context.Background())
+			return nil, err
+		}
+		return repo, nil
+	case "sqlite":
+		if cfg.PII.KeyringPath != "" {
+			logger.Log.Warn("The sqlite driver stores PII in plaintext; PII_KEYRING_PATH only seals the cache")
+		}
+		return sqlite.NewRepository(cfg)
+	case "sharded":
+		repo, err := sharded.NewRepository(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.CheckSealed(context.Background()); err != nil {
+			repo.Close(context.Background())
+			return nil, err
+		}
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Database.Driver)
+	}
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// MaxBatchSize is the maximum number of profiles accepted by a single batch write
+const MaxBatchSize = 1000
+
+// Outcomes of a single item in a batch write
+const (
+	BatchCreated   = "created"
+	BatchUpdated   = "updated"
+	BatchDuplicate = "duplicate"
+	BatchInvalid   = "invalid"
+)
+
+// BatchOutcome is the result of writing a single profile in a batch
+type BatchOutcome struct {
+	// Status is one of BatchCreated, BatchUpdated or BatchDuplicate, or
+	// BatchInvalid for a profile the service rejected before writing
+	Status string
+	// Profile is the stored profile, for created and updated items
+	Profile *models.Profile
+	// Previous is the profile as it was before an upsert updated it
+	Previous *models.Profile
+	// Err is why an invalid item was rejected
+	Err error
+}
@@ -0,0 +1,21 @@
+package repository
+
+import "context"
+
+// consistencyTokenKey is the context key for a read consistency token
+type consistencyTokenKey struct{}
+
+// WithConsistencyToken returns a context whose reads must observe the writes
+// covered by token, as returned by Store.ConsistencyToken
+func WithConsistencyToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, consistencyTokenKey{}, token)
+}
+
+// ConsistencyTokenFrom returns the consistency token carried by ctx, if any
+func ConsistencyTokenFrom(ctx context.Context) string {
+	token, _ := ctx.Value(consistencyTokenKey{}).(string)
+	return token
+}
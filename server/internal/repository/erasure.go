@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// ErasureStore keeps the receipts of data-subject erasure requests. Receipts
+// are scoped to the tenant carried by the context and outlive the profiles
+// they describe.
+type ErasureStore interface {
+	// RecordErasure stores a pending receipt, unless the profile already has
+	// one, in which case that receipt is returned instead. It returns nil when
+	// the receipt was stored.
+	RecordErasure(ctx context.Context, receipt *models.ErasureReceipt) (*models.ErasureReceipt, error)
+
+	// GetErasure retrieves the receipt of a profile, returning
+	// ErrErasureNotFound if no erasure was requested
+	GetErasure(ctx context.Context, profileID string) (*models.ErasureReceipt, error)
+
+	// CompleteErasure marks a pending receipt completed, storing its
+	// CompletedAt time and counts
+	CompleteErasure(ctx context.Context, receipt *models.ErasureReceipt) error
+
+	// ListPendingErasures returns up to limit pending receipts of any tenant
+	// requested before the given time, oldest first
+	ListPendingErasures(ctx context.Context, before time.Time, limit int) ([]*models.ErasureReceipt, error)
+}
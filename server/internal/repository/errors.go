@@ -0,0 +1,69 @@
+package repository
+
+import "errors"
+
+// Domain errors returned by stores and services. Implementations wrap the
+// underlying cause, so callers should compare with errors.Is.
+var (
+	// ErrNotFound is returned when a profile is not found
+	ErrNotFound = errors.New("profile not found")
+
+	// ErrRevisionNotFound is returned when a profile has no matching revision
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrConflict is returned when a profile was modified concurrently and no
+	// longer has the version the caller expected
+	ErrConflict = errors.New("profile version conflict")
+
+	// ErrAttributeNotFound is returned when no attribute has the given name
+	ErrAttributeNotFound = errors.New("attribute not defined")
+
+	// ErrErasureNotFound is returned when no erasure was requested for a profile
+	ErrErasureNotFound = errors.New("erasure not found")
+
+	// ErrImageNotFound is returned when a profile has no uploaded image with the given ID
+	ErrImageNotFound = errors.New("image not found")
+
+	// ErrDuplicateEmail is returned when another profile already uses the email
+	ErrDuplicateEmail = errors.New("email address is already in use")
+
+	// ErrValidation is returned when input is rejected. Errors carrying details
+	// about the invalid input are of type *ValidationError.
+	ErrValidation = errors.New("validation failed")
+
+	// ErrUnavailable is returned when a dependency such as the database cannot be reached
+	ErrUnavailable = errors.New("dependency unavailable")
+
+	// ErrIdempotencyKeyInUse is returned when a request with the same
+	// idempotency key is still in progress
+	ErrIdempotencyKeyInUse = errors.New("a request with this idempotency key is in progress")
+
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again
+	// with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+)
+
+// ValidationError describes input that failed validation
+type ValidationError struct {
+	// Field names the offending input field, if the error concerns a single field
+	Field   string
+	Message string
+}
+
+// NewValidationError creates a validation error for a field
+func NewValidationError(field, message string) *ValidationError {
+	return &ValidationError{Field: field, Message: message}
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Unwrap makes every ValidationError match ErrValidation
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// FollowStore keeps the follower graph between profiles. Like profiles, follows
+// belong to the tenant carried by the context. Follows outlive the soft delete
+// of either profile, so that restoring it restores its graph; they are removed
+// with RemoveFollows when the profile is purged.
+type FollowStore interface {
+	// Follow records that followerID follows targetID. It reports false if the
+	// follow already existed, leaving it unchanged and setting follow.CreatedAt
+	// to when it was made.
+	Follow(ctx context.Context, follow *models.Follow) (bool, error)
+
+	// Unfollow removes the follow of followerID on targetID, reporting false if
+	// there was none
+	Unfollow(ctx context.Context, followerID, targetID string) (bool, error)
+
+	// IsFollowing reports whether followerID follows targetID
+	IsFollowing(ctx context.Context, followerID, targetID string) (bool, error)
+
+	// ListFollowers returns a page of the follows on a profile, most recent first
+	ListFollowers(ctx context.Context, profileID string, opts FollowListOptions) (*FollowListResult, error)
+
+	// ListFollowing returns a page of the follows a profile made, most recent first
+	ListFollowing(ctx context.Context, profileID string, opts FollowListOptions) (*FollowListResult, error)
+
+	// ListMutualFollows returns a page of the follows a profile made on profiles
+	// that follow it back, most recent first
+	ListMutualFollows(ctx context.Context, profileID string, opts FollowListOptions) (*FollowListResult, error)
+
+	// CountFollows returns how many profiles follow a profile and how many it follows
+	CountFollows(ctx context.Context, profileID string) (*models.FollowCounts, error)
+
+	// RemoveFollows removes every follow made by or on a profile and returns them
+	RemoveFollows(ctx context.Context, profileID string) ([]*models.Follow, error)
+}
+
+// FollowListOptions controls the pagination of follow listings
+type FollowListOptions struct {
+	// Limit is the maximum number of follows to return
+	Limit int
+	// Cursor is the opaque token returned as NextCursor by a previous page
+	Cursor string
+}
+
+// FollowListResult is a single page of follows
+type FollowListResult struct {
+	Follows    []*models.Follow `json:"follows"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// FollowCursor is the decoded form of a follow pagination token. It records the
+// time and the listed profile's ID of the last follow on a page.
+type FollowCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ProfileID string    `json:"i"`
+}
+
+// Normalize applies defaults and validates the options
+func (o *FollowListOptions) Normalize() error {
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+	return nil
+}
+
+// DecodeCursor parses the options' cursor. It returns nil when the options
+// have no cursor.
+func (o *FollowListOptions) DecodeCursor() (*FollowCursor, error) {
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	var cursor FollowCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ProfileID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	return &cursor, nil
+}
+
+// NewFollowCursor builds the pagination token that resumes after a follow,
+// listed by the ID of the profile on its other side
+func NewFollowCursor(createdAt time.Time, profileID string) string {
+	data, _ := json.Marshal(FollowCursor{CreatedAt: createdAt, ProfileID: profileID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
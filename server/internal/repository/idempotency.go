@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// IdempotencyStore remembers requests made with an idempotency key, so that a
+// retried request can be answered with the original response instead of being
+// performed again. Keys are scoped to the tenant carried by the context.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey stores an in-flight record for record.Key, unless an
+	// unexpired record already holds the key, in which case that record is
+	// returned instead. It returns nil when the key was reserved.
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+
+	// CompleteIdempotencyKey stores the response of a reserved key, if it is
+	// still reserved with record.Token
+	CompleteIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error
+
+	// ReleaseIdempotencyKey removes a key in flight, if it is still reserved
+	// with record.Token, so that the request can be retried. Releasing a missing
+	// key is not an error.
+	ReleaseIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error
+
+	// DeleteExpiredIdempotencyKeys removes the records of every tenant that
+	// expired before the given time
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+
+	// RedactIdempotencyResponses empties the recorded response bodies of the
+	// context tenant that contain text, such as the ID of an erased profile, and
+	// returns how many it emptied. Their status codes are kept, so retries are
+	// still answered without being performed again.
+	RedactIdempotencyResponses(ctx context.Context, text string) (int64, error)
+}
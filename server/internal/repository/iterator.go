@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// ProfileIterator steps through profiles one at a time, so that long listings
+// need not be held in memory. Like sql.Rows, Next advances to the next profile
+// and reports whether there is one; Err reports what stopped it early.
+//
+//	for it.Next() {
+//		use(it.Profile())
+//	}
+//	err := it.Err()
+//
+// The iterator must be closed once it is no longer needed.
+type ProfileIterator interface {
+	// Next advances to the next profile, returning false at the end or on error
+	Next() bool
+	// Profile returns the current profile
+	Profile() *models.Profile
+	// Err returns the error, if any, that ended the iteration
+	Err() error
+	// Close releases the iterator's resources. It is safe to call more than once.
+	Close() error
+}
+
+// ListFunc reads a page of profiles, as Store.List does
+type ListFunc func(ctx context.Context, opts ListOptions) (*ListResult, error)
+
+// listIterator iterates over a listing by reading it a page at a time
+type listIterator struct {
+	ctx     context.Context
+	list    ListFunc
+	opts    ListOptions
+	page    []*models.Profile
+	current *models.Profile
+	done    bool
+	err     error
+}
+
+// NewListIterator returns an iterator over every profile matching opts that
+// reads the listing through list, MaxListLimit profiles at a time. Each page
+// resumes from the cursor of the one before, so it holds no database resources
+// between pages. opts.Limit is ignored.
+func NewListIterator(ctx context.Context, list ListFunc, opts ListOptions) ProfileIterator {
+	opts.Limit = MaxListLimit
+	return &listIterator{ctx: ctx, list: list, opts: opts}
+}
+
+func (it *listIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			it.current = nil
+			return false
+		}
+		result, err := it.list(it.ctx, it.opts)
+		if err != nil {
+			it.err = err
+			continue
+		}
+		it.page = result.Profiles
+		it.opts.Cursor = result.NextCursor
+		it.done = result.NextCursor == ""
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *listIterator) Profile() *models.Profile { return it.current }
+
+func (it *listIterator) Err() error { return it.err }
+
+func (it *listIterator) Close() error {
+	it.page, it.done = nil, true
+	return nil
+}
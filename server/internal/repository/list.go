@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+const (
+	// DefaultListLimit is the page size used when no limit is requested
+	DefaultListLimit = 20
+	// MaxListLimit caps the page size a client can request
+	MaxListLimit = 100
+)
+
+// Sort fields supported by List
+const (
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+	SortByName      = "name"
+)
+
+// ErrInvalidListOptions is returned when list options or a cursor are malformed
+var ErrInvalidListOptions error = &ValidationError{Message: "invalid list options"}
+
+// ListOptions controls filtering, sorting and pagination of profile listings
+type ListOptions struct {
+	// Limit is the maximum number of profiles to return
+	Limit int
+	// Cursor is the opaque token returned as NextCursor by a previous page
+	Cursor string
+
+	// EmailDomain matches profiles whose email address is at this domain
+	EmailDomain string
+	// NamePrefix matches profiles whose name starts with this prefix (case-insensitive)
+	NamePrefix string
+	// CreatedAfter matches profiles created at or after this time
+	CreatedAfter time.Time
+	// CreatedBefore matches profiles created strictly before this time
+	CreatedBefore time.Time
+	// Attributes matches profiles having all of these custom attribute values.
+	// Values are strings, float64s or bools, typed as their attribute is.
+	Attributes map[string]interface{}
+	// Tags matches profiles carrying all of these tags, or any of them with AnyTag
+	Tags []string
+	// AnyTag makes Tags match profiles carrying at least one of the tags
+	AnyTag bool
+
+	// SortBy is one of the SortBy* fields
+	SortBy string
+	// Ascending reverses the default newest/last-first order
+	Ascending bool
+
+	// Deleted lists soft-deleted profiles instead of live ones
+	Deleted bool
+}
+
+// ListResult is a single page of profiles
+type ListResult struct {
+	Profiles   []*models.Profile `json:"profiles"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// Cursor is the decoded form of a pagination token. It records the sort key and
+// ID of the last profile on a page so the next page can resume after it.
+type Cursor struct {
+	SortBy    string `json:"s"`
+	Ascending bool   `json:"a,omitempty"`
+	Value     string `json:"v"`
+	ID        string `json:"i"`
+}
+
+// Normalize applies defaults and validates the options
+func (o *ListOptions) Normalize() error {
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+
+	switch o.SortBy {
+	case "":
+		o.SortBy = SortByCreatedAt
+	case SortByCreatedAt, SortByUpdatedAt, SortByName:
+	default:
+		return fmt.Errorf("%w: unsupported sort field %q", ErrInvalidListOptions, o.SortBy)
+	}
+
+	if !o.CreatedAfter.IsZero() && !o.CreatedBefore.IsZero() && !o.CreatedBefore.After(o.CreatedAfter) {
+		return fmt.Errorf("%w: created_before must be after created_after", ErrInvalidListOptions)
+	}
+
+	for name, value := range o.Attributes {
+		if !models.ValidAttributeName(name) {
+			return fmt.Errorf("%w: invalid attribute name %q", ErrInvalidListOptions, name)
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return fmt.Errorf("%w: attribute %q has an unsupported value", ErrInvalidListOptions, name)
+		}
+	}
+
+	if len(o.Tags) > 0 {
+		tags, invalid, ok := models.NormalizeTags(o.Tags)
+		if !ok {
+			return fmt.Errorf("%w: invalid tag %q", ErrInvalidListOptions, invalid)
+		}
+		o.Tags = tags
+	}
+
+	o.EmailDomain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(o.EmailDomain)), "@")
+	return nil
+}
+
+// DecodeCursor parses the options' cursor, checking it was issued for the same sort order.
+// It returns nil when the options have no cursor.
+func (o *ListOptions) DecodeCursor() (*Cursor, error) {
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	if cursor.SortBy != o.SortBy || cursor.Ascending != o.Ascending {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidListOptions)
+	}
+	if cursor.SortBy != SortByName {
+		if _, err := cursor.Time(); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+		}
+	}
+	return &cursor, nil
+}
+
+// Time returns the cursor value for time-based sort fields
+func (c *Cursor) Time() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, c.Value)
+}
+
+// NewCursor builds the pagination token that resumes after the given profile
+func NewCursor(opts ListOptions, last *models.Profile) string {
+	cursor := Cursor{
+		SortBy:    opts.SortBy,
+		Ascending: opts.Ascending,
+		Value:     SortValue(opts.SortBy, last),
+		ID:        last.ID,
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// SortValue returns the string form of a profile's sort key
+func SortValue(sortBy string, profile *models.Profile) string {
+	switch sortBy {
+	case SortByUpdatedAt:
+		return profile.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case SortByName:
+		return profile.Name
+	default:
+		return profile.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
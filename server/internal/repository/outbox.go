@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// Outbox defines the storage operations of the transactional outbox. Messages
+// are enqueued in the same transaction as the change they describe and relayed
+// to the queue afterwards.
+type Outbox interface {
+	// Enqueue stores a message for relaying. Call it within Store.WithinTx to
+	// commit it atomically with the change it describes.
+	Enqueue(ctx context.Context, message *models.OutboxMessage) error
+
+	// ClaimPending leases up to limit messages that are due for delivery. Claimed
+	// messages are not handed out again until the lease expires.
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error)
+
+	// MarkSent records that a message was delivered
+	MarkSent(ctx context.Context, message *models.OutboxMessage) error
+
+	// MarkFailed records a failed delivery and schedules the next attempt
+	MarkFailed(ctx context.Context, message *models.OutboxMessage, cause error, retryAt time.Time) error
+
+	// DeleteSent removes delivered messages sent before the given time
+	DeleteSent(ctx context.Context, before time.Time) (int64, error)
+
+	// ListForAggregate returns every stored message of an aggregate, delivered
+	// or not, oldest first
+	ListForAggregate(ctx context.Context, aggregateID string) ([]*models.OutboxMessage, error)
+
+	// DeleteForAggregate removes every message of an aggregate, delivered or
+	// not. Messages that were not delivered yet are never relayed.
+	DeleteForAggregate(ctx context.Context, aggregateID string) (int64, error)
+
+	// Stats reports how far behind the relay is
+	Stats(ctx context.Context) (*OutboxStats, error)
+}
+
+// OutboxStats describes the backlog of undelivered outbox messages
+type OutboxStats struct {
+	Pending          int64
+	OldestPendingAge time.Duration
+}
@@ -0,0 +1,131 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// attributeColumns lists the columns read by scanAttributeDefinition, in scan order
+const attributeColumns = `name, type, required, enum, max_length, created_at, updated_at`
+
+// ListAttributeDefinitions returns every attribute definition of the tenant, by name
+func (r *Repository) ListAttributeDefinitions(ctx context.Context) ([]*models.AttributeDefinition, error) {
+	query := `
+		SELECT ` + attributeColumns + `
+		FROM attribute_definitions
+		WHERE tenant_id = $1
+		ORDER BY name
+	`
+
+	// Definitions are read from the primary: writes validate against them
+	rows, err := r.conn(ctx).QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		logger.Log.Error("Failed to list attribute definitions",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	defs := []*models.AttributeDefinition{}
+	for rows.Next() {
+		def, err := scanAttributeDefinition(rows)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// PutAttributeDefinition creates or replaces an attribute definition of the tenant
+func (r *Repository) PutAttributeDefinition(ctx context.Context, def *models.AttributeDefinition) error {
+	query := `
+		INSERT INTO attribute_definitions (tenant_id, ` + attributeColumns + `)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $7)
+		ON CONFLICT (tenant_id, name) DO UPDATE SET
+			type = EXCLUDED.type,
+			required = EXCLUDED.required,
+			enum = EXCLUDED.enum,
+			max_length = EXCLUDED.max_length,
+			updated_at = EXCLUDED.updated_at
+		RETURNING ` + attributeColumns
+
+	enum := def.Enum
+	if enum == nil {
+		enum = []string{}
+	}
+	enumJSON, err := json.Marshal(enum)
+	if err != nil {
+		return err
+	}
+
+	stored, err := scanAttributeDefinition(r.conn(ctx).QueryRowContext(ctx, query,
+		tenant.FromContext(ctx),
+		def.Name,
+		def.Type,
+		def.Required,
+		string(enumJSON),
+		def.MaxLength,
+		time.Now(),
+	))
+	if err != nil {
+		logger.Log.Error("Failed to store attribute definition",
+			zap.String("name", def.Name),
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+
+	*def = *stored
+	return nil
+}
+
+// DeleteAttributeDefinition removes an attribute definition of the tenant
+func (r *Repository) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		DELETE FROM attribute_definitions WHERE tenant_id = $1 AND name = $2
+	`, tenant.FromContext(ctx), name)
+	if err != nil {
+		logger.Log.Error("Failed to delete attribute definition",
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		return repository.ErrAttributeNotFound
+	}
+	return nil
+}
+
+// scanAttributeDefinition reads a definition selected with attributeColumns
+func scanAttributeDefinition(row rowScanner) (*models.AttributeDefinition, error) {
+	var enumJSON []byte
+	def := &models.AttributeDefinition{}
+	if err := row.Scan(
+		&def.Name,
+		&def.Type,
+		&def.Required,
+		&enumJSON,
+		&def.MaxLength,
+		&def.CreatedAt,
+		&def.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(enumJSON, &def.Enum); err != nil {
+		return nil, err
+	}
+	if len(def.Enum) == 0 {
+		def.Enum = nil
+	}
+	return def, nil
+}
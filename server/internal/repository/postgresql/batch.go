@@ -0,0 +1,222 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// importColumns are the columns of the profile_import staging table, in copy order
+var importColumns = []string{"ord", "id", "name", "email", "bio", "image_urls", "attributes", "tags", "created_at", "updated_at", "email_index", "email_domain_index", "pii_key_id"}
+
+// CreateBatch stores new profiles by copying them into a staging table and
+// inserting them from there in a single statement
+func (r *Repository) CreateBatch(ctx context.Context, profiles []*models.Profile, upsert bool) ([]*repository.BatchOutcome, error) {
+	start := time.Now()
+
+	// A statement cannot upsert the same row twice, so repeated emails are
+	// settled before they reach the database
+	outcomes := make([]*repository.BatchOutcome, len(profiles))
+	byEmail := make(map[string]int, len(profiles))
+	for i, profile := range profiles {
+		if _, seen := byEmail[profile.Email]; seen {
+			outcomes[i] = &repository.BatchOutcome{Status: repository.BatchDuplicate}
+			continue
+		}
+		byEmail[profile.Email] = i
+	}
+	if len(byEmail) == 0 {
+		return outcomes, nil
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := r.stageImport(ctx, profiles, outcomes); err != nil {
+			return err
+		}
+
+		// Lock the profiles an upsert may update, to diff them against the result
+		previous := make(map[string]*models.Profile)
+		if upsert {
+			rows, err := r.conn(ctx).QueryContext(ctx, `
+				SELECT `+profileColumns+`
+				FROM profiles
+				WHERE tenant_id = $1 AND deleted_at IS NULL AND email_index IN (SELECT email_index FROM profile_import)
+				FOR UPDATE
+			`, tenantID)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				profile, err := r.scanProfile(rows)
+				if err != nil {
+					return err
+				}
+				previous[profile.Email] = profile
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+
+		onConflict := `DO NOTHING`
+		if upsert {
+			// The email is resealed along with the bio, so both share a key
+			onConflict = `DO UPDATE SET
+				name = EXCLUDED.name,
+				email = EXCLUDED.email,
+				bio = EXCLUDED.bio,
+				email_domain_index = EXCLUDED.email_domain_index,
+				pii_key_id = EXCLUDED.pii_key_id,
+				image_urls = EXCLUDED.image_urls,
+				attributes = EXCLUDED.attributes,
+				tags = EXCLUDED.tags,
+				updated_at = EXCLUDED.updated_at,
+				version = profiles.version + 1`
+		}
+
+		query := `
+			INSERT INTO profiles (id, name, email, bio, image_urls, attributes, tags, version, created_at, updated_at, tenant_id, email_index, email_domain_index, pii_key_id)
+			SELECT id, name, email, bio, image_urls, attributes, tags, 1, created_at, updated_at, $1, email_index, email_domain_index, pii_key_id
+			FROM profile_import
+			ORDER BY ord
+			ON CONFLICT (tenant_id, email_index) WHERE deleted_at IS NULL ` + onConflict + `
+			RETURNING ` + profileColumns
+
+		rows, err := r.conn(ctx).QueryContext(ctx, query, tenantID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			stored, err := r.scanProfile(rows)
+			if err != nil {
+				return err
+			}
+			i := byEmail[stored.Email]
+			outcome := &repository.BatchOutcome{Status: repository.BatchCreated, Profile: stored}
+			// A returned row with a different ID is an existing profile the upsert updated
+			if stored.ID != profiles[i].ID {
+				outcome.Status = repository.BatchUpdated
+				outcome.Previous = previous[stored.Email]
+			}
+			outcomes[i] = outcome
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("create_batch", "error").Inc()
+		logger.Log.Error("Failed to create profile batch",
+			zap.Int("size", len(profiles)),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	// Rows skipped by ON CONFLICT DO NOTHING are not returned
+	for i := range outcomes {
+		if outcomes[i] == nil {
+			outcomes[i] = &repository.BatchOutcome{Status: repository.BatchDuplicate}
+		}
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("create_batch", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("create_batch").Observe(time.Since(start).Seconds())
+	return outcomes, nil
+}
+
+// stageImport copies the profiles that have no outcome yet into the
+// transaction's profile_import staging table
+func (r *Repository) stageImport(ctx context.Context, profiles []*models.Profile, outcomes []*repository.BatchOutcome) error {
+	tx := r.conn(ctx).(*sql.Tx)
+
+	// The staging table lives until the transaction ends; a second batch in the
+	// same transaction reuses it
+	if _, err := tx.ExecContext(ctx, `
+		CREATE TEMP TABLE IF NOT EXISTS profile_import (
+			ord INTEGER NOT NULL,
+			id VARCHAR(36) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			email TEXT NOT NULL,
+			bio TEXT,
+			image_urls JSONB,
+			attributes JSONB NOT NULL,
+			tags JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			email_index TEXT NOT NULL,
+			email_domain_index TEXT NOT NULL,
+			pii_key_id VARCHAR(64) NOT NULL
+		) ON COMMIT DROP
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `TRUNCATE profile_import`); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("profile_import", importColumns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, profile := range profiles {
+		if outcomes[i] != nil {
+			continue
+		}
+		imageURLs := profile.ImageURLs
+		if imageURLs == nil {
+			imageURLs = []string{}
+		}
+		imageURLsJSON, err := json.Marshal(imageURLs)
+		if err != nil {
+			return err
+		}
+		attributes, err := attributesJSON(profile.Attributes)
+		if err != nil {
+			return err
+		}
+		tags, err := tagsJSON(profile.Tags)
+		if err != nil {
+			return err
+		}
+		stored, err := r.sealPII(profile)
+		if err != nil {
+			return err
+		}
+		// COPY encodes []byte as bytea, so JSON is sent as text
+		if _, err := stmt.ExecContext(ctx,
+			i,
+			profile.ID,
+			profile.Name,
+			stored.email,
+			stored.bio,
+			string(imageURLsJSON),
+			attributes,
+			tags,
+			profile.CreatedAt,
+			profile.UpdatedAt,
+			stored.emailIndex,
+			stored.emailDomainIndex,
+			stored.keyID,
+		); err != nil {
+			return err
+		}
+	}
+
+	// An argument-less Exec flushes the buffered rows
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
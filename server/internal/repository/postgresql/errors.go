@@ -0,0 +1,59 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/lib/pq"
+)
+
+// PostgreSQL error codes mapped to domain errors
+const (
+	uniqueViolation       = "23505"
+	notNullViolation      = "23502"
+	checkViolation        = "23514"
+	stringDataTruncation  = "22001"
+	invalidTextInput      = "22P02"
+	serializationFailure  = "40001"
+	deadlockDetected      = "40P01"
+	connectionException   = "08"
+	insufficientResources = "53"
+	operatorIntervention  = "57P"
+)
+
+// mapError translates database errors into the repository's domain errors,
+// keeping the original error in the chain for logging
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		switch {
+		case code == uniqueViolation && strings.Contains(pqErr.Constraint, "email"):
+			return fmt.Errorf("%w: %v", repository.ErrDuplicateEmail, err)
+		case code == uniqueViolation, code == serializationFailure, code == deadlockDetected:
+			return fmt.Errorf("%w: %v", repository.ErrConflict, err)
+		case code == notNullViolation, code == checkViolation, code == stringDataTruncation, code == invalidTextInput:
+			return &repository.ValidationError{Field: pqErr.Column, Message: pqErr.Message}
+		case strings.HasPrefix(code, connectionException),
+			strings.HasPrefix(code, insufficientResources),
+			strings.HasPrefix(code, operatorIntervention):
+			return fmt.Errorf("%w: %v", repository.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", repository.ErrUnavailable, err)
+	}
+	return err
+}
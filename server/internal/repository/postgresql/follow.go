@@ -0,0 +1,206 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// followColumns lists the columns read by scanFollow, in scan order
+const followColumns = `follower_id, target_id, created_at`
+
+// Follow records that a profile follows another
+func (r *Repository) Follow(ctx context.Context, follow *models.Follow) (bool, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		INSERT INTO profile_follows (tenant_id, `+followColumns+`)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, tenant.FromContext(ctx), follow.FollowerID, follow.TargetID, follow.CreatedAt)
+	if err != nil {
+		logger.Log.Error("Failed to store follow",
+			zap.String("follower_id", follow.FollowerID),
+			zap.String("target_id", follow.TargetID),
+			zap.Error(err),
+		)
+		return false, mapError(err)
+	}
+	if created, err := result.RowsAffected(); err != nil || created > 0 {
+		return created > 0, err
+	}
+
+	err = r.conn(ctx).QueryRowContext(ctx, `
+		SELECT created_at FROM profile_follows WHERE tenant_id = $1 AND follower_id = $2 AND target_id = $3
+	`, tenant.FromContext(ctx), follow.FollowerID, follow.TargetID).Scan(&follow.CreatedAt)
+	return false, mapError(err)
+}
+
+// Unfollow removes a follow
+func (r *Repository) Unfollow(ctx context.Context, followerID, targetID string) (bool, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		DELETE FROM profile_follows WHERE tenant_id = $1 AND follower_id = $2 AND target_id = $3
+	`, tenant.FromContext(ctx), followerID, targetID)
+	if err != nil {
+		logger.Log.Error("Failed to remove follow",
+			zap.String("follower_id", followerID),
+			zap.String("target_id", targetID),
+			zap.Error(err),
+		)
+		return false, mapError(err)
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// IsFollowing reports whether a profile follows another
+func (r *Repository) IsFollowing(ctx context.Context, followerID, targetID string) (bool, error) {
+	var following bool
+	err := r.readConn(ctx).QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM profile_follows WHERE tenant_id = $1 AND follower_id = $2 AND target_id = $3)
+	`, tenant.FromContext(ctx), followerID, targetID).Scan(&following)
+	if err != nil {
+		return false, mapError(err)
+	}
+	return following, nil
+}
+
+// ListFollowers returns a page of the follows on a profile, most recent first
+func (r *Repository) ListFollowers(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return r.listFollows(ctx, profileID, opts, "profile_follows f", false)
+}
+
+// ListFollowing returns a page of the follows a profile made, most recent first
+func (r *Repository) ListFollowing(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return r.listFollows(ctx, profileID, opts, "profile_follows f", true)
+}
+
+// ListMutualFollows returns a page of the follows a profile made on profiles
+// following it back, most recent first
+func (r *Repository) ListMutualFollows(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	from := `profile_follows f
+		JOIN profile_follows back ON back.tenant_id = f.tenant_id AND back.follower_id = f.target_id AND back.target_id = f.follower_id`
+	return r.listFollows(ctx, profileID, opts, from, true)
+}
+
+// listFollows returns a page of the follows selected from the table expression
+// from, aliased f: with following, those made by profileID, otherwise those on
+// it. Pages are ordered by time and then by the profile on the far side.
+func (r *Repository) listFollows(ctx context.Context, profileID string, opts repository.FollowListOptions, from string, following bool) (*repository.FollowListResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	cursor, err := opts.DecodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	match, other := "f.target_id", "f.follower_id"
+	if following {
+		match, other = other, match
+	}
+
+	query := fmt.Sprintf(`
+		SELECT f.follower_id, f.target_id, f.created_at
+		FROM %s
+		WHERE f.tenant_id = $1 AND %s = $2
+	`, from, match)
+	args := []interface{}{tenant.FromContext(ctx), profileID}
+	if cursor != nil {
+		query += fmt.Sprintf(" AND (f.created_at, %s) < ($3, $4)", other)
+		args = append(args, cursor.CreatedAt, cursor.ProfileID)
+	}
+	args = append(args, opts.Limit+1)
+	query += fmt.Sprintf(" ORDER BY f.created_at DESC, %s DESC LIMIT $%d", other, len(args))
+
+	rows, err := r.readConn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Log.Error("Failed to list follows",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	result := &repository.FollowListResult{Follows: []*models.Follow{}}
+	for rows.Next() {
+		follow, err := scanFollow(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Follows = append(result.Follows, follow)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Follows) > opts.Limit {
+		result.Follows = result.Follows[:opts.Limit]
+		last := result.Follows[opts.Limit-1]
+		otherID := last.FollowerID
+		if following {
+			otherID = last.TargetID
+		}
+		result.NextCursor = repository.NewFollowCursor(last.CreatedAt, otherID)
+	}
+	return result, nil
+}
+
+// CountFollows returns how many profiles follow a profile and how many it follows
+func (r *Repository) CountFollows(ctx context.Context, profileID string) (*models.FollowCounts, error) {
+	// Counts are read from the primary, as they are cached
+	counts := &models.FollowCounts{}
+	err := r.conn(ctx).QueryRowContext(ctx, `
+		SELECT
+			(SELECT count(*) FROM profile_follows WHERE tenant_id = $1 AND target_id = $2),
+			(SELECT count(*) FROM profile_follows WHERE tenant_id = $1 AND follower_id = $2)
+	`, tenant.FromContext(ctx), profileID).Scan(&counts.Followers, &counts.Following)
+	if err != nil {
+		logger.Log.Error("Failed to count follows",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	return counts, nil
+}
+
+// RemoveFollows removes every follow made by or on a profile and returns them
+func (r *Repository) RemoveFollows(ctx context.Context, profileID string) ([]*models.Follow, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		DELETE FROM profile_follows
+		WHERE tenant_id = $1 AND (follower_id = $2 OR target_id = $2)
+		RETURNING `+followColumns,
+		tenant.FromContext(ctx), profileID)
+	if err != nil {
+		logger.Log.Error("Failed to remove follows",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	removed := []*models.Follow{}
+	for rows.Next() {
+		follow, err := scanFollow(rows)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, follow)
+	}
+	return removed, rows.Err()
+}
+
+// scanFollow reads a follow selected with followColumns
+func scanFollow(row rowScanner) (*models.Follow, error) {
+	follow := &models.Follow{}
+	if err := row.Scan(&follow.FollowerID, &follow.TargetID, &follow.CreatedAt); err != nil {
+		return nil, err
+	}
+	return follow, nil
+}
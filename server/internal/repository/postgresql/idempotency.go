@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// ReserveIdempotencyKey stores an in-flight record for a key, unless an
+// unexpired record holds it, which is returned instead
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	tenantID := tenant.FromContext(ctx)
+	for {
+		// An expired record is taken over as if the key were free
+		result, err := r.conn(ctx).ExecContext(ctx, `
+			INSERT INTO idempotency_keys (tenant_id, idempotency_key, fingerprint, token, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (tenant_id, idempotency_key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, token = EXCLUDED.token, status_code = 0, content_type = '', body = NULL,
+				created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+		`, tenantID, record.Key, record.Fingerprint, record.Token, record.CreatedAt, record.ExpiresAt)
+		if err != nil {
+			logger.Log.Error("Failed to reserve idempotency key",
+				zap.String("key", record.Key),
+				zap.Error(err),
+			)
+			return nil, mapError(err)
+		}
+		reserved, err := result.RowsAffected()
+		if err != nil || reserved > 0 {
+			return nil, err
+		}
+
+		existing := &models.IdempotencyRecord{}
+		var body []byte
+		err = r.conn(ctx).QueryRowContext(ctx, `
+			SELECT idempotency_key, fingerprint, token, status_code, content_type, body, created_at, expires_at
+			FROM idempotency_keys
+			WHERE tenant_id = $1 AND idempotency_key = $2
+		`, tenantID, record.Key).Scan(
+			&existing.Key,
+			&existing.Fingerprint,
+			&existing.Token,
+			&existing.StatusCode,
+			&existing.ContentType,
+			&body,
+			&existing.CreatedAt,
+			&existing.ExpiresAt,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			// The record was released or purged since the insert; try again
+			continue
+		}
+		if err != nil {
+			return nil, mapError(err)
+		}
+		existing.Body = body
+		return existing, nil
+	}
+}
+
+// CompleteIdempotencyKey stores the response of a key still reserved with the
+// record's token
+func (r *Repository) CompleteIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $4, content_type = $5, body = $6, expires_at = $7
+		WHERE tenant_id = $1 AND idempotency_key = $2 AND token = $3 AND status_code = 0
+	`, tenant.FromContext(ctx), record.Key, record.Token, record.StatusCode, record.ContentType, record.Body, record.ExpiresAt)
+	if err != nil {
+		logger.Log.Error("Failed to complete idempotency key",
+			zap.String("key", record.Key),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// ReleaseIdempotencyKey removes a key still in flight under the record's token
+func (r *Repository) ReleaseIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE tenant_id = $1 AND idempotency_key = $2 AND token = $3 AND status_code = 0
+	`, tenant.FromContext(ctx), record.Key, record.Token)
+	return mapError(err)
+}
+
+// DeleteExpiredIdempotencyKeys removes records that expired before the given time
+func (r *Repository) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return result.RowsAffected()
+}
+
+// RedactIdempotencyResponses empties the tenant's recorded response bodies
+// containing text
+func (r *Repository) RedactIdempotencyResponses(ctx context.Context, text string) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET content_type = '', body = NULL
+		WHERE tenant_id = $1 AND status_code <> 0 AND position($2::bytea IN body) > 0
+	`, tenant.FromContext(ctx), []byte(text))
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,74 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// Iterate streams the profiles matching opts from a single query, reading rows
+// from the server as the iterator advances. The query holds a connection until
+// the iterator is closed.
+func (r *Repository) Iterate(ctx context.Context, opts repository.ListOptions) (repository.ProfileIterator, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	query, args, err := buildListQuery(r.pii, tenant.FromContext(ctx), opts, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.readConn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("iterate", "error").Inc()
+		logger.Log.Error("Failed to iterate profiles",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("iterate", "success").Inc()
+	return &rowsIterator{repo: r, rows: rows}, nil
+}
+
+// rowsIterator iterates over the profiles selected by a query
+type rowsIterator struct {
+	repo    *Repository
+	rows    *sql.Rows
+	current *models.Profile
+	err     error
+}
+
+func (it *rowsIterator) Next() bool {
+	it.current = nil
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+	profile, err := it.repo.scanProfile(it.rows)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.current = profile
+	return true
+}
+
+func (it *rowsIterator) Profile() *models.Profile { return it.current }
+
+func (it *rowsIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if err := it.rows.Err(); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (it *rowsIterator) Close() error { return it.rows.Close() }
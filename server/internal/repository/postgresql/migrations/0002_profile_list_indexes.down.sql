@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS profiles_email_domain_idx;
+DROP INDEX IF EXISTS profiles_lower_name_idx;
+DROP INDEX IF EXISTS profiles_name_id_idx;
+DROP INDEX IF EXISTS profiles_updated_at_id_idx;
+DROP INDEX IF EXISTS profiles_created_at_id_idx;
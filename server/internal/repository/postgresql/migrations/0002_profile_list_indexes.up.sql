@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS profiles_created_at_id_idx ON profiles (created_at, id);
+CREATE INDEX IF NOT EXISTS profiles_updated_at_id_idx ON profiles (updated_at, id);
+CREATE INDEX IF NOT EXISTS profiles_name_id_idx ON profiles (name, id);
+CREATE INDEX IF NOT EXISTS profiles_lower_name_idx ON profiles (lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS profiles_email_domain_idx ON profiles (lower(split_part(email, '@', 2)));
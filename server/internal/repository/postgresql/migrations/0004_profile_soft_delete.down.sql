@@ -0,0 +1,7 @@
+DELETE FROM profiles WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS profiles_deleted_at_idx;
+DROP INDEX IF EXISTS profiles_email_active_idx;
+ALTER TABLE profiles ADD CONSTRAINT profiles_email_key UNIQUE (email);
+
+ALTER TABLE profiles DROP COLUMN IF EXISTS deleted_at;
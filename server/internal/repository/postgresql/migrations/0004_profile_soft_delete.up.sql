@@ -0,0 +1,7 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Tombstoned profiles must not block their email from being reused
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_email_active_idx ON profiles (email) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS profiles_deleted_at_idx ON profiles (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS profiles_search_vector_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS search_vector;
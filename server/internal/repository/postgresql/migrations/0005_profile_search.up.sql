@@ -0,0 +1,7 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(bio, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS profiles_search_vector_idx ON profiles USING GIN (search_vector);
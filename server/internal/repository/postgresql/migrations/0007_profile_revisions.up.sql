@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS profile_revisions (
+    profile_id VARCHAR(36) NOT NULL REFERENCES profiles (id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    operation VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    snapshot JSONB NOT NULL,
+    changes JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (profile_id, revision)
+);
+
+-- Seed each existing profile's history with its current state, so that the
+-- next change has a revision to diff against
+INSERT INTO profile_revisions (profile_id, revision, operation, actor, snapshot, changes, created_at)
+SELECT
+    id,
+    version,
+    CASE WHEN deleted_at IS NULL THEN 'baseline' ELSE 'delete' END,
+    'system',
+    jsonb_build_object(
+        'id', id,
+        'name', name,
+        'email', email,
+        'bio', COALESCE(bio, ''),
+        'image_urls', COALESCE(image_urls, '[]'::jsonb),
+        'version', version,
+        'created_at', created_at,
+        'updated_at', updated_at,
+        'deleted_at', deleted_at
+    ),
+    '[]'::jsonb,
+    updated_at
+FROM profiles
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+-- Maps each email in use to the profile holding it. A sharded deployment keeps
+-- the authoritative copy on its first shard to enforce uniqueness across shards.
+CREATE TABLE IF NOT EXISTS profile_emails (
+    email VARCHAR(255) PRIMARY KEY,
+    profile_id VARCHAR(36) NOT NULL,
+    claimed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
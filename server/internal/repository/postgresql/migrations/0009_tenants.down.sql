@@ -0,0 +1,19 @@
+DELETE FROM profile_emails WHERE tenant_id <> 'default';
+ALTER TABLE profile_emails DROP CONSTRAINT IF EXISTS profile_emails_pkey;
+ALTER TABLE profile_emails ADD PRIMARY KEY (email);
+ALTER TABLE profile_emails DROP COLUMN IF EXISTS tenant_id;
+
+DROP INDEX IF EXISTS profiles_tenant_name_id_idx;
+DROP INDEX IF EXISTS profiles_tenant_updated_at_id_idx;
+DROP INDEX IF EXISTS profiles_tenant_created_at_id_idx;
+CREATE INDEX IF NOT EXISTS profiles_created_at_id_idx ON profiles (created_at, id);
+CREATE INDEX IF NOT EXISTS profiles_updated_at_id_idx ON profiles (updated_at, id);
+CREATE INDEX IF NOT EXISTS profiles_name_id_idx ON profiles (name, id);
+
+-- Profiles of other tenants cannot share the single email namespace
+DELETE FROM profiles WHERE tenant_id <> 'default';
+DROP INDEX IF EXISTS profiles_tenant_email_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_email_active_idx ON profiles (email) WHERE deleted_at IS NULL;
+
+ALTER TABLE profile_revisions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE profiles DROP COLUMN IF EXISTS tenant_id;
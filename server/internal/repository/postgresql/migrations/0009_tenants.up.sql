@@ -0,0 +1,20 @@
+-- Every profile belongs to a tenant. Rows written before tenancy belong to the
+-- default tenant.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE profile_revisions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+-- Emails are unique within a tenant, so two tenants may each have the same one
+DROP INDEX IF EXISTS profiles_email_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_tenant_email_active_idx ON profiles (tenant_id, email) WHERE deleted_at IS NULL;
+
+-- Listing always filters by tenant first
+DROP INDEX IF EXISTS profiles_created_at_id_idx;
+DROP INDEX IF EXISTS profiles_updated_at_id_idx;
+DROP INDEX IF EXISTS profiles_name_id_idx;
+CREATE INDEX IF NOT EXISTS profiles_tenant_created_at_id_idx ON profiles (tenant_id, created_at, id);
+CREATE INDEX IF NOT EXISTS profiles_tenant_updated_at_id_idx ON profiles (tenant_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS profiles_tenant_name_id_idx ON profiles (tenant_id, name, id);
+
+ALTER TABLE profile_emails ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE profile_emails DROP CONSTRAINT IF EXISTS profile_emails_pkey;
+ALTER TABLE profile_emails ADD PRIMARY KEY (tenant_id, email);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS attribute_definitions;
+
+DROP INDEX IF EXISTS profiles_attributes_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS attributes;
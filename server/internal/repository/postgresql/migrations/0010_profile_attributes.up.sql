@@ -0,0 +1,17 @@
+-- Custom attributes, checked against attribute_definitions by the service
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- Serves attribute filters, which are containment queries (attributes @> ...)
+CREATE INDEX IF NOT EXISTS profiles_attributes_idx ON profiles USING GIN (attributes jsonb_path_ops);
+
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    tenant_id VARCHAR(64) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT false,
+    enum JSONB NOT NULL DEFAULT '[]'::jsonb,
+    max_length INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (tenant_id, name)
+);
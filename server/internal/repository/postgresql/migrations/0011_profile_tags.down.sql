@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS profiles_tags_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS tags;
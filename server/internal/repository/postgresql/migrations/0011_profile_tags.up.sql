@@ -0,0 +1,6 @@
+-- Tags, stored normalized, sorted and without duplicates
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+-- Serves tag filters: containment (tags @> ...) for all of several tags and the
+-- ?| operator for any of them, which jsonb_path_ops does not support
+CREATE INDEX IF NOT EXISTS profiles_tags_idx ON profiles USING GIN (tags);
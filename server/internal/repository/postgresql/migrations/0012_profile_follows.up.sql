@@ -0,0 +1,13 @@
+-- The follower graph. Profiles may live on different shards, so follows carry
+-- no foreign keys; the service removes them when a profile is purged.
+CREATE TABLE IF NOT EXISTS profile_follows (
+    tenant_id VARCHAR(64) NOT NULL,
+    follower_id VARCHAR(36) NOT NULL,
+    target_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (tenant_id, follower_id, target_id)
+);
+
+-- Serve the followers and following listings, newest first
+CREATE INDEX IF NOT EXISTS profile_follows_target_created_at_idx ON profile_follows (tenant_id, target_id, created_at, follower_id);
+CREATE INDEX IF NOT EXISTS profile_follows_follower_created_at_idx ON profile_follows (tenant_id, follower_id, created_at, target_id);
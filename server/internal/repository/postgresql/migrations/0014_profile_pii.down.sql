@@ -0,0 +1,9 @@
+-- Sealed rows cannot be restored here: rotate them back to plaintext first
+DROP INDEX IF EXISTS profiles_tenant_email_domain_index_idx;
+DROP INDEX IF EXISTS profiles_tenant_email_index_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_tenant_email_active_idx ON profiles (tenant_id, email) WHERE deleted_at IS NULL;
+
+ALTER TABLE profiles DROP COLUMN IF EXISTS email_domain_index;
+ALTER TABLE profiles DROP COLUMN IF EXISTS email_index;
+ALTER TABLE profiles DROP COLUMN IF EXISTS pii_key_id;
+ALTER TABLE profiles ALTER COLUMN email TYPE VARCHAR(255);
@@ -0,0 +1,18 @@
+-- Emails, and optionally bios, may be sealed, so they are no longer compared in
+-- the database. pii_key_id names the key a row was sealed with, and is empty
+-- for rows stored in plaintext.
+ALTER TABLE profiles ALTER COLUMN email TYPE TEXT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS pii_key_id VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Blind indexes stand in for the email and its domain in lookups. Rows stored
+-- in plaintext are indexed by the values themselves until keys are rotated.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS email_index TEXT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS email_domain_index TEXT;
+UPDATE profiles SET email_index = email, email_domain_index = lower(split_part(email, '@', 2))
+WHERE email_index IS NULL;
+ALTER TABLE profiles ALTER COLUMN email_index SET NOT NULL;
+ALTER TABLE profiles ALTER COLUMN email_domain_index SET NOT NULL;
+
+DROP INDEX IF EXISTS profiles_tenant_email_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_tenant_email_index_active_idx ON profiles (tenant_id, email_index) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS profiles_tenant_email_domain_index_idx ON profiles (tenant_id, email_domain_index);
@@ -0,0 +1,16 @@
+-- Receipts of data-subject erasure requests. They outlive the profiles they
+-- describe, so they reference them by ID only.
+CREATE TABLE IF NOT EXISTS profile_erasures (
+    tenant_id VARCHAR(64) NOT NULL,
+    profile_id VARCHAR(36) NOT NULL,
+    id VARCHAR(36) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    requested_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    images_deleted INTEGER NOT NULL DEFAULT 0,
+    follows_deleted INTEGER NOT NULL DEFAULT 0,
+    events_deleted INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, profile_id)
+);
+
+CREATE INDEX IF NOT EXISTS profile_erasures_pending_idx ON profile_erasures (requested_at) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+-- Identifies the reservation of a key, so that a request that outlived its
+-- lease cannot complete or release a reservation another request took over
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS token VARCHAR(36) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS profiles_tenant_name_c_id_idx;
+CREATE INDEX IF NOT EXISTS profiles_tenant_name_id_idx ON profiles (tenant_id, name, id);
@@ -0,0 +1,2 @@
+ALTER TABLE outbox DROP COLUMN IF EXISTS pii_key_id;
+ALTER TABLE profile_revisions DROP COLUMN IF EXISTS pii_key_id;
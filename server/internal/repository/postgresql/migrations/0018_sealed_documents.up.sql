@@ -0,0 +1,5 @@
+-- Revision snapshots and outbox payloads carry whole profiles, so they are
+-- sealed like the profiles themselves. pii_key_id names the key a row was
+-- sealed with, and is empty for rows stored in plaintext.
+ALTER TABLE profile_revisions ADD COLUMN IF NOT EXISTS pii_key_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS pii_key_id VARCHAR(64) NOT NULL DEFAULT '';
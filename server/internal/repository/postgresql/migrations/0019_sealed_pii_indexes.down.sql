@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS profiles_search_vector_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE profiles ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(bio, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS profiles_search_vector_idx ON profiles USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS profiles_email_domain_idx ON profiles (lower(split_part(email, '@', 2)));
@@ -0,0 +1,14 @@
+-- The email domain is looked up through email_domain_index; indexing the
+-- domain of a sealed email would index ciphertext
+DROP INDEX IF EXISTS profiles_email_domain_idx;
+
+-- Sealed bios are left out of search rather than indexing their ciphertext
+DROP INDEX IF EXISTS profiles_search_vector_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE profiles ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', CASE WHEN bio LIKE 'enc:v1:%' THEN '' ELSE coalesce(bio, '') END), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS profiles_search_vector_idx ON profiles USING GIN (search_vector);
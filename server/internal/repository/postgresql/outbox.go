@@ -0,0 +1,189 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// outboxColumns lists the columns read by scanOutboxMessages, in scan order
+const outboxColumns = `id, aggregate_id, channel, payload, attempts, created_at, pii_key_id`
+
+// Enqueue stores a message in the outbox. Payloads carry profiles, so they are
+// sealed like the profiles themselves.
+func (r *Repository) Enqueue(ctx context.Context, message *models.OutboxMessage) error {
+	payload, err := r.sealJSON(message.Payload)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO outbox (id, aggregate_id, channel, payload, created_at, next_attempt_at, pii_key_id)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $5, $6)
+	`
+
+	_, err = r.conn(ctx).ExecContext(ctx, query,
+		message.ID,
+		message.AggregateID,
+		message.Channel,
+		payload,
+		message.CreatedAt,
+		r.pii.KeyID(),
+	)
+	if err != nil {
+		logger.Log.Error("Failed to enqueue outbox message",
+			zap.String("id", message.ID),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// ClaimPending leases up to limit messages that are due for delivery
+func (r *Repository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	// Pushing next_attempt_at past the lease hides the claimed messages from
+	// other relays; SKIP LOCKED keeps concurrent claims from blocking each other
+	query := `
+		UPDATE outbox
+		SET next_attempt_at = $3, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND next_attempt_at <= $2
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns + `
+	`
+
+	now := time.Now()
+	rows, err := r.conn(ctx).QueryContext(ctx, query, limit, now, now.Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	messages, err := r.scanOutboxMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not preserve the subquery order
+	sortByCreatedAt(messages)
+	return messages, nil
+}
+
+// MarkSent records that a message was delivered
+func (r *Repository) MarkSent(ctx context.Context, message *models.OutboxMessage) error {
+	_, err := r.conn(ctx).ExecContext(ctx,
+		`UPDATE outbox SET sent_at = $2, last_error = NULL WHERE id = $1`,
+		message.ID, time.Now(),
+	)
+	return err
+}
+
+// MarkFailed records a failed delivery and schedules the next attempt
+func (r *Repository) MarkFailed(ctx context.Context, message *models.OutboxMessage, cause error, retryAt time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx,
+		`UPDATE outbox SET next_attempt_at = $2, last_error = $3 WHERE id = $1 AND sent_at IS NULL`,
+		message.ID, retryAt, cause.Error(),
+	)
+	return err
+}
+
+// DeleteSent removes delivered messages sent before the given time
+func (r *Repository) DeleteSent(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx,
+		`DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < $1`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListForAggregate returns every stored message of an aggregate, oldest first
+func (r *Repository) ListForAggregate(ctx context.Context, aggregateID string) ([]*models.OutboxMessage, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		SELECT `+outboxColumns+`
+		FROM outbox
+		WHERE aggregate_id = $1
+		ORDER BY created_at, id
+	`, aggregateID)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanOutboxMessages(rows)
+}
+
+// DeleteForAggregate removes every message of an aggregate
+func (r *Repository) DeleteForAggregate(ctx context.Context, aggregateID string) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx,
+		`DELETE FROM outbox WHERE aggregate_id = $1`,
+		aggregateID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Stats reports the number and age of undelivered messages
+func (r *Repository) Stats(ctx context.Context) (*repository.OutboxStats, error) {
+	query := `
+		SELECT count(*), COALESCE(EXTRACT(EPOCH FROM now() - min(created_at)), 0)
+		FROM outbox
+		WHERE sent_at IS NULL
+	`
+
+	stats := &repository.OutboxStats{}
+	var oldestSeconds float64
+	if err := r.conn(ctx).QueryRowContext(ctx, query).Scan(&stats.Pending, &oldestSeconds); err != nil {
+		return nil, err
+	}
+	stats.OldestPendingAge = time.Duration(oldestSeconds * float64(time.Second))
+	return stats, nil
+}
+
+// scanOutboxMessages reads messages selected with outboxColumns, opening
+// their sealed payloads, and closes rows
+func (r *Repository) scanOutboxMessages(rows *sql.Rows) ([]*models.OutboxMessage, error) {
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var payload []byte
+		var keyID string
+		message := &models.OutboxMessage{}
+		if err := rows.Scan(
+			&message.ID,
+			&message.AggregateID,
+			&message.Channel,
+			&payload,
+			&message.Attempts,
+			&message.CreatedAt,
+			&keyID,
+		); err != nil {
+			return nil, err
+		}
+		payload, err := r.openJSON(keyID, payload)
+		if err != nil {
+			return nil, err
+		}
+		message.Payload = payload
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// sortByCreatedAt orders messages oldest first
+func sortByCreatedAt(messages []*models.OutboxMessage) {
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+}
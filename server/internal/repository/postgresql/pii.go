@@ -0,0 +1,423 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/pii"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// rotatePollInterval is how long a rotation waits for writes holding locks on
+// the profiles it has left to reseal
+const rotatePollInterval = 100 * time.Millisecond
+
+// ErrPlaintextPII is returned when a keyring is configured while profiles or
+// email claims stored before encryption was enabled remain
+var ErrPlaintextPII = errors.New("profiles stored in plaintext remain; run rotate-keys before enabling the keyring")
+
+// storedPII is the form a profile's PII is stored in
+type storedPII struct {
+	email            string
+	bio              string
+	emailIndex       string
+	emailDomainIndex string
+	keyID            string
+}
+
+// sealPII returns the stored form of a profile's email and bio, sealing the bio
+// only if bios are encrypted. Values that look sealed are refused, since they
+// could not be told apart from sealed ones when read back.
+func (r *Repository) sealPII(profile *models.Profile) (*storedPII, error) {
+	if pii.IsSealed(profile.Email) {
+		return nil, repository.NewValidationError("email", "must not start with "+pii.SealedPrefix)
+	}
+	if pii.IsSealed(profile.Bio) {
+		return nil, repository.NewValidationError("bio", "must not start with "+pii.SealedPrefix)
+	}
+
+	stored := &storedPII{
+		bio:              profile.Bio,
+		emailIndex:       r.pii.BlindIndex(profile.Email),
+		emailDomainIndex: r.pii.BlindIndex(pii.EmailDomain(profile.Email)),
+		keyID:            r.pii.KeyID(),
+	}
+	var err error
+	if stored.email, err = r.pii.Seal(profile.Email); err != nil {
+		return nil, err
+	}
+	if r.encryptBio && profile.Bio != "" {
+		if stored.bio, err = r.pii.Seal(profile.Bio); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// openPII replaces the sealed email and bio of a scanned profile with their
+// plaintext
+func (r *Repository) openPII(profile *models.Profile, keyID string) error {
+	var err error
+	if profile.Email, err = r.pii.Open(keyID, profile.Email); err != nil {
+		return err
+	}
+	profile.Bio, err = r.pii.Open(keyID, profile.Bio)
+	return err
+}
+
+// sealJSON returns the stored form of a JSON document holding PII, such as a
+// revision snapshot or an outbox payload: with a keyring, the whole document is
+// sealed and stored as a JSON string; otherwise it is stored as it is
+func (r *Repository) sealJSON(document []byte) ([]byte, error) {
+	if r.pii.KeyID() == "" {
+		return document, nil
+	}
+	sealed, err := r.pii.Seal(string(document))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed)
+}
+
+// openJSON returns the document stored by sealJSON with the key keyID, which
+// is empty for documents stored in plaintext
+func (r *Repository) openJSON(keyID string, stored []byte) ([]byte, error) {
+	if keyID == "" {
+		return stored, nil
+	}
+	var sealed string
+	if err := json.Unmarshal(stored, &sealed); err != nil {
+		return nil, err
+	}
+	document, err := r.pii.Open(keyID, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(document), nil
+}
+
+// sealedTable is a table whose rows hold JSON documents sealed by sealJSON,
+// under the key named by their pii_key_id column
+type sealedTable struct {
+	name string
+	// key lists the columns identifying a row
+	key []string
+	// documents lists the sealed columns
+	documents []string
+}
+
+// sealedTables are the tables resealed by RotateKeys besides profiles
+var sealedTables = []sealedTable{
+	{name: "profile_revisions", key: []string{"profile_id", "revision"}, documents: []string{"snapshot", "changes"}},
+	{name: "outbox", key: []string{"id"}, documents: []string{"payload"}},
+}
+
+// RotateKeys reseals, in batches of batchSize, the PII of every profile of any
+// tenant not sealed with the primary key, including profiles stored before
+// encryption was enabled, and moves email claims to blind indexes. Revision
+// snapshots and outbox payloads are resealed the same way. Versions are
+// left alone, since the profiles do not change. It returns how many profiles
+// were resealed once none is left, and can be repeated safely if interrupted.
+func (r *Repository) RotateKeys(ctx context.Context, batchSize int) (int, error) {
+	if r.pii.KeyID() == "" {
+		return 0, errors.New("rotating keys requires a keyring")
+	}
+	start := time.Now()
+
+	total, err := drain(ctx, batchSize, r.rotateBatch, r.countUnsealed)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("rotate_keys", "error").Inc()
+		logger.Log.Error("Failed to rotate PII keys",
+			zap.Int("rotated", total),
+			zap.Error(err),
+		)
+		return total, mapError(err)
+	}
+
+	if _, err := drain(ctx, batchSize, r.indexEmailClaims, r.countPlaintextClaims); err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("rotate_keys", "error").Inc()
+		logger.Log.Error("Failed to index email claims",
+			zap.Error(err),
+		)
+		return total, mapError(err)
+	}
+
+	for _, table := range sealedTables {
+		if _, err := drain(ctx, batchSize, r.resealBatch(table), r.countUnsealedRows(table)); err != nil {
+			metrics.DbOperationsTotal.WithLabelValues("rotate_keys", "error").Inc()
+			logger.Log.Error("Failed to reseal documents",
+				zap.String("table", table.name),
+				zap.Error(err),
+			)
+			return total, mapError(err)
+		}
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("rotate_keys", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("rotate_keys").Observe(time.Since(start).Seconds())
+	return total, nil
+}
+
+// drain runs batch until remaining reports no rows left, returning how many
+// rows the batches handled. A short batch does not mean the work is done:
+// SKIP LOCKED passes over rows locked by writes, and instances still sealing
+// with an older key keep writing more.
+func drain(ctx context.Context, batchSize int, batch func(context.Context, int) (int, error), remaining func(context.Context) (int, error)) (int, error) {
+	total := 0
+	for {
+		handled, err := batch(ctx, batchSize)
+		total += handled
+		if err != nil {
+			return total, err
+		}
+		if handled == batchSize {
+			continue
+		}
+
+		left, err := remaining(ctx)
+		if err != nil {
+			return total, err
+		}
+		if left == 0 {
+			return total, nil
+		}
+		if handled == 0 {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(rotatePollInterval):
+			}
+		}
+	}
+}
+
+// CheckSealed returns ErrPlaintextPII if a keyring is configured while profiles
+// or email claims stored in plaintext remain. Their plaintext indexes do not
+// match lookups by blind index, which would let an email be registered twice
+// and hide them from domain filters.
+func (r *Repository) CheckSealed(ctx context.Context) error {
+	if r.pii.KeyID() == "" {
+		return nil
+	}
+	var plaintext bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM profiles WHERE pii_key_id = '')
+			OR EXISTS (SELECT 1 FROM profile_emails WHERE position('@' in email) > 0)
+	`).Scan(&plaintext)
+	if err != nil {
+		return mapError(err)
+	}
+	if plaintext {
+		return ErrPlaintextPII
+	}
+	return nil
+}
+
+// countUnsealed returns how many profiles of any tenant are not sealed with
+// the primary key
+func (r *Repository) countUnsealed(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM profiles WHERE pii_key_id <> $1`, r.pii.KeyID()).Scan(&count)
+	return count, err
+}
+
+// countPlaintextClaims returns how many email claims are recorded by plaintext
+// address
+func (r *Repository) countPlaintextClaims(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM profile_emails WHERE position('@' in email) > 0`).Scan(&count)
+	return count, err
+}
+
+// rotateBatch reseals up to limit profiles not sealed with the primary key
+func (r *Repository) rotateBatch(ctx context.Context, limit int) (int, error) {
+	rotated := 0
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		// SKIP LOCKED lets the rotation run alongside writes to other profiles
+		rows, err := r.conn(ctx).QueryContext(ctx, `
+			SELECT `+profileColumns+`
+			FROM profiles
+			WHERE pii_key_id <> $1
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`, r.pii.KeyID(), limit)
+		if err != nil {
+			return err
+		}
+		var profiles []*models.Profile
+		for rows.Next() {
+			profile, err := r.scanProfile(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			profiles = append(profiles, profile)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, profile := range profiles {
+			stored, err := r.sealPII(profile)
+			if err != nil {
+				return err
+			}
+			_, err = r.conn(ctx).ExecContext(ctx, `
+				UPDATE profiles
+				SET email = $2, bio = $3, email_index = $4, email_domain_index = $5, pii_key_id = $6
+				WHERE id = $1
+			`, profile.ID, stored.email, stored.bio, stored.emailIndex, stored.emailDomainIndex, stored.keyID)
+			if err != nil {
+				return err
+			}
+		}
+		rotated = len(profiles)
+		return nil
+	})
+	return rotated, err
+}
+
+// indexEmailClaims replaces up to limit email claims recorded by plaintext
+// address with claims by blind index. Blind indexes never contain an '@',
+// while addresses always do.
+func (r *Repository) indexEmailClaims(ctx context.Context, limit int) (int, error) {
+	indexed := 0
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		rows, err := r.conn(ctx).QueryContext(ctx, `
+			SELECT tenant_id, email
+			FROM profile_emails
+			WHERE position('@' in email) > 0
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`, limit)
+		if err != nil {
+			return err
+		}
+		type claim struct{ tenantID, email string }
+		var claims []claim
+		for rows.Next() {
+			var c claim
+			if err := rows.Scan(&c.tenantID, &c.email); err != nil {
+				rows.Close()
+				return err
+			}
+			claims = append(claims, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, c := range claims {
+			_, err := r.conn(ctx).ExecContext(ctx, `
+				UPDATE profile_emails SET email = $3 WHERE tenant_id = $1 AND email = $2
+			`, c.tenantID, c.email, r.pii.BlindIndex(c.email))
+			if err != nil {
+				return err
+			}
+		}
+		indexed = len(claims)
+		return nil
+	})
+	return indexed, err
+}
+
+// countUnsealedRows returns a function counting the rows of a sealed table not
+// sealed with the primary key
+func (r *Repository) countUnsealedRows(table sealedTable) func(context.Context) (int, error) {
+	return func(ctx context.Context) (int, error) {
+		var count int
+		err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM `+table.name+` WHERE pii_key_id <> $1`, r.pii.KeyID()).Scan(&count)
+		return count, err
+	}
+}
+
+// resealBatch returns a function resealing up to limit rows of a sealed table
+// not sealed with the primary key
+func (r *Repository) resealBatch(table sealedTable) func(context.Context, int) (int, error) {
+	columns := append(append([]string{}, table.key...), table.documents...)
+	selectQuery := `
+		SELECT ` + strings.Join(columns, ", ") + `, pii_key_id
+		FROM ` + table.name + `
+		WHERE pii_key_id <> $1
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+	// Documents are set from $1 on, followed by the key ID and the row's key
+	var set, where []string
+	for i, document := range table.documents {
+		set = append(set, fmt.Sprintf("%s = $%d::jsonb", document, i+1))
+	}
+	set = append(set, fmt.Sprintf("pii_key_id = $%d", len(table.documents)+1))
+	for i, key := range table.key {
+		where = append(where, fmt.Sprintf("%s = $%d", key, len(table.documents)+2+i))
+	}
+	updateQuery := `UPDATE ` + table.name + ` SET ` + strings.Join(set, ", ") + ` WHERE ` + strings.Join(where, " AND ")
+
+	type sealedRow struct {
+		key       []interface{}
+		documents [][]byte
+		keyID     string
+	}
+	return func(ctx context.Context, limit int) (int, error) {
+		resealed := 0
+		err := r.WithinTx(ctx, func(ctx context.Context) error {
+			rows, err := r.conn(ctx).QueryContext(ctx, selectQuery, r.pii.KeyID(), limit)
+			if err != nil {
+				return err
+			}
+			var sealedRows []*sealedRow
+			for rows.Next() {
+				row := &sealedRow{key: make([]interface{}, len(table.key)), documents: make([][]byte, len(table.documents))}
+				dest := make([]interface{}, 0, len(columns)+1)
+				for i := range row.key {
+					dest = append(dest, &row.key[i])
+				}
+				for i := range row.documents {
+					dest = append(dest, &row.documents[i])
+				}
+				if err := rows.Scan(append(dest, &row.keyID)...); err != nil {
+					rows.Close()
+					return err
+				}
+				sealedRows = append(sealedRows, row)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, row := range sealedRows {
+				args := make([]interface{}, 0, len(columns)+1)
+				for _, stored := range row.documents {
+					document, err := r.openJSON(row.keyID, stored)
+					if err != nil {
+						return err
+					}
+					sealed, err := r.sealJSON(document)
+					if err != nil {
+						return err
+					}
+					args = append(args, sealed)
+				}
+				args = append(append(args, r.pii.KeyID()), row.key...)
+				if _, err := r.conn(ctx).ExecContext(ctx, updateQuery, args...); err != nil {
+					return err
+				}
+			}
+			resealed = len(sealedRows)
+			return nil
+		})
+		return resealed, err
+	}
+}
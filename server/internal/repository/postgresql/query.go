@@ -0,0 +1,227 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/pii"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/lib/pq"
+)
+
+// profileColumns lists the columns read by scanProfile, in scan order
+const profileColumns = `id, name, email, bio, image_urls, version, created_at, updated_at, deleted_at, tenant_id, attributes, tags, pii_key_id`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProfile reads a profile selected with profileColumns, followed by any
+// extra columns, which are scanned into extra, and opens its sealed PII
+func (r *Repository) scanProfile(row rowScanner, extra ...interface{}) (*models.Profile, error) {
+	var imageURLsJSON, attributesJSON, tagsJSON []byte
+	var keyID string
+	profile := &models.Profile{}
+	dest := []interface{}{
+		&profile.ID,
+		&profile.Name,
+		&profile.Email,
+		&profile.Bio,
+		&imageURLsJSON,
+		&profile.Version,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+		&profile.DeletedAt,
+		&profile.TenantID,
+		&attributesJSON,
+		&tagsJSON,
+		&keyID,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	// Convert JSON back to []string
+	if err := json.Unmarshal(imageURLsJSON, &profile.ImageURLs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(attributesJSON, &profile.Attributes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tagsJSON, &profile.Tags); err != nil {
+		return nil, err
+	}
+	if err := r.openPII(profile, keyID); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// attributesJSON encodes custom attributes for storage, storing none as an
+// empty object. It is sent as text, which COPY cannot mistake for bytea.
+func attributesJSON(attributes map[string]interface{}) (string, error) {
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	data, err := json.Marshal(attributes)
+	return string(data), err
+}
+
+// tagsJSON encodes tags for storage, storing none as an empty list
+func tagsJSON(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	data, err := json.Marshal(tags)
+	return string(data), err
+}
+
+// sortColumns maps list sort fields to their database columns. Names sort
+// bytewise, whatever the database's collation, so that every shard and the
+// merge of their pages agree on the order.
+var sortColumns = map[string]string{
+	repository.SortByCreatedAt: "created_at",
+	repository.SortByUpdatedAt: "updated_at",
+	repository.SortByName:      `name COLLATE "C"`,
+}
+
+// queryBuilder accumulates WHERE conditions and their positional arguments
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg registers a query argument and returns its placeholder
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// where adds a condition built with placeholders returned by arg
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// clause renders the accumulated conditions as a WHERE clause
+func (b *queryBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// buildListQuery builds a keyset-paginated listing query of a tenant's profiles
+// for normalized options, selecting up to limit rows. A limit of 0 selects
+// every matching row. Email domains are matched by their blind index under codec.
+func buildListQuery(codec pii.Codec, tenantID string, opts repository.ListOptions, limit int) (string, []interface{}, error) {
+	cursor, err := opts.DecodeCursor()
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := &queryBuilder{}
+	if err := filterProfiles(b, codec, tenantID, opts); err != nil {
+		return "", nil, err
+	}
+
+	column := sortColumns[opts.SortBy]
+	direction, comparison := "DESC", "<"
+	if opts.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if cursor != nil {
+		var value interface{} = cursor.Value
+		if opts.SortBy != repository.SortByName {
+			value, _ = cursor.Time()
+		}
+		b.where(fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, b.arg(value), b.arg(cursor.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM profiles
+		%s
+		ORDER BY %s %s, id %s
+	`, profileColumns, b.clause(), column, direction, direction)
+	if limit > 0 {
+		query += "LIMIT " + b.arg(limit)
+	}
+
+	return query, b.args, nil
+}
+
+// buildTagFacetQuery builds a query counting the tags of a tenant's profiles
+// matching normalized options, most common first. A limit of 0 counts every tag.
+func buildTagFacetQuery(codec pii.Codec, tenantID string, opts repository.ListOptions, limit int) (string, []interface{}, error) {
+	b := &queryBuilder{}
+	if err := filterProfiles(b, codec, tenantID, opts); err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT tag, count(*)
+		FROM (SELECT tags FROM profiles %s) AS matching,
+			jsonb_array_elements_text(matching.tags) AS tag
+		GROUP BY tag
+		ORDER BY count(*) DESC, tag
+	`, b.clause())
+	if limit > 0 {
+		query += "LIMIT " + b.arg(limit)
+	}
+
+	return query, b.args, nil
+}
+
+// filterProfiles adds the conditions selecting a tenant's profiles matching
+// normalized options, other than their cursor
+func filterProfiles(b *queryBuilder, codec pii.Codec, tenantID string, opts repository.ListOptions) error {
+	b.where(fmt.Sprintf("tenant_id = %s", b.arg(tenantID)))
+	if opts.Deleted {
+		b.where("deleted_at IS NOT NULL")
+	} else {
+		b.where("deleted_at IS NULL")
+	}
+	if opts.EmailDomain != "" {
+		b.where(fmt.Sprintf("email_domain_index = %s", b.arg(codec.BlindIndex(opts.EmailDomain))))
+	}
+	if opts.NamePrefix != "" {
+		b.where(fmt.Sprintf("lower(name) LIKE %s ESCAPE '\\'", b.arg(likePrefix(opts.NamePrefix))))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		b.where(fmt.Sprintf("created_at >= %s", b.arg(opts.CreatedAfter)))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		b.where(fmt.Sprintf("created_at < %s", b.arg(opts.CreatedBefore)))
+	}
+	if len(opts.Attributes) > 0 {
+		// Containment is what the GIN index on attributes serves
+		filter, err := json.Marshal(opts.Attributes)
+		if err != nil {
+			return err
+		}
+		b.where(fmt.Sprintf("attributes @> %s::jsonb", b.arg(string(filter))))
+	}
+	if len(opts.Tags) > 0 {
+		// Both operators are served by the GIN index on tags
+		if opts.AnyTag {
+			b.where(fmt.Sprintf("tags ?| %s", b.arg(pq.Array(opts.Tags))))
+		} else {
+			filter, err := json.Marshal(opts.Tags)
+			if err != nil {
+				return err
+			}
+			b.where(fmt.Sprintf("tags @> %s::jsonb", b.arg(string(filter))))
+		}
+	}
+	return nil
+}
+
+// likePrefix escapes LIKE wildcards in a prefix and appends a trailing wildcard
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
@@ -0,0 +1,238 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// replicaCheckTimeout bounds a single replica health check
+	replicaCheckTimeout = 2 * time.Second
+	// consistencyPollInterval is how often replicas are polled while a read waits for one to catch up
+	consistencyPollInterval = 10 * time.Millisecond
+)
+
+// replica is a read-only standby of the primary database
+type replica struct {
+	// name identifies the replica in logs and metrics without exposing its DSN
+	name string
+	db   *sql.DB
+
+	healthy   atomic.Bool
+	replayLSN atomic.Uint64
+}
+
+// newReplica opens a connection pool to a replica. The replica serves no reads
+// until a health check succeeds.
+func newReplica(index int, uri string) (*replica, error) {
+	db, err := openPool(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &replica{name: fmt.Sprintf("replica-%d", index), db: db}, nil
+}
+
+// readConn returns the connection a read should use: the transaction carried by
+// ctx, a healthy replica that has replayed the context's consistency token, or
+// the primary
+func (r *Repository) readConn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{db: r.db}).(*sql.Tx); ok {
+		return tx
+	}
+	if len(r.replicas) == 0 {
+		return r.db
+	}
+	var minLSN uint64
+	if token := repository.ConsistencyTokenFrom(ctx); token != "" {
+		lsn, err := parseLSN(token)
+		if err != nil {
+			// The primary is always consistent, so an unreadable token is not fatal
+			logger.Log.Warn("Ignoring malformed consistency token", zap.String("token", token))
+			metrics.DbReadsRoutedTotal.WithLabelValues("primary").Inc()
+			return r.db
+		}
+		minLSN = lsn
+	}
+
+	replica := r.pickReplica(minLSN)
+	if replica == nil && minLSN > 0 {
+		replica = r.awaitReplica(ctx, minLSN)
+	}
+	if replica == nil {
+		metrics.DbReadsRoutedTotal.WithLabelValues("primary").Inc()
+		return r.db
+	}
+
+	metrics.DbReadsRoutedTotal.WithLabelValues("replica").Inc()
+	return replica.db
+}
+
+// pickReplica returns a healthy replica that has replayed at least minLSN,
+// rotating between them, or nil if there is none
+func (r *Repository) pickReplica(minLSN uint64) *replica {
+	start := r.nextReplica.Add(1)
+	for i := range r.replicas {
+		replica := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if replica.healthy.Load() && replica.replayLSN.Load() >= minLSN {
+			return replica
+		}
+	}
+	return nil
+}
+
+// awaitReplica polls the healthy replicas until one has replayed minLSN or the
+// consistency wait runs out
+func (r *Repository) awaitReplica(ctx context.Context, minLSN uint64) *replica {
+	if r.consistencyWait <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.consistencyWait)
+	defer cancel()
+
+	ticker := time.NewTicker(consistencyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, replica := range r.replicas {
+			if !replica.healthy.Load() {
+				continue
+			}
+			var lsn string
+			if err := replica.db.QueryRowContext(ctx, `SELECT pg_last_wal_replay_lsn()::text`).Scan(&lsn); err != nil {
+				continue
+			}
+			if replayed, err := parseLSN(lsn); err == nil {
+				replica.replayLSN.Store(replayed)
+				if replayed >= minLSN {
+					return replica
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// MonitorReplicas checks the health and replay position of every replica at the
+// given interval until ctx is cancelled
+func (r *Repository) MonitorReplicas(ctx context.Context, interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, replica := range r.replicas {
+			r.checkReplica(ctx, replica)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkReplica records whether a replica is reachable, in recovery and within
+// the maximum replication lag
+func (r *Repository) checkReplica(ctx context.Context, replica *replica) {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	// A replica with nothing left to replay is current, however long ago it last
+	// replayed a transaction
+	query := `
+		SELECT
+			pg_last_wal_replay_lsn()::text,
+			CASE
+				WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+			END
+	`
+
+	var lsn sql.NullString
+	var lagSeconds float64
+	err := replica.db.QueryRowContext(ctx, query).Scan(&lsn, &lagSeconds)
+
+	var replayed uint64
+	switch {
+	case err != nil:
+	case !lsn.Valid:
+		err = errors.New("server is not a standby")
+	default:
+		replayed, err = parseLSN(lsn.String)
+	}
+
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	healthy := err == nil && lag <= r.maxReplicaLag
+	if healthy != replica.healthy.Load() {
+		logger.Log.Info("Replica health changed",
+			zap.String("replica", replica.name),
+			zap.Bool("healthy", healthy),
+			zap.Duration("lag", lag),
+			zap.Error(err),
+		)
+	}
+
+	if err == nil {
+		replica.replayLSN.Store(replayed)
+	}
+	replica.healthy.Store(healthy)
+
+	healthyValue := 0.0
+	if healthy {
+		healthyValue = 1
+	}
+	metrics.DbReplicaHealthy.WithLabelValues(replica.name).Set(healthyValue)
+	metrics.DbReplicaLag.WithLabelValues(replica.name).Set(lag.Seconds())
+}
+
+// ConsistencyToken returns the primary's current WAL position. A replica that
+// has replayed it has every write committed before the call.
+func (r *Repository) ConsistencyToken(ctx context.Context) (string, error) {
+	if len(r.replicas) == 0 {
+		return "", nil
+	}
+
+	var lsn string
+	if err := r.db.QueryRowContext(ctx, `SELECT pg_current_wal_lsn()::text`).Scan(&lsn); err != nil {
+		return "", mapError(err)
+	}
+	return lsn, nil
+}
+
+// parseLSN parses a PostgreSQL WAL position of the form "16/B374D848"
+func parseLSN(lsn string) (uint64, error) {
+	high, low, ok := strings.Cut(lsn, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q", lsn)
+	}
+	hi, err := strconv.ParseUint(high, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", lsn)
+	}
+	lo, err := strconv.ParseUint(low, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", lsn)
+	}
+	return hi<<32 | lo, nil
+}
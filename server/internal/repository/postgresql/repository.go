@@ -4,93 +4,164 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"sync/atomic"
 	"time"
 
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
 	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
 	"github.com/fernandobarroso/profile-service/internal/config"
 	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/pii"
 	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/postgresql/migrations"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
-// Repository implements the repository.Store interface for PostgreSQL
+// Repository implements the repository.Store and repository.Outbox interfaces for PostgreSQL
 type Repository struct {
+	// db is the primary, which serves all writes and transactions
 	db *sql.DB
+
+	// replicas serve reads made outside a transaction
+	replicas        []*replica
+	nextReplica     atomic.Uint64
+	maxReplicaLag   time.Duration
+	consistencyWait time.Duration
+
+	// pii seals emails, and bios if encryptBio is set, before they are stored
+	pii        pii.Codec
+	encryptBio bool
 }
 
 // NewRepository creates a new PostgreSQL repository
-func NewRepository(cfg *config.Config) (repository.Store, error) {
-	db, err := sql.Open("postgres", cfg.Database.URI)
+func NewRepository(cfg *config.Config) (*Repository, error) {
+	codec, err := pii.NewCodec(cfg.PII.KeyringPath)
 	if err != nil {
+		logger.Log.Error("Failed to load PII keyring", zap.Error(err))
 		return nil, err
 	}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	// Test the connection
-	if err := db.Ping(); err != nil {
+	db, err := OpenDB(cfg.Database.URI)
+	if err != nil {
 		logger.Log.Error("Failed to connect to PostgreSQL", zap.Error(err))
 		return nil, err
 	}
 
-	// Initialize database schema
-	if err := initSchema(db); err != nil {
-		logger.Log.Error("Failed to initialize database schema", zap.Error(err))
+	// Bring the database schema up to date
+	if cfg.Database.AutoMigrate {
+		migrator, err := migrations.NewMigrator(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.Log.Error("Failed to migrate database schema", zap.Error(err))
+			db.Close()
+			return nil, err
+		}
+	}
+
+	repo := &Repository{
+		db:              db,
+		maxReplicaLag:   cfg.Database.ReplicaMaxLag,
+		consistencyWait: cfg.Database.ConsistencyWait,
+		pii:             codec,
+		encryptBio:      cfg.PII.EncryptBio,
+	}
+	for i, uri := range cfg.Database.ReplicaURIs {
+		replica, err := newReplica(i, uri)
+		if err != nil {
+			repo.Close(context.Background())
+			return nil, err
+		}
+		repo.replicas = append(repo.replicas, replica)
+	}
+
+	return repo, nil
+}
+
+// OpenDB opens a PostgreSQL connection pool and verifies the connection
+func OpenDB(uri string) (*sql.DB, error) {
+	db, err := openPool(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &Repository{db: db}, nil
+	return db, nil
 }
 
-// initSchema creates the necessary database tables
-func initSchema(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS profiles (
-			id VARCHAR(36) PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			email VARCHAR(255) NOT NULL UNIQUE,
-			bio TEXT,
-			image_urls JSONB,
-			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
-			updated_at TIMESTAMP WITH TIME ZONE NOT NULL
-		)
-	`
+// openPool opens a PostgreSQL connection pool without connecting
+func openPool(uri string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := db.Exec(query)
-	return err
+	// Set connection pool settings
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	return db, nil
 }
 
-// Close closes the database connection
+// Close closes the database connections
 func (r *Repository) Close(ctx context.Context) error {
+	for _, replica := range r.replicas {
+		replica.db.Close()
+	}
 	return r.db.Close()
 }
 
 // Create creates a new profile
 func (r *Repository) Create(ctx context.Context, profile *models.Profile) error {
 	query := `
-		INSERT INTO profiles (id, name, email, bio, image_urls, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7)
+		INSERT INTO profiles (id, name, email, bio, image_urls, version, created_at, updated_at, tenant_id, attributes, tags, email_index, email_domain_index, pii_key_id)
+		VALUES ($1, $2, $3, $4, $5::jsonb, 1, $6, $7, $8, $9::jsonb, $10::jsonb, $11, $12, $13)
 	`
+	tenantID := tenant.FromContext(ctx)
+
+	stored, err := r.sealPII(profile)
+	if err != nil {
+		return err
+	}
 
 	// Convert ImageURLs to JSON
 	imageURLsJSON, err := json.Marshal(profile.ImageURLs)
 	if err != nil {
 		return err
 	}
+	attributes, err := attributesJSON(profile.Attributes)
+	if err != nil {
+		return err
+	}
+	tags, err := tagsJSON(profile.Tags)
+	if err != nil {
+		return err
+	}
 
-	_, err = r.db.ExecContext(ctx, query,
+	_, err = r.conn(ctx).ExecContext(ctx, query,
 		profile.ID,
 		profile.Name,
-		profile.Email,
-		profile.Bio,
+		stored.email,
+		stored.bio,
 		imageURLsJSON,
 		profile.CreatedAt,
 		profile.UpdatedAt,
+		tenantID,
+		attributes,
+		tags,
+		stored.emailIndex,
+		stored.emailDomainIndex,
+		stored.keyID,
 	)
 
 	if err != nil {
@@ -98,33 +169,29 @@ func (r *Repository) Create(ctx context.Context, profile *models.Profile) error
 		logger.Log.Error("Failed to create profile",
 			zap.Error(err),
 		)
-		return err
+		return mapError(err)
 	}
 
+	profile.Version = 1
+	profile.TenantID = tenantID
 	metrics.DbOperationsTotal.WithLabelValues("create", "success").Inc()
 	return nil
 }
 
 // Get retrieves a profile by ID
 func (r *Repository) Get(ctx context.Context, id string) (*models.Profile, error) {
+	return r.getProfile(ctx, r.readConn(ctx), id)
+}
+
+// getProfile retrieves a profile by ID over the given connection
+func (r *Repository) getProfile(ctx context.Context, conn querier, id string) (*models.Profile, error) {
 	query := `
-		SELECT id, name, email, bio, image_urls, created_at, updated_at
+		SELECT ` + profileColumns + `
 		FROM profiles
-		WHERE id = $1
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 	`
 
-	var imageURLsJSON []byte
-	profile := &models.Profile{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&profile.ID,
-		&profile.Name,
-		&profile.Email,
-		&profile.Bio,
-		&imageURLsJSON,
-		&profile.CreatedAt,
-		&profile.UpdatedAt,
-	)
-
+	profile, err := r.scanProfile(conn.QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, repository.ErrNotFound
@@ -133,154 +200,256 @@ func (r *Repository) Get(ctx context.Context, id string) (*models.Profile, error
 		logger.Log.Error("Failed to get profile",
 			zap.Error(err),
 		)
-		return nil, err
+		return nil, mapError(err)
 	}
 
-	// Convert JSON back to []string
-	if err := json.Unmarshal(imageURLsJSON, &profile.ImageURLs); err != nil {
-		return nil, err
+	metrics.DbOperationsTotal.WithLabelValues("get", "success").Inc()
+	return profile, nil
+}
+
+// GetIncludingDeleted retrieves a profile by ID, whether or not it is
+// soft-deleted. It always reads from the primary.
+func (r *Repository) GetIncludingDeleted(ctx context.Context, id string) (*models.Profile, error) {
+	query := `
+		SELECT ` + profileColumns + `
+		FROM profiles
+		WHERE id = $1 AND tenant_id = $2
+	`
+
+	profile, err := r.scanProfile(r.conn(ctx).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		metrics.DbOperationsTotal.WithLabelValues("get", "error").Inc()
+		logger.Log.Error("Failed to get profile",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
 	}
 
 	metrics.DbOperationsTotal.WithLabelValues("get", "success").Inc()
 	return profile, nil
 }
 
-// Update updates a profile
-func (r *Repository) Update(ctx context.Context, id string, profile *models.Profile) error {
+// Replace overwrites all editable fields of an existing profile
+func (r *Repository) Replace(ctx context.Context, id string, profile *models.Profile, expectedVersion int) error {
 	start := time.Now()
 
-	// First get the current profile
-	currentProfile, err := r.Get(ctx, id)
+	query := `
+		UPDATE profiles
+		SET name = $1, email = $2, bio = $3, image_urls = $4::jsonb, attributes = $9::jsonb, tags = $10::jsonb, updated_at = $5, version = version + 1,
+			email_index = $11, email_domain_index = $12, pii_key_id = $13
+		WHERE id = $6 AND tenant_id = $8 AND deleted_at IS NULL AND ($7 = 0 OR version = $7)
+		RETURNING ` + profileColumns
+
+	imageURLs := profile.ImageURLs
+	if imageURLs == nil {
+		imageURLs = []string{}
+	}
+	imageURLsJSON, err := json.Marshal(imageURLs)
 	if err != nil {
 		return err
 	}
-
-	// Merge updates with current profile
-	if profile.Name != "" {
-		currentProfile.Name = profile.Name
-	}
-	if profile.Email != "" {
-		currentProfile.Email = profile.Email
-	}
-	if profile.Bio != "" {
-		currentProfile.Bio = profile.Bio
+	attributes, err := attributesJSON(profile.Attributes)
+	if err != nil {
+		return err
 	}
-	if profile.ImageURLs != nil {
-		currentProfile.ImageURLs = profile.ImageURLs
+	tags, err := tagsJSON(profile.Tags)
+	if err != nil {
+		return err
 	}
-
-	query := `
-		UPDATE profiles
-		SET name = $1, email = $2, bio = $3, image_urls = $4::jsonb, updated_at = $5
-		WHERE id = $6
-	`
-
-	// Convert ImageURLs to JSON
-	imageURLsJSON, err := json.Marshal(currentProfile.ImageURLs)
+	sealed, err := r.sealPII(profile)
 	if err != nil {
 		return err
 	}
 
-	result, err := r.db.ExecContext(ctx, query,
-		currentProfile.Name,
-		currentProfile.Email,
-		currentProfile.Bio,
+	stored, err := r.scanProfile(r.conn(ctx).QueryRowContext(ctx, query,
+		profile.Name,
+		sealed.email,
+		sealed.bio,
 		imageURLsJSON,
 		time.Now(),
 		id,
-	)
-
+		expectedVersion,
+		tenant.FromContext(ctx),
+		attributes,
+		tags,
+		sealed.emailIndex,
+		sealed.emailDomainIndex,
+		sealed.keyID,
+	))
 	if err != nil {
-		metrics.DbOperationsTotal.WithLabelValues("update", "error").Inc()
-		logger.Log.Error("Failed to update profile",
+		if err == sql.ErrNoRows {
+			return r.missingOrConflict(ctx, id)
+		}
+		metrics.DbOperationsTotal.WithLabelValues("replace", "error").Inc()
+		logger.Log.Error("Failed to replace profile",
 			zap.Error(err),
 		)
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return repository.ErrNotFound
+		return mapError(err)
 	}
 
-	// Update the input profile with the merged data
-	*profile = *currentProfile
+	*profile = *stored
 
-	metrics.DbOperationsTotal.WithLabelValues("update", "success").Inc()
-	metrics.DbOperationDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
+	metrics.DbOperationsTotal.WithLabelValues("replace", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("replace").Observe(time.Since(start).Seconds())
 	return nil
 }
 
-// Delete deletes a profile
-func (r *Repository) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM profiles WHERE id = $1`
+// Delete soft-deletes a profile by setting its tombstone timestamp
+func (r *Repository) Delete(ctx context.Context, id string, expectedVersion int) (*models.Profile, error) {
+	query := `
+		UPDATE profiles
+		SET deleted_at = $2, updated_at = $2, version = version + 1
+		WHERE id = $1 AND tenant_id = $4 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
+		RETURNING ` + profileColumns
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	profile, err := r.scanProfile(r.conn(ctx).QueryRowContext(ctx, query, id, time.Now(), expectedVersion, tenant.FromContext(ctx)))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, r.missingOrConflict(ctx, id)
+		}
 		metrics.DbOperationsTotal.WithLabelValues("delete", "error").Inc()
 		logger.Log.Error("Failed to delete profile",
 			zap.Error(err),
 		)
-		return err
+		return nil, mapError(err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	metrics.DbOperationsTotal.WithLabelValues("delete", "success").Inc()
+	return profile, nil
+}
+
+// Restore clears the tombstone of a soft-deleted profile
+func (r *Repository) Restore(ctx context.Context, id string) (*models.Profile, error) {
+	query := `
+		UPDATE profiles
+		SET deleted_at = NULL, updated_at = $2, version = version + 1
+		WHERE id = $1 AND tenant_id = $3 AND deleted_at IS NOT NULL
+		RETURNING ` + profileColumns
+
+	profile, err := r.scanProfile(r.conn(ctx).QueryRowContext(ctx, query, id, time.Now(), tenant.FromContext(ctx)))
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		metrics.DbOperationsTotal.WithLabelValues("restore", "error").Inc()
+		logger.Log.Error("Failed to restore profile",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
 	}
 
-	if rowsAffected == 0 {
-		return repository.ErrNotFound
+	metrics.DbOperationsTotal.WithLabelValues("restore", "success").Inc()
+	return profile, nil
+}
+
+// Erase permanently removes a profile, live or soft-deleted, and by cascade its
+// revisions
+func (r *Repository) Erase(ctx context.Context, id string) (*models.Profile, error) {
+	query := `
+		DELETE FROM profiles
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING ` + profileColumns
+
+	profile, err := r.scanProfile(r.conn(ctx).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		metrics.DbOperationsTotal.WithLabelValues("erase", "error").Inc()
+		logger.Log.Error("Failed to erase profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
 	}
 
-	metrics.DbOperationsTotal.WithLabelValues("delete", "success").Inc()
-	return nil
+	metrics.DbOperationsTotal.WithLabelValues("erase", "success").Inc()
+	return profile, nil
 }
 
-// List retrieves all profiles
-func (r *Repository) List(ctx context.Context) ([]*models.Profile, error) {
+// PurgeDeleted permanently removes up to limit profiles of any tenant tombstoned
+// before the given time and returns them
+func (r *Repository) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*models.Profile, error) {
+	// SKIP LOCKED lets several pods purge concurrently without waiting on each other
 	query := `
-		SELECT id, name, email, bio, image_urls, created_at, updated_at
-		FROM profiles
-		ORDER BY created_at DESC
-	`
+		DELETE FROM profiles
+		WHERE id IN (
+			SELECT id FROM profiles
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			ORDER BY deleted_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + profileColumns
 
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, before, limit)
 	if err != nil {
-		metrics.DbOperationsTotal.WithLabelValues("list", "error").Inc()
-		logger.Log.Error("Failed to list profiles",
+		metrics.DbOperationsTotal.WithLabelValues("purge", "error").Inc()
+		logger.Log.Error("Failed to purge deleted profiles",
 			zap.Error(err),
 		)
-		return nil, err
+		return nil, mapError(err)
 	}
 	defer rows.Close()
 
-	var profiles []*models.Profile
+	var purged []*models.Profile
 	for rows.Next() {
-		var imageURLsJSON []byte
-		profile := &models.Profile{}
-		err := rows.Scan(
-			&profile.ID,
-			&profile.Name,
-			&profile.Email,
-			&profile.Bio,
-			&imageURLsJSON,
-			&profile.CreatedAt,
-			&profile.UpdatedAt,
-		)
+		profile, err := r.scanProfile(rows)
 		if err != nil {
 			return nil, err
 		}
+		purged = append(purged, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("purge", "success").Inc()
+	return purged, nil
+}
+
+// missingOrConflict explains why a conditional write matched no rows
+func (r *Repository) missingOrConflict(ctx context.Context, id string) error {
+	var exists bool
+	if err := r.conn(ctx).QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM profiles WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL)`, id, tenant.FromContext(ctx)).Scan(&exists); err != nil {
+		return mapError(err)
+	}
+	if exists {
+		return repository.ErrConflict
+	}
+	return repository.ErrNotFound
+}
+
+// List retrieves a page of profiles matching the given options
+func (r *Repository) List(ctx context.Context, opts repository.ListOptions) (*repository.ListResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	// One extra row tells whether there is a next page
+	query, args, err := buildListQuery(r.pii, tenant.FromContext(ctx), opts, opts.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.readConn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("list", "error").Inc()
+		logger.Log.Error("Failed to list profiles",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
 
-		// Convert JSON back to []string
-		if err := json.Unmarshal(imageURLsJSON, &profile.ImageURLs); err != nil {
+	profiles := make([]*models.Profile, 0, opts.Limit+1)
+	for rows.Next() {
+		profile, err := r.scanProfile(rows)
+		if err != nil {
 			return nil, err
 		}
-
 		profiles = append(profiles, profile)
 	}
 
@@ -288,6 +457,48 @@ func (r *Repository) List(ctx context.Context) ([]*models.Profile, error) {
 		return nil, err
 	}
 
+	result := &repository.ListResult{Profiles: profiles}
+	if len(profiles) > opts.Limit {
+		result.Profiles = profiles[:opts.Limit]
+		result.NextCursor = repository.NewCursor(opts, result.Profiles[opts.Limit-1])
+	}
+
 	metrics.DbOperationsTotal.WithLabelValues("list", "success").Inc()
-	return profiles, nil
+	return result, nil
+}
+
+// TagFacets counts the tags of the profiles matching the given options
+func (r *Repository) TagFacets(ctx context.Context, opts repository.ListOptions, limit int) ([]*models.TagCount, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	query, args, err := buildTagFacetQuery(r.pii, tenant.FromContext(ctx), opts, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.readConn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("tag_facets", "error").Inc()
+		logger.Log.Error("Failed to count profile tags",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	counts := []*models.TagCount{}
+	for rows.Next() {
+		count := &models.TagCount{}
+		if err := rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("tag_facets", "success").Inc()
+	return counts, nil
 }
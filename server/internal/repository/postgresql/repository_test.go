@@ -0,0 +1,215 @@
+package postgresql
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/pii"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/storetest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	os.Exit(m.Run())
+}
+
+// testConfig returns the configuration of the database at TEST_POSTGRES_URI,
+// skipping the test if it is not set
+func testConfig(t *testing.T) *config.Config {
+	uri := os.Getenv("TEST_POSTGRES_URI")
+	if uri == "" {
+		t.Skip("TEST_POSTGRES_URI is not set")
+	}
+
+	cfg := &config.Config{}
+	cfg.Database.URI = uri
+	cfg.Database.AutoMigrate = true
+	return cfg
+}
+
+// openTestRepository connects to the test database, emptying it if empty is set
+func openTestRepository(t *testing.T, cfg *config.Config, empty bool) *Repository {
+	repo, err := NewRepository(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close(context.Background()) })
+
+	if empty {
+		_, err = repo.db.Exec(`TRUNCATE profiles, outbox, profile_emails CASCADE`)
+		require.NoError(t, err)
+	}
+	return repo
+}
+
+// writeTestKeyring writes a keyring whose primary key is primary, holding a
+// key for each of ids, and returns its path
+func writeTestKeyring(t *testing.T, primary string, ids ...string) string {
+	keys := make(map[string]string, len(ids))
+	for i, id := range ids {
+		keys[id] = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"primary":   primary,
+		"keys":      keys,
+		"index_key": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{9}, 32)),
+	})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// TestConformance runs against the database at TEST_POSTGRES_URI, which it
+// empties before every subtest
+func TestConformance(t *testing.T) {
+	cfg := testConfig(t)
+	storetest.Run(t, func(t *testing.T) repository.Backend {
+		return openTestRepository(t, cfg, true)
+	})
+}
+
+// TestConformanceSealed runs the conformance suite with emails and bios sealed
+func TestConformanceSealed(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.PII.KeyringPath = writeTestKeyring(t, "k1", "k1")
+	cfg.PII.EncryptBio = true
+	storetest.Run(t, func(t *testing.T) repository.Backend {
+		return openTestRepository(t, cfg, true)
+	})
+}
+
+func TestRotateKeys(t *testing.T) {
+	cfg := testConfig(t)
+	ctx := context.Background()
+
+	// Profiles stored before encryption was enabled
+	plain := openTestRepository(t, cfg, true)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		profile := &models.Profile{ID: uuid.New().String(), Name: "User", Email: fmt.Sprintf("user%d@Example.com", i), Bio: "Plain bio", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		require.NoError(t, plain.Create(ctx, profile))
+		_, err := plain.ClaimEmail(ctx, profile.Email, profile.ID)
+		require.NoError(t, err)
+		ids = append(ids, profile.ID)
+	}
+	require.NoError(t, plain.AddRevision(ctx, &models.Revision{ProfileID: ids[0], Revision: 1, Operation: "create", Snapshot: &models.Profile{ID: ids[0], Email: "user0@Example.com"}, CreatedAt: time.Now()}))
+	require.NoError(t, plain.Enqueue(ctx, &models.OutboxMessage{ID: uuid.New().String(), AggregateID: ids[0], Channel: "profiles", Payload: []byte(`{"email":"user0@Example.com"}`), CreatedAt: time.Now()}))
+	_, err := plain.RotateKeys(ctx, 2)
+	assert.Error(t, err, "rotation needs a keyring")
+
+	keyring := writeTestKeyring(t, "k1", "k1")
+	sealedCfg := *cfg
+	sealedCfg.PII.KeyringPath = keyring
+	sealedCfg.PII.EncryptBio = true
+	first := openTestRepository(t, &sealedCfg, false)
+	assert.ErrorIs(t, first.CheckSealed(ctx), ErrPlaintextPII)
+
+	// A profile locked by a write is skipped by its batch, but still resealed
+	tx, err := first.db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec(`SELECT 1 FROM profiles WHERE id = $1 FOR UPDATE`, ids[0])
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = tx.Commit()
+	}()
+	rotated, err := first.RotateKeys(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 5, rotated)
+	assert.NoError(t, first.CheckSealed(ctx))
+
+	var email, bio, keyID, emailIndex string
+	require.NoError(t, first.db.QueryRow(`SELECT email, bio, pii_key_id, email_index FROM profiles WHERE id = $1`, ids[0]).Scan(&email, &bio, &keyID, &emailIndex))
+	assert.True(t, pii.IsSealed(email))
+	assert.True(t, pii.IsSealed(bio))
+	assert.Equal(t, "k1", keyID)
+	assert.NotContains(t, emailIndex, "@")
+
+	var plainClaims int
+	require.NoError(t, first.db.QueryRow(`SELECT count(*) FROM profile_emails WHERE position('@' in email) > 0`).Scan(&plainClaims))
+	assert.Zero(t, plainClaims)
+
+	// Revision snapshots and outbox payloads hold the profile too
+	var snapshot, payload string
+	require.NoError(t, first.db.QueryRow(`SELECT snapshot::text FROM profile_revisions WHERE profile_id = $1`, ids[0]).Scan(&snapshot))
+	require.NoError(t, first.db.QueryRow(`SELECT payload::text FROM outbox WHERE aggregate_id = $1`, ids[0]).Scan(&payload))
+	assert.NotContains(t, snapshot, "user0@")
+	assert.NotContains(t, payload, "user0@")
+
+	// Rotating onto a new primary key keeps every profile readable
+	secondCfg := sealedCfg
+	secondCfg.PII.KeyringPath = writeTestKeyring(t, "k2", "k1", "k2")
+	second := openTestRepository(t, &secondCfg, false)
+	rotated, err = second.RotateKeys(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 5, rotated)
+	rotated, err = second.RotateKeys(ctx, 2)
+	require.NoError(t, err)
+	assert.Zero(t, rotated)
+
+	profile, err := second.Get(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, "user0@Example.com", profile.Email)
+	assert.Equal(t, "Plain bio", profile.Bio)
+	revision, err := second.GetRevision(ctx, ids[0], 1)
+	require.NoError(t, err)
+	assert.Equal(t, "user0@Example.com", revision.Snapshot.Email)
+	events, err := second.ListForAggregate(ctx, ids[0])
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.JSONEq(t, `{"email":"user0@Example.com"}`, string(events[0].Payload))
+
+	// Blind indexes keep emails unique and domains searchable
+	duplicate := &models.Profile{ID: uuid.New().String(), Name: "Copy", Email: "user0@Example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.ErrorIs(t, second.Create(ctx, duplicate), repository.ErrDuplicateEmail)
+	claim, err := second.ClaimEmail(ctx, "user1@Example.com", uuid.New().String())
+	require.NoError(t, err)
+	assert.Equal(t, ids[1], claim.ProfileID)
+	result, err := second.List(ctx, repository.ListOptions{EmailDomain: "example.com"})
+	require.NoError(t, err)
+	assert.Len(t, result.Profiles, 5)
+}
+
+func TestSealedPrefixRejected(t *testing.T) {
+	cfg := testConfig(t)
+	sealedCfg := *cfg
+	sealedCfg.PII.KeyringPath = writeTestKeyring(t, "k1", "k1")
+	sealedCfg.PII.EncryptBio = true
+	ctx := context.Background()
+
+	for name, cfg := range map[string]*config.Config{"plaintext": cfg, "sealed": &sealedCfg} {
+		t.Run(name, func(t *testing.T) {
+			repo := openTestRepository(t, cfg, true)
+
+			// A value that looks sealed could not be read back
+			profile := &models.Profile{ID: uuid.New().String(), Name: "User", Email: "user@example.com", Bio: pii.SealedPrefix + "bio", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+			assert.ErrorIs(t, repo.Create(ctx, profile), repository.ErrValidation)
+			_, err := repo.Get(ctx, profile.ID)
+			assert.ErrorIs(t, err, repository.ErrNotFound)
+
+			profile.Bio = "Plain bio"
+			require.NoError(t, repo.Create(ctx, profile))
+			replacement := *profile
+			replacement.Bio = pii.SealedPrefix + "bio"
+			assert.ErrorIs(t, repo.Replace(ctx, profile.ID, &replacement, 0), repository.ErrValidation)
+
+			stored, err := repo.Get(ctx, profile.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Plain bio", stored.Bio)
+		})
+	}
+}
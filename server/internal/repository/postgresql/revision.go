@@ -0,0 +1,235 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// revisionColumns lists the columns read by scanRevision, in scan order
+const revisionColumns = `profile_id, revision, operation, actor, snapshot, changes, created_at, pii_key_id`
+
+// encodeRevision returns the stored form of a revision's snapshot and changes.
+// Both hold the profile's PII, so they are sealed with the row's key.
+func (r *Repository) encodeRevision(revision *models.Revision) (snapshot, changes []byte, err error) {
+	if snapshot, err = json.Marshal(revision.Snapshot); err != nil {
+		return nil, nil, err
+	}
+	if changes, err = json.Marshal(revision.Changes); err != nil {
+		return nil, nil, err
+	}
+	if snapshot, err = r.sealJSON(snapshot); err != nil {
+		return nil, nil, err
+	}
+	if changes, err = r.sealJSON(changes); err != nil {
+		return nil, nil, err
+	}
+	return snapshot, changes, nil
+}
+
+// AddRevision records a change to a profile
+func (r *Repository) AddRevision(ctx context.Context, revision *models.Revision) error {
+	snapshotJSON, changesJSON, err := r.encodeRevision(revision)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO profile_revisions (` + revisionColumns + `, tenant_id)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6::jsonb, $7, $8, $9)
+	`
+
+	_, err = r.conn(ctx).ExecContext(ctx, query,
+		revision.ProfileID,
+		revision.Revision,
+		revision.Operation,
+		revision.Actor,
+		snapshotJSON,
+		changesJSON,
+		revision.CreatedAt,
+		r.pii.KeyID(),
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		logger.Log.Error("Failed to record profile revision",
+			zap.String("profile_id", revision.ProfileID),
+			zap.Int("revision", revision.Revision),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// AddRevisions records several changes at once using COPY
+func (r *Repository) AddRevisions(ctx context.Context, revisions []*models.Revision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		stmt, err := r.conn(ctx).(*sql.Tx).PrepareContext(ctx, pq.CopyIn("profile_revisions",
+			"profile_id", "revision", "operation", "actor", "snapshot", "changes", "created_at", "pii_key_id", "tenant_id",
+		))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, revision := range revisions {
+			snapshotJSON, changesJSON, err := r.encodeRevision(revision)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx,
+				revision.ProfileID,
+				revision.Revision,
+				revision.Operation,
+				revision.Actor,
+				string(snapshotJSON),
+				string(changesJSON),
+				revision.CreatedAt,
+				r.pii.KeyID(),
+				tenantID,
+			); err != nil {
+				return err
+			}
+		}
+
+		_, err = stmt.ExecContext(ctx)
+		return err
+	})
+	if err != nil {
+		logger.Log.Error("Failed to record profile revisions",
+			zap.Int("count", len(revisions)),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// GetRevision retrieves a single revision of a profile
+func (r *Repository) GetRevision(ctx context.Context, profileID string, revision int) (*models.Revision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM profile_revisions
+		WHERE profile_id = $1 AND revision = $2 AND tenant_id = $3
+	`
+
+	return r.getRevision(ctx, query, profileID, revision, tenant.FromContext(ctx))
+}
+
+// GetRevisionAt retrieves the latest revision of a profile recorded at or
+// before the given time
+func (r *Repository) GetRevisionAt(ctx context.Context, profileID string, at time.Time) (*models.Revision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM profile_revisions
+		WHERE profile_id = $1 AND created_at <= $2 AND tenant_id = $3
+		ORDER BY revision DESC
+		LIMIT 1
+	`
+
+	return r.getRevision(ctx, query, profileID, at, tenant.FromContext(ctx))
+}
+
+// getRevision runs a query selecting at most one revision
+func (r *Repository) getRevision(ctx context.Context, query string, args ...interface{}) (*models.Revision, error) {
+	revision, err := r.scanRevision(r.readConn(ctx).QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrRevisionNotFound
+		}
+		logger.Log.Error("Failed to get profile revision",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	return revision, nil
+}
+
+// ListRevisions returns a page of a profile's revisions, newest first
+func (r *Repository) ListRevisions(ctx context.Context, profileID string, opts repository.HistoryOptions) (*repository.HistoryResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM profile_revisions
+		WHERE profile_id = $1 AND tenant_id = $4 AND ($2 = 0 OR revision < $2)
+		ORDER BY revision DESC
+		LIMIT $3
+	`
+
+	rows, err := r.readConn(ctx).QueryContext(ctx, query, profileID, opts.Before, opts.Limit+1, tenant.FromContext(ctx))
+	if err != nil {
+		logger.Log.Error("Failed to list profile revisions",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	result := &repository.HistoryResult{Revisions: []*models.Revision{}}
+	for rows.Next() {
+		revision, err := r.scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Revisions = append(result.Revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Revisions) > opts.Limit {
+		result.Revisions = result.Revisions[:opts.Limit]
+		result.NextBefore = result.Revisions[opts.Limit-1].Revision
+	}
+	return result, nil
+}
+
+// scanRevision reads a revision selected with revisionColumns, opening its
+// sealed snapshot and changes
+func (r *Repository) scanRevision(row rowScanner) (*models.Revision, error) {
+	var snapshotJSON, changesJSON []byte
+	var keyID string
+	revision := &models.Revision{}
+	if err := row.Scan(
+		&revision.ProfileID,
+		&revision.Revision,
+		&revision.Operation,
+		&revision.Actor,
+		&snapshotJSON,
+		&changesJSON,
+		&revision.CreatedAt,
+		&keyID,
+	); err != nil {
+		return nil, err
+	}
+
+	snapshotJSON, err := r.openJSON(keyID, snapshotJSON)
+	if err != nil {
+		return nil, err
+	}
+	if changesJSON, err = r.openJSON(keyID, changesJSON); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(snapshotJSON, &revision.Snapshot); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(changesJSON, &revision.Changes); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
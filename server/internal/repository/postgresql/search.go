@@ -0,0 +1,77 @@
+package postgresql
+
+import (
+	"context"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/pii"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// Search runs a ranked full-text search over profile names and bios
+func (r *Repository) Search(ctx context.Context, opts repository.SearchOptions) (*repository.SearchResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	offset, err := opts.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	// Headlines are expensive, so they are only built for the rows of the
+	// requested page. One extra row is ranked to detect a next page. Sealed bios
+	// get no snippet, which would show their ciphertext. Matches are delimited
+	// for repository.Highlight to mark up once the text is escaped.
+	query := `
+		SELECT ` + profileColumns + `, rank,
+			ts_headline('english', name, query, 'StartSel="` + repository.HighlightStart + `", StopSel="` + repository.HighlightStop + `", HighlightAll=true'),
+			CASE WHEN bio LIKE '` + pii.SealedPrefix + `%' THEN ''
+				ELSE ts_headline('english', coalesce(bio, ''), query, 'StartSel="` + repository.HighlightStart + `", StopSel="` + repository.HighlightStop + `", MaxFragments=2, MaxWords=20, MinWords=5')
+			END
+		FROM (
+			SELECT p.*, ts_rank_cd(p.search_vector, query) AS rank, query
+			FROM profiles p, websearch_to_tsquery('english', $1) AS query
+			WHERE p.tenant_id = $4 AND p.deleted_at IS NULL AND p.search_vector @@ query
+			ORDER BY rank DESC, p.id
+			LIMIT $2 OFFSET $3
+		) AS hits
+		ORDER BY rank DESC, id
+	`
+
+	rows, err := r.readConn(ctx).QueryContext(ctx, query, opts.Query, opts.Limit+1, offset, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("search", "error").Inc()
+		logger.Log.Error("Failed to search profiles",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	hits := make([]*repository.SearchHit, 0, opts.Limit+1)
+	for rows.Next() {
+		hit := &repository.SearchHit{}
+		hit.Profile, err = r.scanProfile(rows, &hit.Rank, &hit.NameHighlight, &hit.BioSnippet)
+		if err != nil {
+			return nil, err
+		}
+		hit.NameHighlight = repository.Highlight(hit.NameHighlight)
+		hit.BioSnippet = repository.Highlight(hit.BioSnippet)
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &repository.SearchResult{Hits: hits}
+	if len(hits) > opts.Limit {
+		result.Hits = hits[:opts.Limit]
+		result.NextCursor = repository.NewSearchCursor(opts, offset+opts.Limit)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("search", "success").Inc()
+	return result, nil
+}
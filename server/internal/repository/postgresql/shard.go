@@ -0,0 +1,188 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// claimAttempts bounds how often ClaimEmail retries when the claim it conflicted
+// with is released before it can be read
+const claimAttempts = 3
+
+// ImportProfile stores a profile and its revisions exactly as given, under the
+// profile's tenant, replacing any copy already stored
+func (r *Repository) ImportProfile(ctx context.Context, profile *models.Profile, revisions []*models.Revision) error {
+	imageURLsJSON, err := json.Marshal(profile.ImageURLs)
+	if err != nil {
+		return err
+	}
+	attributes, err := attributesJSON(profile.Attributes)
+	if err != nil {
+		return err
+	}
+	tags, err := tagsJSON(profile.Tags)
+	if err != nil {
+		return err
+	}
+	stored, err := r.sealPII(profile)
+	if err != nil {
+		return err
+	}
+
+	err = r.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := r.conn(ctx).ExecContext(ctx, `
+			INSERT INTO profiles (`+profileColumns+`, email_index, email_domain_index)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11::jsonb, $12::jsonb, $13, $14, $15)
+			ON CONFLICT (id) DO UPDATE SET
+				name = EXCLUDED.name,
+				email = EXCLUDED.email,
+				bio = EXCLUDED.bio,
+				image_urls = EXCLUDED.image_urls,
+				version = EXCLUDED.version,
+				created_at = EXCLUDED.created_at,
+				updated_at = EXCLUDED.updated_at,
+				deleted_at = EXCLUDED.deleted_at,
+				tenant_id = EXCLUDED.tenant_id,
+				attributes = EXCLUDED.attributes,
+				tags = EXCLUDED.tags,
+				pii_key_id = EXCLUDED.pii_key_id,
+				email_index = EXCLUDED.email_index,
+				email_domain_index = EXCLUDED.email_domain_index
+		`,
+			profile.ID,
+			profile.Name,
+			stored.email,
+			stored.bio,
+			imageURLsJSON,
+			profile.Version,
+			profile.CreatedAt,
+			profile.UpdatedAt,
+			profile.DeletedAt,
+			profile.TenantID,
+			attributes,
+			tags,
+			stored.keyID,
+			stored.emailIndex,
+			stored.emailDomainIndex,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, revision := range revisions {
+			snapshotJSON, changesJSON, err := r.encodeRevision(revision)
+			if err != nil {
+				return err
+			}
+			_, err = r.conn(ctx).ExecContext(ctx, `
+				INSERT INTO profile_revisions (`+revisionColumns+`, tenant_id)
+				VALUES ($1, $2, $3, $4, $5::jsonb, $6::jsonb, $7, $8, $9)
+				ON CONFLICT (profile_id, revision) DO NOTHING
+			`,
+				revision.ProfileID,
+				revision.Revision,
+				revision.Operation,
+				revision.Actor,
+				snapshotJSON,
+				changesJSON,
+				revision.CreatedAt,
+				r.pii.KeyID(),
+				profile.TenantID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Error("Failed to import profile",
+			zap.String("id", profile.ID),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// RemoveProfile permanently removes a profile of any tenant and, by cascade,
+// its revisions
+func (r *Repository) RemoveProfile(ctx context.Context, id string) error {
+	if _, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM profiles WHERE id = $1`, id); err != nil {
+		logger.Log.Error("Failed to remove profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+	return nil
+}
+
+// ListTenants returns the tenants having at least one stored profile
+func (r *Repository) ListTenants(ctx context.Context) ([]string, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT DISTINCT tenant_id FROM profiles ORDER BY tenant_id`)
+	if err != nil {
+		logger.Log.Error("Failed to list tenants",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, id)
+	}
+	return tenants, rows.Err()
+}
+
+// ClaimEmail records profileID as the holder of email in the context's tenant
+// unless another profile holds it, and returns the claim in effect. Claims are
+// recorded by the email's blind index.
+func (r *Repository) ClaimEmail(ctx context.Context, email, profileID string) (*repository.EmailClaim, error) {
+	tenantID := tenant.FromContext(ctx)
+	email = r.pii.BlindIndex(email)
+	for attempt := 0; attempt < claimAttempts; attempt++ {
+		// The insert waits for a concurrent claim of the same email to settle, and
+		// the select that follows sees whichever claim won
+		_, err := r.conn(ctx).ExecContext(ctx, `
+			INSERT INTO profile_emails (tenant_id, email, profile_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (tenant_id, email) DO NOTHING
+		`, tenantID, email, profileID)
+		if err != nil {
+			return nil, mapError(err)
+		}
+
+		claim := &repository.EmailClaim{}
+		err = r.conn(ctx).QueryRowContext(ctx, `
+			SELECT profile_id, claimed_at FROM profile_emails WHERE tenant_id = $1 AND email = $2
+		`, tenantID, email).Scan(&claim.ProfileID, &claim.ClaimedAt)
+		if err == nil {
+			return claim, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, mapError(err)
+		}
+	}
+	return nil, repository.ErrConflict
+}
+
+// ReleaseEmail removes the claim of profileID on email in the context's tenant,
+// if it holds one
+func (r *Repository) ReleaseEmail(ctx context.Context, email, profileID string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `
+		DELETE FROM profile_emails WHERE tenant_id = $1 AND email = $2 AND profile_id = $3
+	`, tenant.FromContext(ctx), r.pii.BlindIndex(email), profileID)
+	return mapError(err)
+}
@@ -0,0 +1,47 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txKey identifies the transaction a context carries for a given database, so
+// that transactions on different databases can travel in the same context
+type txKey struct {
+	db *sql.DB
+}
+
+// conn returns the transaction carried by ctx, or the connection pool if there is none
+func (r *Repository) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{db: r.db}).(*sql.Tx); ok {
+		return tx
+	}
+	return r.db
+}
+
+// WithinTx runs fn in a database transaction. Repository calls made with the
+// context passed to fn join the transaction, which is committed if fn returns
+// nil and rolled back otherwise. Nested calls reuse the outer transaction.
+func (r *Repository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{db: r.db}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{db: r.db}, tx)); err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// RevisionStore records the change history of profiles
+type RevisionStore interface {
+	// AddRevision records a change to a profile
+	AddRevision(ctx context.Context, revision *models.Revision) error
+
+	// AddRevisions records several changes at once
+	AddRevisions(ctx context.Context, revisions []*models.Revision) error
+
+	// GetRevision retrieves a single revision of a profile
+	GetRevision(ctx context.Context, profileID string, revision int) (*models.Revision, error)
+
+	// GetRevisionAt retrieves the latest revision of a profile recorded at or
+	// before the given time
+	GetRevisionAt(ctx context.Context, profileID string, at time.Time) (*models.Revision, error)
+
+	// ListRevisions returns a page of a profile's revisions, newest first
+	ListRevisions(ctx context.Context, profileID string, opts HistoryOptions) (*HistoryResult, error)
+}
+
+// HistoryOptions controls the listing of a profile's revisions
+type HistoryOptions struct {
+	// Limit is the maximum number of revisions to return
+	Limit int
+	// Before restricts the page to revisions older than this one, if non-zero
+	Before int
+}
+
+// HistoryResult is a single page of a profile's revisions
+type HistoryResult struct {
+	Revisions []*models.Revision `json:"revisions"`
+	// NextBefore is passed as Before to fetch the next page, and is zero on the last page
+	NextBefore int `json:"next_before,omitempty"`
+}
+
+// Normalize applies defaults and validates the options
+func (o *HistoryOptions) Normalize() error {
+	if o.Before < 0 {
+		return NewValidationError("before", "must be a positive revision number")
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+	return nil
+}
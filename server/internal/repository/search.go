@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// SearchOptions controls a full-text search over profile names and bios
+type SearchOptions struct {
+	// Query is the search text. Quoted phrases, "or" and "-" exclusions are supported.
+	Query string
+	// Limit is the maximum number of results to return
+	Limit int
+	// Cursor is the opaque token returned as NextCursor by a previous page
+	Cursor string
+}
+
+// SearchHit is a single ranked search result. Its highlights are HTML: the
+// profile's own text is escaped, and the only markup is the <mark> tags around
+// matching terms, so they can be rendered as they are.
+type SearchHit struct {
+	Profile *models.Profile `json:"profile"`
+	Rank    float64         `json:"rank"`
+	// NameHighlight is the profile name with matching terms wrapped in <mark> tags
+	NameHighlight string `json:"name_highlight"`
+	// BioSnippet is an excerpt of the bio around the matching terms, wrapped in <mark> tags
+	BioSnippet string `json:"bio_snippet"`
+}
+
+// Stores delimit matching terms with these private-use characters, which
+// Highlight turns into <mark> tags once the text around them is escaped
+const (
+	HighlightStart = "\uE000"
+	HighlightStop  = "\uE001"
+)
+
+// highlightMarkup replaces escaped highlight delimiters with <mark> tags
+var highlightMarkup = strings.NewReplacer(HighlightStart, "<mark>", HighlightStop, "</mark>")
+
+// Highlight HTML-escapes text whose matching terms are delimited by
+// HighlightStart and HighlightStop, wrapping those terms in <mark> tags
+func Highlight(text string) string {
+	return highlightMarkup.Replace(html.EscapeString(text))
+}
+
+// SearchResult is a single page of search results, best match first
+type SearchResult struct {
+	Hits       []*SearchHit `json:"results"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// searchCursor is the decoded form of a search pagination token. Ranks are not
+// stable enough to key on, so search pages resume from an offset.
+type searchCursor struct {
+	Query  string `json:"q"`
+	Offset int    `json:"o"`
+}
+
+// Normalize applies defaults and validates the options
+func (o *SearchOptions) Normalize() error {
+	o.Query = strings.TrimSpace(o.Query)
+	if o.Query == "" {
+		return fmt.Errorf("%w: search query is required", ErrInvalidListOptions)
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+	return nil
+}
+
+// Offset decodes the options' cursor into a result offset
+func (o *SearchOptions) Offset() (int, error) {
+	if o.Cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	var cursor searchCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Offset < 0 {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	if cursor.Query != o.Query {
+		return 0, fmt.Errorf("%w: cursor was issued for a different query", ErrInvalidListOptions)
+	}
+	return cursor.Offset, nil
+}
+
+// NewSearchCursor builds the pagination token for the page starting at offset
+func NewSearchCursor(opts SearchOptions, offset int) string {
+	data, _ := json.Marshal(searchCursor{Query: opts.Query, Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
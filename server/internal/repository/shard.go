@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// Shard is a backend that can hold one partition of a sharded store
+type Shard interface {
+	Backend
+	EmailDirectory
+
+	// ImportProfile stores a profile and its revisions exactly as given,
+	// including its version and tombstone, replacing any copy already stored
+	ImportProfile(ctx context.Context, profile *models.Profile, revisions []*models.Revision) error
+
+	// RemoveProfile permanently removes a profile and its revisions, whether or
+	// not it is deleted and whichever tenant it belongs to. Removing a missing
+	// profile is not an error.
+	RemoveProfile(ctx context.Context, id string) error
+
+	// ListTenants returns the tenants having at least one stored profile, live
+	// or deleted, in ascending order
+	ListTenants(ctx context.Context) ([]string, error)
+}
+
+// EmailClaim records which profile holds an email address
+type EmailClaim struct {
+	ProfileID string
+	ClaimedAt time.Time
+}
+
+// EmailDirectory maps email addresses to the profiles holding them, so that
+// uniqueness can be enforced across databases. Emails are claimed per tenant,
+// the one carried by the context.
+type EmailDirectory interface {
+	// ClaimEmail records profileID as the holder of email, unless another
+	// profile already holds it, and returns the claim in effect
+	ClaimEmail(ctx context.Context, email, profileID string) (*EmailClaim, error)
+
+	// ReleaseEmail removes the claim of profileID on email, if it holds one
+	ReleaseEmail(ctx context.Context, email, profileID string) error
+}
@@ -0,0 +1,33 @@
+package sharded
+
+import (
+	"context"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// Attribute definitions are few and read by every write, so they are kept
+// whole on the directory shard rather than spread by name.
+
+// ListAttributeDefinitions returns every attribute definition, from the directory shard
+func (r *Repository) ListAttributeDefinitions(ctx context.Context) ([]*models.AttributeDefinition, error) {
+	return r.directory().ListAttributeDefinitions(r.shardContext(ctx, 0))
+}
+
+// PutAttributeDefinition stores an attribute definition on the directory shard
+func (r *Repository) PutAttributeDefinition(ctx context.Context, def *models.AttributeDefinition) error {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return err
+	}
+	return r.directory().PutAttributeDefinition(ctx, def)
+}
+
+// DeleteAttributeDefinition removes an attribute definition from the directory shard
+func (r *Repository) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return err
+	}
+	return r.directory().DeleteAttributeDefinition(ctx, name)
+}
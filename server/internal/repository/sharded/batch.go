@@ -0,0 +1,85 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+)
+
+// CreateBatch claims the batch's emails in the directory and stores each shard's
+// share of the batch in one call. With upsert, a profile whose email is held
+// goes to the shard of the profile holding it, which updates that profile.
+func (r *Repository) CreateBatch(ctx context.Context, profiles []*models.Profile, upsert bool) ([]*repository.BatchOutcome, error) {
+	outcomes := make([]*repository.BatchOutcome, len(profiles))
+
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		// Positions in profiles of the profiles sent to each shard
+		positions := make([][]int, len(r.shards))
+		claimed := make(map[int]bool)
+		seen := make(map[string]bool, len(profiles))
+
+		for i, profile := range profiles {
+			if seen[profile.Email] {
+				outcomes[i] = &repository.BatchOutcome{Status: repository.BatchDuplicate}
+				continue
+			}
+			seen[profile.Email] = true
+
+			holder, err := r.claimEmail(ctx, profile.Email, profile.ID)
+			switch {
+			case err == nil:
+				claimed[i] = true
+			case !errors.Is(err, repository.ErrDuplicateEmail):
+				return err
+			default:
+				// Only a committed profile can be updated in place
+				held := false
+				if upsert {
+					if held, err = r.holdsEmail(ctx, holder, profile.Email); err != nil {
+						return err
+					}
+				}
+				if !held {
+					outcomes[i] = &repository.BatchOutcome{Status: repository.BatchDuplicate}
+					continue
+				}
+			}
+
+			shard := r.shardIndex(holder)
+			positions[shard] = append(positions[shard], i)
+		}
+
+		for shard, indexes := range positions {
+			if len(indexes) == 0 {
+				continue
+			}
+			share := make([]*models.Profile, len(indexes))
+			for j, i := range indexes {
+				share[j] = profiles[i]
+			}
+
+			shardCtx, err := r.txContext(ctx, shard)
+			if err != nil {
+				return err
+			}
+			shardOutcomes, err := r.shards[shard].CreateBatch(shardCtx, share, upsert)
+			if err != nil {
+				return err
+			}
+			for j, i := range indexes {
+				outcomes[i] = shardOutcomes[j]
+				// A profile the shard did not create has no use for its claim
+				if claimed[i] && shardOutcomes[j].Status != repository.BatchCreated {
+					r.releaseEmail(ctx, profiles[i].Email, profiles[i].ID)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return outcomes, nil
+}
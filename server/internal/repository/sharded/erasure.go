@@ -0,0 +1,39 @@
+package sharded
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// Erasure receipts outlive their profiles, which resharding would otherwise
+// have to track down, so they are all kept on the directory shard.
+
+// RecordErasure stores a pending receipt on the directory shard
+func (r *Repository) RecordErasure(ctx context.Context, receipt *models.ErasureReceipt) (*models.ErasureReceipt, error) {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return r.directory().RecordErasure(ctx, receipt)
+}
+
+// GetErasure retrieves a receipt from the directory shard
+func (r *Repository) GetErasure(ctx context.Context, profileID string) (*models.ErasureReceipt, error) {
+	return r.directory().GetErasure(r.shardContext(ctx, 0), profileID)
+}
+
+// CompleteErasure marks a receipt completed on the directory shard
+func (r *Repository) CompleteErasure(ctx context.Context, receipt *models.ErasureReceipt) error {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return err
+	}
+	return r.directory().CompleteErasure(ctx, receipt)
+}
+
+// ListPendingErasures lists pending receipts from the directory shard
+func (r *Repository) ListPendingErasures(ctx context.Context, before time.Time, limit int) ([]*models.ErasureReceipt, error) {
+	return r.directory().ListPendingErasures(r.shardContext(ctx, 0), before, limit)
+}
@@ -0,0 +1,64 @@
+package sharded
+
+import (
+	"context"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+)
+
+// A follow joins two profiles that may live on different shards, so the whole
+// graph is kept on the directory shard, where listings and mutual follows are
+// answered without crossing shards.
+
+// Follow records a follow on the directory shard
+func (r *Repository) Follow(ctx context.Context, follow *models.Follow) (bool, error) {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return false, err
+	}
+	return r.directory().Follow(ctx, follow)
+}
+
+// Unfollow removes a follow from the directory shard
+func (r *Repository) Unfollow(ctx context.Context, followerID, targetID string) (bool, error) {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return false, err
+	}
+	return r.directory().Unfollow(ctx, followerID, targetID)
+}
+
+// IsFollowing reports whether a profile follows another, from the directory shard
+func (r *Repository) IsFollowing(ctx context.Context, followerID, targetID string) (bool, error) {
+	return r.directory().IsFollowing(r.shardContext(ctx, 0), followerID, targetID)
+}
+
+// ListFollowers returns a page of the follows on a profile, from the directory shard
+func (r *Repository) ListFollowers(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return r.directory().ListFollowers(r.shardContext(ctx, 0), profileID, opts)
+}
+
+// ListFollowing returns a page of the follows a profile made, from the directory shard
+func (r *Repository) ListFollowing(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return r.directory().ListFollowing(r.shardContext(ctx, 0), profileID, opts)
+}
+
+// ListMutualFollows returns a page of a profile's mutual follows, from the directory shard
+func (r *Repository) ListMutualFollows(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return r.directory().ListMutualFollows(r.shardContext(ctx, 0), profileID, opts)
+}
+
+// CountFollows counts a profile's follows on the directory shard
+func (r *Repository) CountFollows(ctx context.Context, profileID string) (*models.FollowCounts, error) {
+	return r.directory().CountFollows(r.shardContext(ctx, 0), profileID)
+}
+
+// RemoveFollows removes every follow made by or on a profile from the directory shard
+func (r *Repository) RemoveFollows(ctx context.Context, profileID string) ([]*models.Follow, error) {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return r.directory().RemoveFollows(ctx, profileID)
+}
@@ -0,0 +1,36 @@
+package sharded
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+)
+
+// Idempotency keys belong to requests rather than profiles, so they are all
+// kept on the directory shard.
+
+// ReserveIdempotencyKey reserves a key on the directory shard
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	return r.directory().ReserveIdempotencyKey(ctx, record)
+}
+
+// CompleteIdempotencyKey stores the response of a key on the directory shard
+func (r *Repository) CompleteIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	return r.directory().CompleteIdempotencyKey(ctx, record)
+}
+
+// ReleaseIdempotencyKey removes an in-flight key from the directory shard
+func (r *Repository) ReleaseIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	return r.directory().ReleaseIdempotencyKey(ctx, record)
+}
+
+// DeleteExpiredIdempotencyKeys removes expired keys from the directory shard
+func (r *Repository) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	return r.directory().DeleteExpiredIdempotencyKeys(ctx, before)
+}
+
+// RedactIdempotencyResponses empties response bodies on the directory shard
+func (r *Repository) RedactIdempotencyResponses(ctx context.Context, text string) (int64, error) {
+	return r.directory().RedactIdempotencyResponses(ctx, text)
+}
@@ -0,0 +1,88 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+)
+
+// Iterate merges an iterator over every shard into one in listing order. Each
+// shard's iterator stays open, and one profile ahead, until the merge ends.
+func (r *Repository) Iterate(ctx context.Context, opts repository.ListOptions) (repository.ProfileIterator, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	if _, err := opts.DecodeCursor(); err != nil {
+		return nil, err
+	}
+
+	it := &mergeIterator{opts: opts}
+	for i, shard := range r.shards {
+		shardIt, err := shard.Iterate(r.shardContext(ctx, i), opts)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		it.shards = append(it.shards, shardIt)
+		it.heads = append(it.heads, nil)
+		it.advance(len(it.shards) - 1)
+	}
+	return it, nil
+}
+
+// mergeIterator merges iterators that each return profiles in listing order
+type mergeIterator struct {
+	opts   repository.ListOptions
+	shards []repository.ProfileIterator
+	// heads holds the next profile of each shard, nil once a shard is exhausted
+	heads   []*models.Profile
+	current *models.Profile
+	err     error
+}
+
+// advance moves shard i on to its next profile
+func (it *mergeIterator) advance(i int) {
+	if it.shards[i].Next() {
+		it.heads[i] = it.shards[i].Profile()
+		return
+	}
+	it.heads[i] = nil
+	if err := it.shards[i].Err(); err != nil && it.err == nil {
+		it.err = err
+	}
+}
+
+func (it *mergeIterator) Next() bool {
+	it.current = nil
+	if it.err != nil {
+		return false
+	}
+
+	next := -1
+	for i, head := range it.heads {
+		if head != nil && (next < 0 || listsBefore(it.opts, head, it.heads[next])) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return false
+	}
+
+	it.current = it.heads[next]
+	it.advance(next)
+	return true
+}
+
+func (it *mergeIterator) Profile() *models.Profile { return it.current }
+
+func (it *mergeIterator) Err() error { return it.err }
+
+func (it *mergeIterator) Close() error {
+	var errs []error
+	for _, shardIt := range it.shards {
+		errs = append(errs, shardIt.Close())
+	}
+	return errors.Join(errs...)
+}
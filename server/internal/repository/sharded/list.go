@@ -0,0 +1,180 @@
+package sharded
+
+import (
+	"context"
+	"sort"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+)
+
+// List scatters a listing to every shard and merges their pages. Each shard
+// resumes from the same cursor, so the merged page is the first opts.Limit
+// profiles after it across all shards, and there is a next page if the merge
+// overflows or any shard has one. Names compare bytewise, as the shards sort
+// them.
+func (r *Repository) List(ctx context.Context, opts repository.ListOptions) (*repository.ListResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	if _, err := opts.DecodeCursor(); err != nil {
+		return nil, err
+	}
+
+	var profiles []*models.Profile
+	more := false
+	for i, shard := range r.shards {
+		page, err := shard.List(r.shardContext(ctx, i), opts)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, page.Profiles...)
+		more = more || page.NextCursor != ""
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return listsBefore(opts, profiles[i], profiles[j])
+	})
+
+	result := &repository.ListResult{Profiles: profiles}
+	if len(profiles) > opts.Limit {
+		result.Profiles = profiles[:opts.Limit]
+		result.NextCursor = repository.NewCursor(opts, result.Profiles[opts.Limit-1])
+	} else if len(profiles) == 0 {
+		result.Profiles = []*models.Profile{}
+	} else if more {
+		// A shard filled its page, so profiles may follow the last one merged
+		result.NextCursor = repository.NewCursor(opts, profiles[len(profiles)-1])
+	}
+	return result, nil
+}
+
+// listsBefore reports whether a comes before b in a listing ordered by opts
+func listsBefore(opts repository.ListOptions, a, b *models.Profile) bool {
+	var cmp int
+	switch opts.SortBy {
+	case repository.SortByName:
+		cmp = compareStrings(a.Name, b.Name)
+	case repository.SortByUpdatedAt:
+		cmp = a.UpdatedAt.Compare(b.UpdatedAt)
+	default:
+		cmp = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if cmp == 0 {
+		cmp = compareStrings(a.ID, b.ID)
+	}
+	if opts.Ascending {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// compareStrings returns -1, 0 or 1 as a sorts before, with or after b
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// TagFacets counts tags on every shard and adds up the counts. Every shard
+// counts all of its tags, since a tag outside one shard's top counts may still
+// make the merged top.
+func (r *Repository) TagFacets(ctx context.Context, opts repository.ListOptions, limit int) ([]*models.TagCount, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int)
+	for i, shard := range r.shards {
+		counts, err := shard.TagFacets(r.shardContext(ctx, i), opts, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, count := range counts {
+			totals[count.Tag] += count.Count
+		}
+	}
+
+	counts := make([]*models.TagCount, 0, len(totals))
+	for tag, count := range totals {
+		counts = append(counts, &models.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+	if limit > 0 && len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts, nil
+}
+
+// Search scatters a search to every shard and merges their hits by rank. Search
+// pages resume from an offset, so each shard is read up to the end of the
+// requested page and deep pages cost more than shallow ones.
+func (r *Repository) Search(ctx context.Context, opts repository.SearchOptions) (*repository.SearchResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	offset, err := opts.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	// One hit past the page tells whether there is a next page
+	want := offset + opts.Limit + 1
+	var hits []*repository.SearchHit
+	for i, shard := range r.shards {
+		shardHits, err := searchShard(r.shardContext(ctx, i), shard, opts.Query, want)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, shardHits...)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].Profile.ID < hits[j].Profile.ID
+	})
+
+	result := &repository.SearchResult{Hits: []*repository.SearchHit{}}
+	if offset < len(hits) {
+		hits = hits[offset:]
+		if len(hits) > opts.Limit {
+			hits = hits[:opts.Limit]
+			result.NextCursor = repository.NewSearchCursor(opts, offset+opts.Limit)
+		}
+		result.Hits = hits
+	}
+	return result, nil
+}
+
+// searchShard returns up to want of a shard's best hits for query
+func searchShard(ctx context.Context, shard repository.Shard, query string, want int) ([]*repository.SearchHit, error) {
+	var hits []*repository.SearchHit
+	page := repository.SearchOptions{Query: query, Limit: repository.MaxListLimit}
+	for len(hits) < want {
+		result, err := shard.Search(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, result.Hits...)
+		if result.NextCursor == "" {
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+	if len(hits) > want {
+		hits = hits[:want]
+	}
+	return hits, nil
+}
@@ -0,0 +1,123 @@
+package sharded
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+)
+
+// Enqueue stores a message on the shard owning its aggregate, so that it
+// commits with the change it describes
+func (r *Repository) Enqueue(ctx context.Context, message *models.OutboxMessage) error {
+	i := r.shardIndex(message.AggregateID)
+	ctx, err := r.txContext(ctx, i)
+	if err != nil {
+		return err
+	}
+	return r.shards[i].Enqueue(ctx, message)
+}
+
+// ClaimPending leases up to limit due messages, starting from a different shard
+// on each call so that no shard's backlog starves the others
+func (r *Repository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	var messages []*models.OutboxMessage
+	start := int(r.nextOutbox.Add(1) % uint64(len(r.shards)))
+	for n := 0; n < len(r.shards) && len(messages) < limit; n++ {
+		i := (start + n) % len(r.shards)
+		claimed, err := r.shards[i].ClaimPending(ctx, limit-len(messages), lease)
+		if err != nil {
+			return messages, err
+		}
+		for _, message := range claimed {
+			r.claims.Store(message.ID, i)
+		}
+		messages = append(messages, claimed...)
+	}
+	return messages, nil
+}
+
+// claimedShard returns the shard a message was claimed from, forgetting the
+// claim. Messages not claimed through this repository are looked up by their
+// aggregate.
+func (r *Repository) claimedShard(message *models.OutboxMessage) repository.Shard {
+	if i, ok := r.claims.LoadAndDelete(message.ID); ok {
+		return r.shards[i.(int)]
+	}
+	return r.shardFor(message.AggregateID)
+}
+
+// MarkSent records that a message was delivered
+func (r *Repository) MarkSent(ctx context.Context, message *models.OutboxMessage) error {
+	return r.claimedShard(message).MarkSent(ctx, message)
+}
+
+// MarkFailed records a failed delivery and schedules the next attempt
+func (r *Repository) MarkFailed(ctx context.Context, message *models.OutboxMessage, cause error, retryAt time.Time) error {
+	return r.claimedShard(message).MarkFailed(ctx, message, cause, retryAt)
+}
+
+// DeleteSent removes delivered messages sent before the given time from every shard
+func (r *Repository) DeleteSent(ctx context.Context, before time.Time) (int64, error) {
+	var total int64
+	for _, shard := range r.shards {
+		deleted, err := shard.DeleteSent(ctx, before)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+	}
+	return total, nil
+}
+
+// ListForAggregate collects the messages of an aggregate from every shard, since
+// delivered messages stay where they were stored when profiles move
+func (r *Repository) ListForAggregate(ctx context.Context, aggregateID string) ([]*models.OutboxMessage, error) {
+	var messages []*models.OutboxMessage
+	for i, shard := range r.shards {
+		stored, err := shard.ListForAggregate(r.shardContext(ctx, i), aggregateID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, stored...)
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages, nil
+}
+
+// DeleteForAggregate removes the messages of an aggregate from every shard
+func (r *Repository) DeleteForAggregate(ctx context.Context, aggregateID string) (int64, error) {
+	var total int64
+	for i, shard := range r.shards {
+		shardCtx, err := r.txContext(ctx, i)
+		if err != nil {
+			return total, err
+		}
+		deleted, err := shard.DeleteForAggregate(shardCtx, aggregateID)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+	}
+	return total, nil
+}
+
+// Stats adds up the backlogs of every shard
+func (r *Repository) Stats(ctx context.Context) (*repository.OutboxStats, error) {
+	total := &repository.OutboxStats{}
+	for _, shard := range r.shards {
+		stats, err := shard.Stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		total.Pending += stats.Pending
+		if stats.OldestPendingAge > total.OldestPendingAge {
+			total.OldestPendingAge = stats.OldestPendingAge
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,521 @@
+// Package sharded partitions profiles across several databases by a consistent
+// hash of their ID.
+//
+// Every profile lives, with its revisions, on the shard that owns its ID.
+// Listings and searches are scattered to all shards and their results merged.
+// Email addresses must be unique across shards, so the first shard also keeps a
+// directory of the email each live profile holds.
+package sharded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/postgresql"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// defaultStaleClaimAge is how old an email claim must be before it may be taken
+// over from a profile that does not hold the email. Younger claims may belong to
+// a write whose profile has not been committed yet.
+const defaultStaleClaimAge = time.Minute
+
+// tokenSeparator joins the consistency tokens of the shards
+const tokenSeparator = ","
+
+// Repository implements the repository.Store, repository.Outbox and
+// repository.RevisionStore interfaces over several shards
+type Repository struct {
+	shards        []repository.Shard
+	ring          *ring
+	staleClaimAge time.Duration
+
+	// claims remembers which shard each claimed outbox message came from, as its
+	// aggregate may have moved since it was enqueued
+	claims     sync.Map
+	nextOutbox atomic.Uint64
+}
+
+// New creates a repository over the given shards. Shards are identified by
+// their position: new shards must be appended, never inserted or removed.
+func New(shards []repository.Shard) (*Repository, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("sharded repository needs at least one shard")
+	}
+	return &Repository{shards: shards, ring: newRing(len(shards)), staleClaimAge: defaultStaleClaimAge}, nil
+}
+
+// NewRepository connects to the PostgreSQL shards listed in the configuration
+func NewRepository(cfg *config.Config) (*Repository, error) {
+	shards := make([]repository.Shard, 0, len(cfg.Database.ShardURIs))
+	closeAll := func() {
+		for _, shard := range shards {
+			shard.Close(context.Background())
+		}
+	}
+
+	for i, uri := range cfg.Database.ShardURIs {
+		shardCfg := *cfg
+		shardCfg.Database.URI = uri
+		shardCfg.Database.ReplicaURIs = nil
+
+		shard, err := postgresql.NewRepository(&shardCfg)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("shard %d: %w", i, err)
+		}
+		shards = append(shards, shard)
+	}
+
+	repo, err := New(shards)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// CheckSealed returns postgresql.ErrPlaintextPII if a shard has PII stored in
+// plaintext while a keyring is configured
+func (r *Repository) CheckSealed(ctx context.Context) error {
+	for i, shard := range r.shards {
+		if pg, ok := shard.(*postgresql.Repository); ok {
+			if err := pg.CheckSealed(ctx); err != nil {
+				return fmt.Errorf("shard %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes every shard
+func (r *Repository) Close(ctx context.Context) error {
+	var errs []error
+	for _, shard := range r.shards {
+		errs = append(errs, shard.Close(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// shardIndex returns the index of the shard owning a profile or outbox aggregate
+func (r *Repository) shardIndex(id string) int {
+	return r.ring.owner(id)
+}
+
+// shardFor returns the shard owning a profile or outbox aggregate
+func (r *Repository) shardFor(id string) repository.Shard {
+	return r.shards[r.shardIndex(id)]
+}
+
+// directory returns the shard keeping the email directory
+func (r *Repository) directory() repository.Shard {
+	return r.shards[0]
+}
+
+// txScope holds the transactions a WithinTx call opened on shards, and
+// collects the email claims to release once they commit
+type txScope struct {
+	mu       sync.Mutex
+	txs      map[int]*shardTx
+	releases []emailRelease
+}
+
+// shardTx is a transaction open on one shard. The shard's WithinTx runs in a
+// goroutine of its own, keeping the transaction open until finish tells it to
+// commit, with nil, or roll back.
+type shardTx struct {
+	// ctx carries the transaction
+	ctx    context.Context
+	finish chan error
+	// done receives the result of the shard's WithinTx
+	done chan error
+}
+
+// emailRelease is a claim of a profile on an email that is no longer needed
+type emailRelease struct {
+	tenantID  string
+	email     string
+	profileID string
+}
+
+// txScopeKey identifies the transaction scope a context carries for a repository
+type txScopeKey struct {
+	repo *Repository
+}
+
+// errTxAborted rolls back the shard transactions of a WithinTx call whose fn
+// panicked
+var errTxAborted = errors.New("sharded transaction aborted")
+
+// WithinTx runs fn in a transaction. A shard's transaction is opened when fn
+// first uses the shard, so a write to a single profile involves its shard and,
+// if its email changes, the directory. The transactions commit one after the
+// other, the directory's first, and emails are released only after all have
+// committed. A failure part way therefore leaves at worst a stale email claim,
+// which claimEmail repairs.
+func (r *Repository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txScopeKey{repo: r}).(*txScope); ok {
+		return fn(ctx)
+	}
+
+	scope := &txScope{txs: make(map[int]*shardTx)}
+	ended := false
+	defer func() {
+		if !ended {
+			scope.end(errTxAborted)
+		}
+	}()
+	err := fn(context.WithValue(ctx, txScopeKey{repo: r}, scope))
+	ended = true
+	if err := scope.end(err); err != nil {
+		return err
+	}
+
+	for _, release := range scope.releases {
+		if err := r.directory().ReleaseEmail(tenant.WithID(ctx, release.tenantID), release.email, release.profileID); err != nil {
+			logger.Log.Warn("Failed to release email claim",
+				zap.String("profile_id", release.profileID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// txContext returns ctx joined to the transaction on shard i of the WithinTx
+// call it carries, opening that transaction on first use. Outside WithinTx it
+// returns ctx.
+func (r *Repository) txContext(ctx context.Context, i int) (context.Context, error) {
+	scope, ok := ctx.Value(txScopeKey{repo: r}).(*txScope)
+	if !ok {
+		return ctx, nil
+	}
+
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	tx, ok := scope.txs[i]
+	if !ok {
+		tx = &shardTx{finish: make(chan error), done: make(chan error, 1)}
+		opened := make(chan context.Context)
+		go func() {
+			tx.done <- r.shards[i].WithinTx(ctx, func(ctx context.Context) error {
+				opened <- ctx
+				return <-tx.finish
+			})
+		}()
+		select {
+		case tx.ctx = <-opened:
+		case err := <-tx.done:
+			return nil, err
+		}
+		scope.txs[i] = tx
+	}
+	return joinedContext{Context: ctx, tx: tx.ctx}, nil
+}
+
+// end commits the transactions of the scope if cause is nil, the directory's
+// first, and rolls them back otherwise. Once a commit fails, the remaining
+// transactions are rolled back. It returns cause or the first failure.
+func (s *txScope) end(cause error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shards := make([]int, 0, len(s.txs))
+	for i := range s.txs {
+		shards = append(shards, i)
+	}
+	sort.Ints(shards)
+
+	err := cause
+	for _, i := range shards {
+		tx := s.txs[i]
+		tx.finish <- err
+		if txErr := <-tx.done; err == nil {
+			err = txErr
+		}
+	}
+	return err
+}
+
+// joinedContext is a context that also carries the values of another, such as
+// the transaction a shard opened with it
+type joinedContext struct {
+	context.Context
+	tx context.Context
+}
+
+func (c joinedContext) Value(key any) any {
+	if value := c.Context.Value(key); value != nil {
+		return value
+	}
+	return c.tx.Value(key)
+}
+
+// releaseEmail releases the claim of a profile on email once the transaction
+// carried by ctx commits
+func (r *Repository) releaseEmail(ctx context.Context, email, profileID string) {
+	scope := ctx.Value(txScopeKey{repo: r}).(*txScope)
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	scope.releases = append(scope.releases, emailRelease{tenantID: tenant.FromContext(ctx), email: email, profileID: profileID})
+}
+
+// claimEmail claims email for a profile in the directory. It returns
+// ErrDuplicateEmail, along with the holder's ID, if another live profile holds
+// the email.
+func (r *Repository) claimEmail(ctx context.Context, email, profileID string) (string, error) {
+	ctx, err := r.txContext(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	for {
+		claim, err := r.directory().ClaimEmail(ctx, email, profileID)
+		if err != nil {
+			return "", err
+		}
+		if claim.ProfileID == profileID {
+			return profileID, nil
+		}
+
+		if time.Since(claim.ClaimedAt) < r.staleClaimAge {
+			return claim.ProfileID, repository.ErrDuplicateEmail
+		}
+		held, err := r.holdsEmail(ctx, claim.ProfileID, email)
+		if err != nil {
+			return "", err
+		}
+		if held {
+			return claim.ProfileID, repository.ErrDuplicateEmail
+		}
+
+		// The claim outlived a failed write, or its profile has since let go of
+		// the email without releasing it
+		logger.Log.Warn("Releasing stale email claim",
+			zap.String("profile_id", claim.ProfileID),
+		)
+		if err := r.directory().ReleaseEmail(ctx, email, claim.ProfileID); err != nil {
+			return "", err
+		}
+	}
+}
+
+// holdsEmail reports whether a live profile has the given email
+func (r *Repository) holdsEmail(ctx context.Context, profileID, email string) (bool, error) {
+	profile, err := r.Get(ctx, profileID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return profile.Email == email, nil
+}
+
+// changeEmail runs write, which changes the email of a profile from previous to
+// the one it leaves in profile, keeping the directory in step
+func (r *Repository) changeEmail(ctx context.Context, profile *models.Profile, previous string, write func(ctx context.Context) error) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		if profile.Email != "" && profile.Email != previous {
+			if _, err := r.claimEmail(ctx, profile.Email, profile.ID); err != nil {
+				return err
+			}
+		}
+		if err := write(ctx); err != nil {
+			return err
+		}
+		if profile.Email != previous {
+			r.releaseEmail(ctx, previous, profile.ID)
+		}
+		return nil
+	})
+}
+
+// Create stores a new profile on the shard owning its ID
+func (r *Repository) Create(ctx context.Context, profile *models.Profile) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := r.claimEmail(ctx, profile.Email, profile.ID); err != nil {
+			return err
+		}
+		i := r.shardIndex(profile.ID)
+		ctx, err := r.txContext(ctx, i)
+		if err != nil {
+			return err
+		}
+		return r.shards[i].Create(ctx, profile)
+	})
+}
+
+// Get retrieves a profile by ID
+func (r *Repository) Get(ctx context.Context, id string) (*models.Profile, error) {
+	i := r.shardIndex(id)
+	return r.shards[i].Get(r.shardContext(ctx, i), id)
+}
+
+// GetIncludingDeleted retrieves a profile from the shard owning it, whether or
+// not it is soft-deleted
+func (r *Repository) GetIncludingDeleted(ctx context.Context, id string) (*models.Profile, error) {
+	i := r.shardIndex(id)
+	return r.shards[i].GetIncludingDeleted(r.shardContext(ctx, i), id)
+}
+
+// Replace overwrites all editable fields of an existing profile
+func (r *Repository) Replace(ctx context.Context, id string, profile *models.Profile, expectedVersion int) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		i := r.shardIndex(id)
+		shardCtx, err := r.txContext(ctx, i)
+		if err != nil {
+			return err
+		}
+		current, err := r.shards[i].Get(shardCtx, id)
+		if err != nil {
+			return err
+		}
+
+		profile.ID = id
+		return r.changeEmail(ctx, profile, current.Email, func(ctx context.Context) error {
+			return r.shards[i].Replace(shardCtx, id, profile, expectedVersion)
+		})
+	})
+}
+
+// Delete soft-deletes a profile and frees its email
+func (r *Repository) Delete(ctx context.Context, id string, expectedVersion int) (*models.Profile, error) {
+	var deleted *models.Profile
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		i := r.shardIndex(id)
+		shardCtx, err := r.txContext(ctx, i)
+		if err != nil {
+			return err
+		}
+		if deleted, err = r.shards[i].Delete(shardCtx, id, expectedVersion); err != nil {
+			return err
+		}
+		r.releaseEmail(ctx, deleted.Email, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// Restore undoes the soft delete of a profile, reclaiming its email
+func (r *Repository) Restore(ctx context.Context, id string) (*models.Profile, error) {
+	var restored *models.Profile
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		i := r.shardIndex(id)
+		shardCtx, err := r.txContext(ctx, i)
+		if err != nil {
+			return err
+		}
+		if restored, err = r.shards[i].Restore(shardCtx, id); err != nil {
+			return err
+		}
+		_, err = r.claimEmail(ctx, restored.Email, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// Erase permanently removes a profile, releasing its email if it was live
+func (r *Repository) Erase(ctx context.Context, id string) (*models.Profile, error) {
+	var erased *models.Profile
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		i := r.shardIndex(id)
+		shardCtx, err := r.txContext(ctx, i)
+		if err != nil {
+			return err
+		}
+		if erased, err = r.shards[i].Erase(shardCtx, id); err != nil {
+			return err
+		}
+		// A soft-deleted profile released its email when it was deleted
+		if erased.DeletedAt == nil {
+			r.releaseEmail(ctx, erased.Email, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return erased, nil
+}
+
+// PurgeDeleted permanently removes up to limit profiles of any tenant
+// tombstoned before the given time, taking them from each shard in turn
+func (r *Repository) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*models.Profile, error) {
+	var profiles []*models.Profile
+	for i, shard := range r.shards {
+		if len(profiles) >= limit {
+			break
+		}
+		shardCtx, err := r.txContext(ctx, i)
+		if err != nil {
+			return profiles, err
+		}
+		purged, err := shard.PurgeDeleted(shardCtx, before, limit-len(profiles))
+		if err != nil {
+			return profiles, err
+		}
+		profiles = append(profiles, purged...)
+	}
+	return profiles, nil
+}
+
+// ConsistencyToken combines the consistency tokens of every shard
+func (r *Repository) ConsistencyToken(ctx context.Context) (string, error) {
+	tokens := make([]string, len(r.shards))
+	empty := true
+	for i, shard := range r.shards {
+		token, err := shard.ConsistencyToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		tokens[i] = token
+		empty = empty && token == ""
+	}
+	if empty {
+		return "", nil
+	}
+	return strings.Join(tokens, tokenSeparator), nil
+}
+
+// shardContext prepares ctx for a read from shard i. Within WithinTx, a read
+// from a shard the transaction already wrote to joins its transaction. The
+// consistency token carried by ctx is narrowed to the shard's part. A token
+// issued for a different number of shards is passed on whole, which a shard
+// cannot parse and answers from its primary. So is a token without a part for
+// the shard, which has no replicas to choose from.
+func (r *Repository) shardContext(ctx context.Context, i int) context.Context {
+	if scope, ok := ctx.Value(txScopeKey{repo: r}).(*txScope); ok {
+		scope.mu.Lock()
+		if tx, ok := scope.txs[i]; ok {
+			ctx = joinedContext{Context: ctx, tx: tx.ctx}
+		}
+		scope.mu.Unlock()
+	}
+
+	token := repository.ConsistencyTokenFrom(ctx)
+	if token == "" {
+		return ctx
+	}
+	tokens := strings.Split(token, tokenSeparator)
+	if len(tokens) != len(r.shards) {
+		return ctx
+	}
+	return repository.WithConsistencyToken(ctx, tokens[i])
+}
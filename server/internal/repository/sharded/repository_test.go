@@ -0,0 +1,310 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/sqlite"
+	"github.com/fernandobarroso/profile-service/internal/repository/storetest"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	os.Exit(m.Run())
+}
+
+// openShards opens count empty in-memory shards
+func openShards(t *testing.T, count int) []repository.Shard {
+	shards := make([]repository.Shard, count)
+	for i := range shards {
+		shard, err := sqlite.Open(":memory:")
+		require.NoError(t, err)
+		t.Cleanup(func() { shard.Close(context.Background()) })
+		shards[i] = shard
+	}
+	return shards
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repository.Backend {
+		repo, err := New(openShards(t, 3))
+		require.NoError(t, err)
+		return repo
+	})
+}
+
+func TestEmailUniqueAcrossShards(t *testing.T) {
+	ctx := context.Background()
+	repo, err := New(openShards(t, 4))
+	require.NoError(t, err)
+
+	// Enough profiles with the same email that some land on different shards
+	first := &models.Profile{ID: uuid.New().String(), Name: "First", Email: "shared@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, repo.Create(ctx, first))
+	for i := 0; i < 10; i++ {
+		profile := &models.Profile{ID: uuid.New().String(), Name: "Other", Email: "shared@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		assert.ErrorIs(t, repo.Create(ctx, profile), repository.ErrDuplicateEmail)
+	}
+
+	// Changing an email frees the old one
+	require.NoError(t, repo.Replace(ctx, first.ID, &models.Profile{Name: "First", Email: "moved@example.com"}, 0))
+	second := &models.Profile{ID: uuid.New().String(), Name: "Second", Email: "shared@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, repo.Create(ctx, second))
+}
+
+func TestListPagesThroughUnevenShards(t *testing.T) {
+	ctx := context.Background()
+	repo, err := New(openShards(t, 2))
+	require.NoError(t, err)
+
+	// Four profiles on the first shard and the newest on the second, so the
+	// second page holds only profiles of the first shard
+	base := time.Now().Add(-time.Hour)
+	var want []string
+	for len(want) < 5 {
+		id := uuid.New().String()
+		shard := 0
+		if len(want) == 4 {
+			shard = 1
+		}
+		if repo.shardIndex(id) != shard {
+			continue
+		}
+		createdAt := base.Add(time.Duration(len(want)) * time.Minute)
+		profile := &models.Profile{ID: id, Name: "User", Email: fmt.Sprintf("user%d@example.com", len(want)), CreatedAt: createdAt, UpdatedAt: createdAt}
+		require.NoError(t, repo.Create(ctx, profile))
+		want = append([]string{id}, want...)
+	}
+
+	var got []string
+	opts := repository.ListOptions{Limit: 2}
+	for {
+		page, err := repo.List(ctx, opts)
+		require.NoError(t, err)
+		for _, profile := range page.Profiles {
+			got = append(got, profile.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	assert.Equal(t, want, got)
+}
+
+// countingShard counts the transactions opened on a shard
+type countingShard struct {
+	repository.Shard
+	txs int
+}
+
+func (s *countingShard) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.txs++
+	return s.Shard.WithinTx(ctx, fn)
+}
+
+func TestWithinTxOpensOnlyShardsUsed(t *testing.T) {
+	ctx := context.Background()
+	shards := openShards(t, 4)
+	counting := make([]*countingShard, len(shards))
+	for i, shard := range shards {
+		counting[i] = &countingShard{Shard: shard}
+		shards[i] = counting[i]
+	}
+	repo, err := New(shards)
+	require.NoError(t, err)
+	txs := func() []int {
+		var counts []int
+		for _, shard := range counting {
+			counts = append(counts, shard.txs)
+			shard.txs = 0
+		}
+		return counts
+	}
+
+	// A profile on the last shard
+	profile := &models.Profile{ID: uuid.New().String(), Name: "Ada", Email: "ada@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	for repo.shardIndex(profile.ID) != 3 {
+		profile.ID = uuid.New().String()
+	}
+
+	// A write to the profile, with its event
+	write := func(fn func(ctx context.Context) error) error {
+		return repo.WithinTx(ctx, func(ctx context.Context) error {
+			if err := fn(ctx); err != nil {
+				return err
+			}
+			return repo.Enqueue(ctx, &models.OutboxMessage{ID: uuid.New().String(), AggregateID: profile.ID, Channel: "events", Payload: []byte(`{}`), CreatedAt: time.Now()})
+		})
+	}
+	// Creating it claims its email in the directory
+	require.NoError(t, write(func(ctx context.Context) error { return repo.Create(ctx, profile) }))
+	assert.Equal(t, []int{1, 0, 0, 1}, txs())
+
+	// Keeping the email leaves the directory alone
+	require.NoError(t, write(func(ctx context.Context) error {
+		return repo.Replace(ctx, profile.ID, &models.Profile{Name: "Ada Lovelace", Email: "ada@example.com"}, 0)
+	}))
+	assert.Equal(t, []int{0, 0, 0, 1}, txs())
+
+	require.NoError(t, write(func(ctx context.Context) error {
+		return repo.Replace(ctx, profile.ID, &models.Profile{Name: "Ada Lovelace", Email: "lovelace@example.com"}, 0)
+	}))
+	assert.Equal(t, []int{1, 0, 0, 1}, txs())
+
+	// Every shard rolls back together
+	err = write(func(ctx context.Context) error {
+		if err := repo.Replace(ctx, profile.ID, &models.Profile{Name: "Rolled back", Email: "rolled@example.com"}, 0); err != nil {
+			return err
+		}
+		return errors.New("fail")
+	})
+	require.Error(t, err)
+	got, err := repo.Get(ctx, profile.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "lovelace@example.com", got.Email)
+	claim, err := repo.directory().ClaimEmail(ctx, "rolled@example.com", "other")
+	require.NoError(t, err)
+	assert.Equal(t, "other", claim.ProfileID)
+}
+
+func TestStaleClaimIsRepaired(t *testing.T) {
+	ctx := context.Background()
+	repo, err := New(openShards(t, 3))
+	require.NoError(t, err)
+
+	// A claim left behind by a write that never committed
+	require.NoError(t, repo.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := repo.directory().ClaimEmail(ctx, "stale@example.com", uuid.New().String())
+		return err
+	}))
+
+	profile := &models.Profile{ID: uuid.New().String(), Name: "New", Email: "stale@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.ErrorIs(t, repo.Create(ctx, profile), repository.ErrDuplicateEmail)
+
+	// Once old enough, the claim is checked against its profile and taken over
+	repo.staleClaimAge = 0
+	require.NoError(t, repo.Create(ctx, profile))
+
+	// A claim whose profile holds the email is never taken over
+	other := &models.Profile{ID: uuid.New().String(), Name: "Other", Email: "stale@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.ErrorIs(t, repo.Create(ctx, other), repository.ErrDuplicateEmail)
+}
+
+func TestReshard(t *testing.T) {
+	ctx := context.Background()
+	shards := openShards(t, 3)
+	before, err := New(shards[:2])
+	require.NoError(t, err)
+
+	var profiles []*models.Profile
+	for i := 0; i < 60; i++ {
+		now := time.Now()
+		profile := &models.Profile{
+			ID:        uuid.New().String(),
+			Name:      fmt.Sprintf("User %d", i),
+			Email:     fmt.Sprintf("user%d@example.com", i),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		require.NoError(t, before.Create(ctx, profile))
+		require.NoError(t, before.AddRevision(ctx, &models.Revision{
+			ProfileID: profile.ID,
+			Revision:  1,
+			Operation: models.RevisionCreate,
+			Actor:     "tester",
+			Snapshot:  profile,
+			Changes:   []models.FieldChange{},
+			CreatedAt: now,
+		}))
+		profiles = append(profiles, profile)
+	}
+	_, err = before.Delete(ctx, profiles[0].ID, 0)
+	require.NoError(t, err)
+
+	// Other tenants are resharded too, each keeping its own emails
+	acme := tenant.WithID(ctx, "acme")
+	var tenantProfiles []*models.Profile
+	for i := 0; i < 20; i++ {
+		profile := &models.Profile{ID: uuid.New().String(), Name: "Acme", Email: fmt.Sprintf("user%d@example.com", i), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		require.NoError(t, before.Create(acme, profile))
+		tenantProfiles = append(tenantProfiles, profile)
+	}
+
+	after, err := New(shards)
+	require.NoError(t, err)
+	stats, err := after.Reshard(ctx)
+	require.NoError(t, err)
+	assert.Positive(t, stats.Moved)
+	assert.Less(t, stats.Moved, 55, "adding a third shard should move about a third of the profiles")
+	assert.Zero(t, stats.Conflicts)
+
+	for _, profile := range profiles {
+		owner := after.shardIndex(profile.ID)
+		for i, shard := range shards {
+			page, err := shard.ListRevisions(ctx, profile.ID, repository.HistoryOptions{})
+			require.NoError(t, err)
+			if i == owner {
+				assert.Len(t, page.Revisions, 1, "revisions of %s should be on shard %d", profile.ID, i)
+			} else {
+				assert.Empty(t, page.Revisions, "revisions of %s should have left shard %d", profile.ID, i)
+			}
+		}
+		if profile == profiles[0] {
+			continue
+		}
+		got, err := after.Get(ctx, profile.ID)
+		require.NoError(t, err)
+		assert.Equal(t, profile.Email, got.Email)
+	}
+
+	for _, profile := range tenantProfiles {
+		got, err := after.Get(acme, profile.ID)
+		require.NoError(t, err)
+		assert.Equal(t, profile.Email, got.Email)
+		_, err = after.Get(ctx, profile.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	}
+	duplicate := &models.Profile{ID: uuid.New().String(), Name: "Copy", Email: tenantProfiles[3].Email, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.ErrorIs(t, after.Create(acme, duplicate), repository.ErrDuplicateEmail)
+
+	restored, err := after.Restore(ctx, profiles[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, profiles[0].Email, restored.Email)
+
+	// Emails stay unique after the move
+	duplicate = &models.Profile{ID: uuid.New().String(), Name: "Copy", Email: profiles[5].Email, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.ErrorIs(t, after.Create(ctx, duplicate), repository.ErrDuplicateEmail)
+
+	// Nothing is left to move
+	stats, err = after.Reshard(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Moved)
+}
+
+func TestRingMovesKeysOnlyToNewShard(t *testing.T) {
+	three, four := newRing(3), newRing(4)
+
+	moved := 0
+	const keys = 10000
+	for i := 0; i < keys; i++ {
+		key := uuid.New().String()
+		before, after := three.owner(key), four.owner(key)
+		if before != after {
+			assert.Equal(t, 3, after, "keys may only move to the new shard")
+			moved++
+		}
+	}
+	assert.InDelta(t, keys/4, moved, keys/10)
+}
@@ -0,0 +1,184 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// ReshardStats summarizes a resharding run
+type ReshardStats struct {
+	// Moved counts the profiles moved to the shard owning them
+	Moved int
+	// Conflicts counts live profiles left in place because another live profile
+	// uses their email
+	Conflicts int
+}
+
+// Reshard moves every profile that is not on the shard owning its ID to that
+// shard, together with its revisions, then records the email of every live
+// profile in the directory. Every tenant is resharded in turn.
+//
+// Run it after appending shards, and when first sharding an existing database,
+// with writes paused: until it finishes, profiles that have not moved yet
+// cannot be found. Every step is idempotent, so an interrupted run can simply be
+// repeated. Outbox messages stay where they are and are relayed from there.
+func (r *Repository) Reshard(ctx context.Context) (*ReshardStats, error) {
+	stats := &ReshardStats{}
+
+	tenants, err := r.tenants(ctx)
+	if err != nil {
+		return stats, err
+	}
+	for _, tenantID := range tenants {
+		if err := r.reshardTenant(tenant.WithID(ctx, tenantID), stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// tenants returns every tenant having profiles on any shard
+func (r *Repository) tenants(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	var tenants []string
+	for _, shard := range r.shards {
+		ids, err := shard.ListTenants(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				tenants = append(tenants, id)
+			}
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// reshardTenant moves the profiles of the tenant carried by ctx and rebuilds
+// their email claims
+func (r *Repository) reshardTenant(ctx context.Context, stats *ReshardStats) error {
+	for from, shard := range r.shards {
+		moved := stats.Moved
+		err := r.eachProfile(ctx, shard, func(profile *models.Profile) error {
+			return r.moveProfile(ctx, from, profile, stats)
+		})
+		if err != nil {
+			return err
+		}
+		logger.Log.Info("Shard rebalanced",
+			zap.String("tenant_id", tenant.FromContext(ctx)),
+			zap.Int("shard", from),
+			zap.Int("moved", stats.Moved-moved),
+		)
+	}
+
+	// Claims are checked against the shard owning each profile, so the directory
+	// is rebuilt once every profile is in place
+	for _, shard := range r.shards {
+		err := r.eachProfile(ctx, shard, func(profile *models.Profile) error {
+			if profile.DeletedAt != nil {
+				return nil
+			}
+			_, err := r.claimEmail(ctx, profile.Email, profile.ID)
+			if errors.Is(err, repository.ErrDuplicateEmail) {
+				stats.Conflicts++
+				logger.Log.Warn("Email held by another profile on a different shard",
+					zap.String("profile_id", profile.ID),
+				)
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachProfile calls fn for every profile of the context's tenant stored on a
+// shard, live and deleted.
+// Listing pages resume after the last profile seen, so fn may remove profiles.
+func (r *Repository) eachProfile(ctx context.Context, shard repository.Shard, fn func(profile *models.Profile) error) error {
+	for _, deleted := range []bool{false, true} {
+		opts := repository.ListOptions{Limit: repository.MaxListLimit, Ascending: true, Deleted: deleted}
+		for {
+			page, err := shard.List(ctx, opts)
+			if err != nil {
+				return err
+			}
+			for _, profile := range page.Profiles {
+				if err := fn(profile); err != nil {
+					return err
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+	return nil
+}
+
+// moveProfile moves a profile stored on shard from to the shard owning it, if
+// that is a different one
+func (r *Repository) moveProfile(ctx context.Context, from int, profile *models.Profile, stats *ReshardStats) error {
+	to := r.shardIndex(profile.ID)
+	if to == from {
+		return nil
+	}
+
+	revisions, err := allRevisions(ctx, r.shards[from], profile.ID)
+	if err != nil {
+		return err
+	}
+
+	// The copy is written before the original is removed, so an interruption
+	// leaves the profile on both shards and the next run finishes the move
+	err = r.shards[to].ImportProfile(ctx, profile, revisions)
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		stats.Conflicts++
+		logger.Log.Warn("Profile not moved, its email is in use on the target shard",
+			zap.String("profile_id", profile.ID),
+			zap.Int("shard", to),
+		)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.shards[from].RemoveProfile(ctx, profile.ID); err != nil {
+		return err
+	}
+
+	stats.Moved++
+	return nil
+}
+
+// allRevisions returns every revision of a profile stored on a shard
+func allRevisions(ctx context.Context, shard repository.Shard, profileID string) ([]*models.Revision, error) {
+	var revisions []*models.Revision
+	opts := repository.HistoryOptions{Limit: repository.MaxListLimit}
+	for {
+		page, err := shard.ListRevisions(ctx, profileID, opts)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, page.Revisions...)
+		if page.NextBefore == 0 {
+			return revisions, nil
+		}
+		opts.Before = page.NextBefore
+	}
+}
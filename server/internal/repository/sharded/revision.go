@@ -0,0 +1,63 @@
+package sharded
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+)
+
+// AddRevision records a change on the shard owning the profile
+func (r *Repository) AddRevision(ctx context.Context, revision *models.Revision) error {
+	i := r.shardIndex(revision.ProfileID)
+	ctx, err := r.txContext(ctx, i)
+	if err != nil {
+		return err
+	}
+	return r.shards[i].AddRevision(ctx, revision)
+}
+
+// AddRevisions records several changes, one call per shard involved
+func (r *Repository) AddRevisions(ctx context.Context, revisions []*models.Revision) error {
+	byShard := make([][]*models.Revision, len(r.shards))
+	for _, revision := range revisions {
+		i := r.shardIndex(revision.ProfileID)
+		byShard[i] = append(byShard[i], revision)
+	}
+
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		for i, share := range byShard {
+			if len(share) == 0 {
+				continue
+			}
+			shardCtx, err := r.txContext(ctx, i)
+			if err != nil {
+				return err
+			}
+			if err := r.shards[i].AddRevisions(shardCtx, share); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRevision retrieves a single revision of a profile
+func (r *Repository) GetRevision(ctx context.Context, profileID string, revision int) (*models.Revision, error) {
+	i := r.shardIndex(profileID)
+	return r.shards[i].GetRevision(r.shardContext(ctx, i), profileID, revision)
+}
+
+// GetRevisionAt retrieves the latest revision of a profile recorded at or
+// before the given time
+func (r *Repository) GetRevisionAt(ctx context.Context, profileID string, at time.Time) (*models.Revision, error) {
+	i := r.shardIndex(profileID)
+	return r.shards[i].GetRevisionAt(r.shardContext(ctx, i), profileID, at)
+}
+
+// ListRevisions returns a page of a profile's revisions, newest first
+func (r *Repository) ListRevisions(ctx context.Context, profileID string, opts repository.HistoryOptions) (*repository.HistoryResult, error) {
+	i := r.shardIndex(profileID)
+	return r.shards[i].ListRevisions(r.shardContext(ctx, i), profileID, opts)
+}
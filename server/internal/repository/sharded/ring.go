@@ -0,0 +1,69 @@
+package sharded
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// virtualNodes is the number of points each shard places on the ring. More
+// points spread keys more evenly at the cost of a larger ring.
+const virtualNodes = 128
+
+// ring is a consistent-hash ring. Each key belongs to the shard owning the first
+// point at or after the key's hash, so adding a shard only moves the keys that
+// fall just before its points.
+type ring struct {
+	points []uint64
+	owners []int
+}
+
+// newRing places the points of count shards. A shard's points depend only on
+// its position, so appending shards leaves existing points where they were.
+func newRing(count int) *ring {
+	r := &ring{}
+	type point struct {
+		hash  uint64
+		owner int
+	}
+	points := make([]point, 0, count*virtualNodes)
+	for shard := 0; shard < count; shard++ {
+		for i := 0; i < virtualNodes; i++ {
+			points = append(points, point{hash: hashKey("shard-" + strconv.Itoa(shard) + "#" + strconv.Itoa(i)), owner: shard})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	r.points = make([]uint64, len(points))
+	r.owners = make([]int, len(points))
+	for i, p := range points {
+		r.points[i] = p.hash
+		r.owners[i] = p.owner
+	}
+	return r
+}
+
+// owner returns the index of the shard that owns key
+func (r *ring) owner(key string) int {
+	hash := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[i]
+}
+
+// hashKey hashes a key onto the ring. FNV-1a is stable across processes and
+// releases; the finalizer spreads keys that differ only slightly, such as
+// sequential names, across the whole ring.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// attributeColumns lists the columns read by scanAttributeDefinition, in scan order
+const attributeColumns = `name, type, required, enum, max_length, created_at, updated_at`
+
+// ListAttributeDefinitions returns every attribute definition of the tenant, by name
+func (r *Repository) ListAttributeDefinitions(ctx context.Context) ([]*models.AttributeDefinition, error) {
+	query := `
+		SELECT ` + attributeColumns + `
+		FROM attribute_definitions
+		WHERE tenant_id = ?
+		ORDER BY name
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		logger.Log.Error("Failed to list attribute definitions",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	defs := []*models.AttributeDefinition{}
+	for rows.Next() {
+		def, err := scanAttributeDefinition(rows)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// PutAttributeDefinition creates or replaces an attribute definition of the tenant
+func (r *Repository) PutAttributeDefinition(ctx context.Context, def *models.AttributeDefinition) error {
+	query := `
+		INSERT INTO attribute_definitions (tenant_id, ` + attributeColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, name) DO UPDATE SET
+			type = excluded.type,
+			required = excluded.required,
+			enum = excluded.enum,
+			max_length = excluded.max_length,
+			updated_at = excluded.updated_at
+		RETURNING ` + attributeColumns
+
+	enum := def.Enum
+	if enum == nil {
+		enum = []string{}
+	}
+	enumJSON, err := json.Marshal(enum)
+	if err != nil {
+		return err
+	}
+
+	now := formatTime(time.Now())
+	stored, err := scanAttributeDefinition(r.conn(ctx).QueryRowContext(ctx, query,
+		tenant.FromContext(ctx),
+		def.Name,
+		def.Type,
+		def.Required,
+		string(enumJSON),
+		def.MaxLength,
+		now,
+		now,
+	))
+	if err != nil {
+		logger.Log.Error("Failed to store attribute definition",
+			zap.String("name", def.Name),
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+
+	*def = *stored
+	return nil
+}
+
+// DeleteAttributeDefinition removes an attribute definition of the tenant
+func (r *Repository) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		DELETE FROM attribute_definitions WHERE tenant_id = ? AND name = ?
+	`, tenant.FromContext(ctx), name)
+	if err != nil {
+		logger.Log.Error("Failed to delete attribute definition",
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		return repository.ErrAttributeNotFound
+	}
+	return nil
+}
+
+// scanAttributeDefinition reads a definition selected with attributeColumns
+func scanAttributeDefinition(row rowScanner) (*models.AttributeDefinition, error) {
+	var enumJSON, createdAt, updatedAt string
+	def := &models.AttributeDefinition{}
+	if err := row.Scan(
+		&def.Name,
+		&def.Type,
+		&def.Required,
+		&enumJSON,
+		&def.MaxLength,
+		&createdAt,
+		&updatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(enumJSON), &def.Enum); err != nil {
+		return nil, err
+	}
+	if len(def.Enum) == 0 {
+		def.Enum = nil
+	}
+
+	var err error
+	if def.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if def.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// CreateBatch stores new profiles in a single transaction. SQLite has no bulk
+// load path, but one transaction avoids a disk sync per profile.
+func (r *Repository) CreateBatch(ctx context.Context, profiles []*models.Profile, upsert bool) ([]*repository.BatchOutcome, error) {
+	start := time.Now()
+
+	onConflict := `DO NOTHING`
+	if upsert {
+		onConflict = `DO UPDATE SET
+			name = excluded.name,
+			bio = excluded.bio,
+			image_urls = excluded.image_urls,
+			attributes = excluded.attributes,
+			tags = excluded.tags,
+			updated_at = excluded.updated_at,
+			version = profiles.version + 1`
+	}
+	query := `
+		INSERT INTO profiles (id, name, email, bio, image_urls, version, created_at, updated_at, tenant_id, attributes, tags)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, email) WHERE deleted_at IS NULL ` + onConflict + `
+		RETURNING ` + profileColumns
+	tenantID := tenant.FromContext(ctx)
+
+	outcomes := make([]*repository.BatchOutcome, len(profiles))
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		seen := make(map[string]bool, len(profiles))
+		for i, profile := range profiles {
+			if seen[profile.Email] {
+				outcomes[i] = &repository.BatchOutcome{Status: repository.BatchDuplicate}
+				continue
+			}
+			seen[profile.Email] = true
+
+			var previous *models.Profile
+			if upsert {
+				var err error
+				previous, err = scanProfile(r.conn(ctx).QueryRowContext(ctx,
+					`SELECT `+profileColumns+` FROM profiles WHERE tenant_id = ? AND email = ? AND deleted_at IS NULL`,
+					tenantID,
+					profile.Email,
+				))
+				if err != nil && err != sql.ErrNoRows {
+					return err
+				}
+			}
+
+			imageURLs, err := imageURLsJSON(profile.ImageURLs)
+			if err != nil {
+				return err
+			}
+			attributes, err := attributesJSON(profile.Attributes)
+			if err != nil {
+				return err
+			}
+			tags, err := tagsJSON(profile.Tags)
+			if err != nil {
+				return err
+			}
+			stored, err := scanProfile(r.conn(ctx).QueryRowContext(ctx, query,
+				profile.ID,
+				profile.Name,
+				profile.Email,
+				profile.Bio,
+				imageURLs,
+				formatTime(profile.CreatedAt),
+				formatTime(profile.UpdatedAt),
+				tenantID,
+				attributes,
+				tags,
+			))
+			switch {
+			case err == sql.ErrNoRows:
+				// DO NOTHING skipped a profile whose email is in use
+				outcomes[i] = &repository.BatchOutcome{Status: repository.BatchDuplicate}
+			case err != nil:
+				return err
+			case previous != nil:
+				outcomes[i] = &repository.BatchOutcome{Status: repository.BatchUpdated, Profile: stored, Previous: previous}
+			default:
+				outcomes[i] = &repository.BatchOutcome{Status: repository.BatchCreated, Profile: stored}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("create_batch", "error").Inc()
+		logger.Log.Error("Failed to create profile batch",
+			zap.Int("size", len(profiles)),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("create_batch", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("create_batch").Observe(time.Since(start).Seconds())
+	return outcomes, nil
+}
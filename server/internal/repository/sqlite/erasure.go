@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// erasureColumns lists the columns scanned by scanErasure, in order
+const erasureColumns = `tenant_id, profile_id, id, status, requested_at, completed_at, images_deleted, follows_deleted, events_deleted`
+
+// RecordErasure stores a pending receipt, unless the profile already has one,
+// which is returned instead
+func (r *Repository) RecordErasure(ctx context.Context, receipt *models.ErasureReceipt) (*models.ErasureReceipt, error) {
+	tenantID := tenant.FromContext(ctx)
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		INSERT INTO profile_erasures (tenant_id, profile_id, id, status, requested_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, profile_id) DO NOTHING
+	`, tenantID, receipt.ProfileID, receipt.ID, receipt.Status, formatTime(receipt.RequestedAt))
+	if err != nil {
+		logger.Log.Error("Failed to record erasure",
+			zap.String("profile_id", receipt.ProfileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	recorded, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if recorded > 0 {
+		receipt.TenantID = tenantID
+		return nil, nil
+	}
+	return r.GetErasure(ctx, receipt.ProfileID)
+}
+
+// GetErasure retrieves the erasure receipt of a profile
+func (r *Repository) GetErasure(ctx context.Context, profileID string) (*models.ErasureReceipt, error) {
+	receipt, err := scanErasure(r.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+erasureColumns+`
+		FROM profile_erasures
+		WHERE tenant_id = ? AND profile_id = ?
+	`, tenant.FromContext(ctx), profileID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrErasureNotFound
+	}
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return receipt, nil
+}
+
+// CompleteErasure marks a pending receipt completed
+func (r *Repository) CompleteErasure(ctx context.Context, receipt *models.ErasureReceipt) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `
+		UPDATE profile_erasures
+		SET status = ?, completed_at = ?, images_deleted = ?, follows_deleted = ?, events_deleted = ?
+		WHERE tenant_id = ? AND profile_id = ? AND status = ?
+	`, models.ErasureCompleted, nullTime(receipt.CompletedAt), receipt.ImagesDeleted, receipt.FollowsDeleted, receipt.EventsDeleted,
+		tenant.FromContext(ctx), receipt.ProfileID, models.ErasurePending)
+	if err != nil {
+		logger.Log.Error("Failed to complete erasure",
+			zap.String("profile_id", receipt.ProfileID),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// ListPendingErasures returns up to limit pending receipts of any tenant
+// requested before the given time, oldest first
+func (r *Repository) ListPendingErasures(ctx context.Context, before time.Time, limit int) ([]*models.ErasureReceipt, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		SELECT `+erasureColumns+`
+		FROM profile_erasures
+		WHERE status = ? AND requested_at < ?
+		ORDER BY requested_at
+		LIMIT ?
+	`, models.ErasurePending, formatTime(before), limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var receipts []*models.ErasureReceipt
+	for rows.Next() {
+		receipt, err := scanErasure(rows)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, rows.Err()
+}
+
+// scanErasure reads a receipt selected with erasureColumns
+func scanErasure(row rowScanner) (*models.ErasureReceipt, error) {
+	receipt := &models.ErasureReceipt{}
+	var requestedAt string
+	var completedAt sql.NullString
+	if err := row.Scan(
+		&receipt.TenantID,
+		&receipt.ProfileID,
+		&receipt.ID,
+		&receipt.Status,
+		&requestedAt,
+		&completedAt,
+		&receipt.ImagesDeleted,
+		&receipt.FollowsDeleted,
+		&receipt.EventsDeleted,
+	); err != nil {
+		return nil, err
+	}
+	var err error
+	if receipt.RequestedAt, err = parseTime(requestedAt); err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		completed, err := parseTime(completedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		receipt.CompletedAt = &completed
+	}
+	return receipt, nil
+}
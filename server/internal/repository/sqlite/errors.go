@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// mapError translates SQLite errors into the repository's domain errors,
+// keeping the original error in the chain for logging
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	code := sqliteErr.Code()
+	switch code {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		if strings.Contains(sqliteErr.Error(), ".email") {
+			return fmt.Errorf("%w: %v", repository.ErrDuplicateEmail, err)
+		}
+		return fmt.Errorf("%w: %v", repository.ErrConflict, err)
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return &repository.ValidationError{Field: constraintColumn(sqliteErr.Error()), Message: sqliteErr.Error()}
+	}
+
+	// The low byte of an extended result code is its primary code
+	switch code & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return fmt.Errorf("%w: %v", repository.ErrUnavailable, err)
+	}
+	return err
+}
+
+// constraintColumnPattern matches the table and column named by a constraint
+// failure such as "NOT NULL constraint failed: profiles.name (1299)"
+var constraintColumnPattern = regexp.MustCompile(`constraint failed: \w+\.(\w+)`)
+
+// constraintColumn extracts the column from a constraint failure message, if
+// there is one
+func constraintColumn(message string) string {
+	if match := constraintColumnPattern.FindStringSubmatch(message); match != nil {
+		return match[1]
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// followColumns lists the columns read by scanFollow, in scan order
+const followColumns = `follower_id, target_id, created_at`
+
+// Follow records that a profile follows another
+func (r *Repository) Follow(ctx context.Context, follow *models.Follow) (bool, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		INSERT INTO profile_follows (tenant_id, `+followColumns+`)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, tenant.FromContext(ctx), follow.FollowerID, follow.TargetID, formatTime(follow.CreatedAt))
+	if err != nil {
+		logger.Log.Error("Failed to store follow",
+			zap.String("follower_id", follow.FollowerID),
+			zap.String("target_id", follow.TargetID),
+			zap.Error(err),
+		)
+		return false, mapError(err)
+	}
+	if created, err := result.RowsAffected(); err != nil || created > 0 {
+		return created > 0, err
+	}
+
+	var createdAt string
+	err = r.conn(ctx).QueryRowContext(ctx, `
+		SELECT created_at FROM profile_follows WHERE tenant_id = ? AND follower_id = ? AND target_id = ?
+	`, tenant.FromContext(ctx), follow.FollowerID, follow.TargetID).Scan(&createdAt)
+	if err != nil {
+		return false, mapError(err)
+	}
+	follow.CreatedAt, err = parseTime(createdAt)
+	return false, err
+}
+
+// Unfollow removes a follow
+func (r *Repository) Unfollow(ctx context.Context, followerID, targetID string) (bool, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, `
+		DELETE FROM profile_follows WHERE tenant_id = ? AND follower_id = ? AND target_id = ?
+	`, tenant.FromContext(ctx), followerID, targetID)
+	if err != nil {
+		logger.Log.Error("Failed to remove follow",
+			zap.String("follower_id", followerID),
+			zap.String("target_id", targetID),
+			zap.Error(err),
+		)
+		return false, mapError(err)
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// IsFollowing reports whether a profile follows another
+func (r *Repository) IsFollowing(ctx context.Context, followerID, targetID string) (bool, error) {
+	var following bool
+	err := r.conn(ctx).QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM profile_follows WHERE tenant_id = ? AND follower_id = ? AND target_id = ?)
+	`, tenant.FromContext(ctx), followerID, targetID).Scan(&following)
+	if err != nil {
+		return false, mapError(err)
+	}
+	return following, nil
+}
+
+// ListFollowers returns a page of the follows on a profile, most recent first
+func (r *Repository) ListFollowers(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return r.listFollows(ctx, profileID, opts, "profile_follows f", false)
+}
+
+// ListFollowing returns a page of the follows a profile made, most recent first
+func (r *Repository) ListFollowing(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	return r.listFollows(ctx, profileID, opts, "profile_follows f", true)
+}
+
+// ListMutualFollows returns a page of the follows a profile made on profiles
+// following it back, most recent first
+func (r *Repository) ListMutualFollows(ctx context.Context, profileID string, opts repository.FollowListOptions) (*repository.FollowListResult, error) {
+	from := `profile_follows f
+		JOIN profile_follows back ON back.tenant_id = f.tenant_id AND back.follower_id = f.target_id AND back.target_id = f.follower_id`
+	return r.listFollows(ctx, profileID, opts, from, true)
+}
+
+// listFollows returns a page of the follows selected from the table expression
+// from, aliased f: with following, those made by profileID, otherwise those on
+// it. Pages are ordered by time and then by the profile on the far side.
+func (r *Repository) listFollows(ctx context.Context, profileID string, opts repository.FollowListOptions, from string, following bool) (*repository.FollowListResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	cursor, err := opts.DecodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	match, other := "f.target_id", "f.follower_id"
+	if following {
+		match, other = other, match
+	}
+
+	query := fmt.Sprintf(`
+		SELECT f.follower_id, f.target_id, f.created_at
+		FROM %s
+		WHERE f.tenant_id = ? AND %s = ?
+	`, from, match)
+	args := []interface{}{tenant.FromContext(ctx), profileID}
+	if cursor != nil {
+		query += fmt.Sprintf(" AND (f.created_at, %s) < (?, ?)", other)
+		args = append(args, formatTime(cursor.CreatedAt), cursor.ProfileID)
+	}
+	query += fmt.Sprintf(" ORDER BY f.created_at DESC, %s DESC LIMIT ?", other)
+	args = append(args, opts.Limit+1)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Log.Error("Failed to list follows",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	result := &repository.FollowListResult{Follows: []*models.Follow{}}
+	for rows.Next() {
+		follow, err := scanFollow(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Follows = append(result.Follows, follow)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Follows) > opts.Limit {
+		result.Follows = result.Follows[:opts.Limit]
+		last := result.Follows[opts.Limit-1]
+		otherID := last.FollowerID
+		if following {
+			otherID = last.TargetID
+		}
+		result.NextCursor = repository.NewFollowCursor(last.CreatedAt, otherID)
+	}
+	return result, nil
+}
+
+// CountFollows returns how many profiles follow a profile and how many it follows
+func (r *Repository) CountFollows(ctx context.Context, profileID string) (*models.FollowCounts, error) {
+	tenantID := tenant.FromContext(ctx)
+	counts := &models.FollowCounts{}
+	err := r.conn(ctx).QueryRowContext(ctx, `
+		SELECT
+			(SELECT count(*) FROM profile_follows WHERE tenant_id = ? AND target_id = ?),
+			(SELECT count(*) FROM profile_follows WHERE tenant_id = ? AND follower_id = ?)
+	`, tenantID, profileID, tenantID, profileID).Scan(&counts.Followers, &counts.Following)
+	if err != nil {
+		logger.Log.Error("Failed to count follows",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	return counts, nil
+}
+
+// RemoveFollows removes every follow made by or on a profile and returns them
+func (r *Repository) RemoveFollows(ctx context.Context, profileID string) ([]*models.Follow, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		DELETE FROM profile_follows
+		WHERE tenant_id = ? AND (follower_id = ? OR target_id = ?)
+		RETURNING `+followColumns,
+		tenant.FromContext(ctx), profileID, profileID)
+	if err != nil {
+		logger.Log.Error("Failed to remove follows",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	removed := []*models.Follow{}
+	for rows.Next() {
+		follow, err := scanFollow(rows)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, follow)
+	}
+	return removed, rows.Err()
+}
+
+// scanFollow reads a follow selected with followColumns
+func scanFollow(row rowScanner) (*models.Follow, error) {
+	var createdAt string
+	follow := &models.Follow{}
+	if err := row.Scan(&follow.FollowerID, &follow.TargetID, &createdAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if follow.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	return follow, nil
+}
@@ -0,0 +1,190 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// Enqueue stores a message in the outbox
+func (r *Repository) Enqueue(ctx context.Context, message *models.OutboxMessage) error {
+	query := `
+		INSERT INTO outbox (id, aggregate_id, channel, payload, created_at, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	createdAt := formatTime(message.CreatedAt)
+	_, err := r.conn(ctx).ExecContext(ctx, query,
+		message.ID,
+		message.AggregateID,
+		message.Channel,
+		string(message.Payload),
+		createdAt,
+		createdAt,
+	)
+	if err != nil {
+		logger.Log.Error("Failed to enqueue outbox message",
+			zap.String("id", message.ID),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// ClaimPending leases up to limit messages that are due for delivery
+func (r *Repository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	// Writes are serialized, so pushing next_attempt_at past the lease is
+	// enough to hide the claimed messages from other relays
+	query := `
+		UPDATE outbox
+		SET next_attempt_at = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND next_attempt_at <= ?
+			ORDER BY created_at
+			LIMIT ?
+		)
+		RETURNING id, aggregate_id, channel, payload, attempts, created_at
+	`
+
+	now := time.Now()
+	rows, err := r.conn(ctx).QueryContext(ctx, query, formatTime(now.Add(lease)), formatTime(now), limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var payload, createdAt string
+		message := &models.OutboxMessage{}
+		if err := rows.Scan(
+			&message.ID,
+			&message.AggregateID,
+			&message.Channel,
+			&payload,
+			&message.Attempts,
+			&createdAt,
+		); err != nil {
+			return nil, err
+		}
+		message.Payload = []byte(payload)
+		if message.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not preserve the subquery order
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages, nil
+}
+
+// MarkSent records that a message was delivered
+func (r *Repository) MarkSent(ctx context.Context, message *models.OutboxMessage) error {
+	_, err := r.conn(ctx).ExecContext(ctx,
+		`UPDATE outbox SET sent_at = ?, last_error = NULL WHERE id = ?`,
+		formatTime(time.Now()), message.ID,
+	)
+	return mapError(err)
+}
+
+// MarkFailed records a failed delivery and schedules the next attempt
+func (r *Repository) MarkFailed(ctx context.Context, message *models.OutboxMessage, cause error, retryAt time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx,
+		`UPDATE outbox SET next_attempt_at = ?, last_error = ? WHERE id = ? AND sent_at IS NULL`,
+		formatTime(retryAt), cause.Error(), message.ID,
+	)
+	return mapError(err)
+}
+
+// DeleteSent removes delivered messages sent before the given time
+func (r *Repository) DeleteSent(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx,
+		`DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < ?`,
+		formatTime(before),
+	)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return result.RowsAffected()
+}
+
+// ListForAggregate returns every stored message of an aggregate, oldest first
+func (r *Repository) ListForAggregate(ctx context.Context, aggregateID string) ([]*models.OutboxMessage, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		SELECT id, aggregate_id, channel, payload, attempts, created_at
+		FROM outbox
+		WHERE aggregate_id = ?
+		ORDER BY created_at, id
+	`, aggregateID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var payload, createdAt string
+		message := &models.OutboxMessage{}
+		if err := rows.Scan(
+			&message.ID,
+			&message.AggregateID,
+			&message.Channel,
+			&payload,
+			&message.Attempts,
+			&createdAt,
+		); err != nil {
+			return nil, err
+		}
+		message.Payload = []byte(payload)
+		if message.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// DeleteForAggregate removes every message of an aggregate
+func (r *Repository) DeleteForAggregate(ctx context.Context, aggregateID string) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx,
+		`DELETE FROM outbox WHERE aggregate_id = ?`,
+		aggregateID,
+	)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return result.RowsAffected()
+}
+
+// Stats reports the number and age of undelivered messages
+func (r *Repository) Stats(ctx context.Context) (*repository.OutboxStats, error) {
+	stats := &repository.OutboxStats{}
+	var oldest sql.NullString
+	if err := r.conn(ctx).QueryRowContext(ctx,
+		`SELECT count(*), min(created_at) FROM outbox WHERE sent_at IS NULL`,
+	).Scan(&stats.Pending, &oldest); err != nil {
+		return nil, mapError(err)
+	}
+
+	if oldest.Valid {
+		createdAt, err := parseTime(oldest.String)
+		if err != nil {
+			return nil, err
+		}
+		stats.OldestPendingAge = time.Since(createdAt)
+	}
+	return stats, nil
+}
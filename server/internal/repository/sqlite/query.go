@@ -0,0 +1,276 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+)
+
+// profileColumns lists the columns read by scanProfile, in scan order
+const profileColumns = `id, name, email, bio, image_urls, version, created_at, updated_at, deleted_at, tenant_id, attributes, tags`
+
+// timeLayout stores timestamps as fixed-width UTC text, so that they sort
+// chronologically when compared as strings
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// formatTime renders a timestamp for storage
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// nullTime renders an optional timestamp for storage
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTime(*t)
+}
+
+// parseTime reads a stored timestamp
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(timeLayout, value)
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProfile reads a profile selected with profileColumns, followed by any
+// extra columns, which are scanned into extra
+func scanProfile(row rowScanner, extra ...interface{}) (*models.Profile, error) {
+	var imageURLsJSON, attributesJSON, tagsJSON, createdAt, updatedAt string
+	var deletedAt sql.NullString
+	profile := &models.Profile{}
+	dest := []interface{}{
+		&profile.ID,
+		&profile.Name,
+		&profile.Email,
+		&profile.Bio,
+		&imageURLsJSON,
+		&profile.Version,
+		&createdAt,
+		&updatedAt,
+		&deletedAt,
+		&profile.TenantID,
+		&attributesJSON,
+		&tagsJSON,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(imageURLsJSON), &profile.ImageURLs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(attributesJSON), &profile.Attributes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tagsJSON), &profile.Tags); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if profile.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if profile.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		t, err := parseTime(deletedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		profile.DeletedAt = &t
+	}
+	return profile, nil
+}
+
+// imageURLsJSON encodes image URLs for storage, storing none as an empty list
+func imageURLsJSON(imageURLs []string) (string, error) {
+	if imageURLs == nil {
+		imageURLs = []string{}
+	}
+	data, err := json.Marshal(imageURLs)
+	return string(data), err
+}
+
+// tagsJSON encodes tags for storage, storing none as an empty list
+func tagsJSON(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	data, err := json.Marshal(tags)
+	return string(data), err
+}
+
+// attributesJSON encodes custom attributes for storage, storing none as an
+// empty object
+func attributesJSON(attributes map[string]interface{}) (string, error) {
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	data, err := json.Marshal(attributes)
+	return string(data), err
+}
+
+// attributeArg converts an attribute filter value to what json_extract returns
+// for it, which is 1 or 0 for booleans
+func attributeArg(value interface{}) interface{} {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return value
+}
+
+// sortColumns maps list sort fields to their database columns
+var sortColumns = map[string]string{
+	repository.SortByCreatedAt: "created_at",
+	repository.SortByUpdatedAt: "updated_at",
+	repository.SortByName:      "name",
+}
+
+// queryBuilder accumulates WHERE conditions and their positional arguments
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg registers a query argument and returns its placeholder
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "?"
+}
+
+// where adds a condition built with placeholders returned by arg
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// clause renders the accumulated conditions as a WHERE clause
+func (b *queryBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// buildListQuery builds a keyset-paginated listing query over a tenant's
+// profiles for normalized options. It selects one row more than the limit so the
+// caller can detect a next page.
+func buildListQuery(tenantID string, opts repository.ListOptions) (string, []interface{}, error) {
+	cursor, err := opts.DecodeCursor()
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := &queryBuilder{}
+	filterProfiles(b, tenantID, opts)
+
+	column := sortColumns[opts.SortBy]
+	direction, comparison := "DESC", "<"
+	if opts.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if cursor != nil {
+		value := cursor.Value
+		if opts.SortBy != repository.SortByName {
+			t, _ := cursor.Time()
+			value = formatTime(t)
+		}
+		b.where(fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, b.arg(value), b.arg(cursor.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM profiles
+		%s
+		ORDER BY %s %s, id %s
+		LIMIT %s
+	`, profileColumns, b.clause(), column, direction, direction, b.arg(opts.Limit+1))
+
+	return query, b.args, nil
+}
+
+// buildTagFacetQuery builds a query counting the tags of a tenant's profiles
+// matching normalized options, most common first. A limit of 0 counts every tag.
+func buildTagFacetQuery(tenantID string, opts repository.ListOptions, limit int) (string, []interface{}) {
+	b := &queryBuilder{}
+	filterProfiles(b, tenantID, opts)
+
+	query := fmt.Sprintf(`
+		SELECT tag.value, count(*)
+		FROM (SELECT tags FROM profiles %s) AS matching,
+			json_each(matching.tags) AS tag
+		GROUP BY tag.value
+		ORDER BY count(*) DESC, tag.value
+	`, b.clause())
+	if limit > 0 {
+		query += "LIMIT " + b.arg(limit)
+	}
+
+	return query, b.args
+}
+
+// filterProfiles adds the conditions selecting a tenant's profiles matching
+// normalized options, other than their cursor
+func filterProfiles(b *queryBuilder, tenantID string, opts repository.ListOptions) {
+	b.where(fmt.Sprintf("tenant_id = %s", b.arg(tenantID)))
+	if opts.Deleted {
+		b.where("deleted_at IS NOT NULL")
+	} else {
+		b.where("deleted_at IS NULL")
+	}
+	if opts.EmailDomain != "" {
+		b.where(fmt.Sprintf("lower(substr(email, instr(email, '@') + 1)) = %s", b.arg(opts.EmailDomain)))
+	}
+	if opts.NamePrefix != "" {
+		b.where(fmt.Sprintf("lower(name) LIKE %s ESCAPE '\\'", b.arg(likePrefix(opts.NamePrefix))))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		b.where(fmt.Sprintf("created_at >= %s", b.arg(formatTime(opts.CreatedAfter))))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		b.where(fmt.Sprintf("created_at < %s", b.arg(formatTime(opts.CreatedBefore))))
+	}
+	names := make([]string, 0, len(opts.Attributes))
+	for name := range opts.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// Names are validated, so they are safe to quote into the JSON path
+		b.where(fmt.Sprintf(`json_extract(attributes, '$."%s"') = %s`, name, b.arg(attributeArg(opts.Attributes[name]))))
+	}
+	if len(opts.Tags) > 0 {
+		placeholders := make([]string, len(opts.Tags))
+		for i, tag := range opts.Tags {
+			placeholders[i] = b.arg(tag)
+		}
+		// Stored tags have no duplicates, so matching all of them means
+		// matching as many as were asked for
+		matched := fmt.Sprintf("(SELECT count(*) FROM json_each(profiles.tags) WHERE json_each.value IN (%s))", strings.Join(placeholders, ", "))
+		if opts.AnyTag {
+			b.where(matched + " > 0")
+		} else {
+			b.where(fmt.Sprintf("%s = %d", matched, len(opts.Tags)))
+		}
+	}
+}
+
+// likePrefix escapes LIKE wildcards in a prefix and appends a trailing wildcard
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
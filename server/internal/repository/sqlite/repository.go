@@ -0,0 +1,444 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/config"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed schema.sql
+var schema string
+
+// Repository implements the repository.Store, repository.Outbox and
+// repository.RevisionStore interfaces for SQLite, for local and single-node runs
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new SQLite repository using the configured database file
+func NewRepository(cfg *config.Config) (*Repository, error) {
+	repo, err := Open(cfg.Database.SQLitePath)
+	if err != nil {
+		logger.Log.Error("Failed to open SQLite database", zap.Error(err))
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Open opens the SQLite database at path, creating it and its schema if needed.
+// A path of ":memory:" opens a private in-memory database.
+func Open(path string) (*Repository, error) {
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, so one connection serializes access instead
+	// of failing with SQLITE_BUSY. It also keeps an in-memory database alive.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Repository{db: db}, nil
+}
+
+// Close closes the database connection
+func (r *Repository) Close(ctx context.Context) error {
+	return r.db.Close()
+}
+
+// Create creates a new profile
+func (r *Repository) Create(ctx context.Context, profile *models.Profile) error {
+	query := `
+		INSERT INTO profiles (id, name, email, bio, image_urls, version, created_at, updated_at, tenant_id, attributes, tags)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?)
+	`
+	tenantID := tenant.FromContext(ctx)
+
+	imageURLs, err := imageURLsJSON(profile.ImageURLs)
+	if err != nil {
+		return err
+	}
+	attributes, err := attributesJSON(profile.Attributes)
+	if err != nil {
+		return err
+	}
+	tags, err := tagsJSON(profile.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, query,
+		profile.ID,
+		profile.Name,
+		profile.Email,
+		profile.Bio,
+		imageURLs,
+		formatTime(profile.CreatedAt),
+		formatTime(profile.UpdatedAt),
+		tenantID,
+		attributes,
+		tags,
+	)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("create", "error").Inc()
+		logger.Log.Error("Failed to create profile",
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+
+	profile.Version = 1
+	profile.TenantID = tenantID
+	metrics.DbOperationsTotal.WithLabelValues("create", "success").Inc()
+	return nil
+}
+
+// Get retrieves a profile by ID
+func (r *Repository) Get(ctx context.Context, id string) (*models.Profile, error) {
+	query := `
+		SELECT ` + profileColumns + `
+		FROM profiles
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+	`
+
+	profile, err := scanProfile(r.conn(ctx).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		metrics.DbOperationsTotal.WithLabelValues("get", "error").Inc()
+		logger.Log.Error("Failed to get profile",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("get", "success").Inc()
+	return profile, nil
+}
+
+// GetIncludingDeleted retrieves a profile by ID, whether or not it is soft-deleted
+func (r *Repository) GetIncludingDeleted(ctx context.Context, id string) (*models.Profile, error) {
+	query := `
+		SELECT ` + profileColumns + `
+		FROM profiles
+		WHERE id = ? AND tenant_id = ?
+	`
+
+	profile, err := scanProfile(r.conn(ctx).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		metrics.DbOperationsTotal.WithLabelValues("get", "error").Inc()
+		logger.Log.Error("Failed to get profile",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("get", "success").Inc()
+	return profile, nil
+}
+
+// Replace overwrites all editable fields of an existing profile
+func (r *Repository) Replace(ctx context.Context, id string, profile *models.Profile, expectedVersion int) error {
+	start := time.Now()
+
+	if err := r.write(ctx, id, profile, expectedVersion); err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("replace", "error").Inc()
+		return err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("replace", "success").Inc()
+	metrics.DbOperationDuration.WithLabelValues("replace").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// write stores the editable fields of profile over a live profile, if it is at
+// expectedVersion or expectedVersion is zero, and reads back the stored result
+func (r *Repository) write(ctx context.Context, id string, profile *models.Profile, expectedVersion int) error {
+	query := `
+		UPDATE profiles
+		SET name = ?, email = ?, bio = ?, image_urls = ?, attributes = ?, tags = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
+		RETURNING ` + profileColumns
+
+	imageURLs, err := imageURLsJSON(profile.ImageURLs)
+	if err != nil {
+		return err
+	}
+	attributes, err := attributesJSON(profile.Attributes)
+	if err != nil {
+		return err
+	}
+	tags, err := tagsJSON(profile.Tags)
+	if err != nil {
+		return err
+	}
+
+	stored, err := scanProfile(r.conn(ctx).QueryRowContext(ctx, query,
+		profile.Name,
+		profile.Email,
+		profile.Bio,
+		imageURLs,
+		attributes,
+		tags,
+		formatTime(time.Now()),
+		id,
+		tenant.FromContext(ctx),
+		expectedVersion,
+		expectedVersion,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return r.missingOrConflict(ctx, id)
+		}
+		logger.Log.Error("Failed to write profile",
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+
+	*profile = *stored
+	return nil
+}
+
+// Delete soft-deletes a profile by setting its tombstone timestamp
+func (r *Repository) Delete(ctx context.Context, id string, expectedVersion int) (*models.Profile, error) {
+	query := `
+		UPDATE profiles
+		SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
+		RETURNING ` + profileColumns
+
+	now := formatTime(time.Now())
+	profile, err := scanProfile(r.conn(ctx).QueryRowContext(ctx, query, now, now, id, tenant.FromContext(ctx), expectedVersion, expectedVersion))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, r.missingOrConflict(ctx, id)
+		}
+		metrics.DbOperationsTotal.WithLabelValues("delete", "error").Inc()
+		logger.Log.Error("Failed to delete profile",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("delete", "success").Inc()
+	return profile, nil
+}
+
+// Restore clears the tombstone of a soft-deleted profile
+func (r *Repository) Restore(ctx context.Context, id string) (*models.Profile, error) {
+	query := `
+		UPDATE profiles
+		SET deleted_at = NULL, updated_at = ?, version = version + 1
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NOT NULL
+		RETURNING ` + profileColumns
+
+	profile, err := scanProfile(r.conn(ctx).QueryRowContext(ctx, query, formatTime(time.Now()), id, tenant.FromContext(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		metrics.DbOperationsTotal.WithLabelValues("restore", "error").Inc()
+		logger.Log.Error("Failed to restore profile",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("restore", "success").Inc()
+	return profile, nil
+}
+
+// Erase permanently removes a profile, live or soft-deleted, and by cascade its
+// revisions
+func (r *Repository) Erase(ctx context.Context, id string) (*models.Profile, error) {
+	query := `
+		DELETE FROM profiles
+		WHERE id = ? AND tenant_id = ?
+		RETURNING ` + profileColumns
+
+	profile, err := scanProfile(r.conn(ctx).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		metrics.DbOperationsTotal.WithLabelValues("erase", "error").Inc()
+		logger.Log.Error("Failed to erase profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("erase", "success").Inc()
+	return profile, nil
+}
+
+// PurgeDeleted permanently removes up to limit profiles of any tenant tombstoned
+// before the given time and returns them
+func (r *Repository) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*models.Profile, error) {
+	query := `
+		DELETE FROM profiles
+		WHERE id IN (
+			SELECT id FROM profiles
+			WHERE deleted_at IS NOT NULL AND deleted_at < ?
+			ORDER BY deleted_at
+			LIMIT ?
+		)
+		RETURNING ` + profileColumns
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, formatTime(before), limit)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("purge", "error").Inc()
+		logger.Log.Error("Failed to purge deleted profiles",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var purged []*models.Profile
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		purged = append(purged, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("purge", "success").Inc()
+	return purged, nil
+}
+
+// missingOrConflict explains why a conditional write matched no rows
+func (r *Repository) missingOrConflict(ctx context.Context, id string) error {
+	var exists bool
+	if err := r.conn(ctx).QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM profiles WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL)`, id, tenant.FromContext(ctx)).Scan(&exists); err != nil {
+		return mapError(err)
+	}
+	if exists {
+		return repository.ErrConflict
+	}
+	return repository.ErrNotFound
+}
+
+// List retrieves a page of profiles matching the given options
+func (r *Repository) List(ctx context.Context, opts repository.ListOptions) (*repository.ListResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	query, args, err := buildListQuery(tenant.FromContext(ctx), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("list", "error").Inc()
+		logger.Log.Error("Failed to list profiles",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	profiles := make([]*models.Profile, 0, opts.Limit+1)
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &repository.ListResult{Profiles: profiles}
+	if len(profiles) > opts.Limit {
+		result.Profiles = profiles[:opts.Limit]
+		result.NextCursor = repository.NewCursor(opts, result.Profiles[opts.Limit-1])
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("list", "success").Inc()
+	return result, nil
+}
+
+// TagFacets counts the tags of the profiles matching the given options
+func (r *Repository) TagFacets(ctx context.Context, opts repository.ListOptions, limit int) ([]*models.TagCount, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	query, args := buildTagFacetQuery(tenant.FromContext(ctx), opts, limit)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("tag_facets", "error").Inc()
+		logger.Log.Error("Failed to count profile tags",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	counts := []*models.TagCount{}
+	for rows.Next() {
+		count := &models.TagCount{}
+		if err := rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("tag_facets", "success").Inc()
+	return counts, nil
+}
+
+// Iterate reads the profiles matching opts a page at a time. The database has a
+// single connection, so holding one query open for the whole iteration would
+// block every other caller until it ends.
+func (r *Repository) Iterate(ctx context.Context, opts repository.ListOptions) (repository.ProfileIterator, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	if _, err := opts.DecodeCursor(); err != nil {
+		return nil, err
+	}
+	return repository.NewListIterator(ctx, r.List, opts), nil
+}
+
+// ConsistencyToken returns an empty token: a single database is always consistent
+func (r *Repository) ConsistencyToken(ctx context.Context) (string, error) {
+	return "", nil
+}
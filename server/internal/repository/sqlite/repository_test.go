@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/repository/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	os.Exit(m.Run())
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repository.Backend {
+		repo, err := Open(":memory:")
+		require.NoError(t, err)
+		t.Cleanup(func() { repo.Close(context.Background()) })
+		return repo
+	})
+}
+
+func TestFtsQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"tomatoes", `("tomatoes")`},
+		{"growing tomatoes", `("growing" "tomatoes")`},
+		{`"growing tomatoes" garden`, `("growing tomatoes" "garden")`},
+		{"tomatoes or carl", `("tomatoes" OR "carl")`},
+		{"or tomatoes", `("tomatoes")`},
+		{"climbing -carl", `("climbing") NOT "carl"`},
+		{"-carl", ""},
+		{`name:x AND "y`, `("name:x" "AND" "y")`},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ftsQuery(tt.input), "input %q", tt.input)
+	}
+}
+
+func TestMapErrorNotNull(t *testing.T) {
+	repo, err := Open(":memory:")
+	require.NoError(t, err)
+	defer repo.Close(context.Background())
+
+	_, err = repo.db.Exec(`INSERT INTO profiles (id, name, email, version, created_at, updated_at) VALUES ('x', NULL, 'x@example.com', 1, '', '')`)
+	var validationErr *repository.ValidationError
+	require.ErrorAs(t, mapError(err), &validationErr)
+	assert.Equal(t, "name", validationErr.Field)
+}
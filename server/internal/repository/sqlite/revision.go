@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// revisionColumns lists the columns read by scanRevision, in scan order
+const revisionColumns = `profile_id, revision, operation, actor, snapshot, changes, created_at`
+
+// AddRevision records a change to a profile
+func (r *Repository) AddRevision(ctx context.Context, revision *models.Revision) error {
+	snapshotJSON, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return err
+	}
+	changesJSON, err := json.Marshal(revision.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO profile_revisions (` + revisionColumns + `, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = r.conn(ctx).ExecContext(ctx, query,
+		revision.ProfileID,
+		revision.Revision,
+		revision.Operation,
+		revision.Actor,
+		string(snapshotJSON),
+		string(changesJSON),
+		formatTime(revision.CreatedAt),
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		logger.Log.Error("Failed to record profile revision",
+			zap.String("profile_id", revision.ProfileID),
+			zap.Int("revision", revision.Revision),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// AddRevisions records several changes at once
+func (r *Repository) AddRevisions(ctx context.Context, revisions []*models.Revision) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		for _, revision := range revisions {
+			if err := r.AddRevision(ctx, revision); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRevision retrieves a single revision of a profile
+func (r *Repository) GetRevision(ctx context.Context, profileID string, revision int) (*models.Revision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM profile_revisions
+		WHERE profile_id = ? AND revision = ? AND tenant_id = ?
+	`
+
+	return r.getRevision(ctx, query, profileID, revision, tenant.FromContext(ctx))
+}
+
+// GetRevisionAt retrieves the latest revision of a profile recorded at or
+// before the given time
+func (r *Repository) GetRevisionAt(ctx context.Context, profileID string, at time.Time) (*models.Revision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM profile_revisions
+		WHERE profile_id = ? AND created_at <= ? AND tenant_id = ?
+		ORDER BY revision DESC
+		LIMIT 1
+	`
+
+	return r.getRevision(ctx, query, profileID, formatTime(at), tenant.FromContext(ctx))
+}
+
+// getRevision runs a query selecting at most one revision
+func (r *Repository) getRevision(ctx context.Context, query string, args ...interface{}) (*models.Revision, error) {
+	revision, err := scanRevision(r.conn(ctx).QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrRevisionNotFound
+		}
+		logger.Log.Error("Failed to get profile revision",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	return revision, nil
+}
+
+// ListRevisions returns a page of a profile's revisions, newest first
+func (r *Repository) ListRevisions(ctx context.Context, profileID string, opts repository.HistoryOptions) (*repository.HistoryResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM profile_revisions
+		WHERE profile_id = ? AND tenant_id = ? AND (? = 0 OR revision < ?)
+		ORDER BY revision DESC
+		LIMIT ?
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, profileID, tenant.FromContext(ctx), opts.Before, opts.Before, opts.Limit+1)
+	if err != nil {
+		logger.Log.Error("Failed to list profile revisions",
+			zap.String("profile_id", profileID),
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	result := &repository.HistoryResult{Revisions: []*models.Revision{}}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Revisions = append(result.Revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Revisions) > opts.Limit {
+		result.Revisions = result.Revisions[:opts.Limit]
+		result.NextBefore = result.Revisions[opts.Limit-1].Revision
+	}
+	return result, nil
+}
+
+// scanRevision reads a revision selected with revisionColumns
+func scanRevision(row rowScanner) (*models.Revision, error) {
+	var snapshotJSON, changesJSON, createdAt string
+	revision := &models.Revision{}
+	if err := row.Scan(
+		&revision.ProfileID,
+		&revision.Revision,
+		&revision.Operation,
+		&revision.Actor,
+		&snapshotJSON,
+		&changesJSON,
+		&createdAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(snapshotJSON), &revision.Snapshot); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(changesJSON), &revision.Changes); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if revision.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
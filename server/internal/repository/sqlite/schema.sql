@@ -0,0 +1,141 @@
+-- The schema is created idempotently when the database is opened
+
+CREATE TABLE IF NOT EXISTS profiles (
+    -- seq gives full-text search a stable rowid to index
+    seq INTEGER PRIMARY KEY,
+    id TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL CHECK (length(name) <= 255),
+    email TEXT NOT NULL CHECK (length(email) <= 255),
+    bio TEXT NOT NULL DEFAULT '',
+    image_urls TEXT NOT NULL DEFAULT '[]',
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    deleted_at TEXT,
+    tenant_id TEXT NOT NULL DEFAULT 'default',
+    attributes TEXT NOT NULL DEFAULT '{}',
+    tags TEXT NOT NULL DEFAULT '[]'
+);
+
+-- Emails are unique within a tenant, and tombstoned profiles must not block
+-- their email from being reused
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_tenant_email_active_idx ON profiles (tenant_id, email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS profiles_tenant_created_at_id_idx ON profiles (tenant_id, created_at, id);
+CREATE INDEX IF NOT EXISTS profiles_tenant_updated_at_id_idx ON profiles (tenant_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS profiles_tenant_name_id_idx ON profiles (tenant_id, name, id);
+CREATE INDEX IF NOT EXISTS profiles_deleted_at_idx ON profiles (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS profiles_fts USING fts5 (
+    name,
+    bio,
+    content = 'profiles',
+    content_rowid = 'seq',
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS profiles_fts_insert AFTER INSERT ON profiles BEGIN
+    INSERT INTO profiles_fts (rowid, name, bio) VALUES (new.seq, new.name, new.bio);
+END;
+
+CREATE TRIGGER IF NOT EXISTS profiles_fts_delete AFTER DELETE ON profiles BEGIN
+    INSERT INTO profiles_fts (profiles_fts, rowid, name, bio) VALUES ('delete', old.seq, old.name, old.bio);
+END;
+
+CREATE TRIGGER IF NOT EXISTS profiles_fts_update AFTER UPDATE OF name, bio ON profiles BEGIN
+    INSERT INTO profiles_fts (profiles_fts, rowid, name, bio) VALUES ('delete', old.seq, old.name, old.bio);
+    INSERT INTO profiles_fts (rowid, name, bio) VALUES (new.seq, new.name, new.bio);
+END;
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id TEXT PRIMARY KEY,
+    aggregate_id TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TEXT NOT NULL,
+    next_attempt_at TEXT NOT NULL,
+    sent_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (next_attempt_at) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_sent_at_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS outbox_aggregate_id_idx ON outbox (aggregate_id);
+
+CREATE TABLE IF NOT EXISTS profile_revisions (
+    profile_id TEXT NOT NULL REFERENCES profiles (id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    operation TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    snapshot TEXT NOT NULL,
+    changes TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    tenant_id TEXT NOT NULL DEFAULT 'default',
+    PRIMARY KEY (profile_id, revision)
+);
+
+-- Maps each email in use to the profile holding it, for sharded deployments
+CREATE TABLE IF NOT EXISTS profile_emails (
+    tenant_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    profile_id TEXT NOT NULL,
+    claimed_at TEXT NOT NULL,
+    PRIMARY KEY (tenant_id, email)
+);
+
+-- The custom attributes each tenant's profiles may carry
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    tenant_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    required INTEGER NOT NULL DEFAULT 0,
+    enum TEXT NOT NULL DEFAULT '[]',
+    max_length INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (tenant_id, name)
+);
+
+-- The follower graph. It carries no foreign keys, like the PostgreSQL table,
+-- whose profiles may live on other shards.
+CREATE TABLE IF NOT EXISTS profile_follows (
+    tenant_id TEXT NOT NULL,
+    follower_id TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    PRIMARY KEY (tenant_id, follower_id, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS profile_follows_target_created_at_idx ON profile_follows (tenant_id, target_id, created_at, follower_id);
+CREATE INDEX IF NOT EXISTS profile_follows_follower_created_at_idx ON profile_follows (tenant_id, follower_id, created_at, target_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    tenant_id TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    token TEXT NOT NULL DEFAULT '',
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BLOB,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    PRIMARY KEY (tenant_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+-- Receipts of data-subject erasure requests, which outlive their profiles
+CREATE TABLE IF NOT EXISTS profile_erasures (
+    tenant_id TEXT NOT NULL,
+    profile_id TEXT NOT NULL,
+    id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    requested_at TEXT NOT NULL,
+    completed_at TEXT,
+    images_deleted INTEGER NOT NULL DEFAULT 0,
+    follows_deleted INTEGER NOT NULL DEFAULT 0,
+    events_deleted INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, profile_id)
+);
+
+CREATE INDEX IF NOT EXISTS profile_erasures_pending_idx ON profile_erasures (requested_at) WHERE status = 'pending';
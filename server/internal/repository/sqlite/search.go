@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/metrics"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// Search runs a ranked full-text search over profile names and bios
+func (r *Repository) Search(ctx context.Context, opts repository.SearchOptions) (*repository.SearchResult, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	offset, err := opts.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &repository.SearchResult{Hits: []*repository.SearchHit{}}
+	match := ftsQuery(opts.Query)
+	if match == "" {
+		return result, nil
+	}
+
+	// bm25 scores better matches lower; names weigh more than bios. Matches are
+	// delimited for repository.Highlight to mark up once the text is escaped.
+	query := `
+		SELECT ` + prefixColumns("p.") + `,
+			-bm25(profiles_fts, 2.0, 1.0) AS rank,
+			highlight(profiles_fts, 0, '` + repository.HighlightStart + `', '` + repository.HighlightStop + `'),
+			snippet(profiles_fts, 1, '` + repository.HighlightStart + `', '` + repository.HighlightStop + `', '...', 20)
+		FROM profiles_fts
+		JOIN profiles p ON p.seq = profiles_fts.rowid
+		WHERE profiles_fts MATCH ? AND p.tenant_id = ? AND p.deleted_at IS NULL
+		ORDER BY rank DESC, p.id
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, match, tenant.FromContext(ctx), opts.Limit+1, offset)
+	if err != nil {
+		metrics.DbOperationsTotal.WithLabelValues("search", "error").Inc()
+		logger.Log.Error("Failed to search profiles",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hit := &repository.SearchHit{}
+		hit.Profile, err = scanProfile(rows, &hit.Rank, &hit.NameHighlight, &hit.BioSnippet)
+		if err != nil {
+			return nil, err
+		}
+		hit.NameHighlight = repository.Highlight(hit.NameHighlight)
+		hit.BioSnippet = repository.Highlight(hit.BioSnippet)
+		result.Hits = append(result.Hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Hits) > opts.Limit {
+		result.Hits = result.Hits[:opts.Limit]
+		result.NextCursor = repository.NewSearchCursor(opts, offset+opts.Limit)
+	}
+
+	metrics.DbOperationsTotal.WithLabelValues("search", "success").Inc()
+	return result, nil
+}
+
+// prefixColumns qualifies profileColumns with a table alias
+func prefixColumns(prefix string) string {
+	columns := strings.Split(profileColumns, ", ")
+	for i, column := range columns {
+		columns[i] = prefix + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// ftsQuery translates web search syntax, as accepted by PostgreSQL's
+// websearch_to_tsquery, into an FTS5 query: words and "quoted phrases" must all
+// match, "or" between terms matches either, and -term excludes a term. Every
+// term is quoted, so FTS5 operators in the input are matched literally. It
+// returns an empty string when nothing is left to match.
+func ftsQuery(input string) string {
+	var terms, exclusions []string
+	pendingOr := false
+
+	for input = strings.TrimSpace(input); input != ""; input = strings.TrimSpace(input) {
+		negated := false
+		if input[0] == '-' {
+			negated = true
+			input = input[1:]
+		}
+
+		var term string
+		if strings.HasPrefix(input, `"`) {
+			end := strings.Index(input[1:], `"`)
+			if end < 0 {
+				term, input = input[1:], ""
+			} else {
+				term, input = input[1:end+1], input[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(input, " \t\n")
+			if end < 0 {
+				end = len(input)
+			}
+			term, input = input[:end], input[end:]
+		}
+
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		if !negated && strings.EqualFold(term, "or") {
+			pendingOr = len(terms) > 0
+			continue
+		}
+
+		quoted := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		switch {
+		case negated:
+			exclusions = append(exclusions, quoted)
+		case pendingOr:
+			terms = append(terms, "OR", quoted)
+		default:
+			terms = append(terms, quoted)
+		}
+		pendingOr = false
+	}
+
+	if len(terms) == 0 {
+		return ""
+	}
+	query := "(" + strings.Join(terms, " ") + ")"
+	for _, exclusion := range exclusions {
+		query += " NOT " + exclusion
+	}
+	return query
+}
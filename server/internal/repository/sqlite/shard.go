@@ -0,0 +1,176 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/api/middleware/logger"
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// ImportProfile stores a profile and its revisions exactly as given, under the
+// profile's tenant, replacing any copy already stored
+func (r *Repository) ImportProfile(ctx context.Context, profile *models.Profile, revisions []*models.Revision) error {
+	imageURLs, err := imageURLsJSON(profile.ImageURLs)
+	if err != nil {
+		return err
+	}
+	attributes, err := attributesJSON(profile.Attributes)
+	if err != nil {
+		return err
+	}
+	tags, err := tagsJSON(profile.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = r.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := r.conn(ctx).ExecContext(ctx, `
+			INSERT INTO profiles (`+profileColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				name = excluded.name,
+				email = excluded.email,
+				bio = excluded.bio,
+				image_urls = excluded.image_urls,
+				version = excluded.version,
+				created_at = excluded.created_at,
+				updated_at = excluded.updated_at,
+				deleted_at = excluded.deleted_at,
+				tenant_id = excluded.tenant_id,
+				attributes = excluded.attributes,
+				tags = excluded.tags
+		`,
+			profile.ID,
+			profile.Name,
+			profile.Email,
+			profile.Bio,
+			imageURLs,
+			profile.Version,
+			formatTime(profile.CreatedAt),
+			formatTime(profile.UpdatedAt),
+			nullTime(profile.DeletedAt),
+			profile.TenantID,
+			attributes,
+			tags,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, revision := range revisions {
+			snapshotJSON, err := json.Marshal(revision.Snapshot)
+			if err != nil {
+				return err
+			}
+			changesJSON, err := json.Marshal(revision.Changes)
+			if err != nil {
+				return err
+			}
+			_, err = r.conn(ctx).ExecContext(ctx, `
+				INSERT INTO profile_revisions (`+revisionColumns+`, tenant_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (profile_id, revision) DO NOTHING
+			`,
+				revision.ProfileID,
+				revision.Revision,
+				revision.Operation,
+				revision.Actor,
+				string(snapshotJSON),
+				string(changesJSON),
+				formatTime(revision.CreatedAt),
+				profile.TenantID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Error("Failed to import profile",
+			zap.String("id", profile.ID),
+			zap.Error(err),
+		)
+	}
+	return mapError(err)
+}
+
+// RemoveProfile permanently removes a profile of any tenant and, by cascade,
+// its revisions
+func (r *Repository) RemoveProfile(ctx context.Context, id string) error {
+	if _, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM profiles WHERE id = ?`, id); err != nil {
+		logger.Log.Error("Failed to remove profile",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+		return mapError(err)
+	}
+	return nil
+}
+
+// ListTenants returns the tenants having at least one stored profile
+func (r *Repository) ListTenants(ctx context.Context) ([]string, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT DISTINCT tenant_id FROM profiles ORDER BY tenant_id`)
+	if err != nil {
+		logger.Log.Error("Failed to list tenants",
+			zap.Error(err),
+		)
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, id)
+	}
+	return tenants, rows.Err()
+}
+
+// ClaimEmail records profileID as the holder of email in the context's tenant
+// unless another profile holds it, and returns the claim in effect
+func (r *Repository) ClaimEmail(ctx context.Context, email, profileID string) (*repository.EmailClaim, error) {
+	tenantID := tenant.FromContext(ctx)
+	var claimedAt string
+	claim := &repository.EmailClaim{}
+
+	// Writes are serialized, so the claim read back cannot have been released
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := r.conn(ctx).ExecContext(ctx, `
+			INSERT INTO profile_emails (tenant_id, email, profile_id, claimed_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (tenant_id, email) DO NOTHING
+		`, tenantID, email, profileID, formatTime(time.Now()))
+		if err != nil {
+			return err
+		}
+		return r.conn(ctx).QueryRowContext(ctx, `
+			SELECT profile_id, claimed_at FROM profile_emails WHERE tenant_id = ? AND email = ?
+		`, tenantID, email).Scan(&claim.ProfileID, &claimedAt)
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	if claim.ClaimedAt, err = parseTime(claimedAt); err != nil {
+		return nil, err
+	}
+	return claim, nil
+}
+
+// ReleaseEmail removes the claim of profileID on email in the context's tenant,
+// if it holds one
+func (r *Repository) ReleaseEmail(ctx context.Context, email, profileID string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `
+		DELETE FROM profile_emails WHERE tenant_id = ? AND email = ? AND profile_id = ?
+	`, tenant.FromContext(ctx), email, profileID)
+	return mapError(err)
+}
@@ -2,7 +2,7 @@ package repository
 
 import (
 	"context"
-	"errors"
+	"time"
 
 	"github.com/fernandobarroso/profile-service/internal/models"
 )
@@ -12,21 +12,80 @@ type Store interface {
 	// Create stores a new profile
 	Create(ctx context.Context, profile *models.Profile) error
 
+	// CreateBatch stores new profiles and returns one outcome per profile, in
+	// order. A profile whose email is already in use, by a stored profile or an
+	// earlier one in the batch, is a duplicate; with upsert, a stored profile
+	// with the email is updated instead.
+	CreateBatch(ctx context.Context, profiles []*models.Profile, upsert bool) ([]*BatchOutcome, error)
+
 	// Get retrieves a profile by ID
 	Get(ctx context.Context, id string) (*models.Profile, error)
 
-	// Update updates an existing profile
-	Update(ctx context.Context, id string, profile *models.Profile) error
+	// GetIncludingDeleted retrieves a profile by ID, whether or not it is
+	// soft-deleted
+	GetIncludingDeleted(ctx context.Context, id string) (*models.Profile, error)
+
+	// Replace overwrites all editable fields of an existing profile, leaving
+	// profile holding the stored result. A non-zero expectedVersion makes the
+	// write conditional on the stored version, returning ErrConflict on mismatch.
+	Replace(ctx context.Context, id string, profile *models.Profile, expectedVersion int) error
+
+	// Delete soft-deletes a profile by ID and returns the tombstoned profile. A
+	// non-zero expectedVersion makes the delete conditional on the stored
+	// version, returning ErrConflict on mismatch.
+	Delete(ctx context.Context, id string, expectedVersion int) (*models.Profile, error)
+
+	// List returns a page of profiles matching the given options
+	List(ctx context.Context, opts ListOptions) (*ListResult, error)
+
+	// Iterate returns an iterator over every profile matching opts, in the order
+	// List would return them, starting after opts.Cursor. opts.Limit is ignored.
+	Iterate(ctx context.Context, opts ListOptions) (ProfileIterator, error)
+
+	// TagFacets counts the profiles matching opts that carry each tag, most
+	// common first and then by tag. A positive limit caps the tags returned;
+	// opts.Limit and opts.Cursor are ignored.
+	TagFacets(ctx context.Context, opts ListOptions, limit int) ([]*models.TagCount, error)
 
-	// Delete removes a profile by ID
-	Delete(ctx context.Context, id string) error
+	// Search returns profiles whose name or bio match a full-text query, best match first
+	Search(ctx context.Context, opts SearchOptions) (*SearchResult, error)
 
-	// List returns all profiles
-	List(ctx context.Context) ([]*models.Profile, error)
+	// Restore undoes the soft delete of a profile. It returns ErrNotFound if the
+	// profile is not deleted and ErrDuplicateEmail if its email has been reused.
+	Restore(ctx context.Context, id string) (*models.Profile, error)
+
+	// PurgeDeleted permanently removes up to limit profiles soft-deleted before
+	// the given time and returns them. Unlike every other method, it is not
+	// limited to the context's tenant.
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*models.Profile, error)
+
+	// Erase permanently removes a profile, whether or not it is soft-deleted,
+	// along with its revisions, and returns it
+	Erase(ctx context.Context, id string) (*models.Profile, error)
+
+	// ConsistencyToken returns a token covering every write committed so far.
+	// Reads made with a context from WithConsistencyToken observe those writes.
+	// It returns an empty token when all reads are already consistent.
+	ConsistencyToken(ctx context.Context) (string, error)
+
+	// WithinTx runs fn in a transaction. Store and outbox calls made with the
+	// context passed to fn join it; it commits if fn returns nil.
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 
 	// Close closes any resources used by the store
 	Close(ctx context.Context) error
 }
 
-// ErrNotFound is returned when a profile is not found
-var ErrNotFound = errors.New("profile not found")
+// Backend is a storage implementation that keeps profiles, their outbox, their
+// revision history, their attribute schema and their follower graph together,
+// so that all of them share transactions. It also remembers idempotency keys
+// and erasure receipts.
+type Backend interface {
+	Store
+	Outbox
+	RevisionStore
+	AttributeSchemaStore
+	FollowStore
+	IdempotencyStore
+	ErasureStore
+}
@@ -0,0 +1,1157 @@
+// Package storetest is a conformance suite for repository.Backend
+// implementations. Every implementation must pass it, so that the service
+// behaves the same whichever storage backend it runs on.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fernandobarroso/profile-service/internal/models"
+	"github.com/fernandobarroso/profile-service/internal/repository"
+	"github.com/fernandobarroso/profile-service/internal/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errRollback makes a test transaction roll back
+var errRollback = errors.New("rollback")
+
+// Run runs the conformance suite. newBackend must return an empty backend,
+// which is used by a single subtest.
+func Run(t *testing.T, newBackend func(t *testing.T) repository.Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, b repository.Backend)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"GetMissing", testGetMissing},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"Replace", testReplace},
+		{"DeleteAndRestore", testDeleteAndRestore},
+		{"RestoreReusedEmail", testRestoreReusedEmail},
+		{"PurgeDeleted", testPurgeDeleted},
+		{"Erase", testErase},
+		{"ListOrdering", testListOrdering},
+		{"ListByName", testListByName},
+		{"ListFilters", testListFilters},
+		{"Attributes", testAttributes},
+		{"Tags", testTags},
+		{"Follows", testFollows},
+		{"Iterate", testIterate},
+		{"Search", testSearch},
+		{"WithinTxRollback", testWithinTxRollback},
+		{"CreateBatch", testCreateBatch},
+		{"CreateBatchUpsert", testCreateBatchUpsert},
+		{"Revisions", testRevisions},
+		{"TenantIsolation", testTenantIsolation},
+		{"Outbox", testOutbox},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"Erasures", testErasures},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newBackend(t))
+		})
+	}
+}
+
+// newProfile builds an unsaved profile created at the given time
+func newProfile(name, email string, createdAt time.Time) *models.Profile {
+	return &models.Profile{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Email:     email,
+		Bio:       "Bio of " + name,
+		ImageURLs: []string{},
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+}
+
+// mustCreate stores a new profile created now
+func mustCreate(t *testing.T, b repository.Backend, name, email string) *models.Profile {
+	t.Helper()
+	profile := newProfile(name, email, time.Now())
+	require.NoError(t, b.Create(context.Background(), profile))
+	return profile
+}
+
+func testCreateAndGet(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	profile := newProfile("Ada Lovelace", "ada@example.com", time.Now())
+	profile.ImageURLs = []string{"https://example.com/a.png", "https://example.com/b.png"}
+
+	require.NoError(t, b.Create(ctx, profile))
+	assert.Equal(t, 1, profile.Version)
+
+	got, err := b.Get(ctx, profile.ID)
+	require.NoError(t, err)
+	assert.Equal(t, profile.ID, got.ID)
+	assert.Equal(t, "Ada Lovelace", got.Name)
+	assert.Equal(t, "ada@example.com", got.Email)
+	assert.Equal(t, "Bio of Ada Lovelace", got.Bio)
+	assert.Equal(t, profile.ImageURLs, got.ImageURLs)
+	assert.Equal(t, 1, got.Version)
+	assert.WithinDuration(t, profile.CreatedAt, got.CreatedAt, time.Millisecond)
+	assert.Nil(t, got.DeletedAt)
+}
+
+func testGetMissing(t *testing.T, b repository.Backend) {
+	_, err := b.Get(context.Background(), uuid.New().String())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func testDuplicateEmail(t *testing.T, b repository.Backend) {
+	mustCreate(t, b, "First", "same@example.com")
+
+	err := b.Create(context.Background(), newProfile("Second", "same@example.com", time.Now()))
+	assert.ErrorIs(t, err, repository.ErrDuplicateEmail)
+}
+
+func testReplace(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	profile := mustCreate(t, b, "Replaced", "replace@example.com")
+
+	replacement := &models.Profile{Name: "Replacement", Email: "replace@example.com"}
+	require.NoError(t, b.Replace(ctx, profile.ID, replacement, 1))
+	assert.Equal(t, "", replacement.Bio)
+	assert.Equal(t, 2, replacement.Version)
+
+	err := b.Replace(ctx, profile.ID, &models.Profile{Name: "Stale", Email: "replace@example.com"}, 1)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+
+	other := mustCreate(t, b, "Other", "other@example.com")
+	err = b.Replace(ctx, other.ID, &models.Profile{Name: "Other", Email: "replace@example.com"}, 0)
+	assert.ErrorIs(t, err, repository.ErrDuplicateEmail)
+
+	got, err := b.Get(ctx, profile.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Replacement", got.Name)
+	assert.Equal(t, 2, got.Version)
+
+	err = b.Replace(ctx, uuid.New().String(), &models.Profile{Name: "Nobody", Email: "nobody@example.com"}, 0)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func testDeleteAndRestore(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	profile := mustCreate(t, b, "Deleted", "deleted@example.com")
+
+	_, err := b.Delete(ctx, profile.ID, 2)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+
+	deleted, err := b.Delete(ctx, profile.ID, 1)
+	require.NoError(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+	assert.Equal(t, 2, deleted.Version)
+
+	_, err = b.Get(ctx, profile.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = b.Delete(ctx, profile.ID, 0)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	listed, err := b.List(ctx, repository.ListOptions{Deleted: true})
+	require.NoError(t, err)
+	require.Len(t, listed.Profiles, 1)
+	assert.Equal(t, profile.ID, listed.Profiles[0].ID)
+
+	restored, err := b.Restore(ctx, profile.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, 3, restored.Version)
+
+	_, err = b.Restore(ctx, profile.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func testRestoreReusedEmail(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	profile := mustCreate(t, b, "Original", "reused@example.com")
+	_, err := b.Delete(ctx, profile.ID, 0)
+	require.NoError(t, err)
+
+	// A deleted profile's email is free for reuse
+	mustCreate(t, b, "Successor", "reused@example.com")
+
+	_, err = b.Restore(ctx, profile.ID)
+	assert.ErrorIs(t, err, repository.ErrDuplicateEmail)
+}
+
+func testPurgeDeleted(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	purged := mustCreate(t, b, "Purged", "purged@example.com")
+	kept := mustCreate(t, b, "Kept", "kept@example.com")
+	_, err := b.Delete(ctx, purged.ID, 0)
+	require.NoError(t, err)
+
+	removed, err := b.PurgeDeleted(ctx, time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+
+	removed, err = b.PurgeDeleted(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, purged.ID, removed[0].ID)
+	assert.Equal(t, tenant.DefaultID, removed[0].TenantID)
+
+	_, err = b.Restore(ctx, purged.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = b.Get(ctx, kept.ID)
+	assert.NoError(t, err)
+}
+
+func testErase(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	live := mustCreate(t, b, "Live", "live@example.com")
+	deleted := mustCreate(t, b, "Deleted", "deleted@example.com")
+	_, err := b.Delete(ctx, deleted.ID, 0)
+	require.NoError(t, err)
+	require.NoError(t, b.AddRevision(ctx, &models.Revision{
+		ProfileID: live.ID,
+		Revision:  1,
+		Operation: models.RevisionCreate,
+		Actor:     "tester",
+		Snapshot:  live,
+		Changes:   []models.FieldChange{},
+		CreatedAt: time.Now(),
+	}))
+
+	// Soft-deleted profiles can still be read, and erased, by ID
+	stored, err := b.GetIncludingDeleted(ctx, deleted.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.DeletedAt)
+	_, err = b.GetIncludingDeleted(tenant.WithID(ctx, "acme"), deleted.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = b.Erase(tenant.WithID(ctx, "acme"), live.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	for _, profile := range []*models.Profile{live, deleted} {
+		erased, err := b.Erase(ctx, profile.ID)
+		require.NoError(t, err)
+		assert.Equal(t, profile.Email, erased.Email)
+		_, err = b.GetIncludingDeleted(ctx, profile.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = b.Erase(ctx, profile.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	}
+
+	history, err := b.ListRevisions(ctx, live.ID, repository.HistoryOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, history.Revisions)
+
+	// The email of an erased profile is free again
+	mustCreate(t, b, "Reused", "live@example.com")
+}
+
+func testListOrdering(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour)
+	var created []*models.Profile
+	for i := 0; i < 5; i++ {
+		profile := newProfile(fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), base.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, b.Create(ctx, profile))
+		created = append(created, profile)
+	}
+
+	// Newest first, two at a time
+	var ids []string
+	opts := repository.ListOptions{Limit: 2}
+	for page := 0; ; page++ {
+		require.Less(t, page, 5, "pagination did not terminate")
+		result, err := b.List(ctx, opts)
+		require.NoError(t, err)
+		for _, profile := range result.Profiles {
+			ids = append(ids, profile.ID)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		opts.Cursor = result.NextCursor
+	}
+	assert.Equal(t, []string{created[4].ID, created[3].ID, created[2].ID, created[1].ID, created[0].ID}, ids)
+
+	result, err := b.List(ctx, repository.ListOptions{Limit: 2, Ascending: true})
+	require.NoError(t, err)
+	require.Len(t, result.Profiles, 2)
+	assert.Equal(t, created[0].ID, result.Profiles[0].ID)
+	assert.Equal(t, created[1].ID, result.Profiles[1].ID)
+
+	result, err = b.List(ctx, repository.ListOptions{SortBy: repository.SortByName, Ascending: true, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, result.Profiles, 1)
+	assert.Equal(t, "User 0", result.Profiles[0].Name)
+
+	_, err = b.List(ctx, repository.ListOptions{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, repository.ErrValidation)
+}
+
+func testListByName(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	// Names sort bytewise on every backend, so that pages merged across shards
+	// agree with each shard's own order: upper case before lower case, and
+	// accented letters after both
+	names := []string{"zoe", "Émile", "alice", "Zed", "éclair", "Bob", "bob"}
+	for i, name := range names {
+		mustCreate(t, b, name, fmt.Sprintf("name%d@example.com", i))
+	}
+	want := []string{"Bob", "Zed", "alice", "bob", "zoe", "Émile", "éclair"}
+
+	list := func(opts repository.ListOptions) []string {
+		t.Helper()
+		var got []string
+		for page := 0; ; page++ {
+			require.Less(t, page, len(names), "pagination did not terminate")
+			result, err := b.List(ctx, opts)
+			require.NoError(t, err)
+			for _, profile := range result.Profiles {
+				got = append(got, profile.Name)
+			}
+			if result.NextCursor == "" {
+				return got
+			}
+			opts.Cursor = result.NextCursor
+		}
+	}
+	assert.Equal(t, want, list(repository.ListOptions{SortBy: repository.SortByName, Ascending: true, Limit: 2}))
+
+	reversed := slices.Clone(want)
+	slices.Reverse(reversed)
+	assert.Equal(t, reversed, list(repository.ListOptions{SortBy: repository.SortByName, Limit: 3}))
+
+	it, err := b.Iterate(ctx, repository.ListOptions{SortBy: repository.SortByName, Ascending: true})
+	require.NoError(t, err)
+	defer it.Close()
+	var iterated []string
+	for it.Next() {
+		iterated = append(iterated, it.Profile().Name)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, want, iterated)
+}
+
+func testIterate(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+
+	// More than one listing page, so that paging iterators resume between pages
+	base := time.Now().Add(-time.Hour)
+	var batch []*models.Profile
+	for i := 0; i < repository.MaxListLimit+25; i++ {
+		batch = append(batch, newProfile(fmt.Sprintf("User %03d", i), fmt.Sprintf("user%d@example.com", i), base.Add(time.Duration(i)*time.Second)))
+	}
+	_, err := b.CreateBatch(ctx, batch, false)
+	require.NoError(t, err)
+	_, err = b.Delete(ctx, batch[7].ID, 0)
+	require.NoError(t, err)
+
+	collect := func(opts repository.ListOptions) []string {
+		t.Helper()
+		it, err := b.Iterate(ctx, opts)
+		require.NoError(t, err)
+		defer it.Close()
+		var names []string
+		for it.Next() {
+			names = append(names, it.Profile().Name)
+		}
+		require.NoError(t, it.Err())
+		return names
+	}
+
+	var want []string
+	for i := len(batch) - 1; i >= 0; i-- {
+		if i != 7 {
+			want = append(want, batch[i].Name)
+		}
+	}
+	assert.Equal(t, want, collect(repository.ListOptions{}), "newest first, deleted profiles left out")
+
+	names := collect(repository.ListOptions{SortBy: repository.SortByName, Ascending: true, NamePrefix: "user 01"})
+	assert.Equal(t, []string{"User 010", "User 011", "User 012", "User 013", "User 014", "User 015", "User 016", "User 017", "User 018", "User 019"}, names)
+
+	// Iteration resumes from a listing cursor
+	page, err := b.List(ctx, repository.ListOptions{SortBy: repository.SortByName, Ascending: true, Limit: 3})
+	require.NoError(t, err)
+	names = collect(repository.ListOptions{SortBy: repository.SortByName, Ascending: true, Cursor: page.NextCursor})
+	require.Len(t, names, len(want)-3)
+	assert.Equal(t, "User 003", names[0])
+	assert.Equal(t, "User 124", names[len(names)-1])
+
+	assert.Equal(t, []string{batch[7].Name}, collect(repository.ListOptions{Deleted: true}))
+
+	_, err = b.Iterate(ctx, repository.ListOptions{SortBy: "email"})
+	assert.ErrorIs(t, err, repository.ErrValidation)
+}
+
+func testListFilters(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour)
+	for i, spec := range []struct{ name, email string }{
+		{"Alice", "alice@example.com"},
+		{"Albert", "albert@other.org"},
+		{"Bob_Underscore", "bob@example.com"},
+	} {
+		require.NoError(t, b.Create(ctx, newProfile(spec.name, spec.email, base.Add(time.Duration(i)*time.Minute))))
+	}
+
+	names := func(opts repository.ListOptions) []string {
+		t.Helper()
+		result, err := b.List(ctx, opts)
+		require.NoError(t, err)
+		var names []string
+		for _, profile := range result.Profiles {
+			names = append(names, profile.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"Bob_Underscore", "Alice"}, names(repository.ListOptions{EmailDomain: "EXAMPLE.com"}))
+	assert.Equal(t, []string{"Albert", "Alice"}, names(repository.ListOptions{NamePrefix: "al"}))
+	assert.Equal(t, []string{"Bob_Underscore"}, names(repository.ListOptions{NamePrefix: "bob_"}))
+	assert.Empty(t, names(repository.ListOptions{NamePrefix: "bo%"}))
+	assert.Equal(t, []string{"Bob_Underscore", "Albert"}, names(repository.ListOptions{CreatedAfter: base.Add(30 * time.Second)}))
+	assert.Equal(t, []string{"Alice"}, names(repository.ListOptions{CreatedBefore: base.Add(30 * time.Second)}))
+}
+
+func testAttributes(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	for _, spec := range []struct {
+		name       string
+		attributes map[string]interface{}
+	}{
+		{"Berliner", map[string]interface{}{"location": "Berlin", "age": float64(30), "verified": true}},
+		{"Parisian", map[string]interface{}{"location": "Paris", "age": float64(30), "verified": false}},
+		{"Nobody", nil},
+	} {
+		profile := newProfile(spec.name, strings.ToLower(spec.name)+"@example.com", time.Now())
+		profile.Attributes = spec.attributes
+		require.NoError(t, b.Create(ctx, profile))
+	}
+
+	names := func(attributes map[string]interface{}) []string {
+		t.Helper()
+		result, err := b.List(ctx, repository.ListOptions{Attributes: attributes, SortBy: repository.SortByName, Ascending: true})
+		require.NoError(t, err)
+		var names []string
+		for _, profile := range result.Profiles {
+			names = append(names, profile.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"Berliner"}, names(map[string]interface{}{"location": "Berlin"}))
+	assert.Equal(t, []string{"Berliner", "Parisian"}, names(map[string]interface{}{"age": float64(30)}))
+	assert.Equal(t, []string{"Parisian"}, names(map[string]interface{}{"age": float64(30), "verified": false}))
+	assert.Empty(t, names(map[string]interface{}{"location": "Berlin", "verified": false}))
+
+	// Stored attributes read back as written, and none as an empty map
+	page, err := b.List(ctx, repository.ListOptions{Attributes: map[string]interface{}{"location": "Berlin"}})
+	require.NoError(t, err)
+	require.Len(t, page.Profiles, 1)
+	berliner := page.Profiles[0]
+	assert.Equal(t, map[string]interface{}{"location": "Berlin", "age": float64(30), "verified": true}, berliner.Attributes)
+
+	// Replacing a profile replaces its attributes
+	require.NoError(t, b.Replace(ctx, berliner.ID, &models.Profile{
+		Name:       berliner.Name,
+		Email:      berliner.Email,
+		Attributes: map[string]interface{}{"location": "Munich"},
+	}, 0))
+	got, err := b.Get(ctx, berliner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"location": "Munich"}, got.Attributes)
+	assert.Empty(t, names(map[string]interface{}{"location": "Berlin"}))
+
+	// Definitions are created, replaced and removed by name
+	defs, err := b.ListAttributeDefinitions(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, defs)
+
+	location := &models.AttributeDefinition{Name: "location", Type: models.AttributeString, MaxLength: 10}
+	require.NoError(t, b.PutAttributeDefinition(ctx, location))
+	assert.False(t, location.CreatedAt.IsZero())
+	require.NoError(t, b.PutAttributeDefinition(ctx, &models.AttributeDefinition{Name: "age", Type: models.AttributeInteger, Required: true}))
+	replaced := &models.AttributeDefinition{Name: "location", Type: models.AttributeString, Enum: []string{"Berlin", "Paris"}}
+	require.NoError(t, b.PutAttributeDefinition(ctx, replaced))
+	assert.WithinDuration(t, location.CreatedAt, replaced.CreatedAt, time.Millisecond)
+
+	defs, err = b.ListAttributeDefinitions(ctx)
+	require.NoError(t, err)
+	require.Len(t, defs, 2)
+	assert.Equal(t, "age", defs[0].Name)
+	assert.True(t, defs[0].Required)
+	assert.Equal(t, []string{"Berlin", "Paris"}, defs[1].Enum)
+	assert.Zero(t, defs[1].MaxLength)
+
+	// Definitions belong to a tenant
+	others, err := b.ListAttributeDefinitions(tenant.WithID(ctx, "acme"))
+	require.NoError(t, err)
+	assert.Empty(t, others)
+
+	require.NoError(t, b.DeleteAttributeDefinition(ctx, "age"))
+	assert.ErrorIs(t, b.DeleteAttributeDefinition(ctx, "age"), repository.ErrAttributeNotFound)
+	defs, err = b.ListAttributeDefinitions(ctx)
+	require.NoError(t, err)
+	assert.Len(t, defs, 1)
+}
+
+func testTags(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	profiles := make(map[string]*models.Profile)
+	for _, spec := range []struct {
+		name string
+		tags []string
+	}{
+		{"Ada", []string{"devops", "go", "rust"}},
+		{"Brian", []string{"go", "iot"}},
+		{"Carol", []string{"rust"}},
+		{"Dennis", nil},
+	} {
+		profile := newProfile(spec.name, strings.ToLower(spec.name)+"@example.com", time.Now())
+		profile.Tags = spec.tags
+		require.NoError(t, b.Create(ctx, profile))
+		profiles[spec.name] = profile
+	}
+
+	names := func(opts repository.ListOptions) []string {
+		t.Helper()
+		opts.SortBy, opts.Ascending = repository.SortByName, true
+		result, err := b.List(ctx, opts)
+		require.NoError(t, err)
+		var names []string
+		for _, profile := range result.Profiles {
+			names = append(names, profile.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"Ada", "Brian"}, names(repository.ListOptions{Tags: []string{"go"}}))
+	assert.Equal(t, []string{"Ada"}, names(repository.ListOptions{Tags: []string{"go", "rust"}}))
+	assert.Equal(t, []string{"Ada", "Brian", "Carol"}, names(repository.ListOptions{Tags: []string{"iot", "rust"}, AnyTag: true}))
+	assert.Equal(t, []string{"Ada"}, names(repository.ListOptions{Tags: []string{"GO"}, NamePrefix: "a"}))
+	assert.Empty(t, names(repository.ListOptions{Tags: []string{"go", "missing"}}))
+
+	got, err := b.Get(ctx, profiles["Dennis"].ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Tags)
+
+	// Facets count the tags of the profiles matching the filter
+	facets, err := b.TagFacets(ctx, repository.ListOptions{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []*models.TagCount{
+		{Tag: "go", Count: 2},
+		{Tag: "rust", Count: 2},
+		{Tag: "devops", Count: 1},
+		{Tag: "iot", Count: 1},
+	}, facets)
+
+	facets, err = b.TagFacets(ctx, repository.ListOptions{Tags: []string{"go"}}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []*models.TagCount{{Tag: "go", Count: 2}, {Tag: "devops", Count: 1}}, facets)
+
+	// Tags are replaced with the rest of the profile, and deleted profiles are not counted
+	carol := profiles["Carol"]
+	replacement := &models.Profile{Name: carol.Name, Email: carol.Email, Tags: []string{"go"}}
+	require.NoError(t, b.Replace(ctx, carol.ID, replacement, 0))
+	assert.Equal(t, []string{"go"}, replacement.Tags)
+	_, err = b.Delete(ctx, profiles["Ada"].ID, 0)
+	require.NoError(t, err)
+
+	facets, err = b.TagFacets(ctx, repository.ListOptions{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []*models.TagCount{{Tag: "go", Count: 2}, {Tag: "iot", Count: 1}}, facets)
+
+	facets, err = b.TagFacets(tenant.WithID(ctx, "acme"), repository.ListOptions{}, 0)
+	require.NoError(t, err)
+	assert.Empty(t, facets)
+}
+
+func testFollows(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	star := mustCreate(t, b, "Star", "star@example.com")
+	fans := make([]*models.Profile, 3)
+	for i := range fans {
+		fans[i] = mustCreate(t, b, fmt.Sprintf("Fan %d", i), fmt.Sprintf("fan%d@example.com", i))
+	}
+
+	// Whole seconds survive every backend's timestamp precision
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, fan := range fans {
+		created, err := b.Follow(ctx, &models.Follow{FollowerID: fan.ID, TargetID: star.ID, CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+		require.NoError(t, err)
+		assert.True(t, created)
+	}
+	// Following again changes nothing and reports when the follow was made
+	again := &models.Follow{FollowerID: fans[0].ID, TargetID: star.ID, CreatedAt: time.Now()}
+	created, err := b.Follow(ctx, again)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.True(t, again.CreatedAt.Equal(base), "got %v", again.CreatedAt)
+
+	// The star follows the first fan back
+	_, err = b.Follow(ctx, &models.Follow{FollowerID: star.ID, TargetID: fans[0].ID, CreatedAt: base.Add(time.Hour)})
+	require.NoError(t, err)
+
+	// Followers are listed newest first, page by page
+	var followers []string
+	opts := repository.FollowListOptions{Limit: 2}
+	for {
+		page, err := b.ListFollowers(ctx, star.ID, opts)
+		require.NoError(t, err)
+		for _, follow := range page.Follows {
+			assert.Equal(t, star.ID, follow.TargetID)
+			followers = append(followers, follow.FollowerID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{fans[2].ID, fans[1].ID, fans[0].ID}, followers)
+
+	following, err := b.ListFollowing(ctx, fans[1].ID, repository.FollowListOptions{})
+	require.NoError(t, err)
+	require.Len(t, following.Follows, 1)
+	assert.Equal(t, star.ID, following.Follows[0].TargetID)
+
+	mutual, err := b.ListMutualFollows(ctx, star.ID, repository.FollowListOptions{})
+	require.NoError(t, err)
+	require.Len(t, mutual.Follows, 1)
+	assert.Equal(t, fans[0].ID, mutual.Follows[0].TargetID)
+	mutual, err = b.ListMutualFollows(ctx, fans[0].ID, repository.FollowListOptions{})
+	require.NoError(t, err)
+	require.Len(t, mutual.Follows, 1)
+	assert.Equal(t, star.ID, mutual.Follows[0].TargetID)
+	mutual, err = b.ListMutualFollows(ctx, fans[1].ID, repository.FollowListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, mutual.Follows)
+
+	isFollowing, err := b.IsFollowing(ctx, fans[1].ID, star.ID)
+	require.NoError(t, err)
+	assert.True(t, isFollowing)
+	isFollowing, err = b.IsFollowing(ctx, star.ID, fans[1].ID)
+	require.NoError(t, err)
+	assert.False(t, isFollowing)
+
+	counts, err := b.CountFollows(ctx, star.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.FollowCounts{Followers: 3, Following: 1}, counts)
+
+	// Unfollowing reports whether there was a follow to remove
+	removed, err := b.Unfollow(ctx, fans[2].ID, star.ID)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = b.Unfollow(ctx, fans[2].ID, star.ID)
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	_, err = b.ListFollowers(ctx, star.ID, repository.FollowListOptions{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, repository.ErrInvalidListOptions)
+
+	// The graph belongs to its tenant
+	acme := tenant.WithID(ctx, "acme")
+	counts, err = b.CountFollows(acme, star.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.FollowCounts{}, counts)
+	removedFollows, err := b.RemoveFollows(acme, star.ID)
+	require.NoError(t, err)
+	assert.Empty(t, removedFollows)
+
+	// Removing a profile's follows removes those made by it and on it
+	removedFollows, err = b.RemoveFollows(ctx, star.ID)
+	require.NoError(t, err)
+	assert.Len(t, removedFollows, 3)
+	counts, err = b.CountFollows(ctx, fans[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.FollowCounts{}, counts)
+}
+
+func testSearch(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	gardener := newProfile("Grace Garden", "grace@example.com", time.Now())
+	gardener.Bio = "Loves growing tomatoes and climbing mountains"
+	climber := newProfile("Carl Climber", "carl@example.com", time.Now())
+	climber.Bio = "Tends a small garden between climbing trips"
+	deleted := newProfile("Deleted Climber", "deleted@example.com", time.Now())
+	for _, profile := range []*models.Profile{gardener, climber, deleted} {
+		require.NoError(t, b.Create(ctx, profile))
+	}
+	_, err := b.Delete(ctx, deleted.ID, 0)
+	require.NoError(t, err)
+
+	ids := func(query string) []string {
+		t.Helper()
+		result, err := b.Search(ctx, repository.SearchOptions{Query: query})
+		require.NoError(t, err)
+		var ids []string
+		for _, hit := range result.Hits {
+			ids = append(ids, hit.Profile.ID)
+		}
+		return ids
+	}
+
+	// A name match outranks a bio match, and stemming matches "gardens"
+	assert.Equal(t, []string{gardener.ID, climber.ID}, ids("gardens"))
+	assert.Equal(t, []string{climber.ID}, ids("climber"))
+	assert.Equal(t, []string{gardener.ID}, ids(`"climbing mountains"`))
+	assert.Equal(t, []string{gardener.ID}, ids("climbing -carl"))
+	assert.ElementsMatch(t, []string{gardener.ID, climber.ID}, ids("tomatoes or carl"))
+	assert.Empty(t, ids("astronaut"))
+
+	result, err := b.Search(ctx, repository.SearchOptions{Query: "tomatoes"})
+	require.NoError(t, err)
+	require.Len(t, result.Hits, 1)
+	assert.Contains(t, result.Hits[0].BioSnippet, "<mark>tomatoes</mark>")
+	assert.Greater(t, result.Hits[0].Rank, 0.0)
+
+	// Highlights are HTML with the profile's own text escaped
+	hostile := newProfile(`<script>alert("x")</script> Hacker`, "hacker@example.com", time.Now())
+	hostile.Bio = "Hacker <b>bold</b> & proud"
+	require.NoError(t, b.Create(ctx, hostile))
+	result, err = b.Search(ctx, repository.SearchOptions{Query: "hacker"})
+	require.NoError(t, err)
+	require.Len(t, result.Hits, 1)
+	assert.NotContains(t, result.Hits[0].NameHighlight, "<script>")
+	assert.Contains(t, result.Hits[0].NameHighlight, "&lt;script&gt;")
+	assert.Contains(t, result.Hits[0].NameHighlight, "<mark>Hacker</mark>")
+	assert.Contains(t, result.Hits[0].BioSnippet, "<mark>Hacker</mark> &lt;b&gt;bold&lt;/b&gt; &amp; proud")
+
+	result, err = b.Search(ctx, repository.SearchOptions{Query: "climbing", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, result.Hits, 1)
+	require.NotEmpty(t, result.NextCursor)
+	next, err := b.Search(ctx, repository.SearchOptions{Query: "climbing", Limit: 1, Cursor: result.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, next.Hits, 1)
+	assert.NotEqual(t, result.Hits[0].Profile.ID, next.Hits[0].Profile.ID)
+}
+
+func testWithinTxRollback(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	profile := newProfile("Rolled Back", "rollback@example.com", time.Now())
+
+	err := b.WithinTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, b.Create(ctx, profile))
+		_, err := b.Get(ctx, profile.ID)
+		require.NoError(t, err)
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	_, err = b.Get(ctx, profile.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func testCreateBatch(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	existing := mustCreate(t, b, "Existing", "existing@example.com")
+
+	now := time.Now()
+	batch := []*models.Profile{
+		newProfile("New One", "one@example.com", now),
+		newProfile("Existing Again", "existing@example.com", now),
+		newProfile("New Two", "two@example.com", now),
+		newProfile("One Again", "one@example.com", now),
+	}
+	outcomes, err := b.CreateBatch(ctx, batch, false)
+	require.NoError(t, err)
+	require.Len(t, outcomes, 4)
+
+	statuses := make([]string, len(outcomes))
+	for i, outcome := range outcomes {
+		statuses[i] = outcome.Status
+	}
+	assert.Equal(t, []string{
+		repository.BatchCreated,
+		repository.BatchDuplicate,
+		repository.BatchCreated,
+		repository.BatchDuplicate,
+	}, statuses)
+	assert.Equal(t, batch[0].ID, outcomes[0].Profile.ID)
+	assert.Equal(t, 1, outcomes[0].Profile.Version)
+
+	got, err := b.Get(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Existing", got.Name)
+	_, err = b.Get(ctx, batch[2].ID)
+	assert.NoError(t, err)
+}
+
+func testCreateBatchUpsert(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	existing := mustCreate(t, b, "Existing", "existing@example.com")
+
+	now := time.Now()
+	batch := []*models.Profile{
+		newProfile("Renamed", "existing@example.com", now),
+		newProfile("Fresh", "fresh@example.com", now),
+	}
+	outcomes, err := b.CreateBatch(ctx, batch, true)
+	require.NoError(t, err)
+	require.Len(t, outcomes, 2)
+
+	assert.Equal(t, repository.BatchUpdated, outcomes[0].Status)
+	assert.Equal(t, existing.ID, outcomes[0].Profile.ID)
+	assert.Equal(t, "Renamed", outcomes[0].Profile.Name)
+	assert.Equal(t, 2, outcomes[0].Profile.Version)
+	require.NotNil(t, outcomes[0].Previous)
+	assert.Equal(t, "Existing", outcomes[0].Previous.Name)
+	assert.Equal(t, repository.BatchCreated, outcomes[1].Status)
+
+	got, err := b.Get(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", got.Name)
+}
+
+func testRevisions(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	profile := mustCreate(t, b, "Historic", "historic@example.com")
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for revision := 1; revision <= 3; revision++ {
+		snapshot := *profile
+		snapshot.Version = revision
+		snapshot.Name = fmt.Sprintf("Historic %d", revision)
+		require.NoError(t, b.AddRevision(ctx, &models.Revision{
+			ProfileID: profile.ID,
+			Revision:  revision,
+			Operation: models.RevisionUpdate,
+			Actor:     "tester",
+			Snapshot:  &snapshot,
+			Changes:   []models.FieldChange{{Field: "name", Old: "Historic", New: snapshot.Name}},
+			CreatedAt: base.Add(time.Duration(revision) * time.Minute),
+		}))
+	}
+	require.NoError(t, b.AddRevisions(ctx, []*models.Revision{{
+		ProfileID: profile.ID,
+		Revision:  4,
+		Operation: models.RevisionDelete,
+		Actor:     "tester",
+		Snapshot:  profile,
+		Changes:   []models.FieldChange{},
+		CreatedAt: base.Add(4 * time.Minute),
+	}}))
+
+	revision, err := b.GetRevision(ctx, profile.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Historic 2", revision.Snapshot.Name)
+	assert.Equal(t, "tester", revision.Actor)
+	require.Len(t, revision.Changes, 1)
+	assert.Equal(t, "name", revision.Changes[0].Field)
+
+	_, err = b.GetRevision(ctx, profile.ID, 9)
+	assert.ErrorIs(t, err, repository.ErrRevisionNotFound)
+
+	revision, err = b.GetRevisionAt(ctx, profile.ID, base.Add(150*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2, revision.Revision)
+	_, err = b.GetRevisionAt(ctx, profile.ID, base)
+	assert.ErrorIs(t, err, repository.ErrRevisionNotFound)
+
+	page, err := b.ListRevisions(ctx, profile.ID, repository.HistoryOptions{Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, page.Revisions, 3)
+	assert.Equal(t, 4, page.Revisions[0].Revision)
+	assert.Equal(t, 2, page.NextBefore)
+
+	page, err = b.ListRevisions(ctx, profile.ID, repository.HistoryOptions{Limit: 3, Before: page.NextBefore})
+	require.NoError(t, err)
+	require.Len(t, page.Revisions, 1)
+	assert.Equal(t, 1, page.Revisions[0].Revision)
+	assert.Zero(t, page.NextBefore)
+
+	// Purging a profile removes its history
+	_, err = b.Delete(ctx, profile.ID, 0)
+	require.NoError(t, err)
+	_, err = b.PurgeDeleted(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	page, err = b.ListRevisions(ctx, profile.ID, repository.HistoryOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Revisions)
+}
+
+func testTenantIsolation(t *testing.T, b repository.Backend) {
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+
+	profile := newProfile("Wile Coyote", "wile@example.com", time.Now())
+	require.NoError(t, b.Create(acme, profile))
+	assert.Equal(t, "acme", profile.TenantID)
+	require.NoError(t, b.AddRevision(acme, &models.Revision{
+		ProfileID: profile.ID,
+		Revision:  1,
+		Operation: models.RevisionCreate,
+		Actor:     "tester",
+		Snapshot:  profile,
+		Changes:   []models.FieldChange{},
+		CreatedAt: time.Now(),
+	}))
+
+	// Emails are unique per tenant only
+	other := newProfile("Other Coyote", "wile@example.com", time.Now())
+	require.NoError(t, b.Create(globex, other))
+
+	// Nothing of one tenant is visible to, or writable by, another
+	_, err := b.Get(globex, profile.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	err = b.Replace(globex, profile.ID, &models.Profile{Name: "Taken", Email: "taken@example.com"}, 0)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = b.Delete(globex, profile.ID, 0)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = b.GetRevision(globex, profile.ID, 1)
+	assert.ErrorIs(t, err, repository.ErrRevisionNotFound)
+	history, err := b.ListRevisions(globex, profile.ID, repository.HistoryOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, history.Revisions)
+
+	page, err := b.List(globex, repository.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Profiles, 1)
+	assert.Equal(t, other.ID, page.Profiles[0].ID)
+
+	result, err := b.Search(globex, repository.SearchOptions{Query: "coyote"})
+	require.NoError(t, err)
+	require.Len(t, result.Hits, 1)
+	assert.Equal(t, other.ID, result.Hits[0].Profile.ID)
+
+	got, err := b.Get(acme, profile.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Wile Coyote", got.Name)
+	_, err = b.Get(context.Background(), profile.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func testOutbox(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	message := &models.OutboxMessage{
+		ID:          uuid.New().String(),
+		AggregateID: uuid.New().String(),
+		Channel:     "events",
+		Payload:     []byte(`{"type":"profile_created"}`),
+		CreatedAt:   time.Now().Add(-time.Second),
+	}
+	require.NoError(t, b.Enqueue(ctx, message))
+
+	stats, err := b.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Pending)
+	assert.Greater(t, stats.OldestPendingAge, time.Duration(0))
+
+	claimed, err := b.ClaimPending(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, message.ID, claimed[0].ID)
+	assert.Equal(t, 1, claimed[0].Attempts)
+	assert.JSONEq(t, string(message.Payload), string(claimed[0].Payload))
+
+	// A leased message is not claimed again until it is released
+	claimed, err = b.ClaimPending(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	require.NoError(t, b.MarkFailed(ctx, message, errors.New("queue down"), time.Now().Add(-time.Second)))
+	claimed, err = b.ClaimPending(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, 2, claimed[0].Attempts)
+
+	require.NoError(t, b.MarkSent(ctx, claimed[0]))
+	stats, err = b.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Pending)
+
+	deleted, err := b.DeleteSent(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	// Messages of an aggregate are listed and deleted whether or not they were delivered
+	aggregateID := uuid.New().String()
+	var enqueued []string
+	for i, eventType := range []string{"profile_created", "profile_updated"} {
+		message := &models.OutboxMessage{
+			ID:          uuid.New().String(),
+			AggregateID: aggregateID,
+			Channel:     "events",
+			Payload:     []byte(`{"type":"` + eventType + `"}`),
+			CreatedAt:   time.Now().Add(time.Duration(i-2) * time.Second),
+		}
+		require.NoError(t, b.Enqueue(ctx, message))
+		enqueued = append(enqueued, message.ID)
+	}
+	claimed, err = b.ClaimPending(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, b.MarkSent(ctx, claimed[0]))
+
+	listed, err := b.ListForAggregate(ctx, aggregateID)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+	assert.Equal(t, enqueued[0], listed[0].ID)
+	assert.Equal(t, enqueued[1], listed[1].ID)
+
+	deleted, err = b.DeleteForAggregate(ctx, aggregateID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	listed, err = b.ListForAggregate(ctx, aggregateID)
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+}
+
+func testIdempotencyKeys(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	record := &models.IdempotencyRecord{
+		Key:         "order-1",
+		Fingerprint: "abc",
+		Token:       "token-1",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+
+	existing, err := b.ReserveIdempotencyKey(ctx, record)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// A second reservation sees the request in flight
+	existing, err = b.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{Key: "order-1", Fingerprint: "def", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, "abc", existing.Fingerprint)
+	assert.False(t, existing.Completed())
+
+	// Keys are scoped to the tenant
+	existing, err = b.ReserveIdempotencyKey(tenant.WithID(ctx, "acme"), record)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// Only the holder of the reservation can complete or release it
+	stale := &models.IdempotencyRecord{Key: "order-1", Fingerprint: "abc", Token: "token-0", StatusCode: 500, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, b.CompleteIdempotencyKey(ctx, stale))
+	require.NoError(t, b.ReleaseIdempotencyKey(ctx, stale))
+	existing, err = b.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{Key: "order-1", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, "token-1", existing.Token)
+	assert.False(t, existing.Completed())
+
+	record.StatusCode = 201
+	record.ContentType = "application/json"
+	record.Body = []byte(`{"id":"1"}`)
+	require.NoError(t, b.CompleteIdempotencyKey(ctx, record))
+
+	existing, err = b.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{Key: "order-1", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.True(t, existing.Completed())
+	assert.Equal(t, 201, existing.StatusCode)
+	assert.Equal(t, "application/json", existing.ContentType)
+	assert.Equal(t, record.Body, existing.Body)
+	assert.True(t, existing.ExpiresAt.Equal(record.ExpiresAt), "got %v", existing.ExpiresAt)
+
+	// Releasing leaves completed keys alone, but frees keys in flight
+	require.NoError(t, b.ReleaseIdempotencyKey(ctx, record))
+	existing, err = b.ReserveIdempotencyKey(ctx, record)
+	require.NoError(t, err)
+	assert.NotNil(t, existing)
+
+	require.NoError(t, b.ReleaseIdempotencyKey(tenant.WithID(ctx, "acme"), record))
+	existing, err = b.ReserveIdempotencyKey(tenant.WithID(ctx, "acme"), record)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// An expired key is free again
+	expired := &models.IdempotencyRecord{Key: "order-2", Fingerprint: "abc", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	_, err = b.ReserveIdempotencyKey(ctx, expired)
+	require.NoError(t, err)
+	existing, err = b.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{Key: "order-2", Fingerprint: "def", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	_, err = b.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{Key: "order-3", Fingerprint: "abc", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	deleted, err := b.DeleteExpiredIdempotencyKeys(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	// Redacting empties the bodies of the tenant's responses containing the
+	// text, leaving their status
+	redacted, err := b.RedactIdempotencyResponses(tenant.WithID(ctx, "acme"), `"1"`)
+	require.NoError(t, err)
+	assert.Zero(t, redacted)
+	redacted, err = b.RedactIdempotencyResponses(ctx, `"2"`)
+	require.NoError(t, err)
+	assert.Zero(t, redacted)
+	redacted, err = b.RedactIdempotencyResponses(ctx, `"1"`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), redacted)
+	existing, err = b.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{Key: "order-1", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, 201, existing.StatusCode)
+	assert.Empty(t, existing.ContentType)
+	assert.Empty(t, existing.Body)
+}
+
+func testErasures(t *testing.T, b repository.Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	receipt := &models.ErasureReceipt{
+		ID:          uuid.New().String(),
+		ProfileID:   uuid.New().String(),
+		Status:      models.ErasurePending,
+		RequestedAt: now.Add(-time.Minute),
+	}
+
+	_, err := b.GetErasure(ctx, receipt.ProfileID)
+	assert.ErrorIs(t, err, repository.ErrErasureNotFound)
+
+	existing, err := b.RecordErasure(ctx, receipt)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// A second request finds the first one
+	existing, err = b.RecordErasure(ctx, &models.ErasureReceipt{ID: uuid.New().String(), ProfileID: receipt.ProfileID, Status: models.ErasurePending, RequestedAt: now})
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, receipt.ID, existing.ID)
+	assert.Equal(t, tenant.DefaultID, existing.TenantID)
+	assert.True(t, existing.RequestedAt.Equal(receipt.RequestedAt), "got %v", existing.RequestedAt)
+
+	// Receipts are scoped to the tenant
+	_, err = b.GetErasure(tenant.WithID(ctx, "acme"), receipt.ProfileID)
+	assert.ErrorIs(t, err, repository.ErrErasureNotFound)
+
+	pending, err := b.ListPendingErasures(ctx, now.Add(-time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	pending, err = b.ListPendingErasures(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, receipt.ProfileID, pending[0].ProfileID)
+
+	receipt.CompletedAt = &now
+	receipt.ImagesDeleted = 2
+	receipt.FollowsDeleted = 3
+	receipt.EventsDeleted = 4
+	require.NoError(t, b.CompleteErasure(ctx, receipt))
+
+	stored, err := b.GetErasure(ctx, receipt.ProfileID)
+	require.NoError(t, err)
+	assert.True(t, stored.Completed())
+	require.NotNil(t, stored.CompletedAt)
+	assert.True(t, stored.CompletedAt.Equal(now), "got %v", stored.CompletedAt)
+	assert.Equal(t, 2, stored.ImagesDeleted)
+	assert.Equal(t, 3, stored.FollowsDeleted)
+	assert.Equal(t, 4, stored.EventsDeleted)
+
+	pending, err = b.ListPendingErasures(ctx, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
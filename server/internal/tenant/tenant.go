@@ -0,0 +1,98 @@
+// Package tenant identifies the tenant, a team sharing the deployment, that a
+// request is made for. Every profile belongs to one tenant and is only visible
+// to requests made for it: stores, caches and events are all scoped by the
+// tenant carried in the request context.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// DefaultID is the tenant of requests that do not name one, which is every
+// request of a single-tenant deployment
+const DefaultID = "default"
+
+// idPattern restricts tenant IDs to characters that are safe in cache keys and
+// channel names, which separate the tenant from the rest with ':'
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Errors returned when resolving the tenant of a request
+var (
+	ErrInvalidID       = errors.New("tenant ID must be 1-64 lowercase letters, digits, '-' or '_'")
+	ErrUnauthenticated = errors.New("a valid API key is required")
+	ErrForbidden       = errors.New("API key does not grant access to the requested tenant")
+)
+
+// ValidID reports whether id is a well-formed tenant ID
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// contextKey is the context key for the tenant of a request
+type contextKey struct{}
+
+// WithID returns a context for work done on behalf of a tenant
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ctx was created for. Contexts that name no
+// tenant, such as those of single-tenant deployments, belong to DefaultID.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultID
+}
+
+// Resolver determines the tenant of a request from its credentials
+type Resolver struct {
+	// keys maps API keys to the tenant each one authenticates
+	keys map[string]string
+	// trustHeader lets requests name any tenant in a header when there are no
+	// keys
+	trustHeader bool
+}
+
+// NewResolver creates a resolver for the given API keys. With keys, every
+// request must present one. With no keys, requests are served for DefaultID,
+// unless trustHeader is set: then they name their tenant in a header, which
+// suits deployments behind a gateway that sets it.
+func NewResolver(keys map[string]string, trustHeader bool) (*Resolver, error) {
+	for _, id := range keys {
+		if !ValidID(id) {
+			return nil, ErrInvalidID
+		}
+	}
+	return &Resolver{keys: keys, trustHeader: trustHeader}, nil
+}
+
+// Resolve returns the tenant of a request that presented apiKey and named
+// header as its tenant; either may be empty. A request with an API key may
+// only name the tenant of that key.
+func (r *Resolver) Resolve(apiKey, header string) (string, error) {
+	if len(r.keys) == 0 {
+		if header == "" {
+			return DefaultID, nil
+		}
+		if !ValidID(header) {
+			return "", ErrInvalidID
+		}
+		// Other tenants take a key, unless whatever sets the header is trusted
+		if !r.trustHeader && header != DefaultID {
+			return "", ErrUnauthenticated
+		}
+		return header, nil
+	}
+
+	id, ok := r.keys[apiKey]
+	if apiKey == "" || !ok {
+		return "", ErrUnauthenticated
+	}
+	if header != "" && header != id {
+		return "", ErrForbidden
+	}
+	return id, nil
+}
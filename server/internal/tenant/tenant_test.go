@@ -0,0 +1,73 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	keys := map[string]string{"acme-key": "acme", "globex-key": "globex"}
+
+	tests := []struct {
+		name        string
+		keys        map[string]string
+		trustHeader bool
+		apiKey      string
+		header      string
+		want        string
+		wantErr     error
+	}{
+		// Without keys, requests are for the default tenant...
+		{name: "no keys, no header", want: DefaultID},
+		{name: "no keys, default header", header: DefaultID, want: DefaultID},
+		{name: "no keys, invalid header", header: "Acme!", wantErr: ErrInvalidID},
+		{name: "no keys, other tenant", header: "acme", wantErr: ErrUnauthenticated},
+		{name: "no keys, unknown key", apiKey: "acme-key", header: "acme", wantErr: ErrUnauthenticated},
+		// ...unless the header is trusted to name theirs
+		{name: "trusted, no header", trustHeader: true, want: DefaultID},
+		{name: "trusted, invalid header", trustHeader: true, header: "Acme!", wantErr: ErrInvalidID},
+		{name: "trusted, other tenant", trustHeader: true, header: "acme", want: "acme"},
+
+		// With keys, the key names the tenant, whether or not the header is trusted
+		{name: "keys, no key", keys: keys, wantErr: ErrUnauthenticated},
+		{name: "keys, no key, header", keys: keys, header: "acme", wantErr: ErrUnauthenticated},
+		{name: "keys, no key, trusted header", keys: keys, trustHeader: true, header: "acme", wantErr: ErrUnauthenticated},
+		{name: "keys, unknown key", keys: keys, apiKey: "initech-key", wantErr: ErrUnauthenticated},
+		{name: "keys, key", keys: keys, apiKey: "acme-key", want: "acme"},
+		{name: "keys, key, matching header", keys: keys, apiKey: "acme-key", header: "acme", want: "acme"},
+		{name: "keys, key, mismatched header", keys: keys, apiKey: "acme-key", header: "globex", wantErr: ErrForbidden},
+		{name: "keys, key, invalid header", keys: keys, apiKey: "acme-key", header: "Acme!", wantErr: ErrForbidden},
+		{name: "keys, key, default header", keys: keys, apiKey: "acme-key", header: DefaultID, wantErr: ErrForbidden},
+		{name: "keys, key, trusted mismatched header", keys: keys, trustHeader: true, apiKey: "acme-key", header: "globex", wantErr: ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewResolver(tt.keys, tt.trustHeader)
+			require.NoError(t, err)
+
+			id, err := resolver.Resolve(tt.apiKey, tt.header)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, id)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, id)
+		})
+	}
+}
+
+func TestNewResolverRejectsInvalidTenants(t *testing.T) {
+	_, err := NewResolver(map[string]string{"key": "Acme"}, false)
+	assert.ErrorIs(t, err, ErrInvalidID)
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, DefaultID, FromContext(context.Background()))
+	assert.Equal(t, DefaultID, FromContext(WithID(context.Background(), "")))
+	assert.Equal(t, "acme", FromContext(WithID(context.Background(), "acme")))
+}
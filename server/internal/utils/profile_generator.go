@@ -83,6 +83,7 @@ func GenerateRandomProfile() *models.Profile {
 		Email:     email,
 		Bio:       bio,
 		ImageURLs: []string{},
+		Tags:      []string{interest1, interest2},
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -104,7 +104,7 @@ make_request "POST" "/api/v1/profiles/random" "" "Creating random profile"
 # Test 3: Database operation metrics test
 print_header "Database Operation Metrics Test"
 # Get the ID of the last created profile
-PROFILE_ID=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.[0].id')
+PROFILE_ID=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.profiles[0].id')
 
 # Get profile (should trigger database operation)
 make_request "GET" "/api/v1/profiles/$PROFILE_ID" "" "Getting profile (testing database metrics)"
@@ -92,7 +92,7 @@ print_header "Creating and Caching New Profile"
 make_request "POST" "/api/v1/profiles/random" "" "Creating random profile"
 
 # Get the ID of the newly created profile
-PROFILE_ID=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.[0].id')
+PROFILE_ID=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.profiles[0].id')
 if [ -z "$PROFILE_ID" ]; then
     echo -e "${RED}Failed to get profile ID${NC}"
     exit 1
@@ -133,7 +133,7 @@ for i in {1..5}; do
 done
 
 # Get all profile IDs
-PROFILE_IDS=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.[].id')
+PROFILE_IDS=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.profiles[].id')
 
 # Request profiles in sequence to test cache behavior
 echo -e "${BLUE}Testing cache behavior with multiple profiles${NC}"
@@ -63,12 +63,12 @@ make_request() {
     sleep 2
 }
 
-# Create 15 random profiles
+# Create 15 random profiles in a single batch request
 print_header "Creating 15 random profiles"
+profiles=""
 for i in $(seq 1 15); do
-    make_request "POST" "/api/v1/profiles" \
-        "{\"name\":\"User$i\",\"email\":\"user$i@example.com\",\"bio\":\"Bio for user $i\",\"skills\":[\"skill1\",\"skill2\"]}" \
-        "Creating profile $i"
+    profiles="$profiles{\"name\":\"User$i\",\"email\":\"user$i@example.com\",\"bio\":\"Bio for user $i\"},"
 done
+make_request "POST" "/api/v1/profiles/batch" "[${profiles%,}]" "Creating 15 profiles"
 
 echo -e "\n${GREEN}Test completed!${NC}" 
\ No newline at end of file
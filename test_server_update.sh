@@ -64,7 +64,7 @@ make_request() {
 }
 
 # Get list of profile IDs
-PROFILE_IDS=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.[].id' | head -n 3)
+PROFILE_IDS=$(curl -s "$SERVER_URL/api/v1/profiles" | jq -r '.profiles[].id' | head -n 3)
 
 # Test 1: Get initial profiles
 print_header "Getting initial profiles"